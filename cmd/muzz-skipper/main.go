@@ -0,0 +1,96 @@
+/*
+This command provides an executable version of skipper with the default
+set of filters and the Muzz filters compiled in.
+
+The Muzz filters are registered as custom filters, so no Go plugins need
+to be loaded:
+
+	teapot()
+	teapotDryRun()
+	attestation()
+
+They are configured in the plugin-config section of the config file:
+
+	plugin-config:
+	  teapot:
+	    s3-bucket: my-bucket
+	    s3-services-key: services.json
+	    s3-teapots-key: teapots.json
+	  attestation:
+	    environment: production
+	    dynamo-table-name: my-table
+
+When the zone-aware load balancing is enabled without the -zone option, the
+zone is detected from the ECS or the EC2 metadata endpoint.
+
+For the list of command line options, run:
+
+	muzz-skipper -help
+*/
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando/skipper"
+	"github.com/zalando/skipper/config"
+	"github.com/zalando/skipper/plugins/filters/attestation"
+	"github.com/zalando/skipper/plugins/filters/teapot"
+	"github.com/zalando/skipper/plugins/lib/awsx"
+)
+
+var (
+	version string
+	commit  string
+)
+
+func main() {
+	cfg := config.NewConfig()
+	if err := cfg.Parse(); err != nil {
+		log.Fatalf("Error processing config: %s", err)
+	}
+
+	if cfg.PrintVersion {
+		fmt.Printf(
+			"Muzz Skipper version %s (commit: %s, runtime: %s)\n",
+			version, commit, runtime.Version(),
+		)
+
+		return
+	}
+
+	log.SetLevel(cfg.ApplicationLogLevel)
+
+	var teapotConfig teapot.Config
+	if err := cfg.PluginConfig[teapot.Name].Decode(&teapotConfig); err != nil {
+		log.Fatalf("Error processing teapot config: %s", err)
+	}
+
+	var attestationConfig attestation.Config
+	if err := cfg.PluginConfig[attestation.Name].Decode(&attestationConfig); err != nil {
+		log.Fatalf("Error processing attestation config: %s", err)
+	}
+
+	teapotLoader, err := teapot.NewLoader(teapotConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := cfg.ToOptions()
+	if opts.EnableZoneAwareLoadBalancing && opts.ZoneAwareOptions.Zone == "" {
+		opts.ZoneAwareOptions.Zone = awsx.DetectZone()
+		log.Infof("Detected zone for the zone-aware load balancing: %q", opts.ZoneAwareOptions.Zone)
+	}
+
+	opts.CustomFilters = append(opts.CustomFilters,
+		teapot.NewTeapot(teapotLoader),
+		teapot.NewTeapotDryRun(teapotLoader),
+		attestation.NewAttestation(attestationConfig),
+	)
+
+	if err := skipper.Run(opts); err != nil {
+		log.Fatal(err)
+	}
+}
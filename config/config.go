@@ -19,9 +19,12 @@ import (
 	"github.com/zalando/skipper"
 	"github.com/zalando/skipper/dataclients/kubernetes"
 	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/openpolicyagent"
+	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/net"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxyprotocol"
 	"github.com/zalando/skipper/swarm"
 )
 
@@ -36,6 +39,10 @@ type Config struct {
 	ExpectedBytesPerRequest         int            `yaml:"expected-bytes-per-request"`
 	MaxTCPListenerConcurrency       int            `yaml:"max-tcp-listener-concurrency"`
 	MaxTCPListenerQueue             int            `yaml:"max-tcp-listener-queue"`
+	EnableProxyProtocol             bool           `yaml:"proxy-protocol"`
+	ProxyProtocolTrustedCIDRs       *listFlag      `yaml:"proxy-protocol-trusted-cidrs"`
+	ProxyProtocolHeaderTimeout      time.Duration  `yaml:"proxy-protocol-header-timeout"`
+	EnableH2C                       bool           `yaml:"h2c"`
 	IgnoreTrailingSlash             bool           `yaml:"ignore-trailing-slash"`
 	Insecure                        bool           `yaml:"insecure"`
 	ProxyPreserveHost               bool           `yaml:"proxy-preserve-host"`
@@ -47,6 +54,8 @@ type Config struct {
 	StatusChecks                    *listFlag      `yaml:"status-checks"`
 	PrintVersion                    bool           `yaml:"version"`
 	MaxLoopbacks                    int            `yaml:"max-loopbacks"`
+	MaxRequestBody                  int64          `yaml:"max-request-body"`
+	RequestBodyBufferMemory         int64          `yaml:"request-body-buffer-memory"`
 	DefaultHTTPStatus               int            `yaml:"default-http-status"`
 	PluginDir                       string         `yaml:"plugindir"`
 	LoadBalancerHealthCheckInterval time.Duration  `yaml:"lb-healthcheck-interval"`
@@ -68,6 +77,36 @@ type Config struct {
 	MultiPlugins                    *pluginFlag    `yaml:"multi-plugin"`
 	CompressEncodings               *listFlag      `yaml:"compress-encodings"`
 
+	// passive outlier detection:
+	EnableOutlierDetection                   bool          `yaml:"enable-outlier-detection"`
+	OutlierDetectionConsecutiveErrors        int           `yaml:"outlier-detection-consecutive-errors"`
+	OutlierDetectionInterval                 time.Duration `yaml:"outlier-detection-interval"`
+	OutlierDetectionBaseEjectionTime         time.Duration `yaml:"outlier-detection-base-ejection-time"`
+	OutlierDetectionMaxEjectionTime          time.Duration `yaml:"outlier-detection-max-ejection-time"`
+	OutlierDetectionMaxEjectionPercent       int           `yaml:"outlier-detection-max-ejection-percent"`
+	OutlierDetectionSuccessRateStdevFactor   float64       `yaml:"outlier-detection-success-rate-stdev-factor"`
+	OutlierDetectionSuccessRateMinimumHosts  int           `yaml:"outlier-detection-success-rate-minimum-hosts"`
+	OutlierDetectionSuccessRateRequestVolume int           `yaml:"outlier-detection-success-rate-request-volume"`
+
+	// zone-aware load balancing:
+	EnableZoneAwareLoadBalancing bool    `yaml:"enable-zone-aware-lb"`
+	Zone                         string  `yaml:"zone"`
+	ZoneAwareMinHealthyPercent   int     `yaml:"zone-aware-min-healthy-percent"`
+	ZoneAwareMaxLoadFactor       float64 `yaml:"zone-aware-max-load-factor"`
+
+	// sticky sessions:
+	StickySessionSecretsFile string `yaml:"sticky-session-secrets-file"`
+
+	// response cache:
+	CacheStore          string `yaml:"cache-store"`
+	CacheMemoryMaxBytes int64  `yaml:"cache-memory-max-bytes"`
+
+	IdempotencyStore          string `yaml:"idempotency-store"`
+	IdempotencyMemoryMaxBytes int64  `yaml:"idempotency-memory-max-bytes"`
+
+	// PluginConfig can only be set in the config file.
+	PluginConfig map[string]filters.PluginConfig `yaml:"plugin-config"`
+
 	// logging, metrics, profiling, tracing:
 	EnablePrometheusMetrics             bool      `yaml:"enable-prometheus-metrics"`
 	OpenTracing                         string    `yaml:"opentracing"`
@@ -173,6 +212,7 @@ type Config struct {
 	KubernetesBackendTrafficAlgorithmString string                             `yaml:"kubernetes-backend-traffic-algorithm"`
 	KubernetesBackendTrafficAlgorithm       kubernetes.BackendTrafficAlgorithm `yaml:"-"`
 	KubernetesDefaultLoadBalancerAlgorithm  string                             `yaml:"kubernetes-default-lb-algorithm"`
+	KubernetesEnableEndpointSlices          bool                               `yaml:"kubernetes-enable-endpointslices"`
 
 	// Default filters
 	DefaultFiltersDir string `yaml:"default-filters-dir"`
@@ -215,6 +255,13 @@ type Config struct {
 	// TLS version
 	TLSMinVersion string `yaml:"tls-min-version"`
 
+	// TLS client authentication
+	ClientCAPathTLS string `yaml:"tls-client-ca"`
+	ClientAuthTLS   string `yaml:"tls-client-auth"`
+
+	// TLS client fingerprints
+	EnableTLSFingerprint bool `yaml:"tls-fingerprint"`
+
 	// TLS Config
 	KubernetesEnableTLS bool `yaml:"kubernetes-enable-tls"`
 
@@ -299,6 +346,7 @@ func NewConfig() *Config {
 	cfg.MultiPlugins = newPluginFlag()
 	cfg.CredentialPaths = commaListFlag()
 	cfg.SwarmRedisURLs = commaListFlag()
+	cfg.ProxyProtocolTrustedCIDRs = commaListFlag()
 	cfg.AppendFilters = &defaultFiltersFlags{}
 	cfg.PrependFilters = &defaultFiltersFlags{}
 	cfg.DisabledFilters = commaListFlag()
@@ -323,6 +371,10 @@ func NewConfig() *Config {
 	flag.IntVar(&cfg.ExpectedBytesPerRequest, "expected-bytes-per-request", 50*1024, "bytes per request, that is used to calculate concurrency limits to buffer connection spikes")
 	flag.IntVar(&cfg.MaxTCPListenerConcurrency, "max-tcp-listener-concurrency", 0, "sets hardcoded max for TCP listener concurrency, normally calculated based on available memory cgroups with max TODO")
 	flag.IntVar(&cfg.MaxTCPListenerQueue, "max-tcp-listener-queue", 0, "sets hardcoded max queue size for TCP listener, normally calculated 10x concurrency with max TODO:50k")
+	flag.BoolVar(&cfg.EnableProxyProtocol, "proxy-protocol", false, "enables the PROXY protocol v1 and v2 on the listeners, the client address received in the header is used as the remote address of the requests")
+	flag.Var(cfg.ProxyProtocolTrustedCIDRs, "proxy-protocol-trusted-cidrs", "comma separated list of CIDRs of the load balancers allowed to send the PROXY protocol header, required when the PROXY protocol is enabled")
+	flag.DurationVar(&cfg.ProxyProtocolHeaderTimeout, "proxy-protocol-header-timeout", proxyprotocol.DefaultHeaderTimeout, "time limit for receiving the PROXY protocol header")
+	flag.BoolVar(&cfg.EnableH2C, "h2c", false, "enables accepting HTTP/2 without TLS (h2c) on the listeners, with prior knowledge or by upgrading HTTP/1.1 connections")
 	flag.BoolVar(&cfg.IgnoreTrailingSlash, "ignore-trailing-slash", false, "flag indicating to ignore trailing slashes in paths when routing")
 	flag.BoolVar(&cfg.Insecure, "insecure", false, "flag indicating to ignore the verification of the TLS certificates of the backend services")
 	flag.BoolVar(&cfg.ProxyPreserveHost, "proxy-preserve-host", false, "flag indicating to preserve the incoming request 'Host' header in the outgoing requests")
@@ -334,9 +386,29 @@ func NewConfig() *Config {
 	flag.Var(cfg.StatusChecks, "status-checks", "experimental URLs to check before reporting healthy on startup")
 	flag.BoolVar(&cfg.PrintVersion, "version", false, "print Skipper version")
 	flag.IntVar(&cfg.MaxLoopbacks, "max-loopbacks", proxy.DefaultMaxLoopbacks, "maximum number of loopbacks for an incoming request, set to -1 to disable loopbacks")
+	flag.Int64Var(&cfg.MaxRequestBody, "max-request-body", 0, "maximum size of the request bodies in bytes for the routes without the maxRequestBody filter, larger requests are rejected with 413, 0 means no limit")
+	flag.Int64Var(&cfg.RequestBodyBufferMemory, "request-body-buffer-memory", proxy.DefaultRequestBodyBufferMemoryBytes, "size in bytes, above which the request bodies buffered for the filters are stored in temporary files")
 	flag.IntVar(&cfg.DefaultHTTPStatus, "default-http-status", http.StatusNotFound, "default HTTP status used when no route is found for a request")
 	flag.StringVar(&cfg.PluginDir, "plugindir", "", "set the directory to load plugins from, default is ./")
 	flag.DurationVar(&cfg.LoadBalancerHealthCheckInterval, "lb-healthcheck-interval", 0, "use to set the health checker interval to check healthiness of former dead or unhealthy routes")
+	flag.BoolVar(&cfg.EnableOutlierDetection, "enable-outlier-detection", false, "enables the passive outlier detection, which ejects load balanced endpoints responding with errors")
+	flag.IntVar(&cfg.OutlierDetectionConsecutiveErrors, "outlier-detection-consecutive-errors", 0, "number of consecutive 5xx responses or gateway errors after which an endpoint is ejected, defaults to 5")
+	flag.DurationVar(&cfg.OutlierDetectionInterval, "outlier-detection-interval", 0, "interval of the success rate evaluation of the outlier detection, defaults to 10s")
+	flag.DurationVar(&cfg.OutlierDetectionBaseEjectionTime, "outlier-detection-base-ejection-time", 0, "duration of the first ejection of an endpoint, repeated ejections last multiples of it, defaults to 30s")
+	flag.DurationVar(&cfg.OutlierDetectionMaxEjectionTime, "outlier-detection-max-ejection-time", 0, "maximum duration of the ejection of an endpoint, defaults to 5m")
+	flag.IntVar(&cfg.OutlierDetectionMaxEjectionPercent, "outlier-detection-max-ejection-percent", 0, "maximum percentage of the endpoints of a route that can be ejected at the same time, defaults to 10")
+	flag.Float64Var(&cfg.OutlierDetectionSuccessRateStdevFactor, "outlier-detection-success-rate-stdev-factor", 0, "endpoints with a success rate lower than the mean by this factor of the standard deviation are ejected, defaults to 1.9")
+	flag.IntVar(&cfg.OutlierDetectionSuccessRateMinimumHosts, "outlier-detection-success-rate-minimum-hosts", 0, "minimum number of endpoints of a route with enough requests for the success rate evaluation, defaults to 5")
+	flag.IntVar(&cfg.OutlierDetectionSuccessRateRequestVolume, "outlier-detection-success-rate-request-volume", 0, "minimum number of requests to an endpoint in an interval for the success rate evaluation, defaults to 100")
+	flag.BoolVar(&cfg.EnableZoneAwareLoadBalancing, "enable-zone-aware-lb", false, "enables the zone-aware load balancing, which prefers the endpoints in the same zone as Skipper")
+	flag.StringVar(&cfg.Zone, "zone", "", "sets the availability zone of Skipper, used by the zone-aware load balancing")
+	flag.IntVar(&cfg.ZoneAwareMinHealthyPercent, "zone-aware-min-healthy-percent", 0, "minimum percentage of healthy endpoints in the local zone, below which the requests spill over to the other zones, defaults to 70")
+	flag.Float64Var(&cfg.ZoneAwareMaxLoadFactor, "zone-aware-max-load-factor", 0, "maximum ratio of the average outstanding requests of the local zone endpoints to the average of all endpoints, above which the requests spill over to the other zones, defaults to 2")
+	flag.StringVar(&cfg.StickySessionSecretsFile, "sticky-session-secrets-file", "", "file storing the encryption key of the sticky session cookies. Enables the stickySession filter")
+	flag.StringVar(&cfg.CacheStore, "cache-store", "", "enables the cache filter, and sets where the cached responses are stored: memory, or redis using the Redis ring of the swarm")
+	flag.Int64Var(&cfg.CacheMemoryMaxBytes, "cache-memory-max-bytes", 0, "maximum size of the cached responses in the memory store, defaults to 64MiB")
+	flag.StringVar(&cfg.IdempotencyStore, "idempotency-store", "", "enables the idempotencyKey filter, and sets where the responses are stored: memory, or redis using the Redis ring of the swarm")
+	flag.Int64Var(&cfg.IdempotencyMemoryMaxBytes, "idempotency-memory-max-bytes", 0, "maximum size of the stored responses in the idempotency memory store, defaults to 64MiB")
 	flag.BoolVar(&cfg.ReverseSourcePredicate, "reverse-source-predicate", false, "reverse the order of finding the client IP from X-Forwarded-For header")
 	flag.BoolVar(&cfg.RemoveHopHeaders, "remove-hop-headers", false, "enables removal of Hop-Headers according to RFC-2616")
 	flag.BoolVar(&cfg.RfcPatchPath, "rfc-patch-path", false, "patches the incoming request path to preserve uncoded reserved characters according to RFC 2616 and RFC 3986")
@@ -456,7 +528,8 @@ func NewConfig() *Config {
 	flag.StringVar(&cfg.KubernetesRedisServiceName, "kubernetes-redis-service-name", "", "Sets name for redis to be used to lookup endpoints")
 	flag.IntVar(&cfg.KubernetesRedisServicePort, "kubernetes-redis-service-port", 6379, "Sets the port for redis to be used to lookup endpoints")
 	flag.StringVar(&cfg.KubernetesBackendTrafficAlgorithmString, "kubernetes-backend-traffic-algorithm", kubernetes.TrafficPredicateAlgorithm.String(), "sets the algorithm to be used for traffic splitting between backends: traffic-predicate or traffic-segment-predicate")
-	flag.StringVar(&cfg.KubernetesDefaultLoadBalancerAlgorithm, "kubernetes-default-lb-algorithm", kubernetes.DefaultLoadBalancerAlgorithm, "sets the default algorithm to be used for load balancing between backend endpoints, available options: roundRobin, consistentHash, random, powerOfRandomNChoices")
+	flag.BoolVar(&cfg.KubernetesEnableEndpointSlices, "kubernetes-enable-endpointslices", false, "load the backend endpoints from the Kubernetes EndpointSlices instead of the Endpoints, which also provides the zone of the endpoints")
+	flag.StringVar(&cfg.KubernetesDefaultLoadBalancerAlgorithm, "kubernetes-default-lb-algorithm", kubernetes.DefaultLoadBalancerAlgorithm, "sets the default algorithm to be used for load balancing between backend endpoints, available options: roundRobin, consistentHash, random, powerOfRandomNChoices, peakEwma, weightedLeastRequest, maglev")
 
 	// Auth:
 	flag.BoolVar(&cfg.EnableOAuth2GrantFlow, "enable-oauth2-grant-flow", false, "enables OAuth2 Grant Flow filter")
@@ -501,6 +574,11 @@ func NewConfig() *Config {
 	// TLS version
 	flag.StringVar(&cfg.TLSMinVersion, "tls-min-version", defaultMinTLSVersion, "minimal TLS Version to be used in server, proxy and client connections")
 
+	// TLS client authentication
+	flag.StringVar(&cfg.ClientCAPathTLS, "tls-client-ca", "", "the path on the local filesystem to the PEM file(s) of the CAs used to verify the client certificates, multiple may be given comma separated")
+	flag.StringVar(&cfg.ClientAuthTLS, "tls-client-auth", "none", "client certificate authentication of the server: none, request - verifies the client certificates when given, require - requires verified client certificates")
+	flag.BoolVar(&cfg.EnableTLSFingerprint, "tls-fingerprint", false, "enables calculating the JA3 and JA4 fingerprints of the TLS clients, used by the TLSFingerprint predicate and logged in the access log")
+
 	// API Monitoring:
 	flag.BoolVar(&cfg.ApiUsageMonitoringEnable, "enable-api-usage-monitoring", false, "enables the apiUsageMonitoring filter")
 	flag.StringVar(&cfg.ApiUsageMonitoringRealmKeys, "api-usage-monitoring-realm-keys", "", "name of the property in the JWT payload that contains the authority realm")
@@ -584,6 +662,10 @@ func validate(c *Config) error {
 	if err != nil {
 		return err
 	}
+	_, err = c.getClientAuthTLS()
+	if err != nil {
+		return err
+	}
 	return c.parseForwardedHeaders()
 }
 
@@ -680,6 +762,9 @@ func (c *Config) ToOptions() skipper.Options {
 		whitelistCIDRS = strings.Split(c.WhitelistedHealthCheckCIDR, ",")
 	}
 
+	// validated during parsing
+	clientAuthTLS, _ := c.getClientAuthTLS()
+
 	options := skipper.Options{
 		// generic:
 		Address:                         c.Address,
@@ -689,15 +774,30 @@ func (c *Config) ToOptions() skipper.Options {
 		ExpectedBytesPerRequest:         c.ExpectedBytesPerRequest,
 		MaxTCPListenerConcurrency:       c.MaxTCPListenerConcurrency,
 		MaxTCPListenerQueue:             c.MaxTCPListenerQueue,
+		EnableProxyProtocol:             c.EnableProxyProtocol,
+		ProxyProtocolTrustedCIDRs:       c.ProxyProtocolTrustedCIDRs.values,
+		ProxyProtocolHeaderTimeout:      c.ProxyProtocolHeaderTimeout,
+		EnableH2C:                       c.EnableH2C,
 		IgnoreTrailingSlash:             c.IgnoreTrailingSlash,
 		DevMode:                         c.DevMode,
 		SupportListener:                 c.SupportListener,
 		DebugListener:                   c.DebugListener,
 		CertPathTLS:                     c.CertPathTLS,
+		ClientCAPathTLS:                 c.ClientCAPathTLS,
+		ClientAuthTLS:                   clientAuthTLS,
+		EnableTLSFingerprint:            c.EnableTLSFingerprint,
 		KeyPathTLS:                      c.KeyPathTLS,
 		MaxLoopbacks:                    c.MaxLoopbacks,
+		MaxRequestBodyBytes:             c.MaxRequestBody,
+		RequestBodyBufferMemoryBytes:    c.RequestBodyBufferMemory,
 		DefaultHTTPStatus:               c.DefaultHTTPStatus,
 		LoadBalancerHealthCheckInterval: c.LoadBalancerHealthCheckInterval,
+		EnableOutlierDetection:          c.EnableOutlierDetection,
+		StickySessionSecretsFile:        c.StickySessionSecretsFile,
+		CacheStore:                      c.CacheStore,
+		CacheMemoryMaxBytes:             c.CacheMemoryMaxBytes,
+		IdempotencyStore:                c.IdempotencyStore,
+		IdempotencyMemoryMaxBytes:       c.IdempotencyMemoryMaxBytes,
 		ReverseSourcePredicate:          c.ReverseSourcePredicate,
 		MaxAuditBody:                    c.MaxAuditBody,
 		MaxMatcherBufferSize:            c.MaxMatcherBufferSize,
@@ -712,6 +812,7 @@ func (c *Config) ToOptions() skipper.Options {
 		PredicatePlugins:                c.PredicatePlugins.values,
 		DataClientPlugins:               c.DataclientPlugins.values,
 		Plugins:                         c.MultiPlugins.values,
+		PluginConfig:                    c.PluginConfig,
 		PluginDirs:                      []string{skipper.DefaultPluginDir},
 		CompressEncodings:               c.CompressEncodings.values,
 
@@ -798,6 +899,7 @@ func (c *Config) ToOptions() skipper.Options {
 		KubernetesRedisServicePort:             c.KubernetesRedisServicePort,
 		KubernetesBackendTrafficAlgorithm:      c.KubernetesBackendTrafficAlgorithm,
 		KubernetesDefaultLoadBalancerAlgorithm: c.KubernetesDefaultLoadBalancerAlgorithm,
+		KubernetesEnableEndpointSlices:         c.KubernetesEnableEndpointSlices,
 
 		// API Monitoring:
 		ApiUsageMonitoringEnable:                c.ApiUsageMonitoringEnable,
@@ -904,6 +1006,28 @@ func (c *Config) ToOptions() skipper.Options {
 		options.EditRoute = append(options.EditRoute, eskipEdit)
 	}
 
+	if c.EnableOutlierDetection {
+		options.OutlierDetectionOptions = loadbalancer.OutlierDetectionOptions{
+			ConsecutiveErrors:        c.OutlierDetectionConsecutiveErrors,
+			Interval:                 c.OutlierDetectionInterval,
+			BaseEjectionTime:         c.OutlierDetectionBaseEjectionTime,
+			MaxEjectionTime:          c.OutlierDetectionMaxEjectionTime,
+			MaxEjectionPercent:       c.OutlierDetectionMaxEjectionPercent,
+			SuccessRateStdevFactor:   c.OutlierDetectionSuccessRateStdevFactor,
+			SuccessRateMinimumHosts:  c.OutlierDetectionSuccessRateMinimumHosts,
+			SuccessRateRequestVolume: c.OutlierDetectionSuccessRateRequestVolume,
+		}
+	}
+
+	if c.EnableZoneAwareLoadBalancing {
+		options.EnableZoneAwareLoadBalancing = true
+		options.ZoneAwareOptions = loadbalancer.ZoneAwareOptions{
+			Zone:              c.Zone,
+			MinHealthyPercent: c.ZoneAwareMinHealthyPercent,
+			MaxLoadFactor:     c.ZoneAwareMaxLoadFactor,
+		}
+	}
+
 	if c.PluginDir != "" {
 		options.PluginDirs = append(options.PluginDirs, c.PluginDir)
 	}
@@ -1003,6 +1127,19 @@ func (c *Config) getMinTLSVersion() uint16 {
 	return tlsVersionTable[defaultMinTLSVersion]
 }
 
+func (c *Config) getClientAuthTLS() (tls.ClientAuthType, error) {
+	switch c.ClientAuthTLS {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("invalid tls-client-auth: %s", c.ClientAuthTLS)
+	}
+}
+
 func (c *Config) parseHistogramBuckets() ([]float64, error) {
 	if c.HistogramMetricBucketsString == "" {
 		return prometheus.DefBuckets, nil
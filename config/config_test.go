@@ -10,6 +10,7 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/net"
 	"github.com/zalando/skipper/proxy"
 	"gopkg.in/yaml.v2"
@@ -70,6 +71,7 @@ func defaultConfig() *Config {
 		ExpectedBytesPerRequest:                 50 * 1024,
 		SupportListener:                         ":9911",
 		MaxLoopbacks:                            12,
+		RequestBodyBufferMemory:                 1048576,
 		DefaultHTTPStatus:                       404,
 		MaxAuditBody:                            1024,
 		MaxMatcherBufferSize:                    2097152,
@@ -151,9 +153,12 @@ func defaultConfig() *Config {
 		SwarmMaxMessageBuffer:                   4194304,
 		SwarmLeaveTimeout:                       5 * time.Second,
 		TLSMinVersion:                           defaultMinTLSVersion,
+		ClientAuthTLS:                           "none",
 		RoutesURLs:                              commaListFlag(),
 		ForwardedHeadersList:                    commaListFlag(),
 		ForwardedHeadersExcludeCIDRList:         commaListFlag(),
+		ProxyProtocolTrustedCIDRs:               commaListFlag(),
+		ProxyProtocolHeaderTimeout:              5 * time.Second,
 		ClusterRatelimitMaxGroupShards:          1,
 		RefusePayload:                           multiFlag{"foo", "bar", "baz"},
 		ValidateQuery:                           true,
@@ -161,6 +166,9 @@ func defaultConfig() *Config {
 		LuaModules:                              commaListFlag(),
 		LuaSources:                              commaListFlag(),
 		OpenPolicyAgentCleanerInterval:          10 * time.Second,
+		PluginConfig: map[string]filters.PluginConfig{
+			"teapot": {"s3-bucket": "my-bucket"},
+		},
 	}
 }
 
@@ -285,6 +293,14 @@ func Test_Validate(t *testing.T) {
 			wantErr: true,
 			want:    errors.New(`unable to parse histogram-metric-buckets: strconv.ParseFloat: parsing "abc": invalid syntax`),
 		},
+		{
+			name: "test wrong ClientAuthTLS",
+			change: func(c *Config) {
+				c.ClientAuthTLS = "optional"
+			},
+			wantErr: true,
+			want:    errors.New(`invalid tls-client-auth: optional`),
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := NewConfig()
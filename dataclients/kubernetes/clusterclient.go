@@ -55,6 +55,7 @@ type clusterClient struct {
 	routeGroupsURI      string
 	servicesURI         string
 	endpointsURI        string
+	endpointSlicesURI   string
 	secretsURI          string
 	tokenProvider       secrets.SecretsProvider
 	apiURL              string
@@ -70,6 +71,7 @@ type clusterClient struct {
 	secretsLabelSelectors     string
 	routeGroupsLabelSelectors string
 
+	enableEndpointSlices     bool
 	loggedMissingRouteGroups bool
 	routeGroupValidator      *definitions.RouteGroupValidator
 }
@@ -152,6 +154,7 @@ func newClusterClient(o Options, apiURL, ingCls, rgCls string, quit <-chan struc
 		routeGroupsURI:            routeGroupsClusterURI,
 		servicesURI:               ServicesClusterURI,
 		endpointsURI:              EndpointsClusterURI,
+		endpointSlicesURI:         EndpointSlicesClusterURI,
 		secretsURI:                SecretsClusterURI,
 		ingressClass:              ingClsRx,
 		ingressLabelSelectors:     toLabelSelectorQuery(o.IngressLabelSelectors),
@@ -164,6 +167,7 @@ func newClusterClient(o Options, apiURL, ingCls, rgCls string, quit <-chan struc
 		apiURL:                    apiURL,
 		certificateRegistry:       o.CertificateRegistry,
 		routeGroupValidator:       &definitions.RouteGroupValidator{},
+		enableEndpointSlices:      o.EnableEndpointSlices,
 	}
 
 	if o.KubernetesInCluster {
@@ -217,6 +221,7 @@ func (c *clusterClient) setNamespace(namespace string) {
 	c.routeGroupsURI = fmt.Sprintf(routeGroupsNamespaceFmt, namespace)
 	c.servicesURI = fmt.Sprintf(ServicesNamespaceFmt, namespace)
 	c.endpointsURI = fmt.Sprintf(EndpointsNamespaceFmt, namespace)
+	c.endpointSlicesURI = fmt.Sprintf(EndpointSlicesNamespaceFmt, namespace)
 	c.secretsURI = fmt.Sprintf(SecretsNamespaceFmt, namespace)
 }
 
@@ -486,9 +491,20 @@ func (c *clusterClient) fetchClusterState() (*clusterState, error) {
 		return nil, err
 	}
 
-	endpoints, err := c.loadEndpoints()
-	if err != nil {
-		return nil, err
+	var (
+		endpoints map[definitions.ResourceID]*endpoint
+		zones     map[string]string
+	)
+	if c.enableEndpointSlices {
+		endpoints, zones, err = c.loadEndpointSlices()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		endpoints, err = c.loadEndpoints()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if c.certificateRegistry != nil {
@@ -505,5 +521,6 @@ func (c *clusterClient) fetchClusterState() (*clusterState, error) {
 		endpoints:       endpoints,
 		secrets:         secrets,
 		cachedEndpoints: make(map[endpointID][]string),
+		endpointZones:   zones,
 	}, nil
 }
@@ -18,6 +18,7 @@ type clusterState struct {
 	endpoints       map[definitions.ResourceID]*endpoint
 	secrets         map[definitions.ResourceID]*secret
 	cachedEndpoints map[endpointID][]string
+	endpointZones   map[string]string
 }
 
 func (state *clusterState) getService(namespace, name string) (*service, error) {
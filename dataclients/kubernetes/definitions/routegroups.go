@@ -90,6 +90,10 @@ type SkipperBackend struct {
 	// Endpoints is required for Type lb
 	Endpoints []string
 
+	// EndpointWeights optionally sets the relative weights of the
+	// Endpoints for Type lb, in the same order
+	EndpointWeights []float64
+
 	parseError error
 }
 
@@ -112,6 +116,9 @@ type skipperBackendParser struct {
 	// Endpoints is required for Type lb
 	Endpoints []string `json:"endpoints"`
 
+	// EndpointWeights is optional for Type lb
+	EndpointWeights []float64 `json:"endpointWeights"`
+
 	// ServiceName is required for Type service
 	ServiceName string `json:"serviceName"`
 
@@ -199,6 +206,10 @@ func missingEndpoints(backendName string) error {
 	return fmt.Errorf("missing LB endpoints in backend: %s", backendName)
 }
 
+func invalidEndpointWeights(backendName string) error {
+	return fmt.Errorf("invalid LB endpoint weights in backend: %s", backendName)
+}
+
 func routeGroupError(m *Metadata, err error) error {
 	return fmt.Errorf("error in route group %s/%s: %w", namespaceString(m.Namespace), m.Name, err)
 }
@@ -243,6 +254,7 @@ func (sb *SkipperBackend) UnmarshalJSON(value []byte) error {
 	b.ServicePort = p.ServicePort
 	b.Algorithm = a
 	b.Endpoints = p.Endpoints
+	b.EndpointWeights = p.EndpointWeights
 	b.parseError = perr
 
 	*sb = b
@@ -180,6 +180,24 @@ func (brs BackendReferences) validate(backends map[string]bool) error {
 	return nil
 }
 
+func validEndpointWeights(endpoints []string, weights []float64) bool {
+	if len(weights) == 0 {
+		return true
+	}
+
+	if len(weights) != len(endpoints) {
+		return false
+	}
+
+	for _, w := range weights {
+		if w <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (sb *SkipperBackend) validate() error {
 	if sb.parseError != nil {
 		return sb.parseError
@@ -199,6 +217,8 @@ func (sb *SkipperBackend) validate() error {
 		return invalidServicePort(sb.Name, sb.ServicePort)
 	case sb.Type == eskip.LBBackend && len(sb.Endpoints) == 0:
 		return missingEndpoints(sb.Name)
+	case sb.Type == eskip.LBBackend && !validEndpointWeights(sb.Endpoints, sb.EndpointWeights):
+		return invalidEndpointWeights(sb.Name)
 	}
 
 	return nil
@@ -0,0 +1,181 @@
+package kubernetes
+
+import (
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/dataclients/kubernetes/definitions"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	EndpointSlicesClusterURI   = "/apis/discovery.k8s.io/v1/endpointslices"
+	EndpointSlicesNamespaceFmt = "/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices"
+	endpointSliceServiceLabel  = "kubernetes.io/service-name"
+)
+
+type endpointSliceList struct {
+	Items []*endpointSlice `json:"items"`
+}
+
+type endpointSlice struct {
+	Meta        *definitions.Metadata    `json:"metadata"`
+	AddressType string                   `json:"addressType"`
+	Endpoints   []*endpointSliceEndpoint `json:"endpoints"`
+	Ports       []*port                  `json:"ports"`
+}
+
+type endpointSliceEndpoint struct {
+	Addresses  []string                 `json:"addresses"`
+	Conditions *endpointSliceConditions `json:"conditions"`
+	NodeName   string                   `json:"nodeName"`
+	Zone       string                   `json:"zone"`
+	Hints      *endpointSliceHints      `json:"hints"`
+}
+
+type endpointSliceConditions struct {
+	Ready *bool `json:"ready"`
+}
+
+type endpointSliceHints struct {
+	ForZones []*endpointSliceZone `json:"forZones"`
+}
+
+type endpointSliceZone struct {
+	Name string `json:"name"`
+}
+
+// ready is true unless the endpoint is explicitly not ready, as the
+// Kubernetes API defines it.
+func (e *endpointSliceEndpoint) ready() bool {
+	return e.Conditions == nil || e.Conditions.Ready == nil || *e.Conditions.Ready
+}
+
+// zone returns the zone, that the topology aware hints assign the endpoint
+// to, or the zone where it runs.
+func (e *endpointSliceEndpoint) zone() string {
+	if e.Hints != nil && len(e.Hints.ForZones) > 0 && e.Hints.ForZones[0].Name != "" {
+		return e.Hints.ForZones[0].Name
+	}
+
+	return e.Zone
+}
+
+func samePorts(a, b []*port) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	ports := make(map[port]bool)
+	for _, p := range a {
+		ports[*p] = true
+	}
+
+	for _, p := range b {
+		if !ports[*p] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// subsetWithPorts returns the subset of an endpoint with the given ports,
+// and creates it when it doesn't exist yet.
+func (ep *endpoint) subsetWithPorts(ports []*port) *subset {
+	for _, s := range ep.Subsets {
+		if samePorts(s.Ports, ports) {
+			return s
+		}
+	}
+
+	s := &subset{Ports: ports}
+	ep.Subsets = append(ep.Subsets, s)
+	return s
+}
+
+// endpointsFromSlices merges the ready endpoints of the EndpointSlices of
+// each service into the same representation as the Endpoints resources. It
+// also returns the zones of the endpoints mapped by their IP addresses.
+func endpointsFromSlices(slices []*endpointSlice) (map[definitions.ResourceID]*endpoint, map[string]string) {
+	result := make(map[definitions.ResourceID]*endpoint)
+	zones := make(map[string]string)
+	for _, s := range slices {
+		if s == nil || s.Meta == nil || s.AddressType == "FQDN" {
+			continue
+		}
+
+		svc := s.Meta.Labels[endpointSliceServiceLabel]
+		if svc == "" {
+			continue
+		}
+
+		var addresses []*address
+		for _, e := range s.Endpoints {
+			if e == nil || !e.ready() {
+				continue
+			}
+
+			z := e.zone()
+			for _, a := range e.Addresses {
+				addresses = append(addresses, &address{IP: a, Node: e.NodeName})
+				if z != "" {
+					zones[a] = z
+				}
+			}
+		}
+
+		meta := &definitions.Metadata{Namespace: s.Meta.Namespace, Name: svc}
+		resID := meta.ToResourceID()
+		ep, ok := result[resID]
+		if !ok {
+			ep = &endpoint{Meta: meta}
+			result[resID] = ep
+		}
+
+		if len(addresses) == 0 {
+			continue
+		}
+
+		ss := ep.subsetWithPorts(s.Ports)
+		ss.Addresses = append(ss.Addresses, addresses...)
+	}
+
+	return result, zones
+}
+
+// appendEndpointZones annotates the endpoints of a load balanced route with
+// their zones, using the endpointZone filter.
+func (state *clusterState) appendEndpointZones(r *eskip.Route) {
+	if len(state.endpointZones) == 0 {
+		return
+	}
+
+	for _, ep := range r.LBEndpoints {
+		u, err := url.Parse(ep)
+		if err != nil {
+			continue
+		}
+
+		if z, ok := state.endpointZones[u.Hostname()]; ok {
+			r.Filters = append(r.Filters, &eskip.Filter{
+				Name: filters.EndpointZoneName,
+				Args: []interface{}{ep, z},
+			})
+		}
+	}
+}
+
+func (c *clusterClient) loadEndpointSlices() (map[definitions.ResourceID]*endpoint, map[string]string, error) {
+	var slices endpointSliceList
+	if err := c.getJSON(c.endpointSlicesURI+c.endpointsLabelSelectors, &slices); err != nil {
+		log.Debugf("requesting all endpointslices failed: %v", err)
+		return nil, nil, err
+	}
+
+	log.Debugf("all endpointslices received: %d", len(slices.Items))
+	endpoints, zones := endpointsFromSlices(slices.Items)
+	return endpoints, zones, nil
+}
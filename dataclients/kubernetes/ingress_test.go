@@ -19,5 +19,6 @@ func TestIngressV1Fixtures(t *testing.T) {
 		"testdata/ingressV1/traffic",
 		"testdata/ingressV1/traffic-segment",
 		"testdata/ingressV1/loadbalancer-algorithm",
+		"testdata/ingressV1/endpointslices",
 	)
 }
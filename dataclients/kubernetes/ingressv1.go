@@ -156,6 +156,7 @@ func convertPathRuleV1(
 		LBAlgorithm: getLoadBalancerAlgorithm(metadata, defaultLoadBalancerAlgorithm),
 		HostRegexps: hostRegexp,
 	}
+	state.appendEndpointZones(r)
 	setPathV1(pathMode, r, prule.PathType, prule.Path)
 	traffic.apply(r)
 	return r, nil
@@ -379,12 +380,14 @@ func (ing *ingress) convertDefaultBackendV1(
 		}, true, nil
 	}
 
-	return &eskip.Route{
+	r := &eskip.Route{
 		Id:          routeID(ns, name, "", "", ""),
 		BackendType: eskip.LBBackend,
 		LBEndpoints: eps,
 		LBAlgorithm: getLoadBalancerAlgorithm(i.Metadata, ing.defaultLoadBalancerAlgorithm),
-	}, true, nil
+	}
+	state.appendEndpointZones(r)
+	return r, true, nil
 }
 
 func serviceNameBackend(svcName, svcNamespace string, servicePort *servicePort) string {
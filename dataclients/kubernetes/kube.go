@@ -222,8 +222,13 @@ type Options struct {
 	BackendTrafficAlgorithm BackendTrafficAlgorithm
 
 	// DefaultLoadBalancerAlgorithm sets the default algorithm to be used for load balancing between backend endpoints,
-	// available options: roundRobin, consistentHash, random, powerOfRandomNChoices
+	// available options: roundRobin, consistentHash, random, powerOfRandomNChoices, peakEwma, weightedLeastRequest, maglev
 	DefaultLoadBalancerAlgorithm string
+
+	// EnableEndpointSlices enables loading the backend endpoints from the EndpointSlices
+	// instead of the Endpoints. The EndpointSlices provide the zone of the endpoints, which
+	// is set on the load balanced routes with the endpointZone filter.
+	EnableEndpointSlices bool
 }
 
 // Client is a Skipper DataClient implementation used to create routes based on Kubernetes Ingress settings.
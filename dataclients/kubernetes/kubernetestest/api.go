@@ -23,11 +23,12 @@ type TestAPIOptions struct {
 }
 
 type namespace struct {
-	services    []byte
-	ingresses   []byte
-	routeGroups []byte
-	endpoints   []byte
-	secrets     []byte
+	services       []byte
+	ingresses      []byte
+	routeGroups    []byte
+	endpoints      []byte
+	endpointSlices []byte
+	secrets        []byte
 }
 
 type api struct {
@@ -43,7 +44,7 @@ func NewAPI(o TestAPIOptions, specs ...io.Reader) (*api, error) {
 	a := &api{
 		namespaces: make(map[string]namespace),
 		pathRx: regexp.MustCompile(
-			"(/namespaces/([^/]+))?/(services|ingresses|routegroups|endpoints|secrets)",
+			"(/namespaces/([^/]+))?/(services|ingresses|routegroups|endpointslices|endpoints|secrets)",
 		),
 	}
 
@@ -191,6 +192,8 @@ func (a *api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		b = filterBySelectors(ns.routeGroups, parseSelectors(r))
 	case "endpoints":
 		b = filterBySelectors(ns.endpoints, parseSelectors(r))
+	case "endpointslices":
+		b = filterBySelectors(ns.endpointSlices, parseSelectors(r))
 	case "secrets":
 		b = filterBySelectors(ns.secrets, parseSelectors(r))
 	default:
@@ -281,6 +284,10 @@ func initNamespace(kinds map[string][]interface{}) (ns namespace, err error) {
 		return
 	}
 
+	if err = itemsJSON(&ns.endpointSlices, kinds["EndpointSlice"]); err != nil {
+		return
+	}
+
 	if err = itemsJSON(&ns.secrets, kinds["Secret"]); err != nil {
 		return
 	}
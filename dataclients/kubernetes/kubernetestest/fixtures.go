@@ -50,6 +50,7 @@ type kubeOptionsParser struct {
 	ForceKubernetesService       bool               `yaml:"force-kubernetes-service"`
 	BackendTrafficAlgorithm      string             `yaml:"backend-traffic-algorithm"`
 	DefaultLoadBalancerAlgorithm string             `yaml:"default-lb-algorithm"`
+	EnableEndpointSlices         bool               `yaml:"kubernetes-enable-endpointslices"`
 }
 
 func baseNoExt(n string) string {
@@ -235,6 +236,7 @@ func testFixture(t *testing.T, f fixtureSet) {
 		o.EndpointsLabelSelectors = kop.EndpointsLabels
 		o.ForceKubernetesService = kop.ForceKubernetesService
 		o.DefaultLoadBalancerAlgorithm = kop.DefaultLoadBalancerAlgorithm
+		o.EnableEndpointSlices = kop.EnableEndpointSlices
 
 		if kop.BackendTrafficAlgorithm != "" {
 			o.BackendTrafficAlgorithm, err = kubernetes.ParseBackendTrafficAlgorithm(kop.BackendTrafficAlgorithm)
@@ -215,6 +215,7 @@ func applyServiceBackend(ctx *routeGroupContext, backend *definitions.SkipperBac
 		r.LBAlgorithm = backend.Algorithm.String()
 	}
 
+	ctx.state.appendEndpointZones(r)
 	return nil
 }
 
@@ -263,6 +264,7 @@ func applyBackend(ctx *routeGroupContext, backend *definitions.SkipperBackend, r
 		}
 
 		r.LBEndpoints = backend.Endpoints
+		r.LBEndpointWeights = backend.EndpointWeights
 		r.LBAlgorithm = ctx.defaultLoadBalancerAlgorithm
 		if backend.Algorithm != loadbalancer.None {
 			r.LBAlgorithm = backend.Algorithm.String()
@@ -34,6 +34,10 @@ func TestRouteGroupEastWestRange(t *testing.T) {
 	kubernetestest.FixturesToTest(t, "testdata/routegroups/east-west-range")
 }
 
+func TestRouteGroupEndpointSlices(t *testing.T) {
+	kubernetestest.FixturesToTest(t, "testdata/routegroups/endpointslices")
+}
+
 func TestRouteGroupHTTPSRedirect(t *testing.T) {
 	kubernetestest.FixturesToTest(t, "testdata/routegroups/https-redirect")
 }
@@ -67,6 +67,11 @@ func Copy(r *Route) *Route {
 	c.LBAlgorithm = r.LBAlgorithm
 	c.LBEndpoints = make([]string, len(r.LBEndpoints))
 	copy(c.LBEndpoints, r.LBEndpoints)
+	if len(r.LBEndpointWeights) > 0 {
+		c.LBEndpointWeights = make([]float64, len(r.LBEndpointWeights))
+		copy(c.LBEndpointWeights, r.LBEndpointWeights)
+	}
+
 	return c
 }
 
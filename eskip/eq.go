@@ -54,6 +54,20 @@ func eqStrings(left, right []string) bool {
 	return true
 }
 
+func eqWeights(left, right []float64) bool {
+	if len(left) != len(right) {
+		return false
+	}
+
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
 func eq2(left, right *Route) bool {
 	lc, rc := Canonical(left), Canonical(right)
 
@@ -107,6 +121,10 @@ func eq2(left, right *Route) bool {
 		return false
 	}
 
+	if !eqWeights(lc.LBEndpointWeights, rc.LBEndpointWeights) {
+		return false
+	}
+
 	return true
 }
 
@@ -255,9 +273,7 @@ func Canonical(r *Route) *Route {
 	case LBBackend:
 		// using the LB fields only when apply:
 		c.LBAlgorithm = r.LBAlgorithm
-		c.LBEndpoints = make([]string, len(r.LBEndpoints))
-		copy(c.LBEndpoints, r.LBEndpoints)
-		sort.Strings(c.LBEndpoints)
+		c.LBEndpoints, c.LBEndpointWeights = canonicalLBEndpoints(r.LBEndpoints, r.LBEndpointWeights)
 	}
 
 	// Name and Namespace stripped
@@ -265,6 +281,48 @@ func Canonical(r *Route) *Route {
 	return c
 }
 
+// canonicalLBEndpoints sorts the LB endpoints together with their weights,
+// and drops the weights when they are all the default 1.
+func canonicalLBEndpoints(endpoints []string, weights []float64) ([]string, []float64) {
+	ce := make([]string, len(endpoints))
+	copy(ce, endpoints)
+
+	var weighted bool
+	for _, w := range weights {
+		if w != 1 {
+			weighted = true
+			break
+		}
+	}
+
+	if !weighted {
+		sort.Strings(ce)
+		return ce, nil
+	}
+
+	cw := make([]float64, len(weights))
+	copy(cw, weights)
+	if len(cw) != len(ce) {
+		// invalid, keeping the order for the validation
+		return ce, cw
+	}
+
+	sort.Sort(lbEndpointsByAddress{endpoints: ce, weights: cw})
+	return ce, cw
+}
+
+type lbEndpointsByAddress struct {
+	endpoints []string
+	weights   []float64
+}
+
+func (s lbEndpointsByAddress) Len() int           { return len(s.endpoints) }
+func (s lbEndpointsByAddress) Less(i, j int) bool { return s.endpoints[i] < s.endpoints[j] }
+func (s lbEndpointsByAddress) Swap(i, j int) {
+	s.endpoints[i], s.endpoints[j] = s.endpoints[j], s.endpoints[i]
+	s.weights[i], s.weights[j] = s.weights[j], s.weights[i]
+}
+
 // CanonicalList returns the canonical form of each route in the list,
 // keeping the order. The returned slice is a new slice of the input
 // slice but the routes in the slice and their fields are not necessarily
@@ -108,6 +108,26 @@ func TestEq(t *testing.T) {
 			{BackendType: LBBackend, LBEndpoints: []string{"https://one.example.org"}},
 			{BackendType: LBBackend, LBEndpoints: []string{"https://two.example.org"}},
 		},
+	}, {
+		title: "non-eq lb endpoint weights",
+		routes: []*Route{
+			{BackendType: LBBackend, LBEndpoints: []string{"https://one.example.org", "https://two.example.org"}, LBEndpointWeights: []float64{1, 2}},
+			{BackendType: LBBackend, LBEndpoints: []string{"https://one.example.org", "https://two.example.org"}, LBEndpointWeights: []float64{2, 1}},
+		},
+	}, {
+		title: "eq lb endpoint weights in different order",
+		routes: []*Route{
+			{BackendType: LBBackend, LBEndpoints: []string{"https://one.example.org", "https://two.example.org"}, LBEndpointWeights: []float64{1, 2}},
+			{BackendType: LBBackend, LBEndpoints: []string{"https://two.example.org", "https://one.example.org"}, LBEndpointWeights: []float64{2, 1}},
+		},
+		expect: true,
+	}, {
+		title: "default lb endpoint weights",
+		routes: []*Route{
+			{BackendType: LBBackend, LBEndpoints: []string{"https://one.example.org", "https://two.example.org"}, LBEndpointWeights: []float64{1, 1}},
+			{BackendType: LBBackend, LBEndpoints: []string{"https://one.example.org", "https://two.example.org"}},
+		},
+		expect: true,
 	}, {
 		title: "all eq",
 		routes: []*Route{{
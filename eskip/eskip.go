@@ -237,6 +237,7 @@ type parsedRoute struct {
 	backend     string
 	lbAlgorithm string
 	lbEndpoints []string
+	lbWeights   []float64
 }
 
 // A Predicate object represents a parsed, in-memory, route matching predicate
@@ -332,6 +333,11 @@ type Route struct {
 	// load balancing backends.
 	LBEndpoints []string
 
+	// LBEndpointWeights optionally stores the relative weights of the
+	// load balancing endpoints, in the same order as LBEndpoints. When
+	// not set, every endpoint has the weight 1.
+	LBEndpointWeights []float64
+
 	// Name is deprecated and not used.
 	Name string
 
@@ -415,6 +421,11 @@ func (r *Route) Copy() *Route {
 		copy(c.LBEndpoints, r.LBEndpoints)
 	}
 
+	if len(r.LBEndpointWeights) > 0 {
+		c.LBEndpointWeights = make([]float64, len(r.LBEndpointWeights))
+		copy(c.LBEndpointWeights, r.LBEndpointWeights)
+	}
+
 	return &c
 }
 
@@ -573,6 +584,7 @@ func newRouteDefinition(r *parsedRoute) (*Route, error) {
 	rd.Backend = r.backend
 	rd.LBAlgorithm = r.lbAlgorithm
 	rd.LBEndpoints = r.lbEndpoints
+	rd.LBEndpointWeights = r.lbWeights
 
 	switch {
 	case r.shunt:
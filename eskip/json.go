@@ -11,10 +11,11 @@ type jsonNameArgs struct {
 }
 
 type jsonBackend struct {
-	Type      string   `json:"type"`
-	Address   string   `json:"address,omitempty"`
-	Algorithm string   `json:"algorithm,omitempty"`
-	Endpoints []string `json:"endpoints,omitempty"`
+	Type      string    `json:"type"`
+	Address   string    `json:"address,omitempty"`
+	Algorithm string    `json:"algorithm,omitempty"`
+	Endpoints []string  `json:"endpoints,omitempty"`
+	Weights   []float64 `json:"weights,omitempty"`
 }
 
 type jsonRoute struct {
@@ -38,6 +39,7 @@ func newJSONRoute(r *Route) *jsonRoute {
 			Address:   cr.Backend,
 			Algorithm: cr.LBAlgorithm,
 			Endpoints: cr.LBEndpoints,
+			Weights:   cr.LBEndpointWeights,
 		}
 	}
 
@@ -98,6 +100,11 @@ func (r *Route) UnmarshalJSON(b []byte) error {
 		if len(r.LBEndpoints) == 0 {
 			r.LBEndpoints = nil
 		}
+
+		r.LBEndpointWeights = jr.Backend.Weights
+		if len(r.LBEndpointWeights) == 0 {
+			r.LBEndpointWeights = nil
+		}
 	}
 
 	r.Filters = jr.Filters
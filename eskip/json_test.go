@@ -91,6 +91,11 @@ func TestMarshalUnmarshalJSON(t *testing.T) {
 			[]*Route{{Id: "beef", BackendType: LBBackend, LBAlgorithm: "yolo", LBEndpoints: []string{"localhost"}}},
 			`[{"id":"beef","backend":{"type":"lb","algorithm":"yolo","endpoints":["localhost"]}}]`,
 		},
+		{
+			"weighted lb backend",
+			[]*Route{{Id: "beef", BackendType: LBBackend, LBEndpoints: []string{"http://b", "http://a"}, LBEndpointWeights: []float64{3, 1}}},
+			`[{"id":"beef","backend":{"type":"lb","endpoints":["http://a","http://b"],"weights":[1,3]}}]`,
+		},
 		{
 			"shunt backend",
 			[]*Route{{Id: "shunty", BackendType: ShuntBackend}},
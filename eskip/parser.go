@@ -14,6 +14,16 @@ func convertNumber(s string) float64 {
 	return n
 }
 
+// the weights of the LB endpoints are only kept when at least one of them
+// was set explicitly
+func weightsIfSet(w []float64, set bool) []float64 {
+	if !set {
+		return nil
+	}
+
+	return w
+}
+
 type eskipSymType struct {
 	yys         int
 	token       string
@@ -33,9 +43,10 @@ type eskipSymType struct {
 	numval      float64
 	stringval   string
 	regexpval   string
-	stringvals  []string
 	lbAlgorithm string
 	lbEndpoints []string
+	lbWeights   []float64
+	lbWeighted  bool
 }
 
 const and = 57346
@@ -93,62 +104,62 @@ var eskipExca = [...]int8{
 
 const eskipPrivate = 57344
 
-const eskipLast = 62
+const eskipLast = 67
 
 var eskipAct = [...]int8{
-	34, 40, 32, 31, 24, 17, 20, 21, 22, 25,
-	27, 26, 19, 48, 36, 9, 37, 25, 41, 9,
-	16, 25, 25, 3, 10, 7, 14, 42, 29, 43,
-	4, 55, 8, 45, 44, 49, 45, 30, 28, 19,
-	50, 15, 13, 47, 46, 38, 23, 51, 52, 39,
-	53, 42, 54, 12, 35, 11, 33, 18, 5, 6,
-	2, 1,
+	34, 33, 42, 40, 31, 24, 17, 49, 16, 32,
+	25, 41, 19, 20, 21, 22, 25, 27, 26, 36,
+	9, 37, 9, 25, 3, 10, 25, 43, 7, 14,
+	44, 4, 58, 29, 46, 8, 36, 50, 30, 19,
+	51, 28, 15, 52, 48, 47, 45, 38, 46, 53,
+	13, 43, 43, 55, 57, 56, 54, 12, 23, 11,
+	39, 35, 18, 5, 6, 2, 1,
 }
 
 var eskipPact = [...]int16{
-	14, -1000, 11, -1000, -1000, 49, 34, -1000, 15, -1000,
-	2, -8, 10, 10, 4, -1000, -1000, -1000, 39, -1000,
-	-1000, -1000, -1000, -1000, -1000, -1000, 0, 18, -1000, 15,
-	-1000, 27, -1000, -1000, -1000, -1000, -1000, -1000, -8, -7,
-	26, 31, -1000, 4, -1000, 4, -1000, -1000, -1000, 5,
-	5, 24, -1000, -1000, 26, -1000,
+	17, -1000, 12, -1000, -1000, 53, 42, -1000, 18, -1000,
+	-10, -1, 15, 15, 9, -1000, -1000, -1000, 41, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -7, 19, -1000, 18,
+	-1000, 39, -1000, -1000, -1000, -1000, -1000, -1000, -1, -13,
+	28, 31, -1000, 35, 9, -1000, 9, -1000, -1000, -1000,
+	6, 6, 26, 25, -1000, -1000, 28, -1000, -1000,
 }
 
 var eskipPgo = [...]int8{
-	0, 61, 60, 23, 30, 59, 58, 5, 57, 25,
-	3, 4, 2, 56, 0, 54, 1, 49, 46,
+	0, 66, 65, 24, 31, 64, 63, 6, 62, 28,
+	4, 5, 9, 1, 0, 61, 2, 3, 60, 58,
 }
 
 var eskipR1 = [...]int8{
 	0, 1, 1, 2, 2, 2, 2, 4, 5, 3,
 	3, 6, 6, 9, 9, 8, 8, 11, 10, 10,
-	10, 12, 12, 12, 16, 16, 17, 17, 18, 7,
-	7, 7, 7, 7, 13, 14, 15,
+	10, 12, 12, 12, 16, 16, 17, 17, 18, 18,
+	19, 7, 7, 7, 7, 7, 13, 14, 15,
 }
 
 var eskipR2 = [...]int8{
 	0, 1, 1, 0, 1, 3, 2, 3, 1, 3,
 	5, 1, 3, 1, 4, 1, 3, 4, 0, 1,
-	3, 1, 1, 1, 1, 3, 1, 3, 3, 1,
-	1, 1, 1, 1, 1, 1, 1,
+	3, 1, 1, 1, 1, 3, 1, 3, 1, 3,
+	3, 1, 1, 1, 1, 1, 1, 1, 1,
 }
 
 var eskipChk = [...]int16{
 	-1000, -1, -2, -3, -4, -6, -5, -9, 18, 5,
 	13, 6, 4, 8, 11, -4, 18, -7, -8, -14,
-	14, 15, 16, -18, -11, 17, 19, 18, -9, 18,
-	-3, -10, -12, -13, -14, -15, 10, 12, 6, -17,
-	-16, 18, -14, 11, 7, 9, -7, -11, 20, 9,
-	9, -10, -12, -14, -16, 7,
+	14, 15, 16, -19, -11, 17, 19, 18, -9, 18,
+	-3, -10, -12, -13, -14, -15, 10, 12, 6, -18,
+	-17, 18, -16, -14, 11, 7, 9, -7, -11, 20,
+	9, 9, 8, -10, -12, -16, -17, -13, 7,
 }
 
 var eskipDef = [...]int8{
 	3, -2, 1, 2, 4, 0, 0, 11, 8, 13,
-	6, 0, 0, 0, 18, 5, 8, 9, 0, 29,
-	30, 31, 32, 33, 15, 35, 0, 0, 12, 0,
-	7, 0, 19, 21, 22, 23, 34, 36, 0, 0,
-	26, 0, 24, 18, 14, 0, 10, 16, 28, 0,
-	0, 0, 20, 25, 27, 17,
+	6, 0, 0, 0, 18, 5, 8, 9, 0, 31,
+	32, 33, 34, 35, 15, 37, 0, 0, 12, 0,
+	7, 0, 19, 21, 22, 23, 36, 38, 0, 0,
+	28, 0, 26, 24, 18, 14, 0, 10, 16, 30,
+	0, 0, 0, 0, 20, 27, 29, 25, 17,
 }
 
 var eskipTok1 = [...]int8{
@@ -551,9 +562,11 @@ eskipdefault:
 				lbBackend:   eskipDollar[3].lbBackend,
 				lbAlgorithm: eskipDollar[3].lbAlgorithm,
 				lbEndpoints: eskipDollar[3].lbEndpoints,
+				lbWeights:   eskipDollar[3].lbWeights,
 			}
 			eskipDollar[1].matchers = nil
 			eskipDollar[3].lbEndpoints = nil
+			eskipDollar[3].lbWeights = nil
 		}
 	case 10:
 		eskipDollar = eskipS[eskippt-5 : eskippt+1]
@@ -568,10 +581,12 @@ eskipdefault:
 				lbBackend:   eskipDollar[5].lbBackend,
 				lbAlgorithm: eskipDollar[5].lbAlgorithm,
 				lbEndpoints: eskipDollar[5].lbEndpoints,
+				lbWeights:   eskipDollar[5].lbWeights,
 			}
 			eskipDollar[1].matchers = nil
 			eskipDollar[3].filters = nil
 			eskipDollar[5].lbEndpoints = nil
+			eskipDollar[5].lbWeights = nil
 		}
 	case 11:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
@@ -643,32 +658,54 @@ eskipdefault:
 	case 24:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
-			eskipVAL.stringvals = []string{eskipDollar[1].stringval}
+			eskipVAL.stringval = eskipDollar[1].stringval
+			eskipVAL.numval = 1
+			eskipVAL.lbWeighted = false
 		}
 	case 25:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
 		{
-			eskipVAL.stringvals = eskipDollar[1].stringvals
-			eskipVAL.stringvals = append(eskipVAL.stringvals, eskipDollar[3].stringval)
+			eskipVAL.stringval = eskipDollar[1].stringval
+			eskipVAL.numval = eskipDollar[3].numval
+			eskipVAL.lbWeighted = true
 		}
 	case 26:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
-			eskipVAL.lbEndpoints = eskipDollar[1].stringvals
+			eskipVAL.lbEndpoints = []string{eskipDollar[1].stringval}
+			eskipVAL.lbWeights = []float64{eskipDollar[1].numval}
+			eskipVAL.lbWeighted = eskipDollar[1].lbWeighted
 		}
 	case 27:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
 		{
-			eskipVAL.lbAlgorithm = eskipDollar[1].token
-			eskipVAL.lbEndpoints = eskipDollar[3].stringvals
+			eskipVAL.lbEndpoints = eskipDollar[1].lbEndpoints
+			eskipVAL.lbEndpoints = append(eskipVAL.lbEndpoints, eskipDollar[3].stringval)
+			eskipVAL.lbWeights = eskipDollar[1].lbWeights
+			eskipVAL.lbWeights = append(eskipVAL.lbWeights, eskipDollar[3].numval)
+			eskipVAL.lbWeighted = eskipDollar[1].lbWeighted || eskipDollar[3].lbWeighted
 		}
 	case 28:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+		{
+			eskipVAL.lbEndpoints = eskipDollar[1].lbEndpoints
+			eskipVAL.lbWeights = weightsIfSet(eskipDollar[1].lbWeights, eskipDollar[1].lbWeighted)
+		}
+	case 29:
+		eskipDollar = eskipS[eskippt-3 : eskippt+1]
+		{
+			eskipVAL.lbAlgorithm = eskipDollar[1].token
+			eskipVAL.lbEndpoints = eskipDollar[3].lbEndpoints
+			eskipVAL.lbWeights = weightsIfSet(eskipDollar[3].lbWeights, eskipDollar[3].lbWeighted)
+		}
+	case 30:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
 		{
 			eskipVAL.lbAlgorithm = eskipDollar[2].lbAlgorithm
 			eskipVAL.lbEndpoints = eskipDollar[2].lbEndpoints
+			eskipVAL.lbWeights = eskipDollar[2].lbWeights
 		}
-	case 29:
+	case 31:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.backend = eskipDollar[1].stringval
@@ -677,7 +714,7 @@ eskipdefault:
 			eskipVAL.dynamic = false
 			eskipVAL.lbBackend = false
 		}
-	case 30:
+	case 32:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.shunt = true
@@ -685,7 +722,7 @@ eskipdefault:
 			eskipVAL.dynamic = false
 			eskipVAL.lbBackend = false
 		}
-	case 31:
+	case 33:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.shunt = false
@@ -693,7 +730,7 @@ eskipdefault:
 			eskipVAL.dynamic = false
 			eskipVAL.lbBackend = false
 		}
-	case 32:
+	case 34:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.shunt = false
@@ -701,7 +738,7 @@ eskipdefault:
 			eskipVAL.dynamic = true
 			eskipVAL.lbBackend = false
 		}
-	case 33:
+	case 35:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.shunt = false
@@ -710,18 +747,19 @@ eskipdefault:
 			eskipVAL.lbBackend = true
 			eskipVAL.lbAlgorithm = eskipDollar[1].lbAlgorithm
 			eskipVAL.lbEndpoints = eskipDollar[1].lbEndpoints
+			eskipVAL.lbWeights = eskipDollar[1].lbWeights
 		}
-	case 34:
+	case 36:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.numval = convertNumber(eskipDollar[1].token)
 		}
-	case 35:
+	case 37:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.stringval = eskipDollar[1].token
 		}
-	case 36:
+	case 38:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
 		{
 			eskipVAL.regexpval = eskipDollar[1].token
@@ -26,6 +26,16 @@ func convertNumber(s string) float64 {
 	return n
 }
 
+// the weights of the LB endpoints are only kept when at least one of them
+// was set explicitly
+func weightsIfSet(w []float64, set bool) []float64 {
+	if !set {
+		return nil
+	}
+
+	return w
+}
+
 %}
 
 %union {
@@ -46,9 +56,10 @@ func convertNumber(s string) float64 {
 	numval float64
 	stringval string
 	regexpval string
-	stringvals []string
 	lbAlgorithm string
 	lbEndpoints []string
+	lbWeights []float64
+	lbWeighted bool
 }
 
 %token and
@@ -120,9 +131,11 @@ route:
 			lbBackend: $3.lbBackend,
 			lbAlgorithm: $3.lbAlgorithm,
 			lbEndpoints: $3.lbEndpoints,
+			lbWeights: $3.lbWeights,
 		}
 		$1.matchers = nil
 		$3.lbEndpoints = nil
+		$3.lbWeights = nil
 	}
 	|
 	frontend arrow filters arrow backend {
@@ -136,10 +149,12 @@ route:
 			lbBackend: $5.lbBackend,
 			lbAlgorithm: $5.lbAlgorithm,
 			lbEndpoints: $5.lbEndpoints,
+			lbWeights: $5.lbWeights,
 		}
 		$1.matchers = nil
 		$3.filters = nil
 		$5.lbEndpoints = nil
+		$5.lbWeights = nil
 	}
 
 frontend:
@@ -204,30 +219,51 @@ arg:
 		$$.arg = $1.regexpval
 	}
 
-stringvals:
+lbendpoint:
 	stringval {
-		$$.stringvals = []string{$1.stringval}
+		$$.stringval = $1.stringval
+		$$.numval = 1
+		$$.lbWeighted = false
+	}
+	|
+	stringval colon numval {
+		$$.stringval = $1.stringval
+		$$.numval = $3.numval
+		$$.lbWeighted = true
+	}
+
+lbendpoints:
+	lbendpoint {
+		$$.lbEndpoints = []string{$1.stringval}
+		$$.lbWeights = []float64{$1.numval}
+		$$.lbWeighted = $1.lbWeighted
 	}
 	|
-	stringvals comma stringval {
-		$$.stringvals = $1.stringvals
-		$$.stringvals = append($$.stringvals, $3.stringval)
+	lbendpoints comma lbendpoint {
+		$$.lbEndpoints = $1.lbEndpoints
+		$$.lbEndpoints = append($$.lbEndpoints, $3.stringval)
+		$$.lbWeights = $1.lbWeights
+		$$.lbWeights = append($$.lbWeights, $3.numval)
+		$$.lbWeighted = $1.lbWeighted || $3.lbWeighted
 	}
 
 lbbackendbody:
-	stringvals {
-		$$.lbEndpoints = $1.stringvals
+	lbendpoints {
+		$$.lbEndpoints = $1.lbEndpoints
+		$$.lbWeights = weightsIfSet($1.lbWeights, $1.lbWeighted)
 	}
 	|
-	symbol comma stringvals {
+	symbol comma lbendpoints {
 		$$.lbAlgorithm = $1.token
-		$$.lbEndpoints = $3.stringvals
+		$$.lbEndpoints = $3.lbEndpoints
+		$$.lbWeights = weightsIfSet($3.lbWeights, $3.lbWeighted)
 	}
 
 lbbackend:
 	openarrow lbbackendbody closearrow {
 		$$.lbAlgorithm = $2.lbAlgorithm
 		$$.lbEndpoints = $2.lbEndpoints
+		$$.lbWeights = $2.lbWeights
 	}
 
 backend:
@@ -267,6 +303,7 @@ backend:
 		$$.lbBackend = true
 		$$.lbAlgorithm = $1.lbAlgorithm
 		$$.lbEndpoints = $1.lbEndpoints
+		$$.lbWeights = $1.lbWeights
 	}
 
 numval:
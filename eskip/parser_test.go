@@ -309,6 +309,31 @@ func TestLBBackend(t *testing.T) {
 				"https://example3.org",
 			},
 		}},
+	}, {
+		title: "weighted endpoints",
+		code:  `* -> <algFoo, "https://example1.org":3, "https://example2.org":0.5>`,
+		expectedResult: []*Route{{
+			BackendType:       LBBackend,
+			LBAlgorithm:       "algFoo",
+			LBEndpoints:       []string{"https://example1.org", "https://example2.org"},
+			LBEndpointWeights: []float64{3, 0.5},
+		}},
+	}, {
+		title: "partially weighted endpoints",
+		code:  `* -> <"https://example1.org", "https://example2.org":2, "https://example3.org">`,
+		expectedResult: []*Route{{
+			BackendType:       LBBackend,
+			LBEndpoints:       []string{"https://example1.org", "https://example2.org", "https://example3.org"},
+			LBEndpointWeights: []float64{1, 2, 1},
+		}},
+	}, {
+		title: "weight without endpoint",
+		code:  `* -> <algFoo, :3>`,
+		fail:  true,
+	}, {
+		title: "weight is not a number",
+		code:  `* -> <"https://example1.org":"3">`,
+		fail:  true,
 	}} {
 		t.Run(test.title, func(t *testing.T) {
 			r, err := Parse(test.code)
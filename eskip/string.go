@@ -6,6 +6,7 @@ import (
 	"io"
 	"math"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -215,6 +216,10 @@ func lbBackendString(r *Route) string {
 		b.WriteByte('"')
 		b.WriteString(ep)
 		b.WriteByte('"')
+		if i < len(r.LBEndpointWeights) {
+			b.WriteByte(':')
+			b.WriteString(strconv.FormatFloat(r.LBEndpointWeights[i], 'f', -1, 64))
+		}
 	}
 	b.WriteByte('>')
 	return b.String()
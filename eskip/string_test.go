@@ -120,6 +120,9 @@ func TestRouteString(t *testing.T) {
 	}, {
 		&Route{Method: "GET", LBAlgorithm: "random", BackendType: LBBackend, LBEndpoints: []string{"http://127.0.0.1:9997", "http://127.0.0.1:9998"}},
 		`Method("GET") -> <random, "http://127.0.0.1:9997", "http://127.0.0.1:9998">`,
+	}, {
+		&Route{Method: "GET", LBAlgorithm: "random", BackendType: LBBackend, LBEndpoints: []string{"http://127.0.0.1:9997", "http://127.0.0.1:9998"}, LBEndpointWeights: []float64{3, 0.5}},
+		`Method("GET") -> <random, "http://127.0.0.1:9997":3, "http://127.0.0.1:9998":0.5>`,
 	}, {
 		// test slash escaping
 		&Route{Path: `/`, PathRegexps: []string{`/`}, Filters: []*Filter{{"afilter", []interface{}{`/`}}}, BackendType: ShuntBackend},
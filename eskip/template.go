@@ -9,15 +9,25 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 
 	snet "github.com/zalando/skipper/net"
 )
 
 var placeholderRegexp = regexp.MustCompile(`\$\{([^{}]+)\}`)
 
+var (
+	templateResolversMu sync.RWMutex
+	templateResolvers   = make(map[string]TemplateResolver)
+)
+
 // TemplateGetter functions return the value for a template parameter name.
 type TemplateGetter func(string) string
 
+// TemplateResolver functions return the value of the request placeholders
+// registered with a prefix, by the name following the prefix.
+type TemplateResolver func(r *http.Request, name string) string
+
 // Template represents a string template with named placeholders.
 type Template struct {
 	template     string
@@ -32,6 +42,29 @@ type TemplateContext interface {
 	Response() *http.Response
 }
 
+// RegisterTemplateResolver registers the resolver of the placeholders with
+// the prefix, e.g. request.proxyProtocol., so that the packages providing
+// request values, like the listeners, don't need to be imported by eskip.
+// It is meant to be called from the init function of these packages.
+func RegisterTemplateResolver(prefix string, resolve TemplateResolver) {
+	templateResolversMu.Lock()
+	defer templateResolversMu.Unlock()
+	templateResolvers[prefix] = resolve
+}
+
+func resolveRegistered(r *http.Request, key string) (string, bool) {
+	templateResolversMu.RLock()
+	defer templateResolversMu.RUnlock()
+
+	for prefix, resolve := range templateResolvers {
+		if name := strings.TrimPrefix(key, prefix); name != key {
+			return resolve(r, name), true
+		}
+	}
+
+	return "", false
+}
+
 // New parses a template string and returns a reusable *Template object.
 // The template string can contain named placeholders of the format:
 //
@@ -67,6 +100,9 @@ func (t *Template) ApplyContext(ctx TemplateContext) (string, bool) {
 		if q := strings.TrimPrefix(key, "request.query."); q != key {
 			return ctx.Request().URL.Query().Get(q)
 		}
+		if v, ok := resolveRegistered(ctx.Request(), key); ok {
+			return v
+		}
 		if c := strings.TrimPrefix(key, "request.cookie."); c != key {
 			if cookie, err := ctx.Request().Cookie(c); err == nil {
 				return cookie.Value
@@ -373,3 +373,14 @@ func TestTemplateApplyContext(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplateRegisteredResolver(t *testing.T) {
+	RegisterTemplateResolver("request.test.", func(r *http.Request, name string) string {
+		return r.Method + ":" + name
+	})
+
+	ctx := &filtertest.Context{FRequest: &http.Request{Method: "GET"}}
+	if v, ok := NewTemplate("${request.test.foo}").ApplyContext(ctx); !ok || v != "GET:foo" {
+		t.Errorf("unexpected result: %q, %v", v, ok)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Package activehealthcheck provides the activeHealthCheck filter, which
+configures the active health checks of the endpoints of the route. The
+checks are made by the loadbalancer.ActiveHealthChecker, and the unhealthy
+endpoints of load balanced backends are skipped by the load balancer.
+
+The filter takes the path of the health check requests, and optionally
+further options and a regular expression that the response body needs to
+match:
+
+	activeHealthCheck("/healthz")
+	activeHealthCheck("/healthz", "interval=5s,timeout=500ms,healthy=2,unhealthy=3")
+	activeHealthCheck("/status", "method=HEAD,status=200-299")
+	activeHealthCheck("/status", "", "UP|OK")
+
+The options are a comma separated list of key=value pairs:
+
+  - method: the method of the health check requests, GET by default.
+  - status: the expected response status code, or an inclusive range of
+    them, 200-399 by default.
+  - interval: the period of the health checks, 10s by default.
+  - timeout: the timeout of a single health check, 1s by default.
+  - healthy: the number of consecutive successful checks, after which an
+    unhealthy endpoint becomes healthy again, 2 by default.
+  - unhealthy: the number of consecutive failed checks, after which a healthy
+    endpoint becomes unhealthy, 3 by default.
+*/
+package activehealthcheck
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/loadbalancer"
+)
+
+type spec struct{}
+
+type filter struct {
+	check loadbalancer.HealthCheck
+}
+
+// NewActiveHealthCheck creates the filter specification of the
+// activeHealthCheck filter.
+func NewActiveHealthCheck() filters.Spec {
+	return spec{}
+}
+
+func (spec) Name() string { return filters.ActiveHealthCheckName }
+
+func parseStatus(s string, hc *loadbalancer.HealthCheck) error {
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+
+	var err error
+	if hc.MinStatus, err = strconv.Atoi(lo); err != nil {
+		return fmt.Errorf("invalid health check status: %q", s)
+	}
+
+	if hc.MaxStatus, err = strconv.Atoi(hi); err != nil {
+		return fmt.Errorf("invalid health check status: %q", s)
+	}
+
+	if hc.MinStatus < 100 || hc.MaxStatus > 599 || hc.MinStatus > hc.MaxStatus {
+		return fmt.Errorf("invalid health check status: %q", s)
+	}
+
+	return nil
+}
+
+func parsePositive(key, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid health check %s: %q", key, value)
+	}
+
+	return n, nil
+}
+
+func parseDuration(key, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid health check %s: %q", key, value)
+	}
+
+	return d, nil
+}
+
+func parseOptions(s string, hc *loadbalancer.HealthCheck) error {
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(o, "=")
+		if !ok {
+			return fmt.Errorf("invalid health check option: %q", o)
+		}
+
+		var err error
+		switch key {
+		case "method":
+			switch value = strings.ToUpper(value); value {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				hc.Method = value
+			default:
+				return fmt.Errorf("invalid health check method: %q", value)
+			}
+		case "status":
+			err = parseStatus(value, hc)
+		case "interval":
+			hc.Interval, err = parseDuration(key, value)
+		case "timeout":
+			hc.Timeout, err = parseDuration(key, value)
+		case "healthy":
+			hc.HealthyThreshold, err = parsePositive(key, value)
+		case "unhealthy":
+			hc.UnhealthyThreshold, err = parsePositive(key, value)
+		default:
+			return fmt.Errorf("invalid health check option: %q", o)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var hc loadbalancer.HealthCheck
+	path, ok := args[0].(string)
+	if !ok || !strings.HasPrefix(path, "/") {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	hc.Path = path
+
+	if len(args) > 1 {
+		options, ok := args[1].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if err := parseOptions(options, &hc); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		body, ok := args[2].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		rx, err := regexp.Compile(body)
+		if err != nil {
+			return nil, err
+		}
+
+		hc.Body = rx
+	}
+
+	return &filter{check: hc}, nil
+}
+
+func (*filter) Request(filters.FilterContext)  {}
+func (*filter) Response(filters.FilterContext) {}
+
+// HealthCheck implements loadbalancer.HealthCheckFilter.
+func (f *filter) HealthCheck() loadbalancer.HealthCheck {
+	return f.check
+}
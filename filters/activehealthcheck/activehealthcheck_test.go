@@ -0,0 +1,119 @@
+package activehealthcheck
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/loadbalancer"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		args     []interface{}
+		expected loadbalancer.HealthCheck
+		body     string
+		err      bool
+	}{{
+		title: "no args",
+		err:   true,
+	}, {
+		title: "invalid path",
+		args:  []interface{}{"healthz"},
+		err:   true,
+	}, {
+		title: "path not a string",
+		args:  []interface{}{42.0},
+		err:   true,
+	}, {
+		title:    "path only",
+		args:     []interface{}{"/healthz"},
+		expected: loadbalancer.HealthCheck{Path: "/healthz"},
+	}, {
+		title: "all options",
+		args:  []interface{}{"/healthz?full=true", "method=head, status=200-299, interval=5s, timeout=500ms, healthy=1, unhealthy=4"},
+		expected: loadbalancer.HealthCheck{
+			Path:               "/healthz?full=true",
+			Method:             "HEAD",
+			MinStatus:          200,
+			MaxStatus:          299,
+			Interval:           5 * time.Second,
+			Timeout:            500 * time.Millisecond,
+			HealthyThreshold:   1,
+			UnhealthyThreshold: 4,
+		},
+	}, {
+		title:    "single status",
+		args:     []interface{}{"/healthz", "status=204"},
+		expected: loadbalancer.HealthCheck{Path: "/healthz", MinStatus: 204, MaxStatus: 204},
+	}, {
+		title:    "body",
+		args:     []interface{}{"/healthz", "", "UP|OK"},
+		expected: loadbalancer.HealthCheck{Path: "/healthz"},
+		body:     "UP|OK",
+	}, {
+		title: "unknown option",
+		args:  []interface{}{"/healthz", "foo=bar"},
+		err:   true,
+	}, {
+		title: "invalid option",
+		args:  []interface{}{"/healthz", "interval"},
+		err:   true,
+	}, {
+		title: "invalid method",
+		args:  []interface{}{"/healthz", "method=POST"},
+		err:   true,
+	}, {
+		title: "invalid status",
+		args:  []interface{}{"/healthz", "status=2xx"},
+		err:   true,
+	}, {
+		title: "invalid status range",
+		args:  []interface{}{"/healthz", "status=299-200"},
+		err:   true,
+	}, {
+		title: "invalid interval",
+		args:  []interface{}{"/healthz", "interval=0s"},
+		err:   true,
+	}, {
+		title: "invalid threshold",
+		args:  []interface{}{"/healthz", "healthy=0"},
+		err:   true,
+	}, {
+		title: "invalid body",
+		args:  []interface{}{"/healthz", "", "("},
+		err:   true,
+	}, {
+		title: "too many args",
+		args:  []interface{}{"/healthz", "", "", ""},
+		err:   true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			f, err := NewActiveHealthCheck().CreateFilter(test.args)
+			if test.err {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hc := f.(loadbalancer.HealthCheckFilter).HealthCheck()
+			if test.body != "" {
+				if hc.Body == nil || hc.Body.String() != test.body {
+					t.Errorf("unexpected body: %v", hc.Body)
+				}
+
+				hc.Body = nil
+			}
+
+			if hc != test.expected {
+				t.Errorf("expected: %+v, got: %+v", test.expected, hc)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/zalando/skipper/filters"
+	pauth "github.com/zalando/skipper/predicates/auth"
+)
+
+// ForwardClientCertHeader is the default header of the forwardClientCert
+// filter.
+const ForwardClientCertHeader = "X-Forwarded-Client-Cert"
+
+type (
+	forwardClientCertSpec   struct{}
+	forwardClientCertFilter struct {
+		headerName string
+	}
+)
+
+// NewForwardClientCert creates a filter to forward the verified client
+// certificate of the request to the backend server.
+//
+// The filter sets the X-Forwarded-Client-Cert header, in the format used
+// by Envoy, to the SHA-256 fingerprint, the subject and the subject
+// alternative names of the certificate, e.g.:
+//
+//	Hash=9c4f...;Subject="CN=partner-a,O=Example";URI=spiffe://example.org/partner-a;DNS=partner-a.example.org
+//
+// The header received from the client is always removed. The name of the
+// header can be set by the optional argument of the filter. When the TLS
+// client authentication is enabled, the proxy removes the default header
+// from all the incoming requests, also on the routes without the filter.
+func NewForwardClientCert() filters.Spec {
+	return &forwardClientCertSpec{}
+}
+
+func (*forwardClientCertSpec) Name() string {
+	return filters.ForwardClientCertName
+}
+
+func (*forwardClientCertSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) > 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	headerName := ForwardClientCertHeader
+	if len(args) == 1 {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if !httpguts.ValidHeaderFieldName(s) {
+			return nil, fmt.Errorf("header name %s in invalid", s)
+		}
+
+		headerName = s
+	}
+
+	return &forwardClientCertFilter{headerName: headerName}, nil
+}
+
+// clientCertValue quotes the values containing the separators of the
+// header, and removes the control characters.
+func clientCertValue(s string, quote bool) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+
+		return r
+	}, s)
+
+	if !quote && !strings.ContainsAny(s, ",;=\"\\ ") {
+		return s
+	}
+
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func (f *forwardClientCertFilter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	req.Header.Del(f.headerName)
+
+	cert, ok := pauth.VerifiedClientCert(req)
+	if !ok {
+		return
+	}
+
+	hash := sha256.Sum256(cert.Raw)
+	elements := []string{
+		"Hash=" + hex.EncodeToString(hash[:]),
+		"Subject=" + clientCertValue(cert.Subject.String(), true),
+	}
+
+	for _, u := range cert.URIs {
+		elements = append(elements, "URI="+clientCertValue(u.String(), false))
+	}
+
+	for _, name := range cert.DNSNames {
+		elements = append(elements, "DNS="+clientCertValue(name, false))
+	}
+
+	for _, email := range cert.EmailAddresses {
+		elements = append(elements, "Email="+clientCertValue(email, false))
+	}
+
+	for _, ip := range cert.IPAddresses {
+		elements = append(elements, "IP="+ip.String())
+	}
+
+	req.Header.Set(f.headerName, strings.Join(elements, ";"))
+}
+
+func (*forwardClientCertFilter) Response(filters.FilterContext) {}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestForwardClientCertArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		{42.0},
+		{"X Invalid"},
+		{"X-Client-Cert", "X-Client-Cert"},
+	} {
+		if _, err := NewForwardClientCert().CreateFilter(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+}
+
+func TestForwardClientCert(t *testing.T) {
+	cert := &x509.Certificate{
+		Raw:         []byte("certificate"),
+		Subject:     pkix.Name{CommonName: `partner "a"`, Organization: []string{"Example; Inc"}},
+		DNSNames:    []string{"partner-a.example.org", "evil.example.org;Hash=0"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+		URIs:        []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/partner-a"}},
+	}
+
+	hash := sha256.Sum256(cert.Raw)
+	expected := "Hash=" + hex.EncodeToString(hash[:]) +
+		`;Subject="CN=partner \\\"a\\\",O=Example\\; Inc"` +
+		";URI=spiffe://example.org/partner-a" +
+		";DNS=partner-a.example.org" +
+		`;DNS="evil.example.org;Hash=0"` +
+		";IP=192.0.2.1"
+
+	for _, tc := range []struct {
+		title    string
+		args     []interface{}
+		header   string
+		state    *tls.ConnectionState
+		expected string
+	}{{
+		title:    "verified certificate",
+		header:   ForwardClientCertHeader,
+		state:    &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		expected: expected,
+	}, {
+		title:  "unverified certificate",
+		header: ForwardClientCertHeader,
+		state:  &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+	}, {
+		title:  "no TLS",
+		header: ForwardClientCertHeader,
+	}, {
+		title:    "custom header",
+		args:     []interface{}{"X-Client-Cert"},
+		header:   "X-Client-Cert",
+		state:    &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		expected: expected,
+	}} {
+		t.Run(tc.title, func(t *testing.T) {
+			f, err := NewForwardClientCert().CreateFilter(tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := &http.Request{
+				Header: http.Header{tc.header: []string{"Hash=spoofed"}},
+				TLS:    tc.state,
+			}
+
+			f.Request(&filtertest.Context{FRequest: req})
+			if h := req.Header.Get(tc.header); h != tc.expected {
+				t.Errorf("unexpected header, got: %s, expected: %s", h, tc.expected)
+			}
+		})
+	}
+}
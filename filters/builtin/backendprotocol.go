@@ -0,0 +1,49 @@
+package builtin
+
+import (
+	"github.com/zalando/skipper/filters"
+)
+
+type backendProtocol struct {
+	protocol string
+}
+
+// NewBackendProtocol creates a filter specification, whose instances
+// select the protocol of the backend roundtrip:
+//
+//   - http1: HTTP/1.1, the default
+//   - h2: HTTP/2 over TLS, requires an https backend
+//   - h2c: HTTP/2 without TLS with prior knowledge, requires an http backend
+//
+// The protocols use separate connection pools. Example:
+//
+//	grpc: * -> backendProtocol("h2c") -> "http://10.2.0.1:8080";
+func NewBackendProtocol() filters.Spec {
+	return &backendProtocol{}
+}
+
+func (*backendProtocol) Name() string { return filters.BackendProtocolName }
+
+func (*backendProtocol) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	protocol, ok := args[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	switch protocol {
+	case "http1", "h2", "h2c":
+		return &backendProtocol{protocol: protocol}, nil
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+}
+
+func (f *backendProtocol) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.BackendProtocol] = f.protocol
+}
+
+func (*backendProtocol) Response(filters.FilterContext) {}
@@ -0,0 +1,35 @@
+package builtin
+
+import (
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestBackendProtocol(t *testing.T) {
+	spec := NewBackendProtocol()
+	for _, args := range [][]interface{}{
+		nil,
+		{"h3"},
+		{42.0},
+		{"h2", "h2c"},
+	} {
+		if _, err := spec.CreateFilter(args); err == nil {
+			t.Errorf("failed to fail: %v", args)
+		}
+	}
+
+	for _, protocol := range []string{"http1", "h2", "h2c"} {
+		f, err := spec.CreateFilter([]interface{}{protocol})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+		if ctx.FStateBag[filters.BackendProtocol] != protocol {
+			t.Errorf("expected %s, got: %v", protocol, ctx.FStateBag[filters.BackendProtocol])
+		}
+	}
+}
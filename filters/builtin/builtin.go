@@ -6,21 +6,29 @@ package builtin
 import (
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/filters/activehealthcheck"
 	"github.com/zalando/skipper/filters/auth"
 	"github.com/zalando/skipper/filters/circuit"
+	"github.com/zalando/skipper/filters/coalesce"
 	"github.com/zalando/skipper/filters/consistenthash"
 	"github.com/zalando/skipper/filters/cookie"
 	"github.com/zalando/skipper/filters/cors"
 	"github.com/zalando/skipper/filters/diag"
 	"github.com/zalando/skipper/filters/fadein"
+	"github.com/zalando/skipper/filters/fallback"
 	"github.com/zalando/skipper/filters/flowid"
+	"github.com/zalando/skipper/filters/grpc"
+	"github.com/zalando/skipper/filters/hedge"
 	logfilter "github.com/zalando/skipper/filters/log"
+	"github.com/zalando/skipper/filters/requestbody"
+	"github.com/zalando/skipper/filters/retry"
 	"github.com/zalando/skipper/filters/rfc"
 	"github.com/zalando/skipper/filters/scheduler"
 	"github.com/zalando/skipper/filters/sed"
 	"github.com/zalando/skipper/filters/tee"
 	"github.com/zalando/skipper/filters/tracing"
 	"github.com/zalando/skipper/filters/xforward"
+	"github.com/zalando/skipper/filters/zone"
 	"github.com/zalando/skipper/script"
 )
 
@@ -158,6 +166,9 @@ func Filters() []filters.Spec {
 		NewBackendTimeout(),
 		NewReadTimeout(),
 		NewWriteTimeout(),
+		NewBackendProtocol(),
+		grpc.NewGRPC(),
+		grpc.NewGRPCWeb(),
 		NewSetDynamicBackendHostFromHeader(),
 		NewSetDynamicBackendSchemeFromHeader(),
 		NewSetDynamicBackendUrlFromHeader(),
@@ -214,6 +225,7 @@ func Filters() []filters.Spec {
 		accesslog.NewEnableAccessLog(),
 		auth.NewForwardToken(),
 		auth.NewForwardTokenField(),
+		auth.NewForwardClientCert(),
 		scheduler.NewFifo(),
 		scheduler.NewLIFO(),
 		scheduler.NewLIFOGroup(),
@@ -221,8 +233,15 @@ func Filters() []filters.Spec {
 		rfc.NewHost(),
 		fadein.NewFadeIn(),
 		fadein.NewEndpointCreated(),
+		zone.NewEndpointZone(),
 		consistenthash.NewConsistentHashKey(),
 		consistenthash.NewConsistentHashBalanceFactor(),
+		retry.NewRetry(),
+		hedge.NewHedge(),
+		activehealthcheck.NewActiveHealthCheck(),
+		fallback.NewFallback(),
+		coalesce.NewCoalesce(),
+		requestbody.NewMaxRequestBody(),
 	}
 }
 
@@ -0,0 +1,801 @@
+/*
+Package cache provides the cache filter, which caches the responses of the
+backends, following the HTTP caching semantics of a shared cache, as
+described in RFC 9111.
+
+The responses are stored in a Store shared by the filters, either in memory,
+bounded by the size of the cached responses, or in Redis. The filter takes
+an optional key template, and optional options:
+
+	cache()
+	cache("${request.host}${request.path}")
+	cache("", "ttl=1m,max-ttl=1h,max-body=1048576,wait=5s")
+
+The default key template is ${request.host}${request.path}?${request.rawQuery}.
+The responses varying on request headers, as listed by the Vary response
+header, are stored for each variant.
+
+The options are a comma separated list of key=value pairs:
+
+  - ttl: the freshness lifetime of the responses without explicit freshness
+    information, instead of the heuristic freshness based on Last-Modified.
+  - max-ttl: the maximum freshness lifetime of the responses.
+  - max-body: the maximum size of the cached response bodies in bytes,
+    1048576 by default.
+  - wait: how long the concurrent requests of a missing or stale response
+    wait for the response of the first one, before sending their own backend
+    request, 5s by default.
+
+Only the responses of the GET requests are cached. The stale responses are
+revalidated using the ETag and Last-Modified headers, and served, when the
+Cache-Control response header allows it with stale-while-revalidate, while
+revalidating them in the background, or with stale-if-error, when the backend
+request failed. The successful unsafe requests, e.g. POST, invalidate the
+cached response of the same key.
+*/
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/inflight"
+	"github.com/zalando/skipper/metrics"
+)
+
+const (
+	// DefaultMaxBodyBytes is the default maximum size of the cached
+	// response bodies.
+	DefaultMaxBodyBytes = 1 << 20
+
+	// DefaultWait is the default time, that the concurrent requests of a
+	// missing response wait for the response of the first request.
+	DefaultWait = 5 * time.Second
+
+	defaultKeyTemplate = "${request.host}${request.path}?${request.rawQuery}"
+
+	// revalidationWindow is how long the responses with validators are
+	// stored after they became stale, so that they can be revalidated.
+	revalidationWindow = time.Hour
+
+	stateBagKey   = "cache"
+	revalidateKey = "cache:revalidate"
+)
+
+// skipOnUpdate are the headers of a 304 response that don't update the
+// stored response, see RFC 9111 3.2.
+var skipOnUpdate = map[string]bool{
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Content-Range":     true,
+	"Transfer-Encoding": true,
+}
+
+// notModifiedHeaders are the headers of the stored response that are sent
+// in a 304 response, see RFC 9110 15.4.5.
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary"}
+
+// Options configure the cache registry.
+type Options struct {
+	// Store stores the cached responses.
+	Store Store
+
+	// Metrics collects the hit and miss counts.
+	Metrics metrics.Metrics
+}
+
+// Registry holds the store of the cached responses and the in-flight
+// backend requests, shared by the cache filters. It implements the purge
+// endpoint of the support listener.
+type Registry struct {
+	store   Store
+	metrics metrics.Metrics
+
+	// in-flight backend requests of the missing or stale responses
+	inflight *inflight.Group
+}
+
+// entry is a cached response, or, when VaryID is set, a pointer to the
+// variants of the response.
+type entry struct {
+	Status       int           `json:"status,omitempty"`
+	Header       http.Header   `json:"header,omitempty"`
+	Body         []byte        `json:"body,omitempty"`
+	ResponseTime time.Time     `json:"responseTime"`
+	InitialAge   time.Duration `json:"initialAge,omitempty"`
+	Lifetime     time.Duration `json:"lifetime,omitempty"`
+	Vary         []string      `json:"vary,omitempty"`
+	VaryID       string        `json:"varyId,omitempty"`
+	Variants     []string      `json:"variants,omitempty"`
+}
+
+type spec struct {
+	registry *Registry
+}
+
+type filter struct {
+	registry *Registry
+	key      *eskip.Template
+	ttl      time.Duration
+	maxTTL   time.Duration
+	maxBody  int64
+	wait     time.Duration
+}
+
+// state is the cache state of a request, that is sent to the backend.
+type state struct {
+	key         string
+	call        *inflight.Call
+	stale       *entry
+	conditional bool
+	invalidate  bool
+	directives  directives
+}
+
+// NewRegistry creates a registry with the store.
+func NewRegistry(o Options) *Registry {
+	m := o.Metrics
+	if m == nil {
+		m = metrics.Default
+	}
+
+	return &Registry{
+		store:    o.Store,
+		metrics:  m,
+		inflight: inflight.NewGroup(),
+	}
+}
+
+// NewCache creates the filter specification of the cache filter, storing
+// the responses in the registry.
+func NewCache(r *Registry) filters.Spec {
+	return spec{registry: r}
+}
+
+func (spec) Name() string { return filters.CacheName }
+
+func parseOptions(s string, f *filter) error {
+	return inflight.ParseOptions("cache", s, func(key, value string) (err error) {
+		switch key {
+		case "ttl":
+			f.ttl, err = inflight.ParseDuration("cache", key, value)
+		case "max-ttl":
+			f.maxTTL, err = inflight.ParseDuration("cache", key, value)
+		case "wait":
+			f.wait, err = inflight.ParseDuration("cache", key, value)
+		case "max-body":
+			f.maxBody, err = inflight.ParseSize("cache", key, value)
+		default:
+			err = inflight.UnknownOption("cache", key)
+		}
+
+		return
+	})
+}
+
+func (s spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{
+		registry: s.registry,
+		maxBody:  DefaultMaxBodyBytes,
+		wait:     DefaultWait,
+	}
+
+	key := defaultKeyTemplate
+	if len(args) > 0 {
+		k, ok := args[0].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if k != "" {
+			key = k
+		}
+	}
+
+	f.key = eskip.NewTemplate(key)
+
+	if len(args) > 1 {
+		o, ok := args[1].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if err := parseOptions(o, f); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (r *Registry) inc(result string) {
+	r.metrics.IncCounter("cache." + result)
+}
+
+func (r *Registry) get(ctx context.Context, key string) (*entry, error) {
+	b, err := r.store.Get(ctx, key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var e entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (r *Registry) set(ctx context.Context, key string, e *entry, ttl time.Duration) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return r.store.Set(ctx, key, b, ttl)
+}
+
+func variantKey(key string, vary *entry, req *http.Request) string {
+	h := sha256.New()
+	for _, name := range vary.Vary {
+		fmt.Fprintf(h, "%s:%s\n", name, strings.Join(req.Header.Values(name), ","))
+	}
+
+	return key + "#" + vary.VaryID + "#" + hex.EncodeToString(h.Sum(nil))
+}
+
+func sameNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newVaryID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// lookup returns the cached response of the request.
+func (r *Registry) lookup(ctx context.Context, key string, req *http.Request) (*entry, error) {
+	e, err := r.get(ctx, key)
+	if err != nil || e == nil || e.VaryID == "" {
+		return e, err
+	}
+
+	return r.get(ctx, variantKey(key, e, req))
+}
+
+// save stores the response of the request, and, when it varies on request
+// headers, a pointer to its variants.
+func (r *Registry) save(ctx context.Context, key string, req *http.Request, e *entry) error {
+	ttl := e.storageTTL()
+	if names := inflight.VaryHeaders(e.Header); len(names) > 0 {
+		vary, err := r.get(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if vary == nil || vary.VaryID == "" || !sameNames(vary.Vary, names) {
+			if err := r.deleteVariants(ctx, vary); err != nil {
+				return err
+			}
+
+			vary = &entry{Vary: names, VaryID: newVaryID()}
+		}
+
+		variant := variantKey(key, vary, req)
+		if !contains(vary.Variants, variant) {
+			vary.Variants = append(vary.Variants, variant)
+		}
+
+		if err := r.set(ctx, key, vary, ttl); err != nil {
+			return err
+		}
+
+		key = variant
+	}
+
+	return r.set(ctx, key, e, ttl)
+}
+
+// deleteVariants removes the stored variants of a response, when e is the
+// pointer to them.
+func (r *Registry) deleteVariants(ctx context.Context, e *entry) error {
+	if e == nil {
+		return nil
+	}
+
+	for _, key := range e.Variants {
+		if err := r.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Purge removes the cached response of the key, including all its variants.
+func (r *Registry) Purge(ctx context.Context, key string) error {
+	e, err := r.get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if err := r.deleteVariants(ctx, e); err != nil {
+		return err
+	}
+
+	return r.store.Delete(ctx, key)
+}
+
+// ServeHTTP purges the cached response of the key set in the key query
+// parameter of DELETE requests.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := req.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.Purge(req.Context(), key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	age := e.InitialAge + now.Sub(e.ResponseTime)
+	if age < 0 {
+		return 0
+	}
+
+	return age
+}
+
+// fresh tells whether the response can be served without revalidation,
+// considering the request directives, see RFC 9111 4.2 and 5.2.1.
+func (e *entry) fresh(now time.Time, req directives) bool {
+	d := parseDirectives(e.Header)
+	if d.has("no-cache") {
+		return false
+	}
+
+	age := e.age(now)
+	if maxAge, ok := req.seconds("max-age"); ok && age > maxAge {
+		return false
+	}
+
+	if minFresh, ok := req.seconds("min-fresh"); ok && e.Lifetime-age < minFresh {
+		return false
+	}
+
+	if age < e.Lifetime {
+		return true
+	}
+
+	if d.has("must-revalidate") || d.has("proxy-revalidate") || d.has("s-maxage") {
+		return false
+	}
+
+	maxStale, ok := req["max-stale"]
+	if !ok {
+		return false
+	}
+
+	if maxStale == "" {
+		return true
+	}
+
+	s, _ := req.seconds("max-stale")
+	return age-e.Lifetime <= s
+}
+
+// staleFor tells whether the stale response can be served according to the
+// directive, stale-while-revalidate or stale-if-error, see RFC 5861.
+func (e *entry) staleFor(now time.Time, directive string) bool {
+	d := parseDirectives(e.Header)
+	if d.has("no-cache") || d.has("must-revalidate") || d.has("proxy-revalidate") || d.has("s-maxage") {
+		return false
+	}
+
+	s, ok := d.seconds(directive)
+	return ok && e.age(now) < e.Lifetime+s
+}
+
+// staleness returns how long the response can be served stale.
+func (e *entry) staleness() time.Duration {
+	d := parseDirectives(e.Header)
+
+	var stale time.Duration
+	for _, name := range []string{"stale-while-revalidate", "stale-if-error"} {
+		if s, ok := d.seconds(name); ok && s > stale {
+			stale = s
+		}
+	}
+
+	return stale
+}
+
+// reusable tells whether the response can be served from the cache in any
+// way.
+func (e *entry) reusable() bool {
+	return e.Lifetime > 0 || e.staleness() > 0 || hasValidators(e.Header)
+}
+
+// storageTTL returns how long the response is stored.
+func (e *entry) storageTTL() time.Duration {
+	ttl := e.Lifetime + e.staleness()
+	if hasValidators(e.Header) {
+		ttl += revalidationWindow
+	}
+
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	return ttl
+}
+
+// response creates the response served from the cache. It is a 304
+// response, when the conditional request matches the cached response.
+func (e *entry) response(req *http.Request, now time.Time) *http.Response {
+	rsp := &http.Response{
+		StatusCode: e.Status,
+		Header:     e.Header.Clone(),
+		Request:    req,
+	}
+
+	if rsp.Header == nil {
+		rsp.Header = make(http.Header)
+	}
+
+	rsp.Header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	if e.notModified(req) {
+		h := make(http.Header)
+		for _, name := range append(notModifiedHeaders, "Age") {
+			if v := rsp.Header.Values(name); len(v) > 0 {
+				h[name] = v
+			}
+		}
+
+		rsp.StatusCode = http.StatusNotModified
+		rsp.Header = h
+		rsp.Body = http.NoBody
+		return rsp
+	}
+
+	rsp.ContentLength = int64(len(e.Body))
+	rsp.Header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	rsp.Body = io.NopCloser(bytes.NewReader(e.Body))
+	return rsp
+}
+
+// notModified tells whether the conditional request matches the cached
+// response, see RFC 9110 13.2.2.
+func (e *entry) notModified(req *http.Request) bool {
+	if e.Status != http.StatusOK {
+		return false
+	}
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, e.Header.Get("ETag"))
+	}
+
+	ims, ok := parseTime(req.Header, "If-Modified-Since")
+	if !ok {
+		return false
+	}
+
+	lastModified, ok := parseTime(e.Header, "Last-Modified")
+	return ok && !lastModified.After(ims)
+}
+
+func hasConditionals(h http.Header) bool {
+	return h.Get("If-None-Match") != "" || h.Get("If-Modified-Since") != "" ||
+		h.Get("If-Match") != "" || h.Get("If-Unmodified-Since") != "" || h.Get("If-Range") != ""
+}
+
+// initialAge returns the age of the response, when it was received, see
+// RFC 9111 4.2.3.
+func initialAge(h http.Header, responseTime time.Time) time.Duration {
+	var age time.Duration
+	if s, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && s > 0 {
+		age = time.Duration(s) * time.Second
+	}
+
+	if date, ok := parseTime(h, "Date"); ok && responseTime.Sub(date) > age {
+		age = responseTime.Sub(date)
+	}
+
+	return age
+}
+
+func (f *filter) lifetime(status int, h http.Header, d directives, responseTime time.Time) time.Duration {
+	lifetime := freshnessLifetime(status, h, d, responseTime, f.ttl)
+	if f.maxTTL > 0 && lifetime > f.maxTTL {
+		lifetime = f.maxTTL
+	}
+
+	return lifetime
+}
+
+func setResponse(rsp *http.Response, from *http.Response) {
+	if rsp.Body != nil {
+		rsp.Body.Close()
+	}
+
+	rsp.StatusCode = from.StatusCode
+	rsp.Status = ""
+	rsp.Header = from.Header
+	rsp.ContentLength = from.ContentLength
+	rsp.Body = from.Body
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	key, _ := f.key.ApplyContext(ctx)
+
+	if c, ok := ctx.StateBag()[revalidateKey].(*inflight.Call); ok {
+		f.revalidateRequest(ctx, key, c)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return
+	default:
+		ctx.StateBag()[stateBagKey] = &state{key: key, invalidate: true}
+		return
+	}
+
+	reqDirectives := parseDirectives(req.Header)
+	if reqDirectives.has("no-store") || req.Header.Get("Range") != "" || req.Header.Get("Upgrade") != "" {
+		f.registry.inc("bypass")
+		return
+	}
+
+	e, err := f.registry.lookup(req.Context(), key, req)
+	if err != nil {
+		ctx.Logger().Errorf("Failed to get cached response: %v", err)
+		f.registry.inc("errors")
+	}
+
+	now := time.Now()
+	if e != nil && !reqDirectives.has("no-cache") {
+		if e.fresh(now, reqDirectives) {
+			f.registry.inc("hit")
+			ctx.Serve(e.response(req, now))
+			return
+		}
+
+		if e.staleFor(now, "stale-while-revalidate") {
+			if c, leader := f.registry.inflight.Begin(key, f.wait); leader {
+				f.revalidate(ctx, key, c)
+			}
+
+			f.registry.inc("stale")
+			ctx.Serve(e.response(req, now))
+			return
+		}
+	}
+
+	c, leader := f.registry.inflight.Begin(key, f.wait)
+	if !leader {
+		c.Wait(req.Context(), f.wait)
+		if collapsed, err := f.registry.lookup(req.Context(), key, req); err == nil && collapsed != nil {
+			if now := time.Now(); collapsed.fresh(now, reqDirectives) {
+				f.registry.inc("collapsed")
+				ctx.Serve(collapsed.response(req, now))
+				return
+			}
+		}
+
+		c = nil
+	}
+
+	f.registry.inc("miss")
+	st := &state{key: key, call: c, stale: e, directives: reqDirectives}
+	if e != nil && !hasConditionals(req.Header) {
+		st.conditional = setConditionals(req.Header, e)
+	}
+
+	ctx.StateBag()[stateBagKey] = st
+}
+
+// setConditionals sets the validators of the stale response in the request,
+// so that it can be revalidated.
+func setConditionals(h http.Header, e *entry) bool {
+	var set bool
+	if etag := e.Header.Get("ETag"); etag != "" {
+		h.Set("If-None-Match", etag)
+		set = true
+	}
+
+	if lastModified := e.Header.Get("Last-Modified"); lastModified != "" {
+		h.Set("If-Modified-Since", lastModified)
+		set = true
+	}
+
+	return set
+}
+
+// revalidate sends a copy of the request through the route in the
+// background, to revalidate the stale response.
+func (f *filter) revalidate(ctx filters.FilterContext, key string, c *inflight.Call) {
+	cc, err := ctx.Split()
+	if err != nil {
+		ctx.Logger().Errorf("Failed to revalidate cached response: %v", err)
+		f.registry.inflight.End(key, c, nil)
+		return
+	}
+
+	cc.StateBag()[revalidateKey] = c
+	go cc.Loopback()
+}
+
+func (f *filter) revalidateRequest(ctx filters.FilterContext, key string, c *inflight.Call) {
+	req := ctx.Request()
+	delete(ctx.StateBag(), revalidateKey)
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range"} {
+		req.Header.Del(name)
+	}
+
+	e, err := f.registry.lookup(req.Context(), key, req)
+	if err != nil {
+		ctx.Logger().Errorf("Failed to get cached response: %v", err)
+		f.registry.inc("errors")
+	}
+
+	st := &state{key: key, call: c, stale: e, directives: parseDirectives(req.Header)}
+	if e != nil {
+		st.conditional = setConditionals(req.Header, e)
+	}
+
+	ctx.StateBag()[stateBagKey] = st
+}
+
+func (f *filter) save(ctx filters.FilterContext, key string, e *entry) {
+	req := ctx.Request()
+	if err := f.registry.save(context.Background(), key, req, e); err != nil {
+		ctx.Logger().Errorf("Failed to store cached response: %v", err)
+		f.registry.inc("errors")
+	}
+}
+
+func (f *filter) Response(ctx filters.FilterContext) {
+	st, ok := ctx.StateBag()[stateBagKey].(*state)
+	if !ok {
+		return
+	}
+
+	delete(ctx.StateBag(), stateBagKey)
+
+	req := ctx.Request()
+	rsp := ctx.Response()
+	if st.invalidate {
+		if rsp.StatusCode < http.StatusBadRequest {
+			if err := f.registry.Purge(req.Context(), st.key); err != nil {
+				ctx.Logger().Errorf("Failed to invalidate cached response: %v", err)
+				f.registry.inc("errors")
+			}
+		}
+
+		return
+	}
+
+	if st.conditional {
+		// the validators were set by the filter, not the client
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+	}
+
+	now := time.Now()
+	if st.stale != nil && st.conditional && rsp.StatusCode == http.StatusNotModified {
+		e := *st.stale
+		e.Header = e.Header.Clone()
+		for name, values := range rsp.Header {
+			if !skipOnUpdate[name] {
+				e.Header[name] = values
+			}
+		}
+
+		e.ResponseTime = now
+		e.InitialAge = initialAge(rsp.Header, now)
+		e.Lifetime = f.lifetime(e.Status, e.Header, parseDirectives(e.Header), now)
+		f.save(ctx, st.key, &e)
+		f.registry.inflight.End(st.key, st.call, nil)
+
+		f.registry.inc("revalidated")
+		setResponse(rsp, e.response(req, now))
+		return
+	}
+
+	if st.stale != nil && rsp.StatusCode >= http.StatusInternalServerError && st.stale.staleFor(now, "stale-if-error") {
+		f.registry.inflight.End(st.key, st.call, nil)
+		f.registry.inc("stale")
+		setResponse(rsp, st.stale.response(req, now))
+		return
+	}
+
+	d := parseDirectives(rsp.Header)
+	if !storable(req, st.directives, rsp, d) || rsp.ContentLength > f.maxBody {
+		f.registry.inflight.End(st.key, st.call, nil)
+		return
+	}
+
+	e := &entry{
+		Status:       rsp.StatusCode,
+		Header:       rsp.Header.Clone(),
+		ResponseTime: now,
+		InitialAge:   initialAge(rsp.Header, now),
+		Lifetime:     f.lifetime(rsp.StatusCode, rsp.Header, d, now),
+	}
+
+	if !e.reusable() {
+		f.registry.inflight.End(st.key, st.call, nil)
+		return
+	}
+
+	if rsp.Body == nil || rsp.Body == http.NoBody {
+		f.save(ctx, st.key, e)
+		f.registry.inflight.End(st.key, st.call, nil)
+		return
+	}
+
+	rsp.Body = inflight.NewBody(rsp.Body, f.maxBody, func(body []byte, complete bool) {
+		if complete {
+			e.Body = body
+			f.save(ctx, st.key, e)
+		}
+
+		f.registry.inflight.End(st.key, st.call, nil)
+	})
+}
+
+// HandleErrorResponse enables the filter to serve the stale responses,
+// when the backend request failed.
+func (*filter) HandleErrorResponse() bool { return true }
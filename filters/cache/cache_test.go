@@ -0,0 +1,325 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/inflight/inflighttest"
+	"github.com/zalando/skipper/metrics"
+)
+
+type testCache struct {
+	*inflighttest.Proxy
+	registry *Registry
+}
+
+func newTestCache(t *testing.T, args string, handler http.HandlerFunc) *testCache {
+	t.Helper()
+
+	var registry *Registry
+	p := inflighttest.New(t, func(m metrics.Metrics) filters.Spec {
+		registry = NewRegistry(Options{Store: NewMemoryStore(1 << 20), Metrics: m})
+		return NewCache(registry)
+	}, fmt.Sprintf("cache(%s)", args), handler)
+
+	return &testCache{Proxy: p, registry: registry}
+}
+
+func (c *testCache) get(t *testing.T, path string) (*http.Response, string) {
+	t.Helper()
+	return c.Do(t, http.MethodGet, path, nil)
+}
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		args  []interface{}
+		fail  bool
+	}{
+		{title: "no args"},
+		{title: "key", args: []interface{}{"${request.path}"}},
+		{title: "key not a string", args: []interface{}{42.0}, fail: true},
+		{title: "options", args: []interface{}{"", "ttl=1m, max-ttl=1h, max-body=1024, wait=1s"}},
+		{title: "invalid option", args: []interface{}{"", "ttl"}, fail: true},
+		{title: "unknown option", args: []interface{}{"", "foo=bar"}, fail: true},
+		{title: "invalid ttl", args: []interface{}{"", "ttl=0s"}, fail: true},
+		{title: "invalid max body", args: []interface{}{"", "max-body=-1"}, fail: true},
+		{title: "too many args", args: []interface{}{"", "", ""}, fail: true},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewCache(NewRegistry(Options{Store: NewMemoryStore(1024)})).CreateFilter(test.args)
+			if test.fail && err == nil {
+				t.Error("failed to fail")
+			} else if !test.fail && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCacheHit(t *testing.T) {
+	var n atomic.Int64
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprintf(w, "response %d", n.Add(1))
+	})
+
+	_, b1 := c.get(t, "/countries")
+	rsp, b2 := c.get(t, "/countries")
+	if b1 != "response 1" || b2 != b1 {
+		t.Errorf("unexpected responses: %s, %s", b1, b2)
+	}
+
+	if rsp.Header.Get("Age") == "" {
+		t.Error("missing Age header")
+	}
+
+	_, b3 := c.get(t, "/countries?page=2")
+	if b3 != "response 2" {
+		t.Errorf("unexpected response: %s", b3)
+	}
+
+	c.ExpectRequests(t, 2)
+	c.ExpectCounter(t, "cache.hit", 1)
+	c.ExpectCounter(t, "cache.miss", 2)
+}
+
+func TestCacheNotStored(t *testing.T) {
+	for _, test := range []struct {
+		title  string
+		header http.Header
+		status int
+		body   string
+		args   string
+	}{{
+		title:  "no freshness information",
+		status: http.StatusOK,
+	}, {
+		title:  "no-store",
+		header: http.Header{"Cache-Control": []string{"no-store"}},
+		status: http.StatusOK,
+	}, {
+		title:  "private",
+		header: http.Header{"Cache-Control": []string{"private, max-age=60"}},
+		status: http.StatusOK,
+	}, {
+		title:  "set cookie",
+		header: http.Header{"Cache-Control": []string{"max-age=60"}, "Set-Cookie": []string{"foo=bar"}},
+		status: http.StatusOK,
+	}, {
+		title:  "server error",
+		header: http.Header{"Cache-Control": []string{"max-age=60"}},
+		status: http.StatusInternalServerError,
+	}, {
+		title:  "too large body",
+		header: http.Header{"Cache-Control": []string{"max-age=60"}},
+		status: http.StatusOK,
+		body:   strings.Repeat("x", 64),
+		args:   `"", "max-body=32"`,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			c := newTestCache(t, test.args, func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range test.header {
+					w.Header()[name] = values
+				}
+
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			})
+
+			c.get(t, "/")
+			if _, b := c.get(t, "/"); b != test.body {
+				t.Errorf("unexpected body: %s", b)
+			}
+
+			c.ExpectRequests(t, 2)
+		})
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Write([]byte("language: " + r.Header.Get("Accept-Language")))
+	})
+
+	for _, lang := range []string{"en", "de", "en", "de", ""} {
+		if _, b := c.Do(t, http.MethodGet, "/translations", http.Header{"Accept-Language": []string{lang}}); b != "language: "+lang {
+			t.Errorf("unexpected response for %q: %s", lang, b)
+		}
+	}
+
+	c.ExpectRequests(t, 3)
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write([]byte("config"))
+	})
+
+	for i := 0; i < 3; i++ {
+		if rsp, b := c.get(t, "/config"); rsp.StatusCode != http.StatusOK || b != "config" {
+			t.Errorf("unexpected response: %d %s", rsp.StatusCode, b)
+		}
+	}
+
+	c.ExpectRequests(t, 3)
+	c.ExpectCounter(t, "cache.revalidated", 2)
+}
+
+func TestCacheConditionalRequest(t *testing.T) {
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("config"))
+	})
+
+	c.get(t, "/config")
+	rsp, b := c.Do(t, http.MethodGet, "/config", http.Header{"If-None-Match": []string{`"v1"`}})
+	if rsp.StatusCode != http.StatusNotModified || b != "" || rsp.Header.Get("ETag") != `"v1"` {
+		t.Errorf("unexpected response: %d %s %v", rsp.StatusCode, b, rsp.Header)
+	}
+
+	c.ExpectRequests(t, 1)
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	var fail atomic.Bool
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		w.Write([]byte("bundle"))
+	})
+
+	c.get(t, "/bundle")
+	fail.Store(true)
+	if rsp, b := c.get(t, "/bundle"); rsp.StatusCode != http.StatusOK || b != "bundle" {
+		t.Errorf("unexpected response: %d %s", rsp.StatusCode, b)
+	}
+
+	c.ExpectRequests(t, 2)
+	c.ExpectCounter(t, "cache.stale", 1)
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var n atomic.Int64
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		fmt.Fprintf(w, "response %d", n.Add(1))
+	})
+
+	c.get(t, "/")
+	if _, b := c.get(t, "/"); b != "response 1" {
+		t.Errorf("stale response not served: %s", b)
+	}
+
+	timeout := time.After(time.Second)
+	for {
+		if _, b := c.get(t, "/"); b != "response 1" {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("response not revalidated in the background")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestCacheCollapsedMisses(t *testing.T) {
+	release := make(chan struct{})
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("countries"))
+	})
+
+	const concurrency = 5
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, b := c.get(t, "/countries"); b != "countries" {
+				t.Errorf("unexpected response: %s", b)
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	c.ExpectRequests(t, 1)
+	c.ExpectCounter(t, "cache.collapsed", concurrency-1)
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	c := newTestCache(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	})
+
+	c.get(t, "/items")
+	c.get(t, "/items")
+	c.Do(t, http.MethodPost, "/items", nil)
+	c.get(t, "/items")
+	c.ExpectRequests(t, 3)
+}
+
+func TestCachePurge(t *testing.T) {
+	c := newTestCache(t, `"${request.path}"`, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept")
+	})
+
+	c.get(t, "/items")
+	c.get(t, "/items")
+	c.Do(t, http.MethodGet, "/items", http.Header{"Accept": []string{"text/plain"}})
+	c.ExpectRequests(t, 2)
+
+	for _, test := range []struct {
+		method string
+		query  string
+		status int
+	}{
+		{http.MethodGet, "?key=/items", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "", http.StatusBadRequest},
+		{http.MethodDelete, "?key=/items", http.StatusNoContent},
+	} {
+		w := httptest.NewRecorder()
+		c.registry.ServeHTTP(w, httptest.NewRequest(test.method, "/cache"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected %d, got: %d", test.method, test.query, test.status, w.Code)
+		}
+	}
+
+	store := c.registry.store.(*memoryStore)
+	store.mu.Lock()
+	if len(store.entries) != 0 {
+		t.Errorf("expected the variants to be deleted, got: %d entries", len(store.entries))
+	}
+	store.mu.Unlock()
+
+	c.get(t, "/items")
+	c.ExpectRequests(t, 3)
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters/inflight"
+)
+
+// heuristicFraction is the fraction of the time since the last modification
+// that is used as the freshness lifetime, when the response doesn't have an
+// explicit one, see RFC 9111 4.2.2.
+const heuristicFraction = 10
+
+// maxHeuristicLifetime limits the heuristic freshness lifetime.
+const maxHeuristicLifetime = 24 * time.Hour
+
+// cacheableByDefault are the response statuses that can be stored without
+// explicit freshness information, see RFC 9110 15.1.
+var cacheableByDefault = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// directives are the parsed Cache-Control directives. The directives
+// without a value are stored with an empty value.
+type directives map[string]string
+
+func parseDirectives(h http.Header) directives {
+	d := make(directives)
+	for _, v := range h.Values("Cache-Control") {
+		for _, di := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(di), "=")
+			if name == "" {
+				continue
+			}
+
+			d[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+
+	return d
+}
+
+func (d directives) has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// seconds returns the delta-seconds value of the directive.
+func (d directives) seconds(name string) (time.Duration, bool) {
+	v, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+
+	s, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || s < 0 {
+		// invalid values are treated as stale, see RFC 9111 4.2.1
+		return 0, true
+	}
+
+	return time.Duration(s) * time.Second, true
+}
+
+func parseTime(h http.Header, name string) (time.Time, bool) {
+	v := h.Get(name)
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	t, err := http.ParseTime(v)
+	return t, err == nil
+}
+
+// freshnessLifetime returns the freshness lifetime of the response for a
+// shared cache, see RFC 9111 4.2.1. The defaultTTL is used, when it is not
+// zero, instead of the heuristic freshness, when the response doesn't have an
+// explicit lifetime.
+func freshnessLifetime(status int, h http.Header, d directives, responseTime time.Time, defaultTTL time.Duration) time.Duration {
+	if s, ok := d.seconds("s-maxage"); ok {
+		return s
+	}
+
+	if s, ok := d.seconds("max-age"); ok {
+		return s
+	}
+
+	date, ok := parseTime(h, "Date")
+	if !ok {
+		date = responseTime
+	}
+
+	if h.Get("Expires") != "" {
+		expires, ok := parseTime(h, "Expires")
+		if !ok || !expires.After(date) {
+			return 0
+		}
+
+		return expires.Sub(date)
+	}
+
+	if defaultTTL > 0 {
+		return defaultTTL
+	}
+
+	if lastModified, ok := parseTime(h, "Last-Modified"); ok && cacheableByDefault[status] && lastModified.Before(date) {
+		lifetime := date.Sub(lastModified) / heuristicFraction
+		if lifetime > maxHeuristicLifetime {
+			lifetime = maxHeuristicLifetime
+		}
+
+		return lifetime
+	}
+
+	return 0
+}
+
+// hasExplicitFreshness tells whether the response has explicit freshness
+// information.
+func hasExplicitFreshness(h http.Header, d directives) bool {
+	return d.has("s-maxage") || d.has("max-age") || h.Get("Expires") != ""
+}
+
+// hasValidators tells whether the response can be revalidated.
+func hasValidators(h http.Header) bool {
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+// storable tells whether a shared cache may store the response of the
+// request, see RFC 9111 3. Responses setting cookies are not stored.
+func storable(req *http.Request, reqDirectives directives, rsp *http.Response, d directives) bool {
+	if req.Method != http.MethodGet || reqDirectives.has("no-store") {
+		return false
+	}
+
+	if d.has("no-store") || d.has("private") {
+		return false
+	}
+
+	if rsp.StatusCode == http.StatusPartialContent || rsp.StatusCode == http.StatusNotModified {
+		return false
+	}
+
+	if !cacheableByDefault[rsp.StatusCode] && (rsp.StatusCode >= http.StatusInternalServerError || !hasExplicitFreshness(rsp.Header, d) && !d.has("public")) {
+		return false
+	}
+
+	if req.Header.Get("Authorization") != "" && !d.has("public") && !d.has("s-maxage") && !d.has("must-revalidate") {
+		return false
+	}
+
+	if len(rsp.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	for _, v := range inflight.VaryHeaders(rsp.Header) {
+		if v == "*" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// etagMatches tells whether one of the entity tags in the If-None-Match
+// header matches the etag, using the weak comparison, see RFC 9110 13.1.2.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
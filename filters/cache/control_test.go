@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFreshnessLifetime(t *testing.T) {
+	now := time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		title      string
+		status     int
+		header     http.Header
+		defaultTTL time.Duration
+		expected   time.Duration
+	}{{
+		title:    "no freshness information",
+		status:   http.StatusOK,
+		header:   http.Header{},
+		expected: 0,
+	}, {
+		title:    "max-age",
+		status:   http.StatusOK,
+		header:   http.Header{"Cache-Control": []string{"public, max-age=60"}},
+		expected: time.Minute,
+	}, {
+		title:    "s-maxage takes precedence",
+		status:   http.StatusOK,
+		header:   http.Header{"Cache-Control": []string{"max-age=60, s-maxage=120"}},
+		expected: 2 * time.Minute,
+	}, {
+		title:    "invalid max-age",
+		status:   http.StatusOK,
+		header:   http.Header{"Cache-Control": []string{"max-age=soon"}},
+		expected: 0,
+	}, {
+		title:  "expires",
+		status: http.StatusOK,
+		header: http.Header{
+			"Date":    []string{now.Format(http.TimeFormat)},
+			"Expires": []string{now.Add(time.Hour).Format(http.TimeFormat)},
+		},
+		expected: time.Hour,
+	}, {
+		title:    "invalid expires",
+		status:   http.StatusOK,
+		header:   http.Header{"Expires": []string{"0"}},
+		expected: 0,
+	}, {
+		title:      "default ttl",
+		status:     http.StatusOK,
+		header:     http.Header{"Last-Modified": []string{now.Add(-10 * time.Hour).Format(http.TimeFormat)}},
+		defaultTTL: time.Minute,
+		expected:   time.Minute,
+	}, {
+		title:    "heuristic",
+		status:   http.StatusOK,
+		header:   http.Header{"Last-Modified": []string{now.Add(-10 * time.Hour).Format(http.TimeFormat)}},
+		expected: time.Hour,
+	}, {
+		title:    "limited heuristic",
+		status:   http.StatusOK,
+		header:   http.Header{"Last-Modified": []string{now.Add(-1000 * time.Hour).Format(http.TimeFormat)}},
+		expected: maxHeuristicLifetime,
+	}, {
+		title:    "no heuristic for statuses not cacheable by default",
+		status:   http.StatusCreated,
+		header:   http.Header{"Last-Modified": []string{now.Add(-10 * time.Hour).Format(http.TimeFormat)}},
+		expected: 0,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			lifetime := freshnessLifetime(test.status, test.header, parseDirectives(test.header), now, test.defaultTTL)
+			if lifetime != test.expected {
+				t.Errorf("expected: %v, got: %v", test.expected, lifetime)
+			}
+		})
+	}
+}
+
+func TestStorable(t *testing.T) {
+	for _, test := range []struct {
+		title     string
+		method    string
+		reqHeader http.Header
+		status    int
+		header    http.Header
+		expected  bool
+	}{{
+		title:    "cacheable by default",
+		status:   http.StatusOK,
+		expected: true,
+	}, {
+		title:  "not a GET request",
+		method: http.MethodPost,
+		status: http.StatusOK,
+	}, {
+		title:     "request no-store",
+		reqHeader: http.Header{"Cache-Control": []string{"no-store"}},
+		status:    http.StatusOK,
+	}, {
+		title:  "response no-store",
+		status: http.StatusOK,
+		header: http.Header{"Cache-Control": []string{"no-store"}},
+	}, {
+		title:  "private",
+		status: http.StatusOK,
+		header: http.Header{"Cache-Control": []string{"private, max-age=60"}},
+	}, {
+		title:  "partial content",
+		status: http.StatusPartialContent,
+		header: http.Header{"Cache-Control": []string{"max-age=60"}},
+	}, {
+		title:  "not cacheable by default",
+		status: http.StatusCreated,
+	}, {
+		title:    "explicitly cacheable",
+		status:   http.StatusCreated,
+		header:   http.Header{"Cache-Control": []string{"max-age=60"}},
+		expected: true,
+	}, {
+		title:  "server error",
+		status: http.StatusServiceUnavailable,
+		header: http.Header{"Cache-Control": []string{"max-age=60"}},
+	}, {
+		title:     "authorization",
+		reqHeader: http.Header{"Authorization": []string{"Bearer foo"}},
+		status:    http.StatusOK,
+		header:    http.Header{"Cache-Control": []string{"max-age=60"}},
+	}, {
+		title:     "public with authorization",
+		reqHeader: http.Header{"Authorization": []string{"Bearer foo"}},
+		status:    http.StatusOK,
+		header:    http.Header{"Cache-Control": []string{"public, max-age=60"}},
+		expected:  true,
+	}, {
+		title:  "set cookie",
+		status: http.StatusOK,
+		header: http.Header{"Set-Cookie": []string{"foo=bar"}},
+	}, {
+		title:  "vary all",
+		status: http.StatusOK,
+		header: http.Header{"Vary": []string{"Accept-Encoding, *"}},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			req := &http.Request{Method: method, Header: test.reqHeader}
+			if req.Header == nil {
+				req.Header = http.Header{}
+			}
+
+			rsp := &http.Response{StatusCode: test.status, Header: test.header}
+			if rsp.Header == nil {
+				rsp.Header = http.Header{}
+			}
+
+			if s := storable(req, parseDirectives(req.Header), rsp, parseDirectives(rsp.Header)); s != test.expected {
+				t.Errorf("expected: %v, got: %v", test.expected, s)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	for _, test := range []struct {
+		ifNoneMatch string
+		etag        string
+		expected    bool
+	}{
+		{`"foo"`, `"foo"`, true},
+		{`"bar", "foo"`, `"foo"`, true},
+		{`W/"foo"`, `"foo"`, true},
+		{`"foo"`, `W/"foo"`, true},
+		{`*`, `"foo"`, true},
+		{`"bar"`, `"foo"`, false},
+		{`"foo"`, ``, false},
+	} {
+		if m := etagMatches(test.ifNoneMatch, test.etag); m != test.expected {
+			t.Errorf("%s %s: expected: %v, got: %v", test.ifNoneMatch, test.etag, test.expected, m)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/zalando/skipper/net"
+)
+
+// redisKeyPrefix is the prefix of the keys of the cached responses in Redis.
+const redisKeyPrefix = "skipper.cache."
+
+// Store stores the cached responses.
+type Store interface {
+	// Get returns the value stored with the key, or nil, when there is no
+	// value stored.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Set stores the value with the key, for at most the ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the value stored with the key.
+	Delete(ctx context.Context, key string) error
+}
+
+type (
+	memoryStore struct {
+		maxBytes int64
+		now      func() time.Time
+
+		mu      sync.Mutex
+		bytes   int64
+		entries map[string]*memoryEntry
+		// least recently used entry at the end
+		history *list.List
+	}
+
+	memoryEntry struct {
+		value     []byte
+		expiresAt time.Time
+		// reference in the history
+		href *list.Element
+	}
+)
+
+// NewMemoryStore creates an in-memory store, which removes the least
+// recently used values, when the size of the keys and the values exceeds
+// maxBytes.
+func NewMemoryStore(maxBytes int64) Store {
+	return &memoryStore{
+		maxBytes: maxBytes,
+		now:      time.Now,
+		entries:  make(map[string]*memoryEntry),
+		history:  list.New(),
+	}
+}
+
+func entrySize(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+}
+
+func (s *memoryStore) remove(key string, e *memoryEntry) {
+	delete(s.entries, key)
+	s.history.Remove(e.href)
+	s.bytes -= entrySize(key, e.value)
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	if !now.Before(e.expiresAt) {
+		s.remove(key, e)
+		return nil, nil
+	}
+
+	s.history.MoveToFront(e.href)
+	return e.value, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if entrySize(key, value) > s.maxBytes {
+		return nil
+	}
+
+	expiresAt := s.now().Add(ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.remove(key, e)
+	}
+
+	s.entries[key] = &memoryEntry{
+		value:     value,
+		expiresAt: expiresAt,
+		href:      s.history.PushFront(key),
+	}
+
+	s.bytes += entrySize(key, value)
+	for s.bytes > s.maxBytes {
+		leastUsed := s.history.Back()
+		key := leastUsed.Value.(string)
+		s.remove(key, s.entries[key])
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.remove(key, e)
+	}
+
+	return nil
+}
+
+type redisStore struct {
+	client *net.RedisRingClient
+}
+
+// NewRedisStore creates a store, which stores the values in the Redis
+// ring.
+func NewRedisStore(client *net.RedisRingClient) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.client.Get(ctx, redisKeyPrefix+key)
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(v), nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.client.Set(ctx, redisKeyPrefix+key, value, ttl)
+	return err
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Del(ctx, redisKeyPrefix+key)
+	return err
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/net"
+	"github.com/zalando/skipper/net/redistest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore(15).(*memoryStore)
+	s.now = func() time.Time { return now }
+
+	get := func(key string) string {
+		t.Helper()
+		v, err := s.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(v)
+	}
+
+	s.Set(ctx, "a", []byte("1234"), time.Minute)
+	s.Set(ctx, "b", []byte("1234"), time.Minute)
+	s.Set(ctx, "c", []byte("1234"), time.Minute)
+	if get("a") != "1234" || get("b") != "1234" || get("c") != "1234" {
+		t.Fatal("failed to store values")
+	}
+
+	// a is used again, so b is the least recently used
+	get("a")
+	s.Set(ctx, "d", []byte("1234"), time.Minute)
+	if get("b") != "" {
+		t.Error("least recently used value not removed")
+	}
+
+	if get("a") != "1234" || get("c") != "1234" || get("d") != "1234" {
+		t.Error("unexpected removal")
+	}
+
+	if s.bytes != 15 {
+		t.Errorf("unexpected size: %d", s.bytes)
+	}
+
+	s.Set(ctx, "e", []byte("too large for the store"), time.Minute)
+	if get("e") != "" || get("a") != "1234" {
+		t.Error("unexpected store of too large value")
+	}
+
+	s.Delete(ctx, "a")
+	if get("a") != "" {
+		t.Error("failed to delete")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if get("c") != "" {
+		t.Error("expired value returned")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	redisAddr, done := redistest.NewTestRedis(t)
+	defer done()
+
+	client := net.NewRedisRingClient(&net.RedisOptions{Addrs: []string{redisAddr}})
+	defer client.Close()
+
+	ctx := context.Background()
+	s := NewRedisStore(client)
+
+	if v, err := s.Get(ctx, "foo"); err != nil || v != nil {
+		t.Fatalf("unexpected value: %s, %v", v, err)
+	}
+
+	if err := s.Set(ctx, "foo", []byte("bar"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.Get(ctx, "foo"); err != nil || string(v) != "bar" {
+		t.Fatalf("unexpected value: %s, %v", v, err)
+	}
+
+	if err := s.Delete(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.Get(ctx, "foo"); err != nil || v != nil {
+		t.Fatalf("unexpected value after delete: %s, %v", v, err)
+	}
+}
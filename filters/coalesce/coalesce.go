@@ -0,0 +1,292 @@
+/*
+Package coalesce provides the coalesce filter, which collapses the identical
+concurrent GET requests into a single backend request.
+
+While a request of a key is in flight to the backend, the requests of the
+same key wait for its response, and it is served to all of them. The key is
+built from a template, by default from the method, the host, the path and
+the query of the request:
+
+	coalesce()
+	coalesce("${request.path}:${request.header.Accept-Language}")
+	coalesce("", "max-body=1048576,wait=5s")
+
+Unlike the cache filter, the responses are not stored, only shared with the
+requests that arrived while they were in flight, so the filter works for
+routes whose responses cannot be cached.
+
+The options are a comma separated list of key=value pairs:
+
+  - max-body: the maximum size of the shared response bodies in bytes,
+    1048576 by default.
+  - wait: how long the requests wait for the in-flight request, 5s by
+    default.
+
+The requests with the Authorization or the Cookie header are not coalesced,
+unless the key template contains the header, e.g.
+${request.header.Authorization}, or, for the Cookie header, a cookie, e.g.
+${request.cookie.session}.
+
+When the response varies on request headers, as listed by its Vary header,
+it is shared only with the requests having the same values of these headers
+as the request that received it.
+
+When the response body is larger than the limit, when it cannot be read
+completely, when the response sets cookies, when its Cache-Control header
+contains the private or the no-store directive, when it varies on all the
+request headers (Vary: *), or when the waiting times out, the waiting
+requests are sent to the backend themselves.
+*/
+package coalesce
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/inflight"
+	"github.com/zalando/skipper/metrics"
+)
+
+const (
+	// DefaultMaxBodyBytes is the default maximum size of the shared
+	// response bodies.
+	DefaultMaxBodyBytes = 1 << 20
+
+	// DefaultWait is the default time, that the requests wait for the
+	// in-flight request of the same key.
+	DefaultWait = 5 * time.Second
+
+	defaultKeyTemplate = "${request.method} ${request.host}${request.path}?${request.rawQuery}"
+
+	stateBagKey = "coalesce"
+)
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+
+	// the values of the request headers listed by the Vary header
+	vary http.Header
+}
+
+type spec struct {
+	inflight *inflight.Group
+	metrics  metrics.Metrics
+}
+
+type filter struct {
+	inflight *inflight.Group
+	metrics  metrics.Metrics
+	key      *eskip.Template
+	maxBody  int64
+	wait     time.Duration
+
+	// whether the key contains the credentials of the request
+	keyAuthorization bool
+	keyCookie        bool
+}
+
+type state struct {
+	key    string
+	call   *inflight.Call
+	header http.Header
+}
+
+// NewCoalesce creates the filter specification of the coalesce filter.
+func NewCoalesce() filters.Spec {
+	return &spec{
+		inflight: inflight.NewGroup(),
+		metrics:  metrics.Default,
+	}
+}
+
+func (*spec) Name() string { return filters.CoalesceName }
+
+func parseOptions(s string, f *filter) error {
+	return inflight.ParseOptions("coalesce", s, func(key, value string) (err error) {
+		switch key {
+		case "wait":
+			f.wait, err = inflight.ParseDuration("coalesce", key, value)
+		case "max-body":
+			f.maxBody, err = inflight.ParseSize("coalesce", key, value)
+		default:
+			err = inflight.UnknownOption("coalesce", key)
+		}
+
+		return
+	})
+}
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{
+		inflight: s.inflight,
+		metrics:  s.metrics,
+		maxBody:  DefaultMaxBodyBytes,
+		wait:     DefaultWait,
+	}
+
+	key := defaultKeyTemplate
+	if len(args) > 0 {
+		k, ok := args[0].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if k != "" {
+			key = k
+		}
+	}
+
+	f.key = eskip.NewTemplate(key)
+	lowerKey := strings.ToLower(key)
+	f.keyAuthorization = strings.Contains(lowerKey, "${request.header.authorization}")
+	f.keyCookie = strings.Contains(lowerKey, "${request.header.cookie}") || strings.Contains(lowerKey, "${request.cookie.")
+
+	if len(args) > 1 {
+		o, ok := args[1].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if err := parseOptions(o, f); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (r *response) serve(req *http.Request) *http.Response {
+	return &http.Response{
+		StatusCode:    r.status,
+		Header:        r.header.Clone(),
+		ContentLength: int64(len(r.body)),
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		Request:       req,
+	}
+}
+
+// matches tells whether the request has the same values of the headers
+// listed by the Vary header of the response, as the request that received
+// it.
+func (r *response) matches(req *http.Request) bool {
+	for name, values := range r.vary {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	if req.Method != http.MethodGet || req.ContentLength != 0 {
+		return
+	}
+
+	// the responses of the requests with credentials are shared only
+	// between the requests with the same credentials
+	if !f.keyAuthorization && req.Header.Get("Authorization") != "" ||
+		!f.keyCookie && req.Header.Get("Cookie") != "" {
+		return
+	}
+
+	key, _ := f.key.ApplyContext(ctx)
+	c, leader := f.inflight.Begin(key, f.wait)
+	if leader {
+		ctx.StateBag()[stateBagKey] = &state{key: key, call: c, header: req.Header.Clone()}
+		return
+	}
+
+	v, released := c.Wait(req.Context(), f.wait)
+	switch {
+	case !released && req.Context().Err() == nil:
+		f.metrics.IncCounter("coalesce.timeout")
+	case !released:
+	case v == nil || !v.(*response).matches(req):
+		f.metrics.IncCounter("coalesce.passed")
+	default:
+		f.metrics.IncCounter("coalesce.coalesced")
+		ctx.Serve(v.(*response).serve(req))
+	}
+}
+
+// shareable tells whether the response can be shared with other clients.
+func shareable(h http.Header) bool {
+	if len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	for _, name := range inflight.VaryHeaders(h) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if strings.EqualFold(name, "private") || strings.EqualFold(name, "no-store") {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (f *filter) Response(ctx filters.FilterContext) {
+	st, ok := ctx.StateBag()[stateBagKey].(*state)
+	if !ok {
+		return
+	}
+
+	delete(ctx.StateBag(), stateBagKey)
+
+	rsp := ctx.Response()
+	if ctx.Request().Context().Err() != nil || rsp.ContentLength > f.maxBody || !shareable(rsp.Header) {
+		f.inflight.End(st.key, st.call, nil)
+		return
+	}
+
+	header := rsp.Header.Clone()
+	status := rsp.StatusCode
+	var vary http.Header
+	for _, name := range inflight.VaryHeaders(header) {
+		if vary == nil {
+			vary = make(http.Header)
+		}
+
+		vary[name] = st.header.Values(name)
+	}
+
+	if rsp.Body == nil {
+		f.inflight.End(st.key, st.call, &response{status: status, header: header, vary: vary})
+		return
+	}
+
+	rsp.Body = inflight.NewBody(rsp.Body, f.maxBody, func(body []byte, complete bool) {
+		if !complete {
+			f.inflight.End(st.key, st.call, nil)
+			return
+		}
+
+		f.inflight.End(st.key, st.call, &response{status: status, header: header, body: body, vary: vary})
+	})
+}
+
+// HandleErrorResponse enables the filter to share the error responses of
+// the failed backend requests, too, so that the waiting requests are
+// released.
+func (*filter) HandleErrorResponse() bool { return true }
@@ -0,0 +1,264 @@
+package coalesce
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/inflight/inflighttest"
+	"github.com/zalando/skipper/metrics"
+)
+
+type testProxy struct {
+	*inflighttest.Proxy
+}
+
+func newTestProxy(t *testing.T, args string, handler http.HandlerFunc) *testProxy {
+	t.Helper()
+
+	p := inflighttest.New(t, func(m metrics.Metrics) filters.Spec {
+		s := NewCoalesce().(*spec)
+		s.metrics = m
+		return s
+	}, fmt.Sprintf("coalesce(%s)", args), handler)
+
+	return &testProxy{Proxy: p}
+}
+
+// concurrently sends n requests while the backend is blocked, and returns
+// the response bodies.
+func (p *testProxy) concurrently(t *testing.T, n int, method string, header http.Header, release chan struct{}) []string {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		wg     sync.WaitGroup
+	)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, b := p.Do(t, method, "/countries", header)
+			mu.Lock()
+			bodies = append(bodies, b)
+			mu.Unlock()
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	return bodies
+}
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		args  []interface{}
+		fail  bool
+	}{
+		{title: "no args"},
+		{title: "key", args: []interface{}{"${request.path}"}},
+		{title: "key not a string", args: []interface{}{42.0}, fail: true},
+		{title: "options", args: []interface{}{"", "max-body=1024, wait=1s"}},
+		{title: "invalid option", args: []interface{}{"", "wait"}, fail: true},
+		{title: "unknown option", args: []interface{}{"", "foo=bar"}, fail: true},
+		{title: "invalid wait", args: []interface{}{"", "wait=0s"}, fail: true},
+		{title: "invalid max body", args: []interface{}{"", "max-body=-1"}, fail: true},
+		{title: "too many args", args: []interface{}{"", "", ""}, fail: true},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewCoalesce().CreateFilter(test.args)
+			if test.fail && err == nil {
+				t.Error("failed to fail")
+			} else if !test.fail && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	release := make(chan struct{})
+	p := newTestProxy(t, "", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte("countries"))
+	})
+
+	const concurrency = 5
+	for _, b := range p.concurrently(t, concurrency, http.MethodGet, nil, release) {
+		if b != "countries" {
+			t.Errorf("unexpected response: %s", b)
+		}
+	}
+
+	p.ExpectRequests(t, 1)
+	p.ExpectCounter(t, "coalesce.coalesced", concurrency-1)
+
+	// not in flight anymore
+	p.Do(t, http.MethodGet, "/countries", nil)
+	p.ExpectRequests(t, 2)
+}
+
+func TestCoalesceErrorResponse(t *testing.T) {
+	release := make(chan struct{})
+	p := newTestProxy(t, "", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	p.concurrently(t, 3, http.MethodGet, nil, release)
+	p.ExpectRequests(t, 1)
+}
+
+func TestCoalesceNotShared(t *testing.T) {
+	for _, test := range []struct {
+		title         string
+		method        string
+		args          string
+		requestHeader http.Header
+		header        http.Header
+		body          string
+	}{{
+		title:  "not a GET request",
+		method: http.MethodPost,
+	}, {
+		title:         "authorization",
+		method:        http.MethodGet,
+		requestHeader: http.Header{"Authorization": []string{"Bearer foo"}},
+	}, {
+		title:         "cookie",
+		method:        http.MethodGet,
+		args:          `"${request.path}:${request.header.Authorization}"`,
+		requestHeader: http.Header{"Cookie": []string{"session=foo"}},
+	}, {
+		title:  "private",
+		method: http.MethodGet,
+		header: http.Header{"Cache-Control": []string{"max-age=60, private"}},
+	}, {
+		title:  "no-store",
+		method: http.MethodGet,
+		header: http.Header{"Cache-Control": []string{"No-Store"}},
+	}, {
+		title:  "too large body",
+		method: http.MethodGet,
+		args:   `"", "max-body=32"`,
+		body:   strings.Repeat("x", 64),
+	}, {
+		title:  "set cookie",
+		method: http.MethodGet,
+		header: http.Header{"Set-Cookie": []string{"session=foo"}},
+	}, {
+		title:  "vary all",
+		method: http.MethodGet,
+		header: http.Header{"Vary": []string{"Accept-Encoding, *"}},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			release := make(chan struct{})
+			p := newTestProxy(t, test.args, func(w http.ResponseWriter, r *http.Request) {
+				<-release
+				for name, values := range test.header {
+					w.Header()[name] = values
+				}
+
+				w.Write([]byte(test.body))
+			})
+
+			for _, b := range p.concurrently(t, 3, test.method, test.requestHeader, release) {
+				if b != test.body {
+					t.Errorf("unexpected response: %s", b)
+				}
+			}
+
+			p.ExpectRequests(t, 3)
+			p.ExpectCounter(t, "coalesce.coalesced", 0)
+		})
+	}
+}
+
+func TestCoalesceWaitTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var n atomic.Int64
+	p := newTestProxy(t, `"", "wait=50ms"`, func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 1 {
+			<-release
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.Do(t, http.MethodGet, "/countries", nil)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if rsp, _ := p.Do(t, http.MethodGet, "/countries", nil); rsp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	close(release)
+	<-done
+
+	p.ExpectRequests(t, 2)
+	p.ExpectCounter(t, "coalesce.timeout", 1)
+}
+
+func TestCoalesceCredentialsInKey(t *testing.T) {
+	release := make(chan struct{})
+	p := newTestProxy(t, `"${request.path}:${request.header.Authorization}:${request.cookie.session}"`, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("countries"))
+	})
+
+	header := http.Header{
+		"Authorization": []string{"Bearer foo"},
+		"Cookie":        []string{"session=bar"},
+	}
+
+	for _, b := range p.concurrently(t, 3, http.MethodGet, header, release) {
+		if b != "countries" {
+			t.Errorf("unexpected response: %s", b)
+		}
+	}
+
+	p.ExpectRequests(t, 1)
+	p.ExpectCounter(t, "coalesce.coalesced", 2)
+}
+
+func TestCoalesceVary(t *testing.T) {
+	release := make(chan struct{})
+	p := newTestProxy(t, "", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Write([]byte(r.Header.Get("Accept-Encoding")))
+	})
+
+	var wg sync.WaitGroup
+	for _, encoding := range []string{"gzip", "br", "gzip", "br"} {
+		wg.Add(1)
+		go func(encoding string) {
+			defer wg.Done()
+			if _, b := p.Do(t, http.MethodGet, "/countries", http.Header{"Accept-Encoding": []string{encoding}}); b != encoding {
+				t.Errorf("expected response for %s, got: %s", encoding, b)
+			}
+		}(encoding)
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// the requests with the encoding of the first request are coalesced,
+	// the others are sent to the backend
+	p.ExpectRequests(t, 3)
+	p.ExpectCounter(t, "coalesce.coalesced", 1)
+	p.ExpectCounter(t, "coalesce.passed", 2)
+}
@@ -0,0 +1,190 @@
+/*
+Package fallback provides the fallback filter, which sets the policy used by
+the proxy to send the failed requests of the route to a fallback route.
+
+When the backend request of the route fails with one of the conditions, the
+request is routed again, and only the routes with the Fallback predicate of
+the same key can match it. The fallback route applies its own filters, and
+it can have any backend, e.g. a read-only replica or a shunt backend with
+static content:
+
+	fallback("catalog")
+	fallback("catalog", "connect-failure,timeout,503")
+	fallback("catalog", "connect-failure,gateway-error", "max-body=1048576")
+
+The conditions are a comma separated list of:
+
+  - connect-failure: the connection to the backend could not be established
+  - reset: the connection was reset or closed before a response was received
+  - timeout: the backend request timed out
+  - gateway-error: the backend responded with 502, 503 or 504
+  - a status code, e.g. 503: the backend responded with this status
+
+The default conditions are connect-failure, reset and timeout.
+
+The options are a comma separated list of key=value pairs:
+
+  - max-body: the maximum request body size in bytes that is buffered, so
+    that requests with a body can be sent to the fallback route, 65536 by
+    default. Requests with a larger body are not sent to the fallback route.
+*/
+package fallback
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/retry"
+)
+
+// DefaultMaxBodyBytes is the default maximum request body size that is
+// buffered for the fallback route.
+const DefaultMaxBodyBytes = 64 * 1024
+
+// Policy is set in the state bag by the fallback filter, with the key
+// filters.BackendFallback, and applied by the proxy.
+type Policy struct {
+	// Key selects the fallback routes, the ones with the Fallback predicate
+	// of the same key.
+	Key string
+
+	// Conditions are the errors that are sent to the fallback route.
+	Conditions retry.Condition
+
+	// StatusCodes are the backend response statuses that are sent to the
+	// fallback route.
+	StatusCodes map[int]bool
+
+	// MaxBodyBytes is the maximum request body size that is buffered.
+	MaxBodyBytes int64
+}
+
+type spec struct{}
+
+type filter struct {
+	policy *Policy
+}
+
+// NewFallback creates the filter specification of the fallback filter.
+func NewFallback() filters.Spec {
+	return spec{}
+}
+
+func (spec) Name() string { return filters.FallbackName }
+
+func parseConditions(s string, p *Policy) error {
+	for _, c := range strings.Split(s, ",") {
+		switch c = strings.TrimSpace(c); c {
+		case "":
+		case "connect-failure":
+			p.Conditions |= retry.ConnectFailure
+		case "reset":
+			p.Conditions |= retry.Reset
+		case "timeout":
+			p.Conditions |= retry.Timeout
+		case "gateway-error":
+			p.StatusCodes[http.StatusBadGateway] = true
+			p.StatusCodes[http.StatusServiceUnavailable] = true
+			p.StatusCodes[http.StatusGatewayTimeout] = true
+		default:
+			code, err := strconv.Atoi(c)
+			if err != nil || code < 100 || code > 599 {
+				return fmt.Errorf("invalid fallback condition: %q", c)
+			}
+
+			p.StatusCodes[code] = true
+		}
+	}
+
+	return nil
+}
+
+func parseOptions(s string, p *Policy) error {
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(o, "=")
+		if !ok {
+			return fmt.Errorf("invalid fallback option: %q", o)
+		}
+
+		switch key {
+		case "max-body":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid fallback max body: %q", value)
+			}
+
+			p.MaxBodyBytes = n
+		default:
+			return fmt.Errorf("unknown fallback option: %q", key)
+		}
+	}
+
+	return nil
+}
+
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	key, _ := args[0].(string)
+	if key == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	p := &Policy{
+		Key:          key,
+		Conditions:   retry.ConnectFailure | retry.Reset | retry.Timeout,
+		StatusCodes:  make(map[int]bool),
+		MaxBodyBytes: DefaultMaxBodyBytes,
+	}
+
+	if len(args) > 1 {
+		s, ok := args[1].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		p.Conditions = 0
+		if err := parseConditions(s, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		s, ok := args[2].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if err := parseOptions(s, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return &filter{policy: p}, nil
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.BackendFallback] = f.policy
+}
+
+func (*filter) Response(filters.FilterContext) {}
+
+// FallbackOn tells whether the condition is sent to the fallback route.
+func (p *Policy) FallbackOn(c retry.Condition) bool {
+	return p.Conditions&c != 0
+}
+
+// FallbackStatus tells whether a backend response with the status is sent
+// to the fallback route.
+func (p *Policy) FallbackStatus(code int) bool {
+	return p.StatusCodes[code]
+}
@@ -0,0 +1,102 @@
+package fallback
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/filters/retry"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []interface{}
+		fail bool
+	}{
+		{name: "no args", fail: true},
+		{name: "key", args: []interface{}{"replica"}},
+		{name: "empty key", args: []interface{}{""}, fail: true},
+		{name: "key not a string", args: []interface{}{3.0}, fail: true},
+		{name: "conditions", args: []interface{}{"replica", "connect-failure,reset,timeout,gateway-error,429"}},
+		{name: "invalid condition", args: []interface{}{"replica", "sometimes"}, fail: true},
+		{name: "invalid status", args: []interface{}{"replica", "999"}, fail: true},
+		{name: "options", args: []interface{}{"replica", "503", "max-body=1024"}},
+		{name: "invalid option", args: []interface{}{"replica", "503", "max-body"}, fail: true},
+		{name: "unknown option", args: []interface{}{"replica", "503", "foo=bar"}, fail: true},
+		{name: "invalid max body", args: []interface{}{"replica", "503", "max-body=-1"}, fail: true},
+		{name: "too many args", args: []interface{}{"replica", "503", "", "x"}, fail: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFallback().CreateFilter(tt.args)
+			if tt.fail && err == nil {
+				t.Error("expected error")
+			} else if !tt.fail && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		args       []interface{}
+		conditions []retry.Condition
+		statuses   []int
+		maxBody    int64
+	}{{
+		name:       "defaults",
+		args:       []interface{}{"replica"},
+		conditions: []retry.Condition{retry.ConnectFailure, retry.Reset, retry.Timeout},
+		maxBody:    DefaultMaxBodyBytes,
+	}, {
+		name:       "configured",
+		args:       []interface{}{"replica", "connect-failure,gateway-error", "max-body=10"},
+		conditions: []retry.Condition{retry.ConnectFailure},
+		statuses:   []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		maxBody:    10,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFallback().CreateFilter(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := &filtertest.Context{FRequest: &http.Request{}, FStateBag: make(map[string]interface{})}
+			f.Request(ctx)
+
+			p, ok := ctx.StateBag()[filters.BackendFallback].(*Policy)
+			if !ok {
+				t.Fatal("policy not set in the state bag")
+			}
+
+			if p.Key != "replica" || p.MaxBodyBytes != tt.maxBody {
+				t.Errorf("unexpected policy: %+v", p)
+			}
+
+			var conditions retry.Condition
+			for _, c := range tt.conditions {
+				conditions |= c
+				if !p.FallbackOn(c) {
+					t.Errorf("expected condition: %d", c)
+				}
+			}
+
+			if p.Conditions != conditions {
+				t.Errorf("unexpected conditions: %d", p.Conditions)
+			}
+
+			for _, s := range tt.statuses {
+				if !p.FallbackStatus(s) {
+					t.Errorf("expected status: %d", s)
+				}
+			}
+
+			if len(p.StatusCodes) != len(tt.statuses) {
+				t.Errorf("unexpected statuses: %v", p.StatusCodes)
+			}
+		})
+	}
+}
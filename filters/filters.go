@@ -35,6 +35,30 @@ const (
 
 	// BackendRatelimit is the key used in the state bag to configure backend ratelimit in proxy
 	BackendRatelimit = "backend:ratelimit"
+
+	// BackendRetry is the key used in the state bag to configure the retry policy in proxy
+	BackendRetry = "backend:retry"
+
+	// BackendHedge is the key used in the state bag to configure the hedging policy in proxy
+	BackendHedge = "backend:hedge"
+
+	// BackendStickySession is the key used in the state bag to pass the sticky session to the proxy
+	BackendStickySession = "backend:stickysession"
+
+	// BackendProtocol is the key used in the state bag to select the protocol of the backend roundtrip in proxy
+	BackendProtocol = "backend:protocol"
+
+	// BackendFallback is the key used in the state bag to configure the fallback policy in proxy
+	BackendFallback = "backend:fallback"
+
+	// RequestBodyExceeded is the key used in the state bag to tell the proxy that the request body exceeded its limit
+	RequestBodyExceeded = "request:body:exceeded"
+
+	// GRPCContentType is the key used in the state bag to mark the gRPC routes, its value is the content type of the gRPC error responses generated by the proxy
+	GRPCContentType = "grpc:contenttype"
+
+	// TLSFingerprint is the key used in the state bag to pass the *tlsfingerprint.Fingerprint of the TLS client to the filters
+	TLSFingerprint = "tls:fingerprint"
 )
 
 // FilterContext object providing state and information that is unique to a request.
@@ -124,6 +148,15 @@ type FilterContext interface {
 	// Performs a new route lookup and executes the matched route if any
 	Loopback()
 
+	// BufferedRequestBody reads the request body into a buffer, and returns
+	// a re-readable view of it. The body is read only once, the following
+	// calls return a new view of the same buffer, and the request body is
+	// replaced, so that it is still sent to the backend. When the body is
+	// larger than maxBytes, it returns ErrRequestBodyTooLarge, and the
+	// request body remains complete. The views are valid until the request
+	// is done.
+	BufferedRequestBody(maxBytes int64) (*io.SectionReader, error)
+
 	Logger() FilterContextLogger
 }
 
@@ -195,6 +228,11 @@ type Registry map[string]Spec
 // ErrInvalidFilterParameters is used in case of invalid filter parameters.
 var ErrInvalidFilterParameters = errors.New("invalid filter parameters")
 
+// ErrRequestBodyTooLarge is returned when the request body exceeds its
+// limit, either the limit of the buffered request body, or the limit set by
+// the maxRequestBody filter.
+var ErrRequestBodyTooLarge = errors.New("request body too large")
+
 // Registers a filter specification.
 func (r Registry) Register(s Spec) {
 	name := s.Name()
@@ -246,6 +284,9 @@ const (
 	BackendTimeoutName                         = "backendTimeout"
 	ReadTimeoutName                            = "readTimeout"
 	WriteTimeoutName                           = "writeTimeout"
+	BackendProtocolName                        = "backendProtocol"
+	GRPCName                                   = "grpc"
+	GRPCWebName                                = "grpcWeb"
 	BlockName                                  = "blockContent"
 	BlockHexName                               = "blockContentHex"
 	LatencyName                                = "latency"
@@ -286,6 +327,7 @@ const (
 	SecureOAuthTokenintrospectionAllKVName     = "secureOauthTokenintrospectionAllKV"
 	ForwardTokenName                           = "forwardToken"
 	ForwardTokenFieldName                      = "forwardTokenField"
+	ForwardClientCertName                      = "forwardClientCert"
 	OAuthGrantName                             = "oauthGrant"
 	GrantCallbackName                          = "grantCallback"
 	GrantLogoutName                            = "grantLogout"
@@ -339,10 +381,20 @@ const (
 	OriginMarkerName                           = "originMarker"
 	FadeInName                                 = "fadeIn"
 	EndpointCreatedName                        = "endpointCreated"
+	EndpointZoneName                           = "endpointZone"
 	ConsistentHashKeyName                      = "consistentHashKey"
 	ConsistentHashBalanceFactorName            = "consistentHashBalanceFactor"
 	OpaAuthorizeRequestName                    = "opaAuthorizeRequest"
 	OpaServeResponseName                       = "opaServeResponse"
+	RetryName                                  = "retry"
+	HedgeName                                  = "hedge"
+	StickySessionName                          = "stickySession"
+	ActiveHealthCheckName                      = "activeHealthCheck"
+	FallbackName                               = "fallback"
+	CacheName                                  = "cache"
+	CoalesceName                               = "coalesce"
+	IdempotencyKeyName                         = "idempotencyKey"
+	MaxRequestBodyName                         = "maxRequestBody"
 
 	// Undocumented filters
 	HealthCheckName        = "healthcheck"
@@ -5,6 +5,8 @@ FilterContext interfaces used during tests.
 package filtertest
 
 import (
+	"bytes"
+	"io"
 	"net/http"
 
 	"github.com/opentracing/opentracing-go"
@@ -85,6 +87,31 @@ func (spec *Filter) CreateFilter(config []interface{}) (filters.Filter, error) {
 
 func (fc *Context) Loopback() {}
 
+// BufferedRequestBody buffers the request body in memory.
+func (fc *Context) BufferedRequestBody(maxBytes int64) (*io.SectionReader, error) {
+	req := fc.FRequest
+	if req.Body == nil || req.Body == http.NoBody {
+		return io.NewSectionReader(bytes.NewReader(nil), 0, 0), nil
+	}
+
+	b, err := io.ReadAll(io.LimitReader(req.Body, maxBytes+1))
+	rest := req.Body
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), rest), rest}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > maxBytes {
+		return nil, filters.ErrRequestBodyTooLarge
+	}
+
+	return io.NewSectionReader(bytes.NewReader(b), 0, int64(len(b))), nil
+}
+
 func (fc *Context) Split() (filters.FilterContext, error) {
 	return fc, nil
 }
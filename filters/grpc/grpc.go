@@ -0,0 +1,207 @@
+/*
+Package grpc provides the filters marking the gRPC routes, and translating
+gRPC-Web requests to native gRPC, and the helpers used by the proxy to
+handle the gRPC requests.
+
+For the routes marked with the grpc() or the grpcWeb() filter, the proxy:
+
+  - sends the errors generated by the proxy and the non-gRPC responses as
+    gRPC trailers-only responses, with the grpc-status and grpc-message
+    headers,
+  - uses the grpc-timeout header of the request as the backend timeout,
+    when it is shorter than the one set by the backendTimeout filter,
+  - measures the requests per route and gRPC status.
+
+The gRPC backends need to be reached over HTTP/2, see the backendProtocol
+filter:
+
+	grpc: Host("^grpc[.]example[.]org$") -> grpc() -> backendProtocol("h2c") -> "http://10.2.0.1:8080";
+*/
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// ContentType is the content type of the gRPC requests and responses.
+const ContentType = "application/grpc"
+
+// Code is a gRPC status code.
+type Code int
+
+// The gRPC status codes, see
+// https://github.com/grpc/grpc/blob/master/doc/statuscodes.md.
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+var codeNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+var errInvalidTimeout = errors.New("invalid grpc-timeout")
+
+type spec struct{}
+
+type filter struct{}
+
+func (c Code) String() string {
+	if c < 0 || int(c) >= len(codeNames) {
+		return strconv.Itoa(int(c))
+	}
+
+	return codeNames[c]
+}
+
+// CodeFromHTTPStatus returns the gRPC status code of the HTTP status
+// code, following
+// https://github.com/grpc/grpc/blob/master/doc/http-grpc-status-mapping.md,
+// extended with the status codes used by the proxy for canceled and
+// timed out requests.
+func CodeFromHTTPStatus(status int) Code {
+	switch status {
+	case http.StatusOK:
+		return Unknown
+	case http.StatusBadRequest:
+		return Internal
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return Unimplemented
+	case http.StatusRequestEntityTooLarge:
+		return ResourceExhausted
+	case 499:
+		return Canceled
+	case http.StatusGatewayTimeout:
+		return DeadlineExceeded
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return Unavailable
+	default:
+		return Unknown
+	}
+}
+
+// ParseTimeout parses the value of the grpc-timeout header.
+func ParseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, errInvalidTimeout
+	}
+
+	value, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || value < 0 {
+		return 0, errInvalidTimeout
+	}
+
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, errInvalidTimeout
+	}
+
+	if value > math.MaxInt64/int64(unit) {
+		return time.Duration(math.MaxInt64), nil
+	}
+
+	return time.Duration(value) * unit, nil
+}
+
+// EncodeMessage percent-encodes the value of the grpc-message header.
+func EncodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// IsGRPC tells whether the content type is a gRPC or gRPC-Web content
+// type.
+func IsGRPC(contentType string) bool {
+	return contentType == ContentType ||
+		strings.HasPrefix(contentType, ContentType+"+") ||
+		strings.HasPrefix(contentType, ContentType+";") ||
+		strings.HasPrefix(contentType, webContentType)
+}
+
+// NewGRPC creates a filter specification, whose instances mark the route
+// as a gRPC route. See the package documentation for the effects.
+func NewGRPC() filters.Spec { return spec{} }
+
+func (spec) Name() string { return filters.GRPCName }
+
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return filter{}, nil
+}
+
+func (filter) Request(ctx filters.FilterContext) {
+	// grpcWeb() sets the content type of the gRPC-Web responses
+	if _, ok := ctx.StateBag()[filters.GRPCContentType]; !ok {
+		ctx.StateBag()[filters.GRPCContentType] = ContentType
+	}
+}
+
+func (filter) Response(filters.FilterContext) {}
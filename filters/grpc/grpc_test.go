@@ -0,0 +1,146 @@
+package grpc
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestParseTimeout(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected time.Duration
+		fail     bool
+	}{
+		{value: "1H", expected: time.Hour},
+		{value: "2M", expected: 2 * time.Minute},
+		{value: "3S", expected: 3 * time.Second},
+		{value: "100m", expected: 100 * time.Millisecond},
+		{value: "5u", expected: 5 * time.Microsecond},
+		{value: "7n", expected: 7 * time.Nanosecond},
+		{value: "99999999H", expected: time.Duration(math.MaxInt64)},
+		{value: "", fail: true},
+		{value: "S", fail: true},
+		{value: "10", fail: true},
+		{value: "10s", fail: true},
+		{value: "-1S", fail: true},
+		{value: "1.5S", fail: true},
+		{value: "123456789S", fail: true},
+	} {
+		t.Run(test.value, func(t *testing.T) {
+			d, err := ParseTimeout(test.value)
+			if test.fail {
+				if err == nil {
+					t.Errorf("failed to fail, got: %v", d)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d != test.expected {
+				t.Errorf("expected %v, got: %v", test.expected, d)
+			}
+		})
+	}
+}
+
+func TestCodeFromHTTPStatus(t *testing.T) {
+	for status, expected := range map[int]Code{
+		http.StatusOK:                    Unknown,
+		http.StatusBadRequest:            Internal,
+		http.StatusUnauthorized:          Unauthenticated,
+		http.StatusForbidden:             PermissionDenied,
+		http.StatusNotFound:              Unimplemented,
+		http.StatusRequestEntityTooLarge: ResourceExhausted,
+		http.StatusTooManyRequests:       Unavailable,
+		499:                              Canceled,
+		http.StatusInternalServerError:   Unknown,
+		http.StatusBadGateway:            Unavailable,
+		http.StatusServiceUnavailable:    Unavailable,
+		http.StatusGatewayTimeout:        DeadlineExceeded,
+	} {
+		if c := CodeFromHTTPStatus(status); c != expected {
+			t.Errorf("%d: expected %v, got: %v", status, expected, c)
+		}
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	for c, expected := range map[Code]string{
+		OK:               "OK",
+		Canceled:         "CANCELLED",
+		DeadlineExceeded: "DEADLINE_EXCEEDED",
+		Unauthenticated:  "UNAUTHENTICATED",
+		Code(42):         "42",
+		Code(-1):         "-1",
+	} {
+		if s := c.String(); s != expected {
+			t.Errorf("expected %s, got: %s", expected, s)
+		}
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	for message, expected := range map[string]string{
+		"":                    "",
+		"Bad Gateway":         "Bad Gateway",
+		"100%":                "100%25",
+		"line\nbreak":         "line%0Abreak",
+		"föö":                 "f%C3%B6%C3%B6",
+		"already %20 encoded": "already %2520 encoded",
+	} {
+		if s := EncodeMessage(message); s != expected {
+			t.Errorf("expected %q, got: %q", expected, s)
+		}
+	}
+}
+
+func TestIsGRPC(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"application/grpc":                true,
+		"application/grpc+proto":          true,
+		"application/grpc; charset=utf-8": true,
+		"application/grpc-web":            true,
+		"application/grpc-web+proto":      true,
+		"application/grpc-web-text":       true,
+		"application/grpcx":               false,
+		"application/json":                false,
+		"":                                false,
+	} {
+		if IsGRPC(contentType) != expected {
+			t.Errorf("%q: expected %v", contentType, expected)
+		}
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	spec := NewGRPC()
+	if _, err := spec.CreateFilter([]interface{}{"foo"}); err == nil {
+		t.Error("failed to fail")
+	}
+
+	f, err := spec.CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	if ctx.FStateBag[filters.GRPCContentType] != ContentType {
+		t.Errorf("expected %s, got: %v", ContentType, ctx.FStateBag[filters.GRPCContentType])
+	}
+
+	ctx.FStateBag[filters.GRPCContentType] = webTextContentType
+	f.Request(ctx)
+	if ctx.FStateBag[filters.GRPCContentType] != webTextContentType {
+		t.Errorf("expected %s, got: %v", webTextContentType, ctx.FStateBag[filters.GRPCContentType])
+	}
+}
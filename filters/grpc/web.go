@@ -0,0 +1,252 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	webContentType     = "application/grpc-web"
+	webTextContentType = "application/grpc-web-text"
+
+	// flag of the gRPC-Web frames containing the trailers
+	trailerFrameFlag = 0x80
+
+	readBufferSize = 32 << 10
+)
+
+type webSpec struct{}
+
+type webFilter struct{}
+
+// base64Reader decodes the base64 encoded body of the gRPC-Web text
+// requests. The body may consist of multiple padded base64 chunks.
+type base64Reader struct {
+	body    io.Reader
+	readBuf []byte
+	encoded []byte
+	decoded []byte
+	err     error
+}
+
+// webResponseBody encodes the body of the gRPC response as gRPC-Web,
+// appending the trailers received from the backend as the last frame.
+type webResponseBody struct {
+	response *http.Response
+	body     io.ReadCloser
+	readBuf  []byte
+	text     bool
+	buf      bytes.Buffer
+	done     bool
+}
+
+// NewGRPCWeb creates a filter specification, whose instances translate the
+// gRPC-Web requests, binary and text, to native gRPC requests, and the
+// gRPC responses to gRPC-Web responses. It marks the route as a gRPC route
+// the same way as the grpc() filter, for the gRPC-Web and the native gRPC
+// requests. The other requests, e.g. the CORS preflight requests, are
+// proxied unchanged, and they are not handled as gRPC.
+//
+// The gRPC-Web responses contain the trailers of the gRPC response as the
+// last frame of the body. Example:
+//
+//	grpcWeb: Path("/helloworld.Greeter/*") -> grpcWeb() -> backendProtocol("h2c") -> "http://10.2.0.1:8080";
+func NewGRPCWeb() filters.Spec { return webSpec{} }
+
+func (webSpec) Name() string { return filters.GRPCWebName }
+
+func (webSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return webFilter{}, nil
+}
+
+func (webFilter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	contentType := req.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, webContentType) {
+		// other requests, e.g. the CORS preflight requests, are not
+		// handled as gRPC
+		if IsGRPC(contentType) {
+			filter{}.Request(ctx)
+		}
+
+		return
+	}
+
+	// the errors of the proxy are sent with the content type of the request
+	ctx.StateBag()[filters.GRPCContentType] = contentType
+
+	subtype := strings.TrimPrefix(contentType, webContentType)
+	if strings.HasPrefix(contentType, webTextContentType) {
+		subtype = strings.TrimPrefix(contentType, webTextContentType)
+		req.Header.Del("Content-Length")
+		req.ContentLength = -1
+		req.Body = &base64Reader{body: req.Body}
+	}
+
+	req.Header.Set("Content-Type", ContentType+subtype)
+}
+
+func (webFilter) Response(ctx filters.FilterContext) {
+	contentType, _ := ctx.StateBag()[filters.GRPCContentType].(string)
+	if !strings.HasPrefix(contentType, webContentType) {
+		return
+	}
+
+	// not a gRPC response, the proxy sends it as a trailers-only response
+	rsp := ctx.Response()
+	if c := rsp.Header.Get("Content-Type"); !IsGRPC(c) || strings.HasPrefix(c, webContentType) {
+		return
+	}
+
+	rsp.Header.Set("Content-Type", contentType)
+	rsp.Header.Del("Content-Length")
+	rsp.ContentLength = -1
+	rsp.Body = &webResponseBody{
+		response: rsp,
+		body:     rsp.Body,
+		text:     strings.HasPrefix(contentType, webTextContentType),
+	}
+}
+
+// decodes the complete base64 quanta, up to and including the first
+// padded one
+func (r *base64Reader) decode() error {
+	n := len(r.encoded) / 4 * 4
+	if i := bytes.IndexByte(r.encoded[:n], '='); i >= 0 {
+		n = (i/4 + 1) * 4
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(n))
+	m, err := base64.StdEncoding.Decode(decoded, r.encoded[:n])
+	if err != nil {
+		return err
+	}
+
+	r.decoded = append(r.decoded, decoded[:m]...)
+	r.encoded = r.encoded[n:]
+	return nil
+}
+
+func (r *base64Reader) Read(p []byte) (int, error) {
+	for len(r.decoded) == 0 {
+		if err := r.decode(); err != nil {
+			r.err = err
+			return 0, err
+		}
+
+		if len(r.decoded) > 0 {
+			break
+		}
+
+		if r.err != nil {
+			if r.err == io.EOF && len(r.encoded) > 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+
+			return 0, r.err
+		}
+
+		if r.readBuf == nil {
+			r.readBuf = make([]byte, readBufferSize)
+		}
+
+		n, err := r.body.Read(r.readBuf)
+		r.encoded = append(r.encoded, r.readBuf[:n]...)
+		r.err = err
+	}
+
+	n := copy(p, r.decoded)
+	r.decoded = r.decoded[n:]
+	return n, nil
+}
+
+func (r *base64Reader) Close() error {
+	if c, ok := r.body.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+func (b *webResponseBody) write(data []byte) {
+	if b.text {
+		b.buf.WriteString(base64.StdEncoding.EncodeToString(data))
+		return
+	}
+
+	b.buf.Write(data)
+}
+
+// trailerFrame returns the gRPC-Web frame of the trailers, with the names
+// in lower case.
+func (b *webResponseBody) trailerFrame() []byte {
+	var names []string
+	for name := range b.response.Trailer {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var trailers bytes.Buffer
+	for _, name := range names {
+		for _, value := range b.response.Trailer[name] {
+			trailers.WriteString(strings.ToLower(name))
+			trailers.WriteString(":")
+			trailers.WriteString(value)
+			trailers.WriteString("\r\n")
+		}
+	}
+
+	frame := []byte{trailerFrameFlag}
+	frame = binary.BigEndian.AppendUint32(frame, uint32(trailers.Len()))
+	return append(frame, trailers.Bytes()...)
+}
+
+func (b *webResponseBody) Read(p []byte) (int, error) {
+	for b.buf.Len() == 0 {
+		if b.done {
+			return 0, io.EOF
+		}
+
+		if b.readBuf == nil {
+			b.readBuf = make([]byte, readBufferSize)
+		}
+
+		n, err := b.body.Read(b.readBuf)
+		if n > 0 {
+			b.write(b.readBuf[:n])
+		}
+
+		if err == io.EOF {
+			// trailers-only responses contain the status in the headers
+			if len(b.response.Trailer) > 0 {
+				b.write(b.trailerFrame())
+			}
+
+			b.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	return b.buf.Read(p)
+}
+
+func (b *webResponseBody) Close() error {
+	return b.body.Close()
+}
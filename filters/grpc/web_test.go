@@ -0,0 +1,218 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func frame(data string) []byte {
+	return append([]byte{0, 0, 0, 0, byte(len(data))}, data...)
+}
+
+func createWebFilter(t *testing.T) filters.Filter {
+	t.Helper()
+
+	spec := NewGRPCWeb()
+	if _, err := spec.CreateFilter([]interface{}{"foo"}); err == nil {
+		t.Error("failed to fail")
+	}
+
+	f, err := spec.CreateFilter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestGRPCWebRequest(t *testing.T) {
+	message := frame("hello")
+	encoded := base64.StdEncoding.EncodeToString(message[:3]) + base64.StdEncoding.EncodeToString(message[3:])
+	for _, test := range []struct {
+		title               string
+		method              string
+		contentType         string
+		body                string
+		expectedContentType string
+		expectedState       string
+		expectedBody        []byte
+	}{{
+		title:               "native gRPC",
+		contentType:         "application/grpc",
+		body:                string(message),
+		expectedContentType: "application/grpc",
+		expectedState:       "application/grpc",
+		expectedBody:        message,
+	}, {
+		title:               "binary",
+		contentType:         "application/grpc-web+proto",
+		body:                string(message),
+		expectedContentType: "application/grpc+proto",
+		expectedState:       "application/grpc-web+proto",
+		expectedBody:        message,
+	}, {
+		title:               "text",
+		contentType:         "application/grpc-web-text",
+		body:                base64.StdEncoding.EncodeToString(message),
+		expectedContentType: "application/grpc",
+		expectedState:       "application/grpc-web-text",
+		expectedBody:        message,
+	}, {
+		title:               "text with multiple padded chunks",
+		contentType:         "application/grpc-web-text+proto",
+		body:                encoded,
+		expectedContentType: "application/grpc+proto",
+		expectedState:       "application/grpc-web-text+proto",
+		expectedBody:        message,
+	}, {
+		title:        "CORS preflight",
+		method:       "OPTIONS",
+		expectedBody: []byte{},
+	}, {
+		title:               "not gRPC",
+		contentType:         "application/json",
+		body:                "{}",
+		expectedContentType: "application/json",
+		expectedBody:        []byte("{}"),
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = "POST"
+			}
+
+			f := createWebFilter(t)
+			req, err := http.NewRequest(method, "http://www.example.org/helloworld.Greeter/SayHello", iotest.OneByteReader(strings.NewReader(test.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+			f.Request(ctx)
+
+			if ct := req.Header.Get("Content-Type"); ct != test.expectedContentType {
+				t.Errorf("expected content type %s, got: %s", test.expectedContentType, ct)
+			}
+
+			if s, _ := ctx.FStateBag[filters.GRPCContentType].(string); s != test.expectedState {
+				t.Errorf("expected state %s, got: %v", test.expectedState, s)
+			}
+
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, test.expectedBody) {
+				t.Errorf("expected body %v, got: %v", test.expectedBody, b)
+			}
+		})
+	}
+}
+
+func TestGRPCWebRequestInvalidBase64(t *testing.T) {
+	for _, body := range []string{"not base64!", "AAA"} {
+		f := createWebFilter(t)
+		req, err := http.NewRequest("POST", "http://www.example.org/helloworld.Greeter/SayHello", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", webTextContentType)
+		f.Request(&filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})})
+		if _, err := io.ReadAll(req.Body); err == nil {
+			t.Errorf("failed to fail: %q", body)
+		}
+	}
+}
+
+func TestGRPCWebResponse(t *testing.T) {
+	message := frame("world")
+	trailerFrame := append([]byte{0x80, 0, 0, 0, 32}, "grpc-message:ok\r\ngrpc-status:0\r\n"...)
+	for _, test := range []struct {
+		title               string
+		stateContentType    string
+		contentType         string
+		trailer             http.Header
+		expectedContentType string
+		expectedBody        []byte
+	}{{
+		title:               "native gRPC",
+		stateContentType:    "application/grpc",
+		contentType:         "application/grpc",
+		trailer:             http.Header{"Grpc-Status": []string{"0"}},
+		expectedContentType: "application/grpc",
+		expectedBody:        message,
+	}, {
+		title:               "not a gRPC response",
+		stateContentType:    "application/grpc-web",
+		contentType:         "text/plain",
+		expectedContentType: "text/plain",
+		expectedBody:        message,
+	}, {
+		title:               "binary",
+		stateContentType:    "application/grpc-web+proto",
+		contentType:         "application/grpc+proto",
+		trailer:             http.Header{"Grpc-Status": []string{"0"}, "Grpc-Message": []string{"ok"}},
+		expectedContentType: "application/grpc-web+proto",
+		expectedBody:        append(append([]byte(nil), message...), trailerFrame...),
+	}, {
+		title:               "binary trailers-only",
+		stateContentType:    "application/grpc-web",
+		contentType:         "application/grpc",
+		expectedContentType: "application/grpc-web",
+		expectedBody:        message,
+	}, {
+		title:               "text",
+		stateContentType:    "application/grpc-web-text",
+		contentType:         "application/grpc",
+		trailer:             http.Header{"Grpc-Status": []string{"0"}, "Grpc-Message": []string{"ok"}},
+		expectedContentType: "application/grpc-web-text",
+		expectedBody: []byte(base64.StdEncoding.EncodeToString(message) +
+			base64.StdEncoding.EncodeToString(trailerFrame)),
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			f := createWebFilter(t)
+			rsp := &http.Response{
+				Header:  http.Header{"Content-Type": []string{test.contentType}, "Content-Length": []string{"10"}},
+				Body:    io.NopCloser(bytes.NewReader(message)),
+				Trailer: test.trailer,
+			}
+
+			ctx := &filtertest.Context{
+				FResponse: rsp,
+				FStateBag: map[string]interface{}{filters.GRPCContentType: test.stateContentType},
+			}
+
+			f.Response(ctx)
+			if ct := rsp.Header.Get("Content-Type"); ct != test.expectedContentType {
+				t.Errorf("expected content type %s, got: %s", test.expectedContentType, ct)
+			}
+
+			b, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(b, test.expectedBody) {
+				t.Errorf("expected body %q, got: %q", test.expectedBody, b)
+			}
+
+			if err := rsp.Body.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
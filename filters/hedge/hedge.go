@@ -0,0 +1,146 @@
+/*
+Package hedge provides the hedge filter, which sets the policy used by the
+proxy to send parallel copies of slow requests to other endpoints of a load
+balanced backend.
+
+When the response headers of the backend did not arrive within the delay, the
+proxy sends a copy of the request to another endpoint, up to the maximum
+number of hedges. The first successful response is used, and the other
+requests are canceled:
+
+	hedge("50ms", 1)
+	hedge("20ms", 2, 5)
+
+The optional third argument is the hedging budget, the percentage of the
+in-flight requests of the route that may be hedged at the same time, 10 by
+default. At least one concurrent hedge is always allowed.
+
+Only requests with idempotent methods and without a body are hedged.
+*/
+package hedge
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/retry"
+)
+
+const (
+	// DefaultBudgetPercent is the default percentage of the in-flight
+	// requests that may be hedged at the same time.
+	DefaultBudgetPercent = 10
+
+	minHedgeConcurrency = 1
+)
+
+// Policy is set in the state bag by the hedge filter, with the key
+// filters.BackendHedge, and applied by the proxy.
+type Policy struct {
+	// Delay is the time to wait for the response headers before sending a
+	// hedged request.
+	Delay time.Duration
+
+	// MaxHedges is the maximum number of hedged requests, not including the
+	// original one.
+	MaxHedges int
+
+	budget *retry.Budget
+}
+
+type spec struct{}
+
+type filter struct {
+	policy *Policy
+}
+
+// NewHedge creates the filter specification of the hedge filter.
+func NewHedge() filters.Spec {
+	return spec{}
+}
+
+func (spec) Name() string { return filters.HedgeName }
+
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	p := &Policy{}
+	percent := int64(DefaultBudgetPercent)
+
+	switch v := args[0].(type) {
+	case int:
+		p.Delay = time.Duration(v) * time.Millisecond
+	case float64:
+		p.Delay = time.Duration(v * float64(time.Millisecond))
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Delay = d
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if p.Delay <= 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	switch v := args[1].(type) {
+	case int:
+		p.MaxHedges = v
+	case float64:
+		p.MaxHedges = int(v)
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if p.MaxHedges < 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if len(args) > 2 {
+		switch v := args[2].(type) {
+		case int:
+			percent = int64(v)
+		case float64:
+			percent = int64(v)
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if percent < 0 || percent > 100 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	p.budget = retry.NewBudget(percent, minHedgeConcurrency)
+	return &filter{policy: p}, nil
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.BackendHedge] = f.policy
+}
+
+func (*filter) Response(filters.FilterContext) {}
+
+// HedgeRequest tells whether the request can be hedged.
+func (p *Policy) HedgeRequest(r *http.Request) bool {
+	return retry.IdempotentMethod(r.Method) && (r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0)
+}
+
+// Begin counts an in-flight request for the hedging budget. The returned
+// function needs to be called when the request is done.
+func (p *Policy) Begin() func() {
+	return p.budget.Begin()
+}
+
+// AcquireHedge takes a hedge from the budget. When it succeeds, the returned
+// function needs to be called when the hedged request is done.
+func (p *Policy) AcquireHedge() (func(), bool) {
+	return p.budget.Acquire()
+}
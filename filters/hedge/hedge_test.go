@@ -0,0 +1,119 @@
+package hedge
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []interface{}
+		fail bool
+	}{
+		{name: "no args", fail: true},
+		{name: "delay only", args: []interface{}{"10ms"}, fail: true},
+		{name: "delay and hedges", args: []interface{}{"10ms", 1.0}},
+		{name: "delay millis", args: []interface{}{10.0, 2.0}},
+		{name: "budget", args: []interface{}{"10ms", 1.0, 5.0}},
+		{name: "invalid delay", args: []interface{}{"soon", 1.0}, fail: true},
+		{name: "zero delay", args: []interface{}{"0s", 1.0}, fail: true},
+		{name: "invalid hedges", args: []interface{}{"10ms", 0.0}, fail: true},
+		{name: "hedges not a number", args: []interface{}{"10ms", "1"}, fail: true},
+		{name: "invalid budget", args: []interface{}{"10ms", 1.0, 101.0}, fail: true},
+		{name: "too many args", args: []interface{}{"10ms", 1.0, 5.0, 1.0}, fail: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHedge().CreateFilter(tt.args)
+			if tt.fail && err == nil {
+				t.Error("expected error")
+			} else if !tt.fail && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	f, err := NewHedge().CreateFilter([]interface{}{"15ms", 2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FRequest: &http.Request{}, FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+
+	p, ok := ctx.StateBag()[filters.BackendHedge].(*Policy)
+	if !ok {
+		t.Fatal("policy not set in the state bag")
+	}
+
+	if p.Delay != 15*time.Millisecond || p.MaxHedges != 2 {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+
+	for _, tt := range []struct {
+		method   string
+		body     io.Reader
+		expected bool
+	}{
+		{"GET", nil, true},
+		{"HEAD", nil, true},
+		{"PUT", nil, true},
+		{"POST", nil, false},
+		{"PATCH", nil, false},
+		{"PUT", strings.NewReader("body"), false},
+	} {
+		r, _ := http.NewRequest(tt.method, "http://www.example.org", tt.body)
+		if p.HedgeRequest(r) != tt.expected {
+			t.Errorf("%s with body %v: expected %v", tt.method, tt.body != nil, tt.expected)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	f, err := NewHedge().CreateFilter([]interface{}{"10ms", 1.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := f.(*filter).policy
+
+	// the minimum concurrency is allowed without in-flight requests
+	release, ok := p.AcquireHedge()
+	if !ok {
+		t.Fatal("minimum hedge not allowed")
+	}
+
+	if _, ok := p.AcquireHedge(); ok {
+		t.Error("hedge allowed over the budget")
+	}
+
+	release()
+
+	var ends []func()
+	for i := 0; i < 30; i++ {
+		ends = append(ends, p.Begin())
+	}
+
+	// 10% of 30 in-flight requests is 3 concurrent hedges
+	for i := 0; i < 3; i++ {
+		if _, ok := p.AcquireHedge(); !ok {
+			t.Fatalf("hedge %d not allowed", i)
+		}
+	}
+
+	if _, ok := p.AcquireHedge(); ok {
+		t.Error("hedge allowed over the budget")
+	}
+
+	for _, end := range ends {
+		end()
+	}
+}
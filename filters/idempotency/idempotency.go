@@ -0,0 +1,473 @@
+/*
+Package idempotency provides the idempotencyKey filter, which makes the
+retries of unsafe requests, e.g. POST, with the same Idempotency-Key header
+safe, as described in the IETF draft "The Idempotency-Key HTTP Header
+Field".
+
+The first request of a key is sent to the backend, and its response is
+stored. While it is in flight, the requests with the same key are rejected
+with 409 Conflict. Once it is completed, the stored response is replayed to
+the requests with the same key, with the Idempotent-Replayed header. When a
+key is reused for a different request, i.e. with a different method, path
+or body, the request is rejected with 422 Unprocessable Content.
+
+The keys are scoped by the identity of the client. By default, it is the
+Authorization header of the request, or, when it is not set, the client IP,
+taken from the X-Forwarded-For header, when it is set. The identity can be
+configured:
+
+	idempotencyKey()
+	idempotencyKey("scope=jwt:sub")
+	idempotencyKey("scope=header:X-Client-Id,ttl=24h,max-body=65536")
+	idempotencyKey("scope=udid")
+
+The options are a comma separated list of key=value pairs:
+
+  - scope: the identity of the client, jwt:<claim> for a claim of the
+    bearer token, header:<name> for a request header, or udid for the udid
+    header. The JWT is not verified, it needs to be validated by an earlier
+    filter.
+  - ttl: how long the completed responses are stored, 24h by default.
+  - lock-ttl: how long a request is considered in flight at most, 1m by
+    default. It needs to be longer than the backend timeout.
+  - max-body: the maximum size of the stored response bodies in bytes,
+    1048576 by default.
+  - max-request-body: the maximum size of the request bodies in bytes,
+    1048576 by default. The larger requests are rejected with 413.
+
+The requests without the Idempotency-Key header, the safe requests, and the
+requests without the configured identity are sent to the backend without
+idempotency. The failed requests, and the responses with the status codes
+that may succeed when retried, 401, 403, 408, 409, 429 and 5xx, and the
+responses larger than max-body are not stored, so that they can be retried.
+When the store fails, the requests are sent to the backend.
+*/
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/inflight"
+	"github.com/zalando/skipper/filters/requestbody"
+	"github.com/zalando/skipper/jwt"
+	"github.com/zalando/skipper/metrics"
+	snet "github.com/zalando/skipper/net"
+)
+
+const (
+	// HeaderName is the request header of the idempotency keys.
+	HeaderName = "Idempotency-Key"
+
+	// ReplayedHeader is set on the replayed responses.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// DefaultTTL is how long the completed responses are stored by
+	// default.
+	DefaultTTL = 24 * time.Hour
+
+	// DefaultLockTTL is how long a request is considered in flight at
+	// most by default.
+	DefaultLockTTL = time.Minute
+
+	// DefaultMaxBodyBytes is the default maximum size of the stored
+	// response bodies and of the request bodies.
+	DefaultMaxBodyBytes = 1 << 20
+
+	// maxKeyLength limits the length of the idempotency keys.
+	maxKeyLength = 255
+
+	stateBagKey = "idempotency"
+)
+
+// Options configure the idempotencyKey filter.
+type Options struct {
+	// Store stores the idempotency records.
+	Store Store
+
+	// Metrics collects the replayed and rejected request counts.
+	Metrics metrics.Metrics
+}
+
+// record is an in-flight request, or, when it is completed, its response.
+type record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed,omitempty"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+type scope struct {
+	jwtClaim string
+	header   string
+}
+
+type spec struct {
+	store   Store
+	metrics metrics.Metrics
+}
+
+type filter struct {
+	store          Store
+	metrics        metrics.Metrics
+	scope          *scope
+	ttl            time.Duration
+	lockTTL        time.Duration
+	maxBody        int64
+	maxRequestBody int64
+}
+
+type state struct {
+	key         string
+	fingerprint string
+}
+
+// NewIdempotencyKey creates the filter specification of the idempotencyKey
+// filter.
+func NewIdempotencyKey(o Options) filters.Spec {
+	m := o.Metrics
+	if m == nil {
+		m = metrics.Default
+	}
+
+	return &spec{store: o.Store, metrics: m}
+}
+
+func (*spec) Name() string { return filters.IdempotencyKeyName }
+
+func parseScope(value string) (*scope, error) {
+	kind, name, _ := strings.Cut(value, ":")
+	switch {
+	case kind == "jwt" && name != "":
+		return &scope{jwtClaim: name}, nil
+	case kind == "header" && name != "":
+		return &scope{header: http.CanonicalHeaderKey(name)}, nil
+	case kind == "udid" && name == "":
+		return &scope{header: "Udid"}, nil
+	default:
+		return nil, fmt.Errorf("invalid idempotency key scope: %q", value)
+	}
+}
+
+func parseOptions(s string, f *filter) error {
+	name := filters.IdempotencyKeyName
+	return inflight.ParseOptions(name, s, func(key, value string) (err error) {
+		switch key {
+		case "scope":
+			f.scope, err = parseScope(value)
+		case "ttl":
+			f.ttl, err = inflight.ParseDuration(name, key, value)
+		case "lock-ttl":
+			f.lockTTL, err = inflight.ParseDuration(name, key, value)
+		case "max-body":
+			f.maxBody, err = inflight.ParseSize(name, key, value)
+		case "max-request-body":
+			f.maxRequestBody, err = inflight.ParseSize(name, key, value)
+		default:
+			err = inflight.UnknownOption(name, key)
+		}
+
+		return
+	})
+}
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) > 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{
+		store:          s.store,
+		metrics:        s.metrics,
+		ttl:            DefaultTTL,
+		lockTTL:        DefaultLockTTL,
+		maxBody:        DefaultMaxBodyBytes,
+		maxRequestBody: DefaultMaxBodyBytes,
+	}
+
+	if len(args) > 0 {
+		o, ok := args[0].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if err := parseOptions(o, f); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+func (f *filter) inc(result string) {
+	f.metrics.IncCounter("idempotency." + result)
+}
+
+// identity returns the identity of the client, and false, when it is
+// configured but missing. Without a configured scope, the identity is the
+// Authorization header, or, when it is not set, the client IP.
+func (s *scope) identity(req *http.Request) (string, bool) {
+	if s == nil {
+		if auth := req.Header.Get("Authorization"); auth != "" {
+			return "authorization:" + auth, true
+		}
+
+		return "ip:" + snet.RemoteAddr(req).String(), true
+	}
+
+	if s.header != "" {
+		v := req.Header.Get(s.header)
+		return v, v != ""
+	}
+
+	bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+
+	token, err := jwt.Parse(bearer)
+	if err != nil {
+		return "", false
+	}
+
+	v, ok := token.Claims[s.jwtClaim]
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprint(v), true
+}
+
+func fingerprint(req *http.Request, body io.Reader) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL.RequestURI())
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func storeKey(identity, key string) string {
+	h := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(h[:]) + ":" + key
+}
+
+func reject(ctx filters.FilterContext, status int, text string) {
+	ctx.Serve(&http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:       io.NopCloser(strings.NewReader(text)),
+	})
+}
+
+func (f *filter) get(ctx context.Context, key string) (*record, error) {
+	b, err := f.store.Get(ctx, key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var r record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return
+	}
+
+	key := req.Header.Get(HeaderName)
+	if key == "" {
+		return
+	}
+
+	if len(key) > maxKeyLength {
+		reject(ctx, http.StatusBadRequest, "Idempotency-Key too long")
+		return
+	}
+
+	identity, ok := f.scope.identity(req)
+	if !ok {
+		return
+	}
+
+	body, err := ctx.BufferedRequestBody(f.maxRequestBody)
+	if errors.Is(err, filters.ErrRequestBodyTooLarge) {
+		requestbody.Reject(ctx)
+		return
+	}
+
+	var fp string
+	if err == nil {
+		fp, err = fingerprint(req, body)
+	}
+
+	if err != nil {
+		ctx.Logger().Errorf("Failed to read request body: %v", err)
+		reject(ctx, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	st := &state{
+		key:         storeKey(identity, key),
+		fingerprint: fp,
+	}
+
+	b, err := json.Marshal(&record{Fingerprint: st.fingerprint})
+	if err != nil {
+		ctx.Logger().Errorf("Failed to encode idempotency record: %v", err)
+		f.inc("errors")
+		return
+	}
+
+	stored, err := f.store.SetNX(req.Context(), st.key, b, f.lockTTL)
+	if err != nil {
+		ctx.Logger().Errorf("Failed to store idempotency record: %v", err)
+		f.inc("errors")
+		return
+	}
+
+	if stored {
+		ctx.StateBag()[stateBagKey] = st
+		return
+	}
+
+	r, err := f.get(req.Context(), st.key)
+	if err != nil {
+		ctx.Logger().Errorf("Failed to get idempotency record: %v", err)
+		f.inc("errors")
+		return
+	}
+
+	switch {
+	case r == nil:
+		// expired or deleted since, the request can be retried
+		f.inc("conflict")
+		reject(ctx, http.StatusConflict, "A request with the same Idempotency-Key is in progress")
+	case r.Fingerprint != st.fingerprint:
+		f.inc("mismatch")
+		reject(ctx, http.StatusUnprocessableEntity, "Idempotency-Key reused with a different request")
+	case !r.Completed:
+		f.inc("conflict")
+		reject(ctx, http.StatusConflict, "A request with the same Idempotency-Key is in progress")
+	default:
+		f.inc("replayed")
+		h := r.Header.Clone()
+		if h == nil {
+			h = make(http.Header)
+		}
+
+		h.Set(ReplayedHeader, "true")
+		ctx.Serve(&http.Response{
+			StatusCode:    r.Status,
+			Header:        h,
+			ContentLength: int64(len(r.Body)),
+			Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		})
+	}
+}
+
+// retriable tells whether the response is not stored, because the request
+// may succeed when it is retried.
+func retriable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusRequestTimeout,
+		http.StatusConflict,
+		http.StatusTooManyRequests:
+		return true
+	default:
+		return status >= http.StatusInternalServerError
+	}
+}
+
+func (f *filter) release(ctx filters.FilterContext, key string) {
+	// the request context may be canceled already
+	if err := f.store.Delete(context.Background(), key); err != nil {
+		ctx.Logger().Errorf("Failed to delete idempotency record: %v", err)
+		f.inc("errors")
+	}
+}
+
+func (f *filter) Response(ctx filters.FilterContext) {
+	st, ok := ctx.StateBag()[stateBagKey].(*state)
+	if !ok {
+		return
+	}
+
+	delete(ctx.StateBag(), stateBagKey)
+
+	rsp := ctx.Response()
+	if retriable(rsp.StatusCode) || rsp.ContentLength > f.maxBody {
+		f.release(ctx, st.key)
+		return
+	}
+
+	// the response is read before it is sent, so that it is stored even
+	// when the client doesn't receive it
+	var body []byte
+	if rsp.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(rsp.Body, f.maxBody+1))
+		if err != nil {
+			ctx.Logger().Errorf("Failed to read response body: %v", err)
+			rsp.Body.Close()
+			rsp.Body = io.NopCloser(bytes.NewReader(body))
+			f.release(ctx, st.key)
+			return
+		}
+
+		if int64(len(body)) > f.maxBody {
+			rsp.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(body), rsp.Body), Closer: rsp.Body}
+			f.release(ctx, st.key)
+			return
+		}
+
+		rsp.Body.Close()
+		rsp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	b, err := json.Marshal(&record{
+		Fingerprint: st.fingerprint,
+		Completed:   true,
+		Status:      rsp.StatusCode,
+		Header:      rsp.Header.Clone(),
+		Body:        body,
+	})
+	if err == nil {
+		err = f.store.Set(context.Background(), st.key, b, f.ttl)
+	}
+
+	if err != nil {
+		ctx.Logger().Errorf("Failed to store idempotent response: %v", err)
+		f.inc("errors")
+		f.release(ctx, st.key)
+	}
+}
+
+// HandleErrorResponse enables the filter to release the key of the failed
+// requests, so that they can be retried.
+func (*filter) HandleErrorResponse() bool { return true }
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
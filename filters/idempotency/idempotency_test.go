@@ -0,0 +1,291 @@
+package idempotency
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/proxy/proxytest"
+)
+
+type testProxy struct {
+	url      string
+	requests *atomic.Int64
+	metrics  *metricstest.MockMetrics
+}
+
+func newTestProxy(t *testing.T, args string, handler http.HandlerFunc) *testProxy {
+	t.Helper()
+
+	var requests atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(backend.Close)
+
+	m := &metricstest.MockMetrics{}
+	fr := make(filters.Registry)
+	fr.Register(NewIdempotencyKey(Options{Store: NewMemoryStore(1 << 20), Metrics: m}))
+
+	p := proxytest.New(fr, eskip.MustParse(fmt.Sprintf(`* -> idempotencyKey(%s) -> "%s"`, args, backend.URL))...)
+	t.Cleanup(func() { p.Close() })
+
+	return &testProxy{url: p.URL, requests: &requests, metrics: m}
+}
+
+func (p *testProxy) do(t *testing.T, method, path, body string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, p.url+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsp, string(b)
+}
+
+func (p *testProxy) expectRequests(t *testing.T, n int64) {
+	t.Helper()
+	if r := p.requests.Load(); r != n {
+		t.Errorf("expected %d backend requests, got: %d", n, r)
+	}
+}
+
+func withKey(key string) http.Header {
+	return http.Header{HeaderName: []string{key}}
+}
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		args  []interface{}
+		fail  bool
+	}{
+		{title: "no args"},
+		{title: "options", args: []interface{}{"scope=jwt:sub, ttl=1h, lock-ttl=10s, max-body=1024, max-request-body=1024"}},
+		{title: "header scope", args: []interface{}{"scope=header:X-Client-Id"}},
+		{title: "udid scope", args: []interface{}{"scope=udid"}},
+		{title: "invalid scope", args: []interface{}{"scope=cookie:session"}, fail: true},
+		{title: "missing scope name", args: []interface{}{"scope=jwt"}, fail: true},
+		{title: "invalid option", args: []interface{}{"ttl"}, fail: true},
+		{title: "unknown option", args: []interface{}{"foo=bar"}, fail: true},
+		{title: "invalid ttl", args: []interface{}{"ttl=0s"}, fail: true},
+		{title: "invalid max body", args: []interface{}{"max-body=-1"}, fail: true},
+		{title: "not a string", args: []interface{}{42.0}, fail: true},
+		{title: "too many args", args: []interface{}{"", ""}, fail: true},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewIdempotencyKey(Options{Store: NewMemoryStore(1024)}).CreateFilter(test.args)
+			if test.fail && err == nil {
+				t.Error("failed to fail")
+			} else if !test.fail && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var n atomic.Int64
+	p := newTestProxy(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", fmt.Sprintf("/payments/%d", n.Add(1)))
+		w.WriteHeader(http.StatusCreated)
+		io.Copy(w, r.Body)
+	})
+
+	rsp1, b1 := p.do(t, http.MethodPost, "/payments", "amount=42", withKey("key-1"))
+	rsp2, b2 := p.do(t, http.MethodPost, "/payments", "amount=42", withKey("key-1"))
+	if rsp1.StatusCode != http.StatusCreated || rsp2.StatusCode != http.StatusCreated || b1 != "amount=42" || b2 != b1 {
+		t.Errorf("unexpected responses: %d %s, %d %s", rsp1.StatusCode, b1, rsp2.StatusCode, b2)
+	}
+
+	if rsp2.Header.Get("Location") != "/payments/1" || rsp2.Header.Get(ReplayedHeader) != "true" {
+		t.Errorf("unexpected replayed headers: %v", rsp2.Header)
+	}
+
+	if rsp1.Header.Get(ReplayedHeader) != "" {
+		t.Error("unexpected replayed header")
+	}
+
+	p.do(t, http.MethodPost, "/payments", "amount=42", withKey("key-2"))
+	p.do(t, http.MethodPost, "/payments", "amount=42", nil)
+	p.do(t, http.MethodPost, "/payments", "amount=42", nil)
+	p.expectRequests(t, 4)
+
+	p.metrics.WithCounters(func(counters map[string]int64) {
+		if counters["idempotency.replayed"] != 1 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestInFlightConflict(t *testing.T) {
+	var p *testProxy
+	var conflict *http.Response
+	p = newTestProxy(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if conflict == nil {
+			conflict, _ = p.do(t, http.MethodPost, "/messages", "hello", withKey("key-1"))
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	rsp, _ := p.do(t, http.MethodPost, "/messages", "hello", withKey("key-1"))
+	if rsp.StatusCode != http.StatusAccepted {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	if conflict == nil || conflict.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict, got: %v", conflict)
+	}
+
+	p.expectRequests(t, 1)
+}
+
+func TestMismatch(t *testing.T) {
+	p := newTestProxy(t, "", func(w http.ResponseWriter, r *http.Request) {})
+
+	p.do(t, http.MethodPost, "/payments", "amount=42", withKey("key-1"))
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/payments", "amount=43"},
+		{http.MethodPost, "/refunds", "amount=42"},
+		{http.MethodPatch, "/payments", "amount=42"},
+	} {
+		if rsp, _ := p.do(t, test.method, test.path, test.body, withKey("key-1")); rsp.StatusCode != http.StatusUnprocessableEntity {
+			t.Errorf("%s %s %s: unexpected status: %d", test.method, test.path, test.body, rsp.StatusCode)
+		}
+	}
+
+	p.expectRequests(t, 1)
+}
+
+func TestRetriableResponseNotStored(t *testing.T) {
+	var n atomic.Int64
+	p := newTestProxy(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if n.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+
+	if rsp, _ := p.do(t, http.MethodPost, "/payments", "", withKey("key-1")); rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	if rsp, _ := p.do(t, http.MethodPost, "/payments", "", withKey("key-1")); rsp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	p.expectRequests(t, 2)
+}
+
+func TestLargeBodies(t *testing.T) {
+	p := newTestProxy(t, `"max-body=8,max-request-body=8"`, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a large response"))
+	})
+
+	if rsp, _ := p.do(t, http.MethodPost, "/payments", "a large request", withKey("key-1")); rsp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, b := p.do(t, http.MethodPost, "/payments", "small", withKey("key-2")); b != "a large response" {
+			t.Errorf("unexpected response: %s", b)
+		}
+	}
+
+	p.expectRequests(t, 2)
+}
+
+func TestScope(t *testing.T) {
+	token := func(sub string) string {
+		claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":%q}`, sub)))
+		return "Bearer eyJhbGciOiJub25lIn0." + claims + ".sig"
+	}
+
+	for _, test := range []struct {
+		title    string
+		args     string
+		header   func(user string) http.Header
+		expected int64
+	}{{
+		title: "jwt claim",
+		args:  `"scope=jwt:sub"`,
+		header: func(user string) http.Header {
+			return http.Header{"Authorization": []string{token(user)}}
+		},
+		expected: 2,
+	}, {
+		title: "header",
+		args:  `"scope=header:X-Client-Id"`,
+		header: func(user string) http.Header {
+			return http.Header{"X-Client-Id": []string{user}}
+		},
+		expected: 2,
+	}, {
+		title: "udid",
+		args:  `"scope=udid"`,
+		header: func(user string) http.Header {
+			return http.Header{"Udid": []string{user}}
+		},
+		expected: 2,
+	}, {
+		title: "default, authorization",
+		header: func(user string) http.Header {
+			return http.Header{"Authorization": []string{"Basic " + user}}
+		},
+		expected: 2,
+	}, {
+		title: "default, client IP",
+		header: func(user string) http.Header {
+			ips := map[string]string{"alice": "192.0.2.1", "bob": "192.0.2.2"}
+			return http.Header{"X-Forwarded-For": []string{ips[user]}}
+		},
+		expected: 2,
+	}, {
+		title: "missing identity",
+		args:  `"scope=udid"`,
+		header: func(string) http.Header {
+			return http.Header{}
+		},
+		expected: 3,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			p := newTestProxy(t, test.args, func(w http.ResponseWriter, r *http.Request) {})
+			for _, user := range []string{"alice", "bob", "alice"} {
+				h := test.header(user)
+				h.Set(HeaderName, "key-1")
+				p.do(t, http.MethodPost, "/messages", "hello", h)
+			}
+
+			p.expectRequests(t, test.expected)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/zalando/skipper/filters/cache"
+	"github.com/zalando/skipper/net"
+)
+
+// redisKeyPrefix is the prefix of the keys of the idempotency records in
+// Redis.
+const redisKeyPrefix = "skipper.idempotency."
+
+// Store stores the idempotency records.
+type Store interface {
+	// Get returns the value stored with the key, or nil, when there is no
+	// value stored.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// SetNX stores the value with the key, for at most the ttl, only when
+	// there is no value stored with the key. It returns false, when there
+	// is.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Set stores the value with the key, for at most the ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the value stored with the key.
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrTooLarge is returned by the memory store, when a value doesn't fit in
+// the store.
+var ErrTooLarge = errors.New("idempotency record too large")
+
+// lock is the record of an in-flight request.
+type lock struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	locks    map[string]lock
+	store    cache.Store
+}
+
+// NewMemoryStore creates an in-memory store, which removes the least
+// recently used completed records, when the size of their keys and values
+// exceeds maxBytes. The records of the in-flight requests are kept until
+// they are completed, deleted, or expire.
+func NewMemoryStore(maxBytes int64) Store {
+	return &memoryStore{
+		maxBytes: maxBytes,
+		locks:    make(map[string]lock),
+		store:    cache.NewMemoryStore(maxBytes),
+	}
+}
+
+// getLock returns the unexpired record of an in-flight request, and
+// removes the expired one.
+func (s *memoryStore) getLock(key string) ([]byte, bool) {
+	l, ok := s.locks[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !time.Now().Before(l.expiresAt) {
+		delete(s.locks, key)
+		return nil, false
+	}
+
+	return l.value, true
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.getLock(key); ok {
+		return v, nil
+	}
+
+	return s.store.Get(ctx, key)
+}
+
+func (s *memoryStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.getLock(key); ok {
+		return false, nil
+	}
+
+	v, err := s.store.Get(ctx, key)
+	if err != nil || v != nil {
+		return false, err
+	}
+
+	s.locks[key] = lock{value: value, expiresAt: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if int64(len(key)+len(value)) > s.maxBytes {
+		return ErrTooLarge
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.locks, key)
+	return s.store.Set(ctx, key, value, ttl)
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.locks, key)
+	return s.store.Delete(ctx, key)
+}
+
+type redisStore struct {
+	client *net.RedisRingClient
+}
+
+// NewRedisStore creates a store, which stores the records in the Redis
+// ring.
+func NewRedisStore(client *net.RedisRingClient) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.client.Get(ctx, redisKeyPrefix+key)
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(v), nil
+}
+
+func (s *redisStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, redisKeyPrefix+key, value, ttl)
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.client.Set(ctx, redisKeyPrefix+key, value, ttl)
+	return err
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Del(ctx, redisKeyPrefix+key)
+	return err
+}
@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/net"
+	"github.com/zalando/skipper/net/redistest"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if ok, err := s.SetNX(ctx, "foo", []byte("bar"), time.Minute); err != nil || !ok {
+		t.Fatalf("failed to set value: %v, %v", ok, err)
+	}
+
+	if ok, err := s.SetNX(ctx, "foo", []byte("baz"), time.Minute); err != nil || ok {
+		t.Fatalf("unexpected set of existing value: %v, %v", ok, err)
+	}
+
+	if v, err := s.Get(ctx, "foo"); err != nil || string(v) != "bar" {
+		t.Fatalf("unexpected value: %s, %v", v, err)
+	}
+
+	if err := s.Set(ctx, "foo", []byte("baz"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.Get(ctx, "foo"); err != nil || string(v) != "baz" {
+		t.Fatalf("unexpected value: %s, %v", v, err)
+	}
+
+	if err := s.Delete(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := s.Get(ctx, "foo"); err != nil || v != nil {
+		t.Fatalf("unexpected value after delete: %s, %v", v, err)
+	}
+
+	if ok, err := s.SetNX(ctx, "foo", []byte("qux"), time.Minute); err != nil || !ok {
+		t.Fatalf("failed to set value after delete: %v, %v", ok, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(1024))
+}
+
+func TestMemoryStoreLocksNotEvicted(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(16)
+
+	if ok, err := s.SetNX(ctx, "lock", []byte("in-flight"), time.Minute); err != nil || !ok {
+		t.Fatalf("failed to lock: %v, %v", ok, err)
+	}
+
+	// completed records exceeding the size of the store
+	for _, key := range []string{"foo", "bar", "baz"} {
+		if err := s.Set(ctx, key, []byte("completed"), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ok, err := s.SetNX(ctx, "lock", []byte("in-flight"), time.Minute); err != nil || ok {
+		t.Fatalf("unexpected lock of evicted in-flight record: %v, %v", ok, err)
+	}
+
+	if err := s.Set(ctx, "lock", []byte("too large to store"), time.Minute); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected too large error, got: %v", err)
+	}
+
+	if err := s.Delete(ctx, "lock"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := s.SetNX(ctx, "lock", []byte("in-flight"), time.Minute); err != nil || !ok {
+		t.Fatalf("failed to lock after delete: %v, %v", ok, err)
+	}
+}
+
+func TestMemoryStoreLockExpires(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(1024)
+
+	if ok, err := s.SetNX(ctx, "foo", []byte("bar"), time.Millisecond); err != nil || !ok {
+		t.Fatalf("failed to lock: %v, %v", ok, err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if ok, err := s.SetNX(ctx, "foo", []byte("bar"), time.Minute); err != nil || !ok {
+		t.Fatalf("failed to lock expired record: %v, %v", ok, err)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	redisAddr, done := redistest.NewTestRedis(t)
+	defer done()
+
+	client := net.NewRedisRingClient(&net.RedisOptions{Addrs: []string{redisAddr}})
+	defer client.Close()
+
+	testStore(t, NewRedisStore(client))
+}
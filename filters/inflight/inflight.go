@@ -0,0 +1,212 @@
+/*
+Package inflight provides the parts shared by the filters that collapse the
+concurrent backend requests of the same key, like the cache and the coalesce
+filters: the group of the in-flight backend requests, the copying of the
+response bodies while they are streamed to the client, the Vary header of
+the responses, and the parsing of the filter options.
+*/
+package inflight
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Group holds the in-flight backend requests by key.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*Call
+}
+
+// Call is an in-flight backend request. The requests of the same key wait
+// for it to be released.
+type Call struct {
+	started time.Time
+	done    chan struct{}
+	value   interface{}
+}
+
+// Body copies the response body, while it is streamed to the client, and
+// passes the copy to onClose, when the body is closed.
+type Body struct {
+	io.ReadCloser
+	maxBytes int64
+	onClose  func(body []byte, complete bool)
+
+	buf      bytes.Buffer
+	tooLarge bool
+	eof      bool
+	once     sync.Once
+}
+
+// NewGroup creates an empty group.
+func NewGroup() *Group {
+	return &Group{calls: make(map[string]*Call)}
+}
+
+// Begin registers the backend request of the key. It returns false, when
+// another request of the key is in flight for less than the timeout, and
+// its call. The calls in flight for longer are released and taken over, so
+// that a lost call doesn't block the key.
+func (g *Group) Begin(key string, timeout time.Duration) (*Call, bool) {
+	now := time.Now()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.calls[key]; ok {
+		if now.Sub(c.started) < timeout {
+			return c, false
+		}
+
+		c.release(nil)
+	}
+
+	c := &Call{started: now, done: make(chan struct{})}
+	g.calls[key] = c
+	return c, true
+}
+
+// End releases the requests waiting for the call, passing them the value,
+// when the call was not released before. The call can be nil.
+func (g *Group) End(key string, c *Call, value interface{}) {
+	if c == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+
+	c.release(value)
+}
+
+func (c *Call) release(value interface{}) {
+	select {
+	case <-c.done:
+	default:
+		c.value = value
+		close(c.done)
+	}
+}
+
+// Wait waits until the call is released, but not longer than the timeout
+// measured from the start of the call, or until the context is done. It
+// returns the value of the call, and whether it was released.
+func (c *Call) Wait(ctx context.Context, timeout time.Duration) (interface{}, bool) {
+	timer := time.NewTimer(timeout - time.Since(c.started))
+	defer timer.Stop()
+
+	select {
+	case <-c.done:
+		return c.value, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	return nil, false
+}
+
+// NewBody creates a body copying at most maxBytes of the body. The copy is
+// complete, when the body was read until the end, within the limit.
+func NewBody(body io.ReadCloser, maxBytes int64, onClose func(body []byte, complete bool)) *Body {
+	return &Body{ReadCloser: body, maxBytes: maxBytes, onClose: onClose}
+}
+
+func (b *Body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.tooLarge {
+		if int64(b.buf.Len()+n) > b.maxBytes {
+			b.tooLarge = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+func (b *Body) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.onClose(b.buf.Bytes(), b.eof && !b.tooLarge)
+	})
+
+	return err
+}
+
+// VaryHeaders returns the canonical names of the request headers listed by
+// the Vary header of the response.
+func VaryHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	return names
+}
+
+// ParseOptions parses the comma separated key=value options of the filter,
+// calling set for each of them.
+func ParseOptions(filterName, s string, set func(key, value string) error) error {
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(o, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s option: %q", filterName, o)
+		}
+
+		if err := set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ParseDuration parses the positive duration value of an option.
+func ParseDuration(filterName, key, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %s: %q", filterName, key, value)
+	}
+
+	return d, nil
+}
+
+// ParseSize parses the positive size value of an option, in bytes.
+func ParseSize(filterName, key, value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %s: %q", filterName, key, value)
+	}
+
+	return n, nil
+}
+
+// UnknownOption returns the error of an unknown option of the filter.
+func UnknownOption(filterName, key string) error {
+	return fmt.Errorf("unknown %s option: %q", filterName, key)
+}
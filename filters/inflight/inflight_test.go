@@ -0,0 +1,140 @@
+package inflight
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	g := NewGroup()
+
+	c, leader := g.Begin("foo", time.Minute)
+	if !leader {
+		t.Fatal("expected the first call to lead")
+	}
+
+	if w, leader := g.Begin("foo", time.Minute); leader || w != c {
+		t.Fatal("expected the second call to wait")
+	}
+
+	go g.End("foo", c, "bar")
+	if v, ok := c.Wait(context.Background(), time.Minute); !ok || v != "bar" {
+		t.Errorf("unexpected value: %v %t", v, ok)
+	}
+
+	if _, leader := g.Begin("foo", time.Minute); !leader {
+		t.Error("expected the key to be released")
+	}
+
+	g.End("bar", nil, nil)
+}
+
+func TestGroupTakeOver(t *testing.T) {
+	g := NewGroup()
+
+	c, _ := g.Begin("foo", time.Minute)
+	taken, leader := g.Begin("foo", 0)
+	if !leader || taken == c {
+		t.Fatal("expected the call to be taken over")
+	}
+
+	if v, ok := c.Wait(context.Background(), time.Minute); !ok || v != nil {
+		t.Errorf("expected the lost call to be released, got: %v %t", v, ok)
+	}
+
+	// ending the lost call doesn't release the new one
+	g.End("foo", c, "bar")
+	if _, ok := taken.Wait(context.Background(), 10*time.Millisecond); ok {
+		t.Error("unexpected release")
+	}
+}
+
+func TestBody(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		maxBytes int64
+		readAll  bool
+		complete bool
+	}{
+		{title: "complete", maxBytes: 8, readAll: true, complete: true},
+		{title: "too large", maxBytes: 2, readAll: true},
+		{title: "not read", maxBytes: 8},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			var (
+				copied   string
+				complete bool
+			)
+
+			b := NewBody(io.NopCloser(strings.NewReader("foo")), test.maxBytes, func(body []byte, c bool) {
+				copied, complete = string(body), c
+			})
+
+			if test.readAll {
+				if _, err := io.ReadAll(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			b.Close()
+			if complete != test.complete || complete && copied != "foo" {
+				t.Errorf("unexpected copy: %q %t", copied, complete)
+			}
+		})
+	}
+}
+
+func TestVaryHeaders(t *testing.T) {
+	h := http.Header{"Vary": []string{"accept-encoding, Accept-Language", " *"}}
+	names := VaryHeaders(h)
+	if strings.Join(names, ",") != "Accept-Encoding,Accept-Language,*" {
+		t.Errorf("unexpected headers: %v", names)
+	}
+
+	if names := VaryHeaders(http.Header{}); len(names) != 0 {
+		t.Errorf("unexpected headers: %v", names)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	var wait time.Duration
+	var size int64
+	err := ParseOptions("test", "wait=1s, max-body=42", func(key, value string) (err error) {
+		switch key {
+		case "wait":
+			wait, err = ParseDuration("test", key, value)
+		case "max-body":
+			size, err = ParseSize("test", key, value)
+		default:
+			err = UnknownOption("test", key)
+		}
+
+		return
+	})
+
+	if err != nil || wait != time.Second || size != 42 {
+		t.Errorf("unexpected result: %v %v %d", err, wait, size)
+	}
+
+	for _, s := range []string{"wait", "wait=0s", "max-body=-1", "foo=bar"} {
+		if err := ParseOptions("test", s, func(key, value string) error {
+			if key == "wait" {
+				_, err := ParseDuration("test", key, value)
+				return err
+			}
+
+			if key == "max-body" {
+				_, err := ParseSize("test", key, value)
+				return err
+			}
+
+			return UnknownOption("test", key)
+		}); err == nil {
+			t.Errorf("failed to fail: %s", s)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Package inflighttest provides a test proxy for the filters that collapse the
+concurrent backend requests, counting the requests of its backend.
+*/
+package inflighttest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/proxy/proxytest"
+)
+
+// Proxy is a test proxy with a single route, that applies the tested filter
+// before proxying the requests to the test backend.
+type Proxy struct {
+	URL      string
+	Metrics  *metricstest.MockMetrics
+	requests atomic.Int64
+}
+
+// New starts a proxy with a route applying the filter, e.g. cache("key"),
+// and a backend handling the requests with the handler. The filter
+// specification is created with the mock metrics of the proxy. The proxy
+// and the backend are closed when the test finishes.
+func New(t *testing.T, spec func(metrics.Metrics) filters.Spec, filter string, handler http.HandlerFunc) *Proxy {
+	t.Helper()
+
+	p := &Proxy{Metrics: &metricstest.MockMetrics{}}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(backend.Close)
+
+	fr := make(filters.Registry)
+	fr.Register(spec(p.Metrics))
+
+	tp := proxytest.New(fr, eskip.MustParse(fmt.Sprintf(`* -> %s -> "%s"`, filter, backend.URL))...)
+	t.Cleanup(func() { tp.Close() })
+
+	p.URL = tp.URL
+	return p
+}
+
+// Do sends a request to the proxy, and returns the response with the body
+// read. It can be called from other goroutines than the test: on failure,
+// it reports the error and returns an empty response.
+func (p *Proxy) Do(t *testing.T, method, path string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, p.URL+path, nil)
+	if err != nil {
+		t.Error(err)
+		return &http.Response{Header: make(http.Header)}, ""
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Error(err)
+		return &http.Response{Header: make(http.Header)}, ""
+	}
+	defer rsp.Body.Close()
+
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Error(err)
+	}
+
+	return rsp, string(b)
+}
+
+// ExpectRequests checks the number of the requests received by the
+// backend.
+func (p *Proxy) ExpectRequests(t *testing.T, n int64) {
+	t.Helper()
+	if r := p.requests.Load(); r != n {
+		t.Errorf("expected %d backend requests, got: %d", n, r)
+	}
+}
+
+// ExpectCounter checks a counter of the mock metrics.
+func (p *Proxy) ExpectCounter(t *testing.T, key string, n int64) {
+	t.Helper()
+	p.Metrics.WithCounters(func(counters map[string]int64) {
+		if counters[key] != n {
+			t.Errorf("expected %s: %d, got: %v", key, n, counters)
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package filters
+
+import "gopkg.in/yaml.v2"
+
+// PluginConfig is the configuration section of a single plugin, taken from
+// the plugin-config key of the skipper YAML config file:
+//
+//	plugin-config:
+//	  teapot:
+//	    s3-bucket: my-bucket
+//
+// Plugins decode it into their own typed configuration with Decode.
+type PluginConfig map[string]interface{}
+
+// Decode decodes the configuration section into v, using the yaml tags of
+// v. Unknown keys are reported as an error.
+func (c PluginConfig) Decode(v interface{}) error {
+	if len(c) == 0 {
+		return nil
+	}
+
+	b, err := yaml.Marshal(map[string]interface{}(c))
+	if err != nil {
+		return err
+	}
+
+	return yaml.UnmarshalStrict(b, v)
+}
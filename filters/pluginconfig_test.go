@@ -0,0 +1,44 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestPluginConfigDecode(t *testing.T) {
+	var sections map[string]PluginConfig
+	if err := yaml.Unmarshal([]byte(`
+teapot:
+  s3-bucket: my-bucket
+  interval: 1m
+  allowed:
+    127.0.0.1: local
+`), &sections); err != nil {
+		t.Fatal(err)
+	}
+
+	type teapotConfig struct {
+		S3Bucket string            `yaml:"s3-bucket"`
+		Interval time.Duration     `yaml:"interval"`
+		Allowed  map[string]string `yaml:"allowed"`
+	}
+
+	var c teapotConfig
+	if err := sections["teapot"].Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.S3Bucket != "my-bucket" || c.Interval != time.Minute || c.Allowed["127.0.0.1"] != "local" {
+		t.Errorf("unexpected config: %+v", c)
+	}
+
+	if err := sections["missing"].Decode(&c); err != nil {
+		t.Errorf("expected no error for a missing section, got: %v", err)
+	}
+
+	if err := (PluginConfig{"unknown": true}).Decode(&c); err == nil {
+		t.Error("expected error for an unknown key")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Package requestbody provides the maxRequestBody filter, which limits the
+size of the request bodies.
+
+The requests, whose Content-Length header exceeds the limit, are rejected
+with 413 Request Entity Too Large, before they are sent to the backend. The
+bodies without a declared length, e.g. chunked uploads, are cut off, once
+the limit is exceeded, and the reads of the body return ErrTooLarge. The
+proxy responds then with 413, and the filters reading the body are expected
+to do the same.
+
+	maxRequestBody(1048576)
+
+The proxy applies the same limit to all the routes without the filter,
+when a global default is configured.
+*/
+package requestbody
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// ErrTooLarge is returned by the reads of the limited request bodies,
+// when the body exceeds the limit.
+var ErrTooLarge = filters.ErrRequestBodyTooLarge
+
+// limitedBody returns ErrTooLarge, when more than the limit is read from
+// the body.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded *atomic.Bool
+}
+
+type filter struct {
+	limit int64
+}
+
+type spec struct{}
+
+// NewMaxRequestBody creates the filter specification of the
+// maxRequestBody filter.
+func NewMaxRequestBody() filters.Spec {
+	return spec{}
+}
+
+func (spec) Name() string { return filters.MaxRequestBodyName }
+
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var limit int64
+	switch v := args[0].(type) {
+	case float64:
+		limit = int64(v)
+	case int:
+		limit = int64(v)
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if limit < 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return filter{limit: limit}, nil
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit {
+		return 0, ErrTooLarge
+	}
+
+	// reading one more byte than the limit tells whether the body
+	// exceeds it
+	if rest := b.limit + 1 - b.read; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		b.exceeded.Store(true)
+		return n - int(b.read-b.limit), ErrTooLarge
+	}
+
+	return n, err
+}
+
+// Limit limits the body of the request to maxBytes. When the request
+// body was already limited, the previous limit is replaced. It returns
+// false, when the Content-Length of the request exceeds the limit.
+func Limit(ctx filters.FilterContext, maxBytes int64) bool {
+	exceeded, ok := ctx.StateBag()[filters.RequestBodyExceeded].(*atomic.Bool)
+	if !ok {
+		exceeded = &atomic.Bool{}
+		ctx.StateBag()[filters.RequestBodyExceeded] = exceeded
+	}
+
+	req := ctx.Request()
+	if req.ContentLength > maxBytes {
+		exceeded.Store(true)
+		return false
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+
+	body := req.Body
+	if lb, ok := body.(*limitedBody); ok {
+		body = lb.ReadCloser
+	}
+
+	req.Body = &limitedBody{ReadCloser: body, limit: maxBytes, exceeded: exceeded}
+	return true
+}
+
+// Exceeded tells whether the request body exceeded the limit.
+func Exceeded(ctx filters.FilterContext) bool {
+	exceeded, ok := ctx.StateBag()[filters.RequestBodyExceeded].(*atomic.Bool)
+	return ok && exceeded.Load()
+}
+
+// Reject responds with 413 Request Entity Too Large.
+func Reject(ctx filters.FilterContext) {
+	ctx.Serve(&http.Response{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+		Body:       io.NopCloser(strings.NewReader(http.StatusText(http.StatusRequestEntityTooLarge))),
+	})
+}
+
+func (f filter) Request(ctx filters.FilterContext) {
+	if !Limit(ctx, f.limit) {
+		Reject(ctx)
+	}
+}
+
+func (filter) Response(filters.FilterContext) {}
@@ -0,0 +1,103 @@
+package requestbody
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		args  []interface{}
+		fail  bool
+	}{
+		{title: "limit", args: []interface{}{1024.0}},
+		{title: "zero", args: []interface{}{0.0}},
+		{title: "no args", fail: true},
+		{title: "negative", args: []interface{}{-1.0}, fail: true},
+		{title: "not a number", args: []interface{}{"1024"}, fail: true},
+		{title: "too many args", args: []interface{}{1024.0, 1024.0}, fail: true},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := NewMaxRequestBody().CreateFilter(test.args)
+			if test.fail && err == nil {
+				t.Error("failed to fail")
+			} else if !test.fail && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func newContext(body string, contentLength int64) *filtertest.Context {
+	return &filtertest.Context{
+		FRequest: &http.Request{
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: contentLength,
+		},
+		FStateBag: make(map[string]interface{}),
+	}
+}
+
+func TestDeclaredLength(t *testing.T) {
+	f, _ := NewMaxRequestBody().CreateFilter([]interface{}{4.0})
+
+	ctx := newContext("12345", 5)
+	f.Request(ctx)
+	if !ctx.FServed || ctx.FResponse.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Error("request not rejected")
+	}
+
+	if !Exceeded(ctx) {
+		t.Error("exceeded limit not recorded")
+	}
+
+	ctx = newContext("1234", 4)
+	f.Request(ctx)
+	if ctx.FServed || Exceeded(ctx) {
+		t.Error("request rejected")
+	}
+
+	if b, err := io.ReadAll(ctx.FRequest.Body); err != nil || string(b) != "1234" {
+		t.Errorf("unexpected body: %s, %v", b, err)
+	}
+}
+
+func TestStreamedBody(t *testing.T) {
+	f, _ := NewMaxRequestBody().CreateFilter([]interface{}{4.0})
+
+	ctx := newContext("12345", -1)
+	f.Request(ctx)
+	if ctx.FServed {
+		t.Fatal("request rejected")
+	}
+
+	b, err := io.ReadAll(ctx.FRequest.Body)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected too large error, got: %v", err)
+	}
+
+	if string(b) != "1234" {
+		t.Errorf("unexpected body read: %s", b)
+	}
+
+	if !Exceeded(ctx) {
+		t.Error("exceeded limit not recorded")
+	}
+}
+
+func TestReplaceLimit(t *testing.T) {
+	ctx := newContext("12345", -1)
+	if !Limit(ctx, 2) || !Limit(ctx, 8) {
+		t.Fatal("request rejected")
+	}
+
+	if b, err := io.ReadAll(ctx.FRequest.Body); err != nil || string(b) != "12345" {
+		t.Errorf("unexpected body: %s, %v", b, err)
+	}
+}
@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// Budget limits the concurrent extra requests of a route, retries or
+// hedges, to a percentage of its in-flight requests. A minimum number of
+// concurrent extra requests is always allowed.
+type Budget struct {
+	percent       int64
+	minConcurrent int64
+	requests      atomic.Int64
+	extra         atomic.Int64
+}
+
+// IdempotentMethod tells whether the HTTP method is idempotent, and the
+// requests with the method can be sent to the backend more than once.
+func IdempotentMethod(method string) bool {
+	return idempotentMethods[method]
+}
+
+// NewBudget creates a budget allowing percent of the in-flight requests as
+// concurrent extra requests, but at least minConcurrent.
+func NewBudget(percent, minConcurrent int64) *Budget {
+	return &Budget{percent: percent, minConcurrent: minConcurrent}
+}
+
+// Begin counts an in-flight request. The returned function needs to be
+// called when the request is done.
+func (b *Budget) Begin() func() {
+	if b == nil {
+		return func() {}
+	}
+
+	b.requests.Add(1)
+	return func() { b.requests.Add(-1) }
+}
+
+// Acquire takes an extra request from the budget. When it succeeds, the
+// returned function needs to be called when the extra request is done.
+func (b *Budget) Acquire() (func(), bool) {
+	if b == nil {
+		return func() {}, true
+	}
+
+	limit := b.requests.Load() * b.percent / 100
+	if limit < b.minConcurrent {
+		limit = b.minConcurrent
+	}
+
+	if b.extra.Add(1) > limit {
+		b.extra.Add(-1)
+		return nil, false
+	}
+
+	return func() { b.extra.Add(-1) }, true
+}
@@ -0,0 +1,295 @@
+/*
+Package retry provides the retry filter, which sets the policy used by the
+proxy to retry failed backend requests on the route.
+
+The filter takes the maximum number of attempts, including the first one, and
+optionally the retry conditions, the timeout of a single attempt and further
+options:
+
+	retry(3)
+	retry(3, "connect-failure,reset,timeout,503")
+	retry(3, "connect-failure,gateway-error", "500ms")
+	retry(3, "connect-failure,reset", "1s", "budget=10,max-body=1048576,methods=all,endpoint=same")
+
+The conditions are a comma separated list of:
+
+  - connect-failure: the connection to the backend could not be established
+  - reset: the connection was reset or closed before a response was received
+  - timeout: the attempt timed out, see the per-try timeout
+  - gateway-error: the backend responded with 502, 503 or 504
+  - a status code, e.g. 503: the backend responded with this status
+
+The default conditions are connect-failure and reset.
+
+The options are a comma separated list of key=value pairs:
+
+  - budget: the percentage of the in-flight requests of the route that may
+    be retries at the same time, 20 by default. At least 3 concurrent retries
+    are always allowed.
+  - max-body: the maximum request body size in bytes that is buffered, so
+    that requests with a body can be retried, 65536 by default. Requests with
+    a larger body are not retried.
+  - methods: idempotent (default) only retries GET, HEAD, OPTIONS, TRACE, PUT
+    and DELETE requests, all retries requests with any method.
+  - endpoint: different (default) sends each attempt to a different endpoint
+    of a load balanced backend when possible, same uses the load balancer
+    algorithm without restrictions.
+*/
+package retry
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// Condition is a reason for retrying a backend request.
+type Condition int
+
+const (
+	// ConnectFailure retries when the connection could not be established.
+	ConnectFailure Condition = 1 << iota
+
+	// Reset retries when the connection was reset before a response was received.
+	Reset
+
+	// Timeout retries when a single attempt timed out.
+	Timeout
+)
+
+const (
+	// DefaultBudgetPercent is the default percentage of the in-flight
+	// requests that may be retried at the same time.
+	DefaultBudgetPercent = 20
+
+	// DefaultMaxBodyBytes is the default maximum request body size that is
+	// buffered for retries.
+	DefaultMaxBodyBytes = 64 * 1024
+
+	minRetryConcurrency = 3
+)
+
+// Policy is set in the state bag by the retry filter, with the key
+// filters.BackendRetry, and applied by the proxy.
+type Policy struct {
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+
+	// Conditions are the errors that are retried.
+	Conditions Condition
+
+	// StatusCodes are the backend response statuses that are retried.
+	StatusCodes map[int]bool
+
+	// AllMethods enables retrying requests with non-idempotent methods.
+	AllMethods bool
+
+	// PerTryTimeout is the timeout of a single attempt, when not zero.
+	PerTryTimeout time.Duration
+
+	// MaxBodyBytes is the maximum request body size that is buffered.
+	MaxBodyBytes int64
+
+	// SameEndpoint disables choosing a different endpoint for each attempt.
+	SameEndpoint bool
+
+	budget *Budget
+}
+
+type spec struct{}
+
+type filter struct {
+	policy *Policy
+}
+
+// NewRetry creates the filter specification of the retry filter.
+func NewRetry() filters.Spec {
+	return spec{}
+}
+
+func (spec) Name() string { return filters.RetryName }
+
+func parseConditions(s string, p *Policy) error {
+	for _, c := range strings.Split(s, ",") {
+		switch c = strings.TrimSpace(c); c {
+		case "":
+		case "connect-failure":
+			p.Conditions |= ConnectFailure
+		case "reset":
+			p.Conditions |= Reset
+		case "timeout":
+			p.Conditions |= Timeout
+		case "gateway-error":
+			p.StatusCodes[http.StatusBadGateway] = true
+			p.StatusCodes[http.StatusServiceUnavailable] = true
+			p.StatusCodes[http.StatusGatewayTimeout] = true
+		default:
+			code, err := strconv.Atoi(c)
+			if err != nil || code < 100 || code > 599 {
+				return fmt.Errorf("invalid retry condition: %q", c)
+			}
+
+			p.StatusCodes[code] = true
+		}
+	}
+
+	return nil
+}
+
+func parseOptions(s string, p *Policy) error {
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(o, "=")
+		if !ok {
+			return fmt.Errorf("invalid retry option: %q", o)
+		}
+
+		switch key {
+		case "budget":
+			percent, err := strconv.Atoi(value)
+			if err != nil || percent < 0 || percent > 100 {
+				return fmt.Errorf("invalid retry budget: %q", value)
+			}
+
+			p.budget.percent = int64(percent)
+		case "max-body":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid retry max body: %q", value)
+			}
+
+			p.MaxBodyBytes = n
+		case "methods":
+			switch value {
+			case "idempotent":
+				p.AllMethods = false
+			case "all":
+				p.AllMethods = true
+			default:
+				return fmt.Errorf("invalid retry methods: %q", value)
+			}
+		case "endpoint":
+			switch value {
+			case "different":
+				p.SameEndpoint = false
+			case "same":
+				p.SameEndpoint = true
+			default:
+				return fmt.Errorf("invalid retry endpoint: %q", value)
+			}
+		default:
+			return fmt.Errorf("unknown retry option: %q", key)
+		}
+	}
+
+	return nil
+}
+
+func (spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 || len(args) > 4 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	p := &Policy{
+		Conditions:   ConnectFailure | Reset,
+		StatusCodes:  make(map[int]bool),
+		MaxBodyBytes: DefaultMaxBodyBytes,
+		budget:       NewBudget(DefaultBudgetPercent, minRetryConcurrency),
+	}
+
+	switch v := args[0].(type) {
+	case int:
+		p.Attempts = v
+	case float64:
+		p.Attempts = int(v)
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if p.Attempts < 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if len(args) > 1 {
+		s, ok := args[1].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		p.Conditions = 0
+		if err := parseConditions(s, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) > 2 {
+		switch v := args[2].(type) {
+		case int:
+			p.PerTryTimeout = time.Duration(v) * time.Millisecond
+		case float64:
+			p.PerTryTimeout = time.Duration(v * float64(time.Millisecond))
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, err
+			}
+
+			p.PerTryTimeout = d
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	}
+
+	if len(args) > 3 {
+		s, ok := args[3].(string)
+		if !ok {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if err := parseOptions(s, p); err != nil {
+			return nil, err
+		}
+	}
+
+	return &filter{policy: p}, nil
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	ctx.StateBag()[filters.BackendRetry] = f.policy
+}
+
+func (*filter) Response(filters.FilterContext) {}
+
+// RetryOn tells whether the condition is retried.
+func (p *Policy) RetryOn(c Condition) bool {
+	return p.Conditions&c != 0
+}
+
+// RetryStatus tells whether a backend response with the status is retried.
+func (p *Policy) RetryStatus(code int) bool {
+	return p.StatusCodes[code]
+}
+
+// RetryMethod tells whether requests with the method can be retried.
+func (p *Policy) RetryMethod(method string) bool {
+	return p.AllMethods || IdempotentMethod(method)
+}
+
+// Begin counts an in-flight request for the retry budget. The returned
+// function needs to be called when the request is done.
+func (p *Policy) Begin() func() {
+	return p.budget.Begin()
+}
+
+// AcquireRetry takes a retry from the budget. When it succeeds, the returned
+// function needs to be called when the retry is done.
+func (p *Policy) AcquireRetry() (func(), bool) {
+	return p.budget.Acquire()
+}
@@ -0,0 +1,137 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestCreateFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []interface{}
+		fail bool
+	}{
+		{name: "no args", fail: true},
+		{name: "attempts", args: []interface{}{3.0}},
+		{name: "invalid attempts", args: []interface{}{0.0}, fail: true},
+		{name: "attempts not a number", args: []interface{}{"3"}, fail: true},
+		{name: "conditions", args: []interface{}{3.0, "connect-failure,reset,timeout,gateway-error,429"}},
+		{name: "invalid condition", args: []interface{}{3.0, "sometimes"}, fail: true},
+		{name: "invalid status", args: []interface{}{3.0, "999"}, fail: true},
+		{name: "timeout string", args: []interface{}{3.0, "503", "500ms"}},
+		{name: "timeout millis", args: []interface{}{3.0, "503", 500.0}},
+		{name: "invalid timeout", args: []interface{}{3.0, "503", "soon"}, fail: true},
+		{name: "options", args: []interface{}{3.0, "503", "1s", "budget=10, max-body=1024, methods=all, endpoint=same"}},
+		{name: "invalid option", args: []interface{}{3.0, "503", "1s", "budget"}, fail: true},
+		{name: "unknown option", args: []interface{}{3.0, "503", "1s", "foo=bar"}, fail: true},
+		{name: "invalid budget", args: []interface{}{3.0, "503", "1s", "budget=120"}, fail: true},
+		{name: "invalid methods", args: []interface{}{3.0, "503", "1s", "methods=some"}, fail: true},
+		{name: "too many args", args: []interface{}{3.0, "503", "1s", "", "x"}, fail: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRetry().CreateFilter(tt.args)
+			if tt.fail && err == nil {
+				t.Error("expected error")
+			} else if !tt.fail && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	f, err := NewRetry().CreateFilter([]interface{}{3.0, "connect-failure,gateway-error", "250ms", "max-body=10,endpoint=same"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &filtertest.Context{FRequest: &http.Request{}, FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+
+	p, ok := ctx.StateBag()[filters.BackendRetry].(*Policy)
+	if !ok {
+		t.Fatal("policy not set in the state bag")
+	}
+
+	if p.Attempts != 3 || p.PerTryTimeout != 250*time.Millisecond || p.MaxBodyBytes != 10 || !p.SameEndpoint {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+
+	if !p.RetryOn(ConnectFailure) || p.RetryOn(Reset) || p.RetryOn(Timeout) {
+		t.Errorf("unexpected conditions: %b", p.Conditions)
+	}
+
+	if !p.RetryStatus(502) || !p.RetryStatus(503) || !p.RetryStatus(504) || p.RetryStatus(500) {
+		t.Errorf("unexpected status codes: %v", p.StatusCodes)
+	}
+
+	if !p.RetryMethod("GET") || !p.RetryMethod("PUT") || p.RetryMethod("POST") || p.RetryMethod("PATCH") {
+		t.Error("unexpected retried methods")
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	f, err := NewRetry().CreateFilter([]interface{}{2.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := f.(*filter).policy
+	if !p.RetryOn(ConnectFailure) || !p.RetryOn(Reset) || p.RetryOn(Timeout) || len(p.StatusCodes) != 0 {
+		t.Errorf("unexpected default conditions: %+v", p)
+	}
+
+	if p.MaxBodyBytes != DefaultMaxBodyBytes || p.SameEndpoint || p.AllMethods || p.PerTryTimeout != 0 {
+		t.Errorf("unexpected default options: %+v", p)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	f, err := NewRetry().CreateFilter([]interface{}{2.0, "503", "1s", "budget=10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := f.(*filter).policy
+
+	var ends []func()
+	for i := 0; i < 50; i++ {
+		ends = append(ends, p.Begin())
+	}
+
+	// 10% of 50 in-flight requests is 5 concurrent retries
+	var releases []func()
+	for i := 0; i < 5; i++ {
+		release, ok := p.AcquireRetry()
+		if !ok {
+			t.Fatalf("retry %d not allowed", i)
+		}
+
+		releases = append(releases, release)
+	}
+
+	if _, ok := p.AcquireRetry(); ok {
+		t.Error("retry allowed over the budget")
+	}
+
+	releases[0]()
+	if _, ok := p.AcquireRetry(); !ok {
+		t.Error("retry not allowed after release")
+	}
+
+	for _, end := range ends {
+		end()
+	}
+
+	// the minimum concurrency is always allowed
+	p.budget.extra.Store(0)
+	for i := 0; i < minRetryConcurrency; i++ {
+		if _, ok := p.AcquireRetry(); !ok {
+			t.Fatalf("minimum retry %d not allowed", i)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Package stickysession provides the stickySession filter, which pins the
+clients to an endpoint of a load balanced backend with a session cookie.
+
+On the first request, the endpoint is chosen by the load balancer algorithm
+of the route, and the response sets the session cookie identifying it. The
+later requests with the cookie are sent to the same endpoint, as long as it
+is an endpoint of the route and it is not ejected by the outlier detection.
+Otherwise, the endpoint is chosen by the load balancer algorithm again, and
+the cookie is updated.
+
+The cookie value is encrypted and authenticated with the key from the secrets
+file, so it doesn't reveal the address of the endpoint, and it cannot be
+forged. Every Skipper instance needs to use the same secrets file. The
+arguments are the name of the cookie and its time to live, as a number of
+seconds or a duration string:
+
+	stickySession("chat-session", 3600)
+	stickySession("chat-session", "1h")
+
+The cookie is refreshed when more than half of its time to live has passed.
+*/
+package stickysession
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/secrets"
+)
+
+const secretsRefreshInterval = time.Minute
+
+type spec struct {
+	secretsFile string
+	registry    secrets.EncrypterCreator
+}
+
+type filter struct {
+	cookieName string
+	ttl        time.Duration
+	encrypter  secrets.Encryption
+}
+
+// Session is set in the state bag by the stickySession filter, with the key
+// filters.BackendStickySession, and applied by the proxy.
+type Session struct {
+	// Endpoint is the endpoint stored in the session cookie of the
+	// request, in the form of scheme://host. It is empty when the request
+	// doesn't have a valid session cookie.
+	Endpoint string
+
+	// Selected is set by the proxy to the endpoint that the request was
+	// sent to, in the form of scheme://host.
+	Selected string
+
+	expires time.Time
+	filter  *filter
+}
+
+// NewStickySession creates the filter specification of the stickySession
+// filter. The session cookies are encrypted with the key read from the
+// secrets file.
+func NewStickySession(secretsFile string, registry secrets.EncrypterCreator) filters.Spec {
+	return &spec{secretsFile: secretsFile, registry: registry}
+}
+
+func (*spec) Name() string { return filters.StickySessionName }
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := args[0].(string)
+	if !ok || name == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var ttl time.Duration
+	switch v := args[1].(type) {
+	case int:
+		ttl = time.Duration(v) * time.Second
+	case float64:
+		ttl = time.Duration(v * float64(time.Second))
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl = d
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	// the Max-Age of the cookie is set in seconds
+	if ttl < time.Second {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	encrypter, err := s.registry.GetEncrypter(secretsRefreshInterval, s.secretsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &filter{cookieName: name, ttl: ttl, encrypter: encrypter}, nil
+}
+
+func (f *filter) encode(endpoint string, expires time.Time) (string, error) {
+	v, err := f.encrypter.Encrypt([]byte(fmt.Sprintf("%d %s", expires.Unix(), endpoint)))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(v), nil
+}
+
+// decode returns the endpoint and the expiry time stored in the cookie value,
+// or an empty endpoint, when the value is invalid or expired.
+func (f *filter) decode(value string, now time.Time) (string, time.Time) {
+	v, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	v, err = f.encrypter.Decrypt(v)
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	ts, endpoint, ok := strings.Cut(string(v), " ")
+	if !ok {
+		return "", time.Time{}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) {
+		return "", time.Time{}
+	}
+
+	return endpoint, expires
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	s := &Session{filter: f}
+	if c, err := ctx.Request().Cookie(f.cookieName); err == nil {
+		s.Endpoint, s.expires = f.decode(c.Value, time.Now())
+	}
+
+	ctx.StateBag()[filters.BackendStickySession] = s
+}
+
+func (*filter) Response(ctx filters.FilterContext) {
+	s, ok := ctx.StateBag()[filters.BackendStickySession].(*Session)
+	if !ok {
+		return
+	}
+
+	if c := s.Cookie(); c != nil {
+		ctx.Response().Header.Add("Set-Cookie", c.String())
+	}
+}
+
+// Cookie returns the session cookie identifying the selected endpoint, or
+// nil, when the request already had a session cookie for it that doesn't need
+// to be refreshed, or when no endpoint was selected.
+func (s *Session) Cookie() *http.Cookie {
+	if s.Selected == "" {
+		return nil
+	}
+
+	now := time.Now()
+	if s.Selected == s.Endpoint && s.expires.Sub(now) > s.filter.ttl/2 {
+		return nil
+	}
+
+	value, err := s.filter.encode(s.Selected, now.Add(s.filter.ttl))
+	if err != nil {
+		log.Errorf("Failed to encode sticky session cookie: %v", err)
+		return nil
+	}
+
+	return &http.Cookie{
+		Name:     s.filter.cookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(s.filter.ttl / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
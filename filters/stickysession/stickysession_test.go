@@ -0,0 +1,208 @@
+package stickysession
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/secrets/secrettest"
+)
+
+func newTestFilter(t *testing.T, args ...interface{}) *filter {
+	t.Helper()
+
+	f, err := NewStickySession("test-secret", secrettest.NewTestRegistry()).CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f.(*filter)
+}
+
+func TestCreateFilter(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		args  []interface{}
+		ttl   time.Duration
+		err   bool
+	}{{
+		title: "no args",
+		err:   true,
+	}, {
+		title: "missing ttl",
+		args:  []interface{}{"session"},
+		err:   true,
+	}, {
+		title: "empty cookie name",
+		args:  []interface{}{"", 60.0},
+		err:   true,
+	}, {
+		title: "invalid ttl",
+		args:  []interface{}{"session", "foo"},
+		err:   true,
+	}, {
+		title: "ttl too short",
+		args:  []interface{}{"session", "10ms"},
+		err:   true,
+	}, {
+		title: "too many args",
+		args:  []interface{}{"session", 60.0, "foo"},
+		err:   true,
+	}, {
+		title: "ttl in seconds",
+		args:  []interface{}{"session", 60.0},
+		ttl:   time.Minute,
+	}, {
+		title: "ttl as duration",
+		args:  []interface{}{"session", "1h"},
+		ttl:   time.Hour,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			f, err := NewStickySession("test-secret", secrettest.NewTestRegistry()).CreateFilter(test.args)
+			if test.err {
+				if err == nil {
+					t.Fatal("failed to fail")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ttl := f.(*filter).ttl; ttl != test.ttl {
+				t.Errorf("expected ttl: %v, got: %v", test.ttl, ttl)
+			}
+		})
+	}
+}
+
+func requestWithCookie(f *filter, c *http.Cookie) *Session {
+	req, _ := http.NewRequest("GET", "https://www.example.org", nil)
+	if c != nil {
+		req.AddCookie(c)
+	}
+
+	ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	return ctx.FStateBag[filters.BackendStickySession].(*Session)
+}
+
+func TestSessionCookie(t *testing.T) {
+	f := newTestFilter(t, "session", "1h")
+
+	s := requestWithCookie(f, nil)
+	if s.Endpoint != "" {
+		t.Fatalf("unexpected endpoint: %s", s.Endpoint)
+	}
+
+	if s.Cookie() != nil {
+		t.Fatal("unexpected cookie without selected endpoint")
+	}
+
+	s.Selected = "http://10.0.0.1:8080"
+	c := s.Cookie()
+	if c == nil {
+		t.Fatal("failed to create cookie")
+	}
+
+	if c.Name != "session" || c.MaxAge != 3600 || !c.HttpOnly || !c.Secure {
+		t.Errorf("unexpected cookie: %v", c)
+	}
+
+	if c.Value == "" || len(c.Value) < len(s.Selected) || c.Value == s.Selected {
+		t.Errorf("cookie value is not opaque: %s", c.Value)
+	}
+
+	s = requestWithCookie(f, c)
+	if s.Endpoint != "http://10.0.0.1:8080" {
+		t.Fatalf("unexpected endpoint: %s", s.Endpoint)
+	}
+
+	s.Selected = s.Endpoint
+	if s.Cookie() != nil {
+		t.Error("unexpected cookie for the same endpoint")
+	}
+
+	s.Selected = "http://10.0.0.2:8080"
+	if s.Cookie() == nil {
+		t.Error("failed to update cookie for a different endpoint")
+	}
+}
+
+func TestSessionCookieRefresh(t *testing.T) {
+	f := newTestFilter(t, "session", "1h")
+	value, err := f.encode("http://10.0.0.1:8080", time.Now().Add(20*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := requestWithCookie(f, &http.Cookie{Name: "session", Value: value})
+	if s.Endpoint != "http://10.0.0.1:8080" {
+		t.Fatalf("unexpected endpoint: %s", s.Endpoint)
+	}
+
+	s.Selected = s.Endpoint
+	if s.Cookie() == nil {
+		t.Error("failed to refresh cookie")
+	}
+}
+
+func TestInvalidSessionCookie(t *testing.T) {
+	f := newTestFilter(t, "session", "1h")
+	expired, err := f.encode("http://10.0.0.1:8080", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := f.encode("http://10.0.0.1:8080", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := base64.RawURLEncoding.DecodeString(valid)
+	b[len(b)-1] ^= 1
+	tampered := base64.RawURLEncoding.EncodeToString(b)
+
+	other := newTestFilter(t, "session", "1h")
+	other.encrypter, err = secrettest.NewTestRegistry().GetEncrypter(0, "other-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foreign, err := other.encode("http://10.0.0.1:8080", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		title string
+		value string
+	}{{
+		title: "plain endpoint",
+		value: "http://10.0.0.1:8080",
+	}, {
+		title: "invalid encoding",
+		value: "not base64!",
+	}, {
+		title: "tampered",
+		value: tampered,
+	}, {
+		title: "different key",
+		value: foreign,
+	}, {
+		title: "expired",
+		value: expired,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			s := requestWithCookie(f, &http.Cookie{Name: "session", Value: test.value})
+			if s.Endpoint != "" {
+				t.Errorf("unexpected endpoint: %s", s.Endpoint)
+			}
+		})
+	}
+}
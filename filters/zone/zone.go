@@ -0,0 +1,113 @@
+/*
+Package zone provides the endpointZone filter, which annotates the endpoints
+of load balanced routes with their availability zone, and the post-processor
+that applies the annotations to the LB endpoints. The zones are used by the
+zone-aware load balancing.
+
+Example:
+
+  - -> endpointZone("http://10.2.0.1:8080", "eu-central-1a")
+    -> endpointZone("http://10.2.0.2:8080", "eu-central-1b")
+    -> <roundRobin, "http://10.2.0.1:8080", "http://10.2.0.2:8080">
+*/
+package zone
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+)
+
+type (
+	endpointZone struct {
+		which string
+		zone  string
+	}
+
+	postProcessor struct{}
+)
+
+// NewEndpointZone creates a filter spec for the endpointZone filter.
+func NewEndpointZone() filters.Spec {
+	return endpointZone{}
+}
+
+func (endpointZone) Name() string { return filters.EndpointZoneName }
+
+func (endpointZone) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) != 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	e, ok := args[0].(string)
+	if !ok {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	z, ok := args[1].(string)
+	if !ok || z == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	u, err := url.Parse(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpointZone{which: endpointKey(u.Scheme, u.Host), zone: z}, nil
+}
+
+func (endpointZone) Request(filters.FilterContext)  {}
+func (endpointZone) Response(filters.FilterContext) {}
+
+// endpointKey normalizes the scheme and the host of an endpoint, such that
+// the default ports and the case don't matter.
+func endpointKey(scheme, host string) string {
+	scheme, host = strings.ToLower(scheme), strings.ToLower(host)
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		switch scheme {
+		case "http":
+			host = net.JoinHostPort(strings.Trim(host, "[]"), "80")
+		case "https":
+			host = net.JoinHostPort(strings.Trim(host, "[]"), "443")
+		}
+	}
+
+	return scheme + "://" + host
+}
+
+// NewPostProcessor creates the post-processor that sets the zone of the LB
+// endpoints annotated with the endpointZone filter.
+func NewPostProcessor() routing.PostProcessor {
+	return postProcessor{}
+}
+
+func (postProcessor) Do(r []*routing.Route) []*routing.Route {
+	for _, ri := range r {
+		if ri.Route.BackendType != eskip.LBBackend {
+			continue
+		}
+
+		zones := make(map[string]string)
+		for _, f := range ri.Filters {
+			if ez, ok := f.Filter.(endpointZone); ok {
+				zones[ez.which] = ez.zone
+			}
+		}
+
+		if len(zones) == 0 {
+			continue
+		}
+
+		for i := range ri.LBEndpoints {
+			ep := &ri.LBEndpoints[i]
+			ep.Zone = zones[endpointKey(ep.Scheme, ep.Host)]
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,105 @@
+package zone
+
+import (
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/loadbalancer"
+	"github.com/zalando/skipper/routing"
+)
+
+func TestCreateEndpointZone(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		args   []interface{}
+		expect endpointZone
+		fail   bool
+	}{{
+		name: "no args",
+		fail: true,
+	}, {
+		name: "too many args",
+		args: []interface{}{"http://10.0.0.1:8080", "eu-central-1a", "foo"},
+		fail: true,
+	}, {
+		name: "invalid endpoint",
+		args: []interface{}{42, "eu-central-1a"},
+		fail: true,
+	}, {
+		name: "invalid zone",
+		args: []interface{}{"http://10.0.0.1:8080", 42},
+		fail: true,
+	}, {
+		name: "empty zone",
+		args: []interface{}{"http://10.0.0.1:8080", ""},
+		fail: true,
+	}, {
+		name:   "endpoint with port",
+		args:   []interface{}{"http://10.0.0.1:8080", "eu-central-1a"},
+		expect: endpointZone{which: "http://10.0.0.1:8080", zone: "eu-central-1a"},
+	}, {
+		name:   "endpoint with default port",
+		args:   []interface{}{"HTTPS://www.Example.org", "eu-central-1b"},
+		expect: endpointZone{which: "https://www.example.org:443", zone: "eu-central-1b"},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := NewEndpointZone().CreateFilter(test.args)
+			if test.fail {
+				if err == nil {
+					t.Fatal("Failed to fail.")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if f != test.expect {
+				t.Fatalf("Unexpected value, expected: %v, got: %v.", test.expect, f)
+			}
+		})
+	}
+}
+
+func TestPostProcessor(t *testing.T) {
+	zoneFilter := func(endpoint, zone string) *routing.RouteFilter {
+		f, err := NewEndpointZone().CreateFilter([]interface{}{endpoint, zone})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return &routing.RouteFilter{Filter: f, Name: filters.EndpointZoneName}
+	}
+
+	lb := &routing.Route{
+		Route: eskip.Route{
+			Id:          "lb",
+			BackendType: eskip.LBBackend,
+			LBEndpoints: []string{"http://10.0.0.1:8080", "http://10.0.0.2", "http://10.0.0.3:8080"},
+		},
+		Filters: []*routing.RouteFilter{
+			zoneFilter("http://10.0.0.1:8080", "eu-central-1a"),
+			zoneFilter("http://10.0.0.2:80", "eu-central-1b"),
+		},
+	}
+
+	network := &routing.Route{
+		Route:   eskip.Route{Id: "network", BackendType: eskip.NetworkBackend, Backend: "http://10.0.0.1:8080"},
+		Filters: []*routing.RouteFilter{zoneFilter("http://10.0.0.1:8080", "eu-central-1a")},
+	}
+
+	rr := loadbalancer.NewAlgorithmProvider().Do([]*routing.Route{lb, network})
+	rr = NewPostProcessor().Do(rr)
+	if len(rr) != 2 {
+		t.Fatalf("Failed to post-process the routes: %v.", rr)
+	}
+
+	for i, expected := range []string{"eu-central-1a", "eu-central-1b", ""} {
+		if zone := lb.LBEndpoints[i].Zone; zone != expected {
+			t.Errorf("Unexpected zone of endpoint %d, expected: %q, got: %q.", i, expected, zone)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package loadbalancer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	defaultHealthCheckMethod             = http.MethodGet
+	defaultHealthCheckMinStatus          = 200
+	defaultHealthCheckMaxStatus          = 399
+	defaultHealthCheckInterval           = 10 * time.Second
+	defaultHealthCheckTimeout            = time.Second
+	defaultHealthCheckHealthyThreshold   = 2
+	defaultHealthCheckUnhealthyThreshold = 3
+
+	// maxHealthCheckBody limits the part of the response body that is
+	// matched against the expected body.
+	maxHealthCheckBody = 64 << 10
+)
+
+// HealthCheck configures the active health checks of the endpoints of a
+// route. The zero values mean the defaults.
+type HealthCheck struct {
+	// Path is the path, and optionally the query, of the health check
+	// requests.
+	Path string
+
+	// Method is the method of the health check requests, GET by default.
+	Method string
+
+	// MinStatus and MaxStatus set the range of the expected response
+	// status codes, inclusive, 200-399 by default.
+	MinStatus, MaxStatus int
+
+	// Body, when set, needs to match the response body, or its first
+	// 64KB.
+	Body *regexp.Regexp
+
+	// Interval is the period of the health checks, 10s by default.
+	Interval time.Duration
+
+	// Timeout limits the duration of a single health check, 1s by
+	// default.
+	Timeout time.Duration
+
+	// HealthyThreshold is the number of consecutive successful checks,
+	// after which an unhealthy endpoint becomes healthy again, 2 by
+	// default.
+	HealthyThreshold int
+
+	// UnhealthyThreshold is the number of consecutive failed checks, after
+	// which a healthy endpoint becomes unhealthy, 3 by default.
+	UnhealthyThreshold int
+}
+
+// HealthCheckFilter is implemented by the filters that configure the
+// active health checks of a route, e.g. the activeHealthCheck filter.
+type HealthCheckFilter interface {
+	HealthCheck() HealthCheck
+}
+
+// ActiveHealthCheckOptions configures the active health checks. The zero
+// values mean the defaults.
+type ActiveHealthCheckOptions struct {
+	// Transport is used to make the health check requests. By default, it
+	// is a clone of http.DefaultTransport.
+	Transport http.RoundTripper
+
+	// Metrics is used to report the results of the checks and the state of
+	// the endpoints, metrics.Default when not set.
+	Metrics metrics.Metrics
+}
+
+type healthTarget struct {
+	route    string
+	endpoint string
+	check    HealthCheck
+	quit     chan struct{}
+
+	mu                   sync.Mutex
+	healthy              bool
+	consecutiveSuccesses int
+	consecutiveFailures  int
+	lastCheck            time.Time
+	lastError            string
+}
+
+// ActiveHealthChecker checks the health of the endpoints of the routes,
+// that have the health checks configured with a filter, e.g. with the
+// activeHealthCheck filter. It implements routing.PostProcessor, to skip the
+// unhealthy endpoints with any load balancing algorithm, and http.Handler to
+// show the state of the endpoints. Use NewActiveHealthChecker() to create
+// one.
+type ActiveHealthChecker struct {
+	options   ActiveHealthCheckOptions
+	transport http.RoundTripper
+	metrics   metrics.Metrics
+	mu        sync.RWMutex
+	targets   map[string]*healthTarget
+	routes    map[string]map[string]*healthTarget
+	closed    bool
+}
+
+type healthCheckAlgorithm struct {
+	routing.LBAlgorithm
+	checker *ActiveHealthChecker
+}
+
+type healthCheckState struct {
+	Route                string     `json:"route"`
+	Endpoint             string     `json:"endpoint"`
+	Path                 string     `json:"path"`
+	Healthy              bool       `json:"healthy"`
+	ConsecutiveSuccesses int        `json:"consecutiveSuccesses"`
+	ConsecutiveFailures  int        `json:"consecutiveFailures"`
+	LastCheck            *time.Time `json:"lastCheck,omitempty"`
+	LastError            string     `json:"lastError,omitempty"`
+}
+
+// NewActiveHealthChecker creates an ActiveHealthChecker. The checks are
+// started by the routes. Close() needs to be called to stop them.
+func NewActiveHealthChecker(o ActiveHealthCheckOptions) *ActiveHealthChecker {
+	t := o.Transport
+	if t == nil {
+		dt := http.DefaultTransport.(*http.Transport).Clone()
+		dt.MaxIdleConnsPerHost = 1
+		t = dt
+	}
+
+	m := o.Metrics
+	if m == nil {
+		m = metrics.Default
+	}
+
+	return &ActiveHealthChecker{
+		options:   o,
+		transport: t,
+		metrics:   m,
+		targets:   make(map[string]*healthTarget),
+		routes:    make(map[string]map[string]*healthTarget),
+	}
+}
+
+func (hc HealthCheck) withDefaults() HealthCheck {
+	if hc.Method == "" {
+		hc.Method = defaultHealthCheckMethod
+	}
+
+	if hc.MinStatus <= 0 {
+		hc.MinStatus = defaultHealthCheckMinStatus
+	}
+
+	if hc.MaxStatus <= 0 {
+		hc.MaxStatus = defaultHealthCheckMaxStatus
+	}
+
+	if hc.Interval <= 0 {
+		hc.Interval = defaultHealthCheckInterval
+	}
+
+	if hc.Timeout <= 0 {
+		hc.Timeout = defaultHealthCheckTimeout
+	}
+
+	if hc.HealthyThreshold <= 0 {
+		hc.HealthyThreshold = defaultHealthCheckHealthyThreshold
+	}
+
+	if hc.UnhealthyThreshold <= 0 {
+		hc.UnhealthyThreshold = defaultHealthCheckUnhealthyThreshold
+	}
+
+	return hc
+}
+
+func (hc HealthCheck) key() string {
+	var body string
+	if hc.Body != nil {
+		body = hc.Body.String()
+	}
+
+	return fmt.Sprintf(
+		"%s %s %d-%d %v %v %d %d %q",
+		hc.Method,
+		hc.Path,
+		hc.MinStatus,
+		hc.MaxStatus,
+		hc.Interval,
+		hc.Timeout,
+		hc.HealthyThreshold,
+		hc.UnhealthyThreshold,
+		body,
+	)
+}
+
+func routeHealthCheck(r *routing.Route) (HealthCheck, bool) {
+	for _, f := range r.Filters {
+		if hf, ok := f.Filter.(HealthCheckFilter); ok {
+			return hf.HealthCheck().withDefaults(), true
+		}
+	}
+
+	return HealthCheck{}, false
+}
+
+// routeEndpoints returns the endpoints to be checked, the LB endpoints or the
+// network backend of the route.
+func routeEndpoints(r *routing.Route) []string {
+	switch r.Route.BackendType {
+	case eskip.LBBackend:
+		return endpointKeys(r.LBEndpoints)
+	case eskip.NetworkBackend:
+		if r.Scheme == "" || r.Host == "" {
+			return nil
+		}
+
+		return []string{r.Scheme + "://" + r.Host}
+	default:
+		return nil
+	}
+}
+
+// Do implements routing.PostProcessor. It starts the checks of the new
+// endpoints of the routes, stops the checks of the removed ones, and wraps
+// the algorithm of the load balanced routes. It needs to be applied after
+// the algorithms of the routes were initialized.
+func (c *ActiveHealthChecker) Do(routes []*routing.Route) []*routing.Route {
+	targets := make(map[string]*healthTarget)
+	routeTargets := make(map[string]map[string]*healthTarget)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return routes
+	}
+
+	for _, r := range routes {
+		hc, ok := routeHealthCheck(r)
+		if !ok {
+			continue
+		}
+
+		endpoints := make(map[string]*healthTarget)
+		for _, e := range routeEndpoints(r) {
+			key := r.Id + " " + e + " " + hc.key()
+			if _, ok := targets[key]; ok {
+				continue
+			}
+
+			t, ok := c.targets[key]
+			if !ok {
+				t = &healthTarget{route: r.Id, endpoint: e, check: hc, healthy: true, quit: make(chan struct{})}
+				go c.run(t)
+			}
+
+			targets[key] = t
+			endpoints[e] = t
+		}
+
+		routeTargets[r.Id] = endpoints
+
+		if r.Route.BackendType == eskip.LBBackend && r.LBAlgorithm != nil {
+			if _, ok := r.LBAlgorithm.(*healthCheckAlgorithm); !ok {
+				r.LBAlgorithm = &healthCheckAlgorithm{LBAlgorithm: r.LBAlgorithm, checker: c}
+			}
+		}
+	}
+
+	for key, t := range c.targets {
+		if _, ok := targets[key]; !ok {
+			close(t.quit)
+		}
+	}
+
+	c.targets = targets
+	c.routes = routeTargets
+	return routes
+}
+
+// Close stops the health checks.
+func (c *ActiveHealthChecker) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	c.closed = true
+	for _, t := range c.targets {
+		close(t.quit)
+	}
+
+	c.targets = nil
+	c.routes = nil
+}
+
+func (t *healthTarget) gaugeKey() string {
+	return "activehealthcheck.healthy." + t.route + "." + t.endpoint
+}
+
+// run checks the target periodically until its checks are stopped. The
+// state of the removed targets is deleted from the metrics here, after the
+// last check.
+func (c *ActiveHealthChecker) run(t *healthTarget) {
+	defer c.metrics.DeleteGauge(t.gaugeKey())
+	c.checkTarget(t)
+
+	ticker := time.NewTicker(t.check.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkTarget(t)
+		case <-t.quit:
+			return
+		}
+	}
+}
+
+// check makes a single health check request to the endpoint of the target.
+func (c *ActiveHealthChecker) check(t *healthTarget) error {
+	u, err := url.Parse(t.endpoint + t.check.Path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.check.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, t.check.Method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("User-Agent", "Skipper-HealthCheck")
+	rsp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < t.check.MinStatus || rsp.StatusCode > t.check.MaxStatus {
+		io.Copy(io.Discard, rsp.Body)
+		return fmt.Errorf("unexpected status code: %d", rsp.StatusCode)
+	}
+
+	if t.check.Body == nil {
+		io.Copy(io.Discard, rsp.Body)
+		return nil
+	}
+
+	b, err := io.ReadAll(io.LimitReader(rsp.Body, maxHealthCheckBody))
+	if err != nil {
+		return err
+	}
+
+	if !t.check.Body.Match(b) {
+		return fmt.Errorf("unexpected response body")
+	}
+
+	return nil
+}
+
+// checkTarget checks the endpoint of the target, and updates its state.
+func (c *ActiveHealthChecker) checkTarget(t *healthTarget) {
+	err := c.check(t)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastCheck = time.Now()
+	m := c.metrics
+	if err != nil {
+		m.IncCounter("activehealthcheck.failures")
+		t.lastError = err.Error()
+		t.consecutiveSuccesses = 0
+		t.consecutiveFailures++
+		if t.healthy && t.consecutiveFailures >= t.check.UnhealthyThreshold {
+			t.healthy = false
+			log.Infof("Active health check marked endpoint %s of route %s unhealthy: %v", t.endpoint, t.route, err)
+		}
+	} else {
+		m.IncCounter("activehealthcheck.successes")
+		t.lastError = ""
+		t.consecutiveFailures = 0
+		t.consecutiveSuccesses++
+		if !t.healthy && t.consecutiveSuccesses >= t.check.HealthyThreshold {
+			t.healthy = true
+			log.Infof("Active health check marked endpoint %s of route %s healthy", t.endpoint, t.route)
+		}
+	}
+
+	var state float64
+	if t.healthy {
+		state = 1
+	}
+
+	m.UpdateGauge(t.gaugeKey(), state)
+}
+
+// Healthy tells whether the endpoint passes the health checks of the route.
+// The endpoints without health checks, and the endpoints that were not
+// checked yet, are healthy.
+func (c *ActiveHealthChecker) Healthy(routeID string, e routing.LBEndpoint) bool {
+	c.mu.RLock()
+	t, ok := c.routes[routeID][outlierKey(e)]
+	c.mu.RUnlock()
+
+	if !ok {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.healthy
+}
+
+// Apply implements routing.LBAlgorithm. When the endpoint chosen by the
+// wrapped algorithm is unhealthy, it chooses again, and then falls back to the
+// next healthy endpoint.
+func (a *healthCheckAlgorithm) Apply(ctx *routing.LBContext) routing.LBEndpoint {
+	return chooseHealthy(a.LBAlgorithm, ctx, func(e routing.LBEndpoint) bool {
+		return a.checker.Healthy(ctx.Route.Id, e)
+	})
+}
+
+// ServeHTTP shows the state of the checked endpoints as JSON.
+func (c *ActiveHealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mu.RLock()
+	targets := make([]*healthTarget, 0, len(c.targets))
+	for _, t := range c.targets {
+		targets = append(targets, t)
+	}
+	c.mu.RUnlock()
+
+	states := make([]healthCheckState, 0, len(targets))
+	for _, t := range targets {
+		t.mu.Lock()
+		state := healthCheckState{
+			Route:                t.route,
+			Endpoint:             t.endpoint,
+			Path:                 t.check.Path,
+			Healthy:              t.healthy,
+			ConsecutiveSuccesses: t.consecutiveSuccesses,
+			ConsecutiveFailures:  t.consecutiveFailures,
+			LastError:            t.lastError,
+		}
+
+		if !t.lastCheck.IsZero() {
+			last := t.lastCheck.UTC()
+			state.LastCheck = &last
+		}
+
+		t.mu.Unlock()
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Route != states[j].Route {
+			return states[i].Route < states[j].Route
+		}
+
+		return states[i].Endpoint < states[j].Endpoint
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(states)
+}
@@ -0,0 +1,312 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+type healthCheckFilter struct{ check HealthCheck }
+
+func (healthCheckFilter) Request(filters.FilterContext)  {}
+func (healthCheckFilter) Response(filters.FilterContext) {}
+func (f healthCheckFilter) HealthCheck() HealthCheck     { return f.check }
+
+type healthCheckBackend struct {
+	*httptest.Server
+	status   atomic.Int64
+	requests atomic.Int64
+}
+
+func newHealthCheckBackend(body string) *healthCheckBackend {
+	b := &healthCheckBackend{}
+	b.status.Store(http.StatusOK)
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.requests.Add(1)
+		w.WriteHeader(int(b.status.Load()))
+		w.Write([]byte(body))
+	}))
+
+	return b
+}
+
+func newHealthCheckRoute(t *testing.T, c *ActiveHealthChecker, hc HealthCheck, endpoints ...string) *routing.Route {
+	t.Helper()
+
+	r := &routing.Route{
+		Route: eskip.Route{
+			Id:          "healthcheck",
+			BackendType: eskip.LBBackend,
+			LBAlgorithm: RoundRobin.String(),
+			LBEndpoints: endpoints,
+		},
+		Filters: []*routing.RouteFilter{{Filter: healthCheckFilter{check: hc}, Name: "activeHealthCheck"}},
+	}
+
+	rr := c.Do(NewAlgorithmProvider().Do([]*routing.Route{r}))
+	if len(rr) != 1 {
+		t.Fatalf("failed to create route: %v", rr)
+	}
+
+	return rr[0]
+}
+
+func waitForHealth(t *testing.T, c *ActiveHealthChecker, routeID string, e routing.LBEndpoint, healthy bool) {
+	t.Helper()
+
+	timeout := time.After(3 * time.Second)
+	for c.Healthy(routeID, e) != healthy {
+		select {
+		case <-timeout:
+			t.Fatalf("timeout waiting for endpoint %s to become healthy=%v", e.Host, healthy)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestActiveHealthCheckSkipsUnhealthyEndpoints(t *testing.T) {
+	b0, b1, b2 := newHealthCheckBackend("OK"), newHealthCheckBackend("OK"), newHealthCheckBackend("OK")
+	defer b0.Close()
+	defer b1.Close()
+	defer b2.Close()
+
+	m := &metricstest.MockMetrics{}
+	c := NewActiveHealthChecker(ActiveHealthCheckOptions{Metrics: m})
+	defer c.Close()
+
+	rt := newHealthCheckRoute(t, c, HealthCheck{
+		Path:               "/healthz",
+		Interval:           10 * time.Millisecond,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+	}, b0.URL, b1.URL, b2.URL)
+
+	failing := rt.LBEndpoints[1]
+	b1.status.Store(http.StatusServiceUnavailable)
+	waitForHealth(t, c, rt.Id, failing, false)
+
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	for i := 0; i < 30; i++ {
+		if e := rt.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: rt}); e.Host == failing.Host {
+			t.Fatal("unhealthy endpoint selected")
+		}
+	}
+
+	m.WithGauges(func(gauges map[string]float64) {
+		if v, ok := gauges["activehealthcheck.healthy.healthcheck."+b1.URL]; !ok || v != 0 {
+			t.Errorf("unexpected gauges: %v", gauges)
+		}
+	})
+
+	b1.status.Store(http.StatusOK)
+	waitForHealth(t, c, rt.Id, failing, true)
+
+	var selected bool
+	for i := 0; i < 30; i++ {
+		if e := rt.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: rt}); e.Host == failing.Host {
+			selected = true
+		}
+	}
+
+	if !selected {
+		t.Error("recovered endpoint not selected")
+	}
+}
+
+func TestActiveHealthCheckAllUnhealthy(t *testing.T) {
+	b := newHealthCheckBackend("")
+	defer b.Close()
+	b.status.Store(http.StatusInternalServerError)
+
+	c := NewActiveHealthChecker(ActiveHealthCheckOptions{Metrics: &metricstest.MockMetrics{}})
+	defer c.Close()
+
+	rt := newHealthCheckRoute(t, c, HealthCheck{Path: "/", Interval: 10 * time.Millisecond, UnhealthyThreshold: 1}, b.URL, "http://127.0.0.1:1")
+	waitForHealth(t, c, rt.Id, rt.LBEndpoints[0], false)
+	waitForHealth(t, c, rt.Id, rt.LBEndpoints[1], false)
+
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	if e := rt.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: rt}); e.Host == "" {
+		t.Error("no endpoint selected")
+	}
+}
+
+func TestActiveHealthCheckExpectations(t *testing.T) {
+	b := newHealthCheckBackend(`{"status": "UP"}`)
+	defer b.Close()
+
+	c := NewActiveHealthChecker(ActiveHealthCheckOptions{Metrics: &metricstest.MockMetrics{}})
+	defer c.Close()
+
+	for _, test := range []struct {
+		title  string
+		status int
+		check  HealthCheck
+		fail   bool
+	}{{
+		title:  "default status range",
+		status: http.StatusNoContent,
+	}, {
+		title:  "redirect is healthy by default",
+		status: http.StatusFound,
+	}, {
+		title:  "server error",
+		status: http.StatusInternalServerError,
+		fail:   true,
+	}, {
+		title:  "not in the expected range",
+		status: http.StatusFound,
+		check:  HealthCheck{MinStatus: 200, MaxStatus: 299},
+		fail:   true,
+	}, {
+		title:  "exact status",
+		status: http.StatusAccepted,
+		check:  HealthCheck{MinStatus: 202, MaxStatus: 202},
+	}, {
+		title:  "body matches",
+		status: http.StatusOK,
+		check:  HealthCheck{Body: regexp.MustCompile(`"status":\s*"UP"`)},
+	}, {
+		title:  "body doesn't match",
+		status: http.StatusOK,
+		check:  HealthCheck{Body: regexp.MustCompile(`"status":\s*"DOWN"`)},
+		fail:   true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			b.status.Store(int64(test.status))
+			test.check.Path = "/health"
+			err := c.check(&healthTarget{endpoint: b.URL, check: test.check.withDefaults()})
+			if test.fail && err == nil {
+				t.Error("failed to fail")
+			} else if !test.fail && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestActiveHealthCheckTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	c := NewActiveHealthChecker(ActiveHealthCheckOptions{Metrics: &metricstest.MockMetrics{}})
+	defer c.Close()
+
+	if err := c.check(&healthTarget{endpoint: slow.URL, check: HealthCheck{Path: "/", Timeout: 10 * time.Millisecond}.withDefaults()}); err == nil {
+		t.Error("failed to time out")
+	}
+}
+
+func TestActiveHealthCheckRemovedEndpoints(t *testing.T) {
+	b := newHealthCheckBackend("")
+	defer b.Close()
+
+	m := &metricstest.MockMetrics{}
+	c := NewActiveHealthChecker(ActiveHealthCheckOptions{Metrics: m})
+	defer c.Close()
+
+	newHealthCheckRoute(t, c, HealthCheck{Path: "/", Interval: 10 * time.Millisecond}, b.URL)
+	time.Sleep(50 * time.Millisecond)
+	if b.requests.Load() == 0 {
+		t.Fatal("endpoint not checked")
+	}
+
+	if _, ok := m.Gauge("activehealthcheck.healthy.healthcheck." + b.URL); !ok {
+		t.Error("gauge not set")
+	}
+
+	c.Do(nil)
+	time.Sleep(20 * time.Millisecond)
+	requests := b.requests.Load()
+	time.Sleep(50 * time.Millisecond)
+	if b.requests.Load() != requests {
+		t.Error("removed endpoint still checked")
+	}
+
+	if _, ok := m.Gauge("activehealthcheck.healthy.healthcheck." + b.URL); ok {
+		t.Error("gauge of the removed endpoint not deleted")
+	}
+}
+
+func TestActiveHealthCheckPerRoute(t *testing.T) {
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer b.Close()
+
+	c := NewActiveHealthChecker(ActiveHealthCheckOptions{Metrics: &metricstest.MockMetrics{}})
+	defer c.Close()
+
+	newRoute := func(id, path string) *routing.Route {
+		return &routing.Route{
+			Route: eskip.Route{
+				Id:          id,
+				BackendType: eskip.LBBackend,
+				LBAlgorithm: RoundRobin.String(),
+				LBEndpoints: []string{b.URL},
+			},
+			Filters: []*routing.RouteFilter{{
+				Filter: healthCheckFilter{check: HealthCheck{Path: path, Interval: 10 * time.Millisecond, UnhealthyThreshold: 1}},
+				Name:   "activeHealthCheck",
+			}},
+		}
+	}
+
+	rr := c.Do(NewAlgorithmProvider().Do([]*routing.Route{newRoute("failing", "/missing"), newRoute("passing", "/")}))
+	e := rr[0].LBEndpoints[0]
+	waitForHealth(t, c, "failing", e, false)
+	time.Sleep(30 * time.Millisecond)
+
+	if !c.Healthy("passing", e) {
+		t.Error("endpoint unhealthy for the route with passing checks")
+	}
+
+	if !c.Healthy("unchecked", e) {
+		t.Error("endpoint unhealthy for a route without health checks")
+	}
+}
+
+func TestActiveHealthCheckState(t *testing.T) {
+	b := newHealthCheckBackend("")
+	defer b.Close()
+	b.status.Store(http.StatusServiceUnavailable)
+
+	c := NewActiveHealthChecker(ActiveHealthCheckOptions{Metrics: &metricstest.MockMetrics{}})
+	defer c.Close()
+
+	rt := newHealthCheckRoute(t, c, HealthCheck{Path: "/healthz", Interval: 10 * time.Millisecond, UnhealthyThreshold: 1}, b.URL)
+	waitForHealth(t, c, rt.Id, rt.LBEndpoints[0], false)
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/healthchecks", nil))
+
+	var states []healthCheckState
+	if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 1 {
+		t.Fatalf("unexpected states: %v", states)
+	}
+
+	s := states[0]
+	if s.Endpoint != b.URL || s.Path != "/healthz" || s.Healthy || s.ConsecutiveFailures == 0 || s.LastCheck == nil || s.LastError == "" {
+		t.Errorf("unexpected state: %+v", s)
+	}
+}
@@ -36,9 +36,38 @@ const (
 
 	// PowerOfRandomNChoices selects N random endpoints and picks the one with least outstanding requests from them.
 	PowerOfRandomNChoices
+
+	// PeakEwma selects two random endpoints and picks the one with the lower peak EWMA of the response latency,
+	// multiplied by the outstanding requests.
+	PeakEwma
+
+	// WeightedLeastRequest selects two random endpoints and picks the one with the least outstanding requests
+	// relative to its weight.
+	WeightedLeastRequest
+
+	// Maglev indicates choice between the backends based on consistent hashing with a Maglev lookup table.
+	Maglev
 )
 
 const powerOfRandomNChoicesDefaultN = 2
+
+const (
+	// peakEwmaPenalty is the latency assumed for endpoints with outstanding requests, but without observed
+	// latency, in nanoseconds.
+	peakEwmaPenalty = float64(time.Second)
+
+	// leastRequestActiveBias is the exponent applied to the outstanding requests by the weighted least request
+	// algorithm. Higher values prefer the endpoints with less outstanding requests more strongly over their
+	// weight.
+	leastRequestActiveBias = 1.0
+
+	// goldenRatioConjugate is used by the weighted round-robin to spread the consecutive choices evenly over
+	// the cumulative weights of the endpoints.
+	goldenRatioConjugate = 0.6180339887498949
+
+	// consistentHashesPerEndpoint is the average number of the virtual nodes of an endpoint in the hash ring.
+	consistentHashesPerEndpoint = 100
+)
 const (
 	ConsistentHashKey           = "consistentHashKey"
 	ConsistentHashBalanceFactor = "consistentHashBalanceFactor"
@@ -50,10 +79,54 @@ var (
 		Random:                newRandom,
 		ConsistentHash:        newConsistentHash,
 		PowerOfRandomNChoices: newPowerOfRandomNChoices,
+		PeakEwma:              newPeakEwma,
+		WeightedLeastRequest:  newWeightedLeastRequest,
+		Maglev:                newMaglev,
 	}
 	defaultAlgorithm = newRoundRobin
+
+	// weightedAlgorithms contains the algorithms that need to know the endpoint weights when initialized.
+	// The other algorithms read the weights of the endpoints when applied.
+	weightedAlgorithms = map[Algorithm]initializeWeightedAlgorithm{
+		ConsistentHash: newWeightedConsistentHash,
+		Maglev:         newWeightedMaglev,
+	}
 )
 
+// weighted tells whether the endpoints of a route have explicit weights.
+func weighted(r *routing.Route) bool {
+	return len(r.Route.LBEndpointWeights) > 0
+}
+
+// endpointWeight returns the weight of an endpoint, 1 when not set.
+func endpointWeight(e routing.LBEndpoint) float64 {
+	if e.Weight <= 0 {
+		return 1
+	}
+
+	return e.Weight
+}
+
+// weightedIndex returns the index of the endpoint found at x of the cumulative weights of the endpoints,
+// where x is in [0, 1).
+func weightedIndex(ep []routing.LBEndpoint, x float64) int {
+	var sum float64
+	for _, e := range ep {
+		sum += endpointWeight(e)
+	}
+
+	r := x * sum
+	var upto float64
+	for i, e := range ep {
+		upto += endpointWeight(e)
+		if upto > r {
+			return i
+		}
+	}
+
+	return len(ep) - 1
+}
+
 func fadeInState(now time.Time, duration time.Duration, detected time.Time) (time.Duration, bool) {
 	rel := now.Sub(detected)
 	return rel, rel > 0 && rel < duration
@@ -132,6 +205,10 @@ func withFadeIn(rnd *rand.Rand, ctx *routing.LBContext, choice int, algo routing
 		return shiftToRemaining(a.rnd, ctx, notFadingIndexes, now)
 	case *random:
 		return shiftToRemaining(a.rnd, ctx, notFadingIndexes, now)
+	case *peakEwma:
+		return shiftToRemaining(a.rnd, ctx, notFadingIndexes, now)
+	case *weightedLeastRequest:
+		return shiftToRemaining(a.rnd, ctx, notFadingIndexes, now)
 	case *consistentHash:
 		// If all endpoints are fading, normal consistent hash result
 		if len(notFadingIndexes) == 0 {
@@ -139,6 +216,13 @@ func withFadeIn(rnd *rand.Rand, ctx *routing.LBContext, choice int, algo routing
 		}
 		// otherwise calculate consistent hash again using endpoints which are not fading
 		return ep[a.chooseConsistentHashEndpoint(ctx, skipFadingEndpoints(notFadingIndexes))]
+	case *maglev:
+		// If all endpoints are fading, normal Maglev result
+		if len(notFadingIndexes) == 0 {
+			return ep[choice]
+		}
+		// otherwise look up the endpoint again skipping the ones which are fading
+		return ep[a.chooseMaglevEndpoint(ctx, skipFadingEndpoints(notFadingIndexes))]
 	default:
 		return ep[choice]
 	}
@@ -163,7 +247,13 @@ func (r *roundRobin) Apply(ctx *routing.LBContext) routing.LBEndpoint {
 		return ctx.Route.LBEndpoints[0]
 	}
 
-	index := int(atomic.AddInt64(&r.index, 1) % int64(len(ctx.Route.LBEndpoints)))
+	var index int
+	if weighted(ctx.Route) {
+		_, x := math.Modf(float64(atomic.AddInt64(&r.index, 1)) * goldenRatioConjugate)
+		index = weightedIndex(ctx.Route.LBEndpoints, x)
+	} else {
+		index = int(atomic.AddInt64(&r.index, 1) % int64(len(ctx.Route.LBEndpoints)))
+	}
 
 	if ctx.Route.LBFadeInDuration <= 0 {
 		return ctx.Route.LBEndpoints[index]
@@ -189,7 +279,13 @@ func (r *random) Apply(ctx *routing.LBContext) routing.LBEndpoint {
 		return ctx.Route.LBEndpoints[0]
 	}
 
-	i := r.rnd.Intn(len(ctx.Route.LBEndpoints))
+	var i int
+	if weighted(ctx.Route) {
+		i = weightedIndex(ctx.Route.LBEndpoints, r.rnd.Float64())
+	} else {
+		i = r.rnd.Intn(len(ctx.Route.LBEndpoints))
+	}
+
 	if ctx.Route.LBFadeInDuration <= 0 {
 		return ctx.Route.LBEndpoints[i]
 	}
@@ -215,23 +311,53 @@ func (ch *consistentHash) Swap(i, j int) {
 }
 
 func newConsistentHashInternal(endpoints []string, hashesPerEndpoint int) routing.LBAlgorithm {
+	return newWeightedConsistentHashInternal(endpoints, nil, hashesPerEndpoint)
+}
+
+// newWeightedConsistentHashInternal creates the hash ring with a number of virtual nodes for each endpoint
+// proportional to its weight, hashesPerEndpoint on average. The virtual nodes of an endpoint with a higher
+// weight are a superset of the ones with a lower weight, so changing the weights remaps only a part of the
+// keys.
+func newWeightedConsistentHashInternal(endpoints []string, weights []float64, hashesPerEndpoint int) routing.LBAlgorithm {
+	var sum float64
+	for i := range endpoints {
+		sum += weightAt(weights, i)
+	}
+
 	rnd := rand.New(newLockedSource()) // #nosec
 	ch := &consistentHash{
-		hashRing: make([]endpointHash, hashesPerEndpoint*len(endpoints)),
+		hashRing: make([]endpointHash, 0, hashesPerEndpoint*len(endpoints)),
 		rnd:      rnd,
 	}
 	for i, ep := range endpoints {
-		endpointStartIndex := hashesPerEndpoint * i
-		for j := 0; j < hashesPerEndpoint; j++ {
-			ch.hashRing[endpointStartIndex+j] = endpointHash{i, hash(fmt.Sprintf("%s-%d", ep, j))}
+		n := int(math.Round(float64(hashesPerEndpoint*len(endpoints)) * weightAt(weights, i) / sum))
+		if n < 1 {
+			n = 1
+		}
+
+		for j := 0; j < n; j++ {
+			ch.hashRing = append(ch.hashRing, endpointHash{i, hash(fmt.Sprintf("%s-%d", ep, j))})
 		}
 	}
 	sort.Sort(ch)
 	return ch
 }
 
+// weightAt returns the weight at index i, 1 when not set.
+func weightAt(weights []float64, i int) float64 {
+	if i >= len(weights) || weights[i] <= 0 {
+		return 1
+	}
+
+	return weights[i]
+}
+
 func newConsistentHash(endpoints []string) routing.LBAlgorithm {
-	return newConsistentHashInternal(endpoints, 100)
+	return newConsistentHashInternal(endpoints, consistentHashesPerEndpoint)
+}
+
+func newWeightedConsistentHash(endpoints []string, weights []float64) routing.LBAlgorithm {
+	return newWeightedConsistentHashInternal(endpoints, weights, consistentHashesPerEndpoint)
 }
 
 func hash(s string) uint64 {
@@ -266,22 +392,65 @@ func computeLoadAverage(ctx *routing.LBContext) float64 {
 	return sum / float64(len(endpoints))
 }
 
+// computeWeightAverage returns the average weight of the endpoints.
+func computeWeightAverage(ctx *routing.LBContext) float64 {
+	var sum float64
+	endpoints := ctx.Route.LBEndpoints
+	for _, v := range endpoints {
+		sum += endpointWeight(v)
+	}
+	return sum / float64(len(endpoints))
+}
+
+// belowTargetLoad returns a function that tells whether the load of an endpoint is below the target load, which
+// is the average load multiplied by the balance factor.
+func belowTargetLoad(ctx *routing.LBContext, balanceFactor float64) func(routing.LBEndpoint) bool {
+	averageLoad := computeLoadAverage(ctx)
+	targetLoad := averageLoad * balanceFactor
+	isWeighted := weighted(ctx.Route)
+	var averageWeight float64
+	if isWeighted {
+		averageWeight = computeWeightAverage(ctx)
+	}
+
+	return func(ep routing.LBEndpoint) bool {
+		load := ep.Metrics.GetInflightRequests()
+		// We know there must be an endpoint whose load <= average load.
+		// Since targetLoad >= average load (balancerFactor >= 1), there must also be an endpoint with load <= targetLoad.
+		// With weighted endpoints, the target load of each endpoint is proportional to its weight.
+		endpointTargetLoad := targetLoad
+		if isWeighted {
+			endpointTargetLoad *= endpointWeight(ep) / averageWeight
+		}
+
+		return load <= int(endpointTargetLoad)
+	}
+}
+
+// consistentHashParams returns the request key and the optional balance factor used by the consistent hashing
+// algorithms.
+func consistentHashParams(ctx *routing.LBContext) (key string, balanceFactor float64, bounded bool) {
+	key, ok := ctx.Params[ConsistentHashKey].(string)
+	if !ok {
+		key = net.RemoteHost(ctx.Request).String()
+	}
+
+	balanceFactor, bounded = ctx.Params[ConsistentHashBalanceFactor].(float64)
+	return
+}
+
 // Returns index of endpoint with closest hash to key's hash, which is also below the target load
 // skipEndpoint function is used to skip endpoints we don't want, such as fading endpoints
 func (ch *consistentHash) boundedLoadSearch(key string, balanceFactor float64, ctx *routing.LBContext, skipEndpoint func(int) bool) int {
 	ringIndex := ch.searchRing(key, skipEndpoint)
-	averageLoad := computeLoadAverage(ctx)
-	targetLoad := averageLoad * balanceFactor
+	belowTarget := belowTargetLoad(ctx, balanceFactor)
 	// Loop round ring, starting at endpoint with closest hash. Stop when we find one whose load is less than targetLoad.
 	for i := 0; i < ch.Len(); i++ {
 		endpointIndex := ch.hashRing[ringIndex].index
 		if skipEndpoint(endpointIndex) {
 			continue
 		}
-		load := ctx.Route.LBEndpoints[endpointIndex].Metrics.GetInflightRequests()
-		// We know there must be an endpoint whose load <= average load.
-		// Since targetLoad >= average load (balancerFactor >= 1), there must also be an endpoint with load <= targetLoad.
-		if load <= int(targetLoad) {
+		if belowTarget(ctx.Route.LBEndpoints[endpointIndex]) {
 			break
 		}
 		ringIndex = (ringIndex + 1) % ch.Len()
@@ -306,13 +475,9 @@ func (ch *consistentHash) Apply(ctx *routing.LBContext) routing.LBEndpoint {
 }
 
 func (ch *consistentHash) chooseConsistentHashEndpoint(ctx *routing.LBContext, skipEndpoint func(int) bool) int {
-	key, ok := ctx.Params[ConsistentHashKey].(string)
-	if !ok {
-		key = net.RemoteHost(ctx.Request).String()
-	}
-	balanceFactor, ok := ctx.Params[ConsistentHashBalanceFactor].(float64)
+	key, balanceFactor, bounded := consistentHashParams(ctx)
 	var choice int
-	if !ok {
+	if !bounded {
 		choice = ch.search(key, skipEndpoint)
 	} else {
 		choice = ch.boundedLoadSearch(key, balanceFactor, ctx, skipEndpoint)
@@ -370,15 +535,106 @@ func (p *powerOfRandomNChoices) Apply(ctx *routing.LBContext) routing.LBEndpoint
 	return best
 }
 
-// getScore returns negative value of inflightrequests count.
-func (p *powerOfRandomNChoices) getScore(e routing.LBEndpoint) int {
+// getScore returns negative value of inflightrequests count relative to the weight of the endpoint.
+func (p *powerOfRandomNChoices) getScore(e routing.LBEndpoint) float64 {
 	// endpoints with higher inflight request should have lower score
-	return -e.Metrics.GetInflightRequests()
+	return -float64(e.Metrics.GetInflightRequests()) / endpointWeight(e)
+}
+
+// twoRandomChoices returns the indexes of two different random endpoints.
+func twoRandomChoices(rnd *rand.Rand, n int) (int, int) {
+	i := rnd.Intn(n)
+	j := rnd.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+
+	return i, j
+}
+
+type peakEwma struct {
+	rnd *rand.Rand
+}
+
+// newPeakEwma selects two random backends and picks the one with the lower peak EWMA latency cost.
+func newPeakEwma([]string) routing.LBAlgorithm {
+	return &peakEwma{
+		rnd: rand.New(newLockedSource()), // #nosec
+	}
+}
+
+// cost returns the peak EWMA of the latency of the endpoint multiplied by its outstanding requests, divided
+// by its weight.
+func (p *peakEwma) cost(e routing.LBEndpoint, now time.Time) float64 {
+	inflight := float64(e.Metrics.GetInflightRequests())
+	latency := e.Metrics.GetLatencyEWMA(now)
+	if latency == 0 && inflight > 0 {
+		return (peakEwmaPenalty + inflight) / endpointWeight(e)
+	}
+
+	return latency * (inflight + 1) / endpointWeight(e)
+}
+
+// Apply implements routing.LBAlgorithm with the peak EWMA algorithm.
+func (p *peakEwma) Apply(ctx *routing.LBContext) routing.LBEndpoint {
+	ep := ctx.Route.LBEndpoints
+	if len(ep) == 1 {
+		return ep[0]
+	}
+
+	now := time.Now()
+	choice, other := twoRandomChoices(p.rnd, len(ep))
+	if p.cost(ep[other], now) < p.cost(ep[choice], now) {
+		choice = other
+	}
+
+	if ctx.Route.LBFadeInDuration <= 0 {
+		return ep[choice]
+	}
+
+	return withFadeIn(p.rnd, ctx, choice, p)
+}
+
+type weightedLeastRequest struct {
+	rnd *rand.Rand
+}
+
+// newWeightedLeastRequest selects two random backends and picks the one with less outstanding requests relative
+// to its weight.
+func newWeightedLeastRequest([]string) routing.LBAlgorithm {
+	return &weightedLeastRequest{
+		rnd: rand.New(newLockedSource()), // #nosec
+	}
+}
+
+// score returns the weight of the endpoint divided by its outstanding requests.
+func (w *weightedLeastRequest) score(e routing.LBEndpoint) float64 {
+	return endpointWeight(e) / math.Pow(float64(e.Metrics.GetInflightRequests()+1), leastRequestActiveBias)
+}
+
+// Apply implements routing.LBAlgorithm with the weighted least request algorithm.
+func (w *weightedLeastRequest) Apply(ctx *routing.LBContext) routing.LBEndpoint {
+	ep := ctx.Route.LBEndpoints
+	if len(ep) == 1 {
+		return ep[0]
+	}
+
+	choice, other := twoRandomChoices(w.rnd, len(ep))
+	if w.score(ep[other]) > w.score(ep[choice]) {
+		choice = other
+	}
+
+	if ctx.Route.LBFadeInDuration <= 0 {
+		return ep[choice]
+	}
+
+	return withFadeIn(w.rnd, ctx, choice, w)
 }
 
 type (
-	algorithmProvider   struct{}
-	initializeAlgorithm func(endpoints []string) routing.LBAlgorithm
+	algorithmProvider           struct{}
+	initializeAlgorithm         func(endpoints []string) routing.LBAlgorithm
+	initializeWeightedAlgorithm func(endpoints []string, weights []float64) routing.LBAlgorithm
 )
 
 // NewAlgorithmProvider creates a routing.PostProcessor used to initialize
@@ -402,6 +658,12 @@ func AlgorithmFromString(a string) (Algorithm, error) {
 		return ConsistentHash, nil
 	case "powerOfRandomNChoices":
 		return PowerOfRandomNChoices, nil
+	case "peakEwma":
+		return PeakEwma, nil
+	case "weightedLeastRequest":
+		return WeightedLeastRequest, nil
+	case "maglev":
+		return Maglev, nil
 	default:
 		return None, errors.New("unsupported algorithm")
 	}
@@ -418,12 +680,23 @@ func (a Algorithm) String() string {
 		return "consistentHash"
 	case PowerOfRandomNChoices:
 		return "powerOfRandomNChoices"
+	case PeakEwma:
+		return "peakEwma"
+	case WeightedLeastRequest:
+		return "weightedLeastRequest"
+	case Maglev:
+		return "maglev"
 	default:
 		return ""
 	}
 }
 
 func parseEndpoints(r *routing.Route) error {
+	weights := r.Route.LBEndpointWeights
+	if len(weights) > 0 && len(weights) != len(r.Route.LBEndpoints) {
+		return fmt.Errorf("number of LB endpoint weights (%d) does not match the number of endpoints (%d)", len(weights), len(r.Route.LBEndpoints))
+	}
+
 	r.LBEndpoints = make([]routing.LBEndpoint, len(r.Route.LBEndpoints))
 	for i, e := range r.Route.LBEndpoints {
 		eu, err := url.ParseRequestURI(e)
@@ -436,15 +709,27 @@ func parseEndpoints(r *routing.Route) error {
 			Host:    eu.Host,
 			Metrics: &routing.LBMetrics{},
 		}
+
+		if len(weights) > 0 {
+			if weights[i] <= 0 || math.IsInf(weights[i], 0) || math.IsNaN(weights[i]) {
+				return fmt.Errorf("invalid weight of LB endpoint %s: %v", e, weights[i])
+			}
+
+			r.LBEndpoints[i].Weight = weights[i]
+		}
 	}
 
 	return nil
 }
 
-func setAlgorithm(r *routing.Route) error {
-	t, err := AlgorithmFromString(r.Route.LBAlgorithm)
+func newAlgorithm(name string, endpoints []string, weights []float64) (routing.LBAlgorithm, error) {
+	t, err := AlgorithmFromString(name)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if initialize, ok := weightedAlgorithms[t]; ok && len(weights) > 0 {
+		return initialize(endpoints, weights), nil
 	}
 
 	initialize := defaultAlgorithm
@@ -452,7 +737,16 @@ func setAlgorithm(r *routing.Route) error {
 		initialize = algorithms[t]
 	}
 
-	r.LBAlgorithm = initialize(r.Route.LBEndpoints)
+	return initialize(endpoints), nil
+}
+
+func setAlgorithm(r *routing.Route) error {
+	a, err := newAlgorithm(r.Route.LBAlgorithm, r.Route.LBEndpoints, r.Route.LBEndpointWeights)
+	if err != nil {
+		return err
+	}
+
+	r.LBAlgorithm = a
 	return nil
 }
 
@@ -483,5 +777,6 @@ func (p *algorithmProvider) Do(r []*routing.Route) []*routing.Route {
 		rr = append(rr, ri)
 	}
 
+	maglevTables.rotate()
 	return rr
 }
@@ -5,6 +5,7 @@ import (
 	"math"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/net"
@@ -244,6 +245,21 @@ func TestApply(t *testing.T) {
 			expected:      N,
 			algorithm:     newPowerOfRandomNChoices(eps),
 			algorithmName: "powerOfRandomNChoices",
+		}, {
+			name:          "peakEwma algorithm",
+			expected:      N,
+			algorithm:     newPeakEwma(eps),
+			algorithmName: "peakEwma",
+		}, {
+			name:          "weightedLeastRequest algorithm",
+			expected:      N,
+			algorithm:     newWeightedLeastRequest(eps),
+			algorithmName: "weightedLeastRequest",
+		}, {
+			name:          "maglev algorithm",
+			expected:      1,
+			algorithm:     newMaglev(eps),
+			algorithmName: "maglev",
 		}} {
 		t.Run(tt.name, func(t *testing.T) {
 			req, _ := http.NewRequest("GET", "http://127.0.0.1:1234/foo", nil)
@@ -417,6 +433,228 @@ func TestConsistentHashKeyDistribution(t *testing.T) {
 	}
 }
 
+func newTwoEndpointsLBContext(t *testing.T, algorithm string) *routing.LBContext {
+	t.Helper()
+
+	r := &routing.Route{
+		Route: eskip.Route{
+			BackendType: eskip.LBBackend,
+			LBAlgorithm: algorithm,
+			LBEndpoints: []string{"http://127.0.0.1:1234", "http://127.0.0.1:1235"},
+		},
+	}
+
+	rr := NewAlgorithmProvider().Do([]*routing.Route{r})
+	if len(rr) != 1 {
+		t.Fatal("failed to process LB route")
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	return &routing.LBContext{Request: req, Route: rr[0]}
+}
+
+func TestPeakEwmaPrefersLowLatency(t *testing.T) {
+	ctx := newTwoEndpointsLBContext(t, "peakEwma")
+	slow, fast := ctx.Route.LBEndpoints[0], ctx.Route.LBEndpoints[1]
+
+	now := time.Now()
+	slow.Metrics.ObserveLatency(now, 100*time.Millisecond)
+	fast.Metrics.ObserveLatency(now, 10*time.Millisecond)
+
+	for i := 0; i < 100; i++ {
+		if e := ctx.Route.LBAlgorithm.Apply(ctx); e.Host != fast.Host {
+			t.Fatalf("slow endpoint selected: %s", e.Host)
+		}
+	}
+
+	// the outstanding requests raise the cost of the fast endpoint
+	addInflightRequests(fast, 20)
+	if e := ctx.Route.LBAlgorithm.Apply(ctx); e.Host != slow.Host {
+		t.Fatalf("busy endpoint selected: %s", e.Host)
+	}
+}
+
+func TestPeakEwmaPenalizesUnknownLatency(t *testing.T) {
+	ctx := newTwoEndpointsLBContext(t, "peakEwma")
+	known, unknown := ctx.Route.LBEndpoints[0], ctx.Route.LBEndpoints[1]
+
+	known.Metrics.ObserveLatency(time.Now(), 100*time.Millisecond)
+	addInflightRequests(unknown, 1)
+
+	if e := ctx.Route.LBAlgorithm.Apply(ctx); e.Host != known.Host {
+		t.Fatalf("endpoint without observed latency selected: %s", e.Host)
+	}
+}
+
+func TestWeightedLeastRequestPrefersLessInflight(t *testing.T) {
+	ctx := newTwoEndpointsLBContext(t, "weightedLeastRequest")
+	busy, idle := ctx.Route.LBEndpoints[0], ctx.Route.LBEndpoints[1]
+
+	addInflightRequests(busy, 3)
+	addInflightRequests(idle, 1)
+
+	for i := 0; i < 100; i++ {
+		if e := ctx.Route.LBAlgorithm.Apply(ctx); e.Host != idle.Host {
+			t.Fatalf("busy endpoint selected: %s", e.Host)
+		}
+	}
+}
+
+func newWeightedLBRoute(t *testing.T, algorithm string, weights ...float64) *routing.Route {
+	t.Helper()
+
+	eps := make([]string, len(weights))
+	for i := range eps {
+		eps[i] = fmt.Sprintf("http://127.0.0.1:%d", 1234+i)
+	}
+
+	r := &routing.Route{
+		Route: eskip.Route{
+			BackendType:       eskip.LBBackend,
+			LBAlgorithm:       algorithm,
+			LBEndpoints:       eps,
+			LBEndpointWeights: weights,
+		},
+	}
+
+	rr := NewAlgorithmProvider().Do([]*routing.Route{r})
+	if len(rr) != 1 {
+		t.Fatal("failed to process LB route")
+	}
+
+	return rr[0]
+}
+
+func TestWeightedEndpointsDistribution(t *testing.T) {
+	const requests = 10000
+	weights := []float64{1, 3, 0.5, 1.5}
+	for _, algorithm := range []string{"roundRobin", "random", "consistentHash", "maglev"} {
+		t.Run(algorithm, func(t *testing.T) {
+			rt := newWeightedLBRoute(t, algorithm, weights...)
+			req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+			hosts := make(map[string]int)
+			for i := 0; i < requests; i++ {
+				ctx := &routing.LBContext{
+					Request: req,
+					Route:   rt,
+					Params:  map[string]interface{}{ConsistentHashKey: fmt.Sprintf("key-%d", i)},
+				}
+
+				hosts[rt.LBAlgorithm.Apply(ctx).Host]++
+			}
+
+			var sum float64
+			for _, w := range weights {
+				sum += w
+			}
+
+			for i, w := range weights {
+				host := fmt.Sprintf("127.0.0.1:%d", 1234+i)
+				share := float64(hosts[host]) / requests
+				if math.Abs(share-w/sum) > 0.05 {
+					t.Errorf("unexpected share of %s, expected: %.3f, got: %.3f", host, w/sum, share)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedEndpointsLoad(t *testing.T) {
+	for _, algorithm := range []string{"powerOfRandomNChoices", "peakEwma", "weightedLeastRequest"} {
+		t.Run(algorithm, func(t *testing.T) {
+			rt := newWeightedLBRoute(t, algorithm, 4, 1)
+			heavy, light := rt.LBEndpoints[0], rt.LBEndpoints[1]
+
+			now := time.Now()
+			heavy.Metrics.ObserveLatency(now, 10*time.Millisecond)
+			light.Metrics.ObserveLatency(now, 10*time.Millisecond)
+
+			// relative to its weight, the heavy endpoint has less outstanding requests
+			addInflightRequests(heavy, 3)
+			addInflightRequests(light, 1)
+
+			// powerOfRandomNChoices may choose the same endpoint twice, so the light one is selected 1/4 of the
+			// time
+			const requests = 1000
+			req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+			ctx := &routing.LBContext{Request: req, Route: rt}
+			var selected int
+			for i := 0; i < requests; i++ {
+				if e := rt.LBAlgorithm.Apply(ctx); e.Host == heavy.Host {
+					selected++
+				}
+			}
+
+			if selected < requests*2/3 {
+				t.Fatalf("endpoint with more load relative to its weight preferred: %d/%d", requests-selected, requests)
+			}
+		})
+	}
+}
+
+func TestWeightedConsistentHashVirtualNodes(t *testing.T) {
+	ch := newWeightedConsistentHashInternal([]string{"http://127.0.0.1:1234", "http://127.0.0.1:1235"}, []float64{1, 3}, 100).(*consistentHash)
+	counts := make(map[int]int)
+	for _, h := range ch.hashRing {
+		counts[h.index]++
+	}
+
+	if counts[0] != 50 || counts[1] != 150 {
+		t.Errorf("unexpected number of virtual nodes: %v", counts)
+	}
+
+	// the virtual nodes of the unweighted ring are kept
+	unweighted := newConsistentHashInternal([]string{"http://127.0.0.1:1234", "http://127.0.0.1:1235"}, 100).(*consistentHash)
+	nodes := make(map[endpointHash]bool)
+	for _, h := range ch.hashRing {
+		nodes[h] = true
+	}
+
+	var kept int
+	for _, h := range unweighted.hashRing {
+		if nodes[h] {
+			kept++
+		}
+	}
+
+	if kept != 150 {
+		t.Errorf("unexpected number of kept virtual nodes: %d", kept)
+	}
+}
+
+func TestInvalidEndpointWeights(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		weights []float64
+	}{{
+		title:   "count mismatch",
+		weights: []float64{1},
+	}, {
+		title:   "zero weight",
+		weights: []float64{1, 0},
+	}, {
+		title:   "negative weight",
+		weights: []float64{-1, 1},
+	}, {
+		title:   "infinite weight",
+		weights: []float64{math.Inf(1), 1},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			r := &routing.Route{
+				Route: eskip.Route{
+					BackendType:       eskip.LBBackend,
+					LBEndpoints:       []string{"http://127.0.0.1:1234", "http://127.0.0.1:1235"},
+					LBEndpointWeights: test.weights,
+				},
+			}
+
+			if rr := NewAlgorithmProvider().Do([]*routing.Route{r}); len(rr) != 0 {
+				t.Fatal("failed to fail")
+			}
+		})
+	}
+}
+
 func addInflightRequests(endpoint routing.LBEndpoint, count int) {
 	for i := 0; i < count; i++ {
 		endpoint.Metrics.IncInflightRequest()
@@ -19,6 +19,14 @@ consistentHash Algorithm
 	client IP, which will be looked up from X-Forwarded-For header
 	with remote IP as the fallback.
 
+maglev Algorithm
+
+	The maglev algorithm chooses backend endpoints by hashing the
+	same client data as the consistentHash algorithm, but instead
+	of a hash ring, it uses a fixed size lookup table populated
+	as described in the Maglev paper. The lookup takes constant
+	time, and the keys are distributed more evenly.
+
 powerOfRandomNChoices Algorithm
 
 	The powerOfRandomNChoices algorithm selects N random endpoints
@@ -35,6 +43,7 @@ Eskip example:
 	r2: * -> <consistentHash, "http://127.0.0.1:9998", "http://127.0.0.1:9997">;
 	r3: * -> <random, "http://127.0.0.1:9998", "http://127.0.0.1:9997">;
 	r4: * -> <powerOfRandomNChoices, "http://127.0.0.1:9998", "http://127.0.0.1:9997">;
+	r5: * -> <maglev, "http://127.0.0.1:9998", "http://127.0.0.1:9997">;
 
 Package loadbalancer also implements health checking of pool members for
 a group of routes, if backend calls are reported to the loadbalancer.
@@ -68,6 +68,7 @@ func initializeEndpoints(endpointAges []time.Duration, fadeInDuration time.Durat
 		ctx.Route.LBEndpoints = append(ctx.Route.LBEndpoints, routing.LBEndpoint{
 			Host:     eps[i],
 			Detected: detectionTimes[i],
+			Metrics:  &routing.LBMetrics{},
 		})
 	}
 
@@ -200,6 +201,17 @@ func TestFadeIn(t *testing.T) {
 	testFadeIn(t, "consistent-hash, 7", newConsistentHashForTest, old, 0, 0, 0, 0, 0, 0)
 	testFadeIn(t, "consistent-hash, 8", newConsistentHashForTest, 0, 0, 0, 0, 0, 0)
 	testFadeIn(t, "consistent-hash, 9", newConsistentHashForTest, fadeInDuration/2, fadeInDuration/3, fadeInDuration/4)
+
+	testFadeIn(t, "maglev, 0", newMaglev, old, old)
+	testFadeIn(t, "maglev, 1", newMaglev, 0, old)
+	testFadeIn(t, "maglev, 2", newMaglev, 0, 0)
+	testFadeIn(t, "maglev, 3", newMaglev, old, 0)
+	testFadeIn(t, "maglev, 4", newMaglev, old, old, old, 0)
+	testFadeIn(t, "maglev, 5", newMaglev, old, old, old, 0, 0, 0)
+	testFadeIn(t, "maglev, 6", newMaglev, old, 0, 0, 0)
+	testFadeIn(t, "maglev, 7", newMaglev, old, 0, 0, 0, 0, 0, 0)
+	testFadeIn(t, "maglev, 8", newMaglev, 0, 0, 0, 0, 0, 0)
+	testFadeIn(t, "maglev, 9", newMaglev, fadeInDuration/2, fadeInDuration/3, fadeInDuration/4)
 }
 
 func testFadeInLoadBetweenOldEps(
@@ -256,6 +268,9 @@ func TestFadeInLoadBetweenOldEps(t *testing.T) {
 			testFadeInLoadBetweenOldEps(t, fmt.Sprintf("consistent-hash, %d old, %d new", nOld, nNew), newConsistentHash, nOld, nNew)
 			testFadeInLoadBetweenOldEps(t, fmt.Sprintf("random, %d old, %d new", nOld, nNew), newRandom, nOld, nNew)
 			testFadeInLoadBetweenOldEps(t, fmt.Sprintf("round-robin, %d old, %d new", nOld, nNew), newRoundRobin, nOld, nNew)
+			testFadeInLoadBetweenOldEps(t, fmt.Sprintf("peak-ewma, %d old, %d new", nOld, nNew), newPeakEwma, nOld, nNew)
+			testFadeInLoadBetweenOldEps(t, fmt.Sprintf("weighted-least-request, %d old, %d new", nOld, nNew), newWeightedLeastRequest, nOld, nNew)
+			testFadeInLoadBetweenOldEps(t, fmt.Sprintf("maglev, %d old, %d new", nOld, nNew), newMaglev, nOld, nNew)
 		}
 	}
 }
@@ -295,6 +310,9 @@ func TestApplyEndsWhenAllEndpointsAreFading(t *testing.T) {
 		testApplyEndsWhenAllEndpointsAreFading(t, "consistent-hash", newConsistentHash, nEndpoints)
 		testApplyEndsWhenAllEndpointsAreFading(t, "random", newRandom, nEndpoints)
 		testApplyEndsWhenAllEndpointsAreFading(t, "round-robin", newRoundRobin, nEndpoints)
+		testApplyEndsWhenAllEndpointsAreFading(t, "peak-ewma", newPeakEwma, nEndpoints)
+		testApplyEndsWhenAllEndpointsAreFading(t, "weighted-least-request", newWeightedLeastRequest, nEndpoints)
+		testApplyEndsWhenAllEndpointsAreFading(t, "maglev", newMaglev, nEndpoints)
 	}
 }
 
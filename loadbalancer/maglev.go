@@ -0,0 +1,194 @@
+package loadbalancer
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zalando/skipper/routing"
+)
+
+// maglevTableSize is the size of the Maglev lookup table. It needs to be a prime number, much larger than the
+// number of the endpoints. It doesn't depend on the number of the endpoints, because changing it would remap
+// most of the keys. The table takes 128KB of memory.
+const maglevTableSize = 65537
+
+// maglevMaxEndpoints is the maximum number of the endpoints that fit in the table. Routes with more endpoints
+// use the hash ring.
+const maglevMaxEndpoints = math.MaxUint16
+
+// maglev implements the consistent hashing based on the lookup table described in "Maglev: A Fast and
+// Reliable Software Network Load Balancer", https://research.google/pubs/pub44824/. Compared to the hash
+// ring, the lookup is O(1), and the keys are distributed more evenly between the endpoints, while changing
+// the endpoints remaps close to the minimum number of keys.
+type maglev struct {
+	table []uint16
+	rnd   *rand.Rand
+}
+
+// maglevTableCache holds the lookup tables by their endpoints and weights, so that the tables of the
+// unchanged routes are not populated again on every routing update. The tables are read only. The tables
+// not used by the last two routing updates are dropped.
+type maglevTableCache struct {
+	mu       sync.Mutex
+	current  map[string][]uint16
+	previous map[string][]uint16
+}
+
+var maglevTables = &maglevTableCache{current: make(map[string][]uint16)}
+
+func maglevTableKey(endpoints []string, weights []float64) string {
+	var b strings.Builder
+	for i, ep := range endpoints {
+		b.WriteString(ep)
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(weightAt(weights, i), 'g', -1, 64))
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// get returns the table of the key, or populates it, when it was not used by the current or the previous
+// routing update.
+func (c *maglevTableCache) get(key string, populate func() []uint16) []uint16 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.current[key]; ok {
+		return t
+	}
+
+	t, ok := c.previous[key]
+	if !ok {
+		t = populate()
+	}
+
+	c.current[key] = t
+	return t
+}
+
+// rotate is called after the routing updates, dropping the tables that were not used by the last two.
+func (c *maglevTableCache) rotate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.previous = c.current
+	c.current = make(map[string][]uint16)
+}
+
+// populateMaglevTable populates the lookup table. Every endpoint has its own permutation of the table slots,
+// derived from the hash of its address, and the endpoints take turns in occupying their next preferred slot
+// that is still free. With weights, the endpoints take turns proportionally to their weights.
+func populateMaglevTable(endpoints []string, weights []float64, size int) []uint16 {
+	n := len(endpoints)
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	next := make([]uint64, n)
+	credits := make([]float64, n)
+
+	var maxWeight float64
+	for i, ep := range endpoints {
+		offsets[i] = hash(ep) % uint64(size)
+		skips[i] = hash(ep+"-skip")%uint64(size-1) + 1
+		if w := weightAt(weights, i); w > maxWeight {
+			maxWeight = w
+		}
+	}
+
+	table := make([]uint16, size)
+	taken := make([]bool, size)
+	for filled := 0; filled < size; {
+		for i := 0; i < n && filled < size; i++ {
+			credits[i] += weightAt(weights, i) / maxWeight
+			if credits[i] < 1 {
+				continue
+			}
+
+			credits[i]--
+			slot := (offsets[i] + next[i]*skips[i]) % uint64(size)
+			for taken[slot] {
+				next[i]++
+				slot = (offsets[i] + next[i]*skips[i]) % uint64(size)
+			}
+
+			table[slot] = uint16(i)
+			taken[slot] = true
+			next[i]++
+			filled++
+		}
+	}
+
+	return table
+}
+
+func newMaglev(endpoints []string) routing.LBAlgorithm {
+	return newWeightedMaglev(endpoints, nil)
+}
+
+func newWeightedMaglev(endpoints []string, weights []float64) routing.LBAlgorithm {
+	if len(endpoints) > maglevMaxEndpoints {
+		return newWeightedConsistentHash(endpoints, weights)
+	}
+
+	table := maglevTables.get(maglevTableKey(endpoints, weights), func() []uint16 {
+		return populateMaglevTable(endpoints, weights, maglevTableSize)
+	})
+
+	return &maglev{
+		table: table,
+		rnd:   rand.New(newLockedSource()), // #nosec
+	}
+}
+
+// search returns the index of the endpoint in the slot of the key, or, when the endpoint needs to be skipped,
+// in the next slot with an endpoint that doesn't.
+func (m *maglev) search(key string, skipEndpoint func(int) bool) int {
+	slot := int(hash(key) % uint64(len(m.table)))
+	for i := 0; i < len(m.table); i++ {
+		if e := int(m.table[(slot+i)%len(m.table)]); !skipEndpoint(e) {
+			return e
+		}
+	}
+
+	return int(m.table[slot])
+}
+
+// boundedLoadSearch returns the index of the endpoint in the slot of the key, or in the next slot with an
+// endpoint that is not skipped, and whose load is below the target load.
+func (m *maglev) boundedLoadSearch(key string, balanceFactor float64, ctx *routing.LBContext, skipEndpoint func(int) bool) int {
+	belowTarget := belowTargetLoad(ctx, balanceFactor)
+	slot := int(hash(key) % uint64(len(m.table)))
+	for i := 0; i < len(m.table); i++ {
+		e := int(m.table[(slot+i)%len(m.table)])
+		if !skipEndpoint(e) && belowTarget(ctx.Route.LBEndpoints[e]) {
+			return e
+		}
+	}
+
+	return m.search(key, skipEndpoint)
+}
+
+func (m *maglev) chooseMaglevEndpoint(ctx *routing.LBContext, skipEndpoint func(int) bool) int {
+	key, balanceFactor, bounded := consistentHashParams(ctx)
+	if !bounded {
+		return m.search(key, skipEndpoint)
+	}
+
+	return m.boundedLoadSearch(key, balanceFactor, ctx, skipEndpoint)
+}
+
+// Apply implements routing.LBAlgorithm with the Maglev consistent hashing algorithm.
+func (m *maglev) Apply(ctx *routing.LBContext) routing.LBEndpoint {
+	if len(ctx.Route.LBEndpoints) == 1 {
+		return ctx.Route.LBEndpoints[0]
+	}
+
+	choice := m.chooseMaglevEndpoint(ctx, noSkippedEndpoints)
+	if ctx.Route.LBFadeInDuration <= 0 {
+		return ctx.Route.LBEndpoints[choice]
+	}
+
+	return withFadeIn(m.rnd, ctx, choice, m)
+}
@@ -0,0 +1,319 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+)
+
+func testEndpoints(n int) []string {
+	eps := make([]string, n)
+	for i := range eps {
+		eps[i] = fmt.Sprintf("http://10.2.%d.%d:8080", i/256, i%256)
+	}
+
+	return eps
+}
+
+func newMaglevTestRoute(t testing.TB, algorithm string, endpoints []string) *routing.Route {
+	t.Helper()
+
+	rr := NewAlgorithmProvider().Do([]*routing.Route{{
+		Route: eskip.Route{
+			BackendType: eskip.LBBackend,
+			LBAlgorithm: algorithm,
+			LBEndpoints: endpoints,
+		},
+	}})
+
+	if len(rr) != 1 {
+		t.Fatal("failed to process LB route")
+	}
+
+	return rr[0]
+}
+
+// keyDistribution returns the number of keys mapped to each endpoint.
+func keyDistribution(rt *routing.Route, keys int) map[string]int {
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	d := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		ctx := &routing.LBContext{Request: req, Route: rt, Params: map[string]interface{}{ConsistentHashKey: fmt.Sprintf("key-%d", i)}}
+		d[rt.LBAlgorithm.Apply(ctx).Host]++
+	}
+
+	return d
+}
+
+func keyStdDeviation(d map[string]int, endpoints int) float64 {
+	counters := make(map[int]uint64)
+	var i int
+	for _, c := range d {
+		counters[i] = uint64(c)
+		i++
+	}
+
+	for ; i < endpoints; i++ {
+		counters[i] = 0
+	}
+
+	return stdDeviation(counters)
+}
+
+func TestMaglevTable(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 10, 11, 100, 1000} {
+		t.Run(fmt.Sprintf("%d endpoints", n), func(t *testing.T) {
+			m := newMaglev(testEndpoints(n)).(*maglev)
+			slots := make([]int, n)
+			for _, e := range m.table {
+				if int(e) >= n {
+					t.Fatalf("invalid slot: %d", e)
+				}
+
+				slots[e]++
+			}
+
+			// the endpoints take turns, so the difference is at most one slot
+			for _, s := range slots {
+				if s < len(m.table)/n || s > len(m.table)/n+1 {
+					t.Fatalf("uneven slots: %v", slots)
+				}
+			}
+		})
+	}
+}
+
+func TestMaglevWeightedTable(t *testing.T) {
+	weights := []float64{1, 3, 0.5, 1.5}
+	m := newWeightedMaglev(testEndpoints(len(weights)), weights).(*maglev)
+	slots := make([]int, len(weights))
+	for _, e := range m.table {
+		slots[e]++
+	}
+
+	for i, w := range weights {
+		share := float64(slots[i]) / float64(len(m.table))
+		if math.Abs(share-w/6) > 0.001 {
+			t.Errorf("unexpected share of endpoint %d, expected: %.4f, got: %.4f", i, w/6, share)
+		}
+	}
+}
+
+func TestMaglevTableReused(t *testing.T) {
+	p := NewAlgorithmProvider()
+	update := func(weights []float64) *maglev {
+		r := p.Do([]*routing.Route{{Route: eskip.Route{
+			BackendType:       eskip.LBBackend,
+			LBAlgorithm:       "maglev",
+			LBEndpoints:       testEndpoints(3),
+			LBEndpointWeights: weights,
+		}}})
+
+		return r[0].LBAlgorithm.(*maglev)
+	}
+
+	weights := []float64{1, 2, 3}
+	first := update(nil)
+	if second := update(nil); &second.table[0] != &first.table[0] {
+		t.Error("table of unchanged endpoints populated again")
+	}
+
+	if weighted := update(weights); &weighted.table[0] == &first.table[0] {
+		t.Error("table of changed weights reused")
+	}
+
+	// not used by the last two updates
+	update(weights)
+	if third := update(nil); &third.table[0] == &first.table[0] {
+		t.Error("unused table not dropped")
+	}
+}
+
+func TestMaglevKey(t *testing.T) {
+	rt := newMaglevTestRoute(t, "maglev", testEndpoints(3))
+	r, _ := http.NewRequest("GET", "http://127.0.0.1:1234/foo", nil)
+	r.RemoteAddr = "192.168.0.1:8765"
+
+	defaultEndpoint := rt.LBAlgorithm.Apply(&routing.LBContext{Request: r, Route: rt, Params: make(map[string]interface{})})
+	remoteHostEndpoint := rt.LBAlgorithm.Apply(&routing.LBContext{Request: r, Route: rt, Params: map[string]interface{}{ConsistentHashKey: "192.168.0.1"}})
+	if defaultEndpoint != remoteHostEndpoint {
+		t.Error("remote host should be used as a default key")
+	}
+
+	d := keyDistribution(rt, 300)
+	if len(d) != 3 {
+		t.Errorf("keys not distributed between the endpoints: %v", d)
+	}
+}
+
+func TestMaglevBoundedLoadSearch(t *testing.T) {
+	rt := newMaglevTestRoute(t, "maglev", testEndpoints(3))
+	r, _ := http.NewRequest("GET", "http://127.0.0.1:1234/foo", nil)
+	ctx := &routing.LBContext{Request: r, Route: rt, Params: map[string]interface{}{ConsistentHashBalanceFactor: 1.25}}
+	noLoad := rt.LBAlgorithm.Apply(ctx)
+	nonBounded := rt.LBAlgorithm.Apply(&routing.LBContext{Request: r, Route: rt, Params: map[string]interface{}{}})
+	if noLoad != nonBounded {
+		t.Error("When no endpoints are overloaded, the chosen endpoint should be the same as standard maglev")
+	}
+
+	addInflightRequests(noLoad, 20)
+	failover1 := rt.LBAlgorithm.Apply(ctx)
+	if failover1 == nonBounded {
+		t.Error("When the selected endpoint is overloaded, the chosen endpoint should be different to standard maglev")
+	}
+
+	addInflightRequests(failover1, 20)
+	failover2 := rt.LBAlgorithm.Apply(ctx)
+	if failover2 == nonBounded || failover2 == failover1 {
+		t.Error("Only the final endpoint had load below the average * balanceFactor, so it should have been selected.")
+	}
+
+	addInflightRequests(failover2, 20)
+	allLoaded := rt.LBAlgorithm.Apply(ctx)
+	if allLoaded != nonBounded {
+		t.Error("When all endpoints have the same load, the maglev endpoint should be chosen again.")
+	}
+}
+
+func TestMaglevBoundedLoadDistribution(t *testing.T) {
+	rt := newMaglevTestRoute(t, "maglev", testEndpoints(3))
+	r, _ := http.NewRequest("GET", "http://127.0.0.1:1234/foo", nil)
+	balanceFactor := 1.25
+	ctx := &routing.LBContext{Request: r, Route: rt, Params: map[string]interface{}{ConsistentHashBalanceFactor: balanceFactor}}
+
+	for i := 0; i < 100; i++ {
+		ep := rt.LBAlgorithm.Apply(ctx)
+		ifr0 := rt.LBEndpoints[0].Metrics.GetInflightRequests()
+		ifr1 := rt.LBEndpoints[1].Metrics.GetInflightRequests()
+		ifr2 := rt.LBEndpoints[2].Metrics.GetInflightRequests()
+		avg := float64(ifr0+ifr1+ifr2) / 3.0
+		limit := int(avg*balanceFactor) + 1
+		if ifr0 > limit || ifr1 > limit || ifr2 > limit {
+			t.Errorf("Expected in-flight requests for each endpoint to be less than %d. In-flight request counts: %d, %d, %d", limit, ifr0, ifr1, ifr2)
+		}
+		ep.Metrics.IncInflightRequest()
+	}
+}
+
+func TestMaglevKeyDistribution(t *testing.T) {
+	const keys = 100000
+	for _, n := range []int{2, 3, 5, 10, 50} {
+		t.Run(fmt.Sprintf("%d endpoints", n), func(t *testing.T) {
+			eps := testEndpoints(n)
+			ring := keyStdDeviation(keyDistribution(newMaglevTestRoute(t, "consistentHash", eps), keys), n)
+			table := keyStdDeviation(keyDistribution(newMaglevTestRoute(t, "maglev", eps), keys), n)
+			t.Logf("relative standard deviation of the keys, ring: %.2f%%, maglev: %.2f%%", ring, table)
+			if table >= ring {
+				t.Errorf("maglev distributes the keys less evenly than the ring: %.2f%% >= %.2f%%", table, ring)
+			}
+
+			if table >= 3 {
+				t.Errorf("uneven key distribution: %.2f%%", table)
+			}
+		})
+	}
+}
+
+// remapped returns the ratio of the keys that are mapped to a different endpoint by the two routes.
+func remapped(before, after *routing.Route, keys int) float64 {
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	var changed int
+	for i := 0; i < keys; i++ {
+		p := map[string]interface{}{ConsistentHashKey: fmt.Sprintf("key-%d", i)}
+		b := before.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: before, Params: p})
+		a := after.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: after, Params: p})
+		if a.Host != b.Host {
+			changed++
+		}
+	}
+
+	return float64(changed) / float64(keys)
+}
+
+func TestMaglevRemapping(t *testing.T) {
+	const (
+		keys = 20000
+		n    = 10
+	)
+
+	eps := testEndpoints(n + 1)
+	// the optimal ratio is the share of the removed and the added endpoints
+	for _, test := range []struct {
+		title         string
+		before, after []string
+		optimal       float64
+	}{{
+		title:   "endpoint removed",
+		before:  eps[:n],
+		after:   eps[1:n],
+		optimal: 1.0 / n,
+	}, {
+		title:   "endpoint added",
+		before:  eps[:n],
+		after:   eps[:n+1],
+		optimal: 1.0 / (n + 1),
+	}, {
+		title:   "endpoint replaced",
+		before:  eps[:n],
+		after:   eps[1 : n+1],
+		optimal: 2.0 / n,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			ring := remapped(newMaglevTestRoute(t, "consistentHash", test.before), newMaglevTestRoute(t, "consistentHash", test.after), keys)
+			table := remapped(newMaglevTestRoute(t, "maglev", test.before), newMaglevTestRoute(t, "maglev", test.after), keys)
+			t.Logf("remapped keys, optimal: %.2f%%, ring: %.2f%%, maglev: %.2f%%", 100*test.optimal, 100*ring, 100*table)
+			if table > 1.5*test.optimal {
+				t.Errorf("too many keys remapped: %.2f%%", 100*table)
+			}
+		})
+	}
+}
+
+func benchmarkConsistentHashing(b *testing.B, algorithm string, endpoints int) {
+	rt := newMaglevTestRoute(b, algorithm, testEndpoints(endpoints))
+	keys := make([]map[string]interface{}, 1024)
+	for i := range keys {
+		keys[i] = map[string]interface{}{ConsistentHashKey: fmt.Sprintf("key-%d", i)}
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			rt.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: rt, Params: keys[i%len(keys)]})
+			i++
+		}
+	})
+}
+
+func BenchmarkConsistentHashingApply(b *testing.B) {
+	for _, algorithm := range []string{"consistentHash", "maglev"} {
+		for _, n := range []int{3, 10, 100, 1000} {
+			b.Run(fmt.Sprintf("%s, %d endpoints", algorithm, n), func(b *testing.B) {
+				benchmarkConsistentHashing(b, algorithm, n)
+			})
+		}
+	}
+}
+
+func BenchmarkConsistentHashingCreate(b *testing.B) {
+	for _, algorithm := range []string{"consistentHash", "maglev"} {
+		for _, n := range []int{3, 10, 100, 1000} {
+			b.Run(fmt.Sprintf("%s, %d endpoints", algorithm, n), func(b *testing.B) {
+				eps := testEndpoints(n)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := newAlgorithm(algorithm, eps, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
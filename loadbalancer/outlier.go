@@ -0,0 +1,484 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	defaultOutlierConsecutiveErrors        = 5
+	defaultOutlierInterval                 = 10 * time.Second
+	defaultOutlierBaseEjectionTime         = 30 * time.Second
+	defaultOutlierMaxEjectionTime          = 5 * time.Minute
+	defaultOutlierMaxEjectionPercent       = 10
+	defaultOutlierSuccessRateStdevFactor   = 1.9
+	defaultOutlierSuccessRateMinimumHosts  = 5
+	defaultOutlierSuccessRateRequestVolume = 100
+
+	consecutiveErrorsReason = "consecutive-errors"
+	successRateReason       = "success-rate"
+)
+
+// OutlierDetectionOptions configures the passive outlier detection of the
+// load balanced endpoints. The zero values mean the defaults.
+type OutlierDetectionOptions struct {
+	// ConsecutiveErrors is the number of consecutive 5xx responses or
+	// gateway errors after which an endpoint is ejected, 5 by default.
+	ConsecutiveErrors int
+
+	// Interval is the period of the success rate evaluation, 10s by default.
+	Interval time.Duration
+
+	// BaseEjectionTime is the duration of the first ejection of an
+	// endpoint, 30s by default. Repeated ejections last multiples of it.
+	BaseEjectionTime time.Duration
+
+	// MaxEjectionTime limits the ejection duration, 5m by default.
+	MaxEjectionTime time.Duration
+
+	// MaxEjectionPercent is the maximum percentage of the endpoints of a
+	// route that can be ejected at the same time, 10 by default. One
+	// endpoint can always be ejected.
+	MaxEjectionPercent int
+
+	// SuccessRateStdevFactor sets how far below the mean success rate of
+	// the endpoints of a route, in standard deviations, the success rate of
+	// an endpoint needs to be to get ejected, 1.9 by default.
+	SuccessRateStdevFactor float64
+
+	// SuccessRateMinimumHosts is the minimum number of endpoints of a route
+	// with enough requests for the success rate evaluation, 5 by default.
+	SuccessRateMinimumHosts int
+
+	// SuccessRateRequestVolume is the minimum number of requests to an
+	// endpoint in an interval for the success rate evaluation, 100 by
+	// default.
+	SuccessRateRequestVolume int
+
+	// Metrics is used to report the ejections, metrics.Default when not
+	// set.
+	Metrics metrics.Metrics
+}
+
+type outlierStats struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	requests            int
+	failures            int
+	ejections           int
+	ejectedUntil        atomic.Int64
+}
+
+// OutlierDetector ejects load balanced endpoints based on the results of
+// the proxied requests. It implements routing.PostProcessor, to apply
+// the ejections with any load balancing algorithm, and http.Handler to
+// show the state of the endpoints. Use NewOutlierDetector() to create one.
+type OutlierDetector struct {
+	options   OutlierDetectionOptions
+	metrics   metrics.Metrics
+	now       func() time.Time
+	mu        sync.RWMutex
+	endpoints map[string]*outlierStats
+	sets      [][]string
+	quit      chan struct{}
+	once      sync.Once
+}
+
+type outlierAlgorithm struct {
+	routing.LBAlgorithm
+	detector *OutlierDetector
+}
+
+type outlierEndpointState struct {
+	Endpoint            string     `json:"endpoint"`
+	Ejected             bool       `json:"ejected"`
+	EjectedUntil        *time.Time `json:"ejectedUntil,omitempty"`
+	Ejections           int        `json:"ejections"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Requests            int        `json:"requests"`
+	Failures            int        `json:"failures"`
+}
+
+// NewOutlierDetector creates an OutlierDetector, and starts the periodic
+// success rate evaluation. Close() needs to be called to stop it.
+func NewOutlierDetector(o OutlierDetectionOptions) *OutlierDetector {
+	if o.ConsecutiveErrors <= 0 {
+		o.ConsecutiveErrors = defaultOutlierConsecutiveErrors
+	}
+
+	if o.Interval <= 0 {
+		o.Interval = defaultOutlierInterval
+	}
+
+	if o.BaseEjectionTime <= 0 {
+		o.BaseEjectionTime = defaultOutlierBaseEjectionTime
+	}
+
+	if o.MaxEjectionTime <= 0 {
+		o.MaxEjectionTime = defaultOutlierMaxEjectionTime
+	}
+
+	if o.MaxEjectionTime < o.BaseEjectionTime {
+		o.MaxEjectionTime = o.BaseEjectionTime
+	}
+
+	if o.MaxEjectionPercent <= 0 {
+		o.MaxEjectionPercent = defaultOutlierMaxEjectionPercent
+	}
+
+	if o.SuccessRateStdevFactor <= 0 {
+		o.SuccessRateStdevFactor = defaultOutlierSuccessRateStdevFactor
+	}
+
+	if o.SuccessRateMinimumHosts <= 0 {
+		o.SuccessRateMinimumHosts = defaultOutlierSuccessRateMinimumHosts
+	}
+
+	if o.SuccessRateRequestVolume <= 0 {
+		o.SuccessRateRequestVolume = defaultOutlierSuccessRateRequestVolume
+	}
+
+	m := o.Metrics
+	if m == nil {
+		m = metrics.Default
+	}
+
+	d := &OutlierDetector{
+		options:   o,
+		metrics:   m,
+		now:       time.Now,
+		endpoints: make(map[string]*outlierStats),
+		quit:      make(chan struct{}),
+	}
+
+	go d.run()
+	return d
+}
+
+func outlierKey(e routing.LBEndpoint) string {
+	return e.Scheme + "://" + e.Host
+}
+
+func (d *OutlierDetector) run() {
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.evaluate()
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// Close stops the periodic success rate evaluation.
+func (d *OutlierDetector) Close() {
+	d.once.Do(func() { close(d.quit) })
+}
+
+func (d *OutlierDetector) stats(key string) *outlierStats {
+	d.mu.RLock()
+	s := d.endpoints[key]
+	d.mu.RUnlock()
+	return s
+}
+
+// snapshot returns the stats of the endpoints, so that they can be locked
+// without holding the lock of the detector.
+func (d *OutlierDetector) snapshot() map[string]*outlierStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	endpoints := make(map[string]*outlierStats, len(d.endpoints))
+	for key, s := range d.endpoints {
+		endpoints[key] = s
+	}
+
+	return endpoints
+}
+
+func (d *OutlierDetector) ejected(s *outlierStats, now time.Time) bool {
+	return s != nil && s.ejectedUntil.Load() > now.UnixNano()
+}
+
+// Ejected tells whether the endpoint is currently ejected.
+func (d *OutlierDetector) Ejected(e routing.LBEndpoint) bool {
+	return d.ejected(d.stats(outlierKey(e)), d.now())
+}
+
+func (d *OutlierDetector) countEjected(set []string, now time.Time) int {
+	var n int
+	for _, key := range set {
+		if d.ejected(d.stats(key), now) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// eject needs to be called with the lock of the stats held.
+func (d *OutlierDetector) eject(key string, s *outlierStats, set []string, reason string, now time.Time) {
+	if d.ejected(s, now) {
+		return
+	}
+
+	if ejected := d.countEjected(set, now); ejected > 0 && ejected*100 >= d.options.MaxEjectionPercent*len(set) {
+		d.metrics.IncCounter("outlier.ejections.overflow")
+		return
+	}
+
+	s.ejections++
+	duration := time.Duration(s.ejections) * d.options.BaseEjectionTime
+	if duration > d.options.MaxEjectionTime {
+		duration = d.options.MaxEjectionTime
+	}
+
+	s.ejectedUntil.Store(now.Add(duration).UnixNano())
+	s.consecutiveFailures = 0
+
+	d.metrics.IncCounter("outlier.ejections." + reason)
+	log.Infof("Outlier detection ejected endpoint %s for %v: %s", key, duration, reason)
+}
+
+// Report records the result of a request to an endpoint of the route.
+func (d *OutlierDetector) Report(r *routing.Route, e routing.LBEndpoint, failed bool) {
+	key := outlierKey(e)
+	s := d.stats(key)
+	if s == nil {
+		d.mu.Lock()
+		if s = d.endpoints[key]; s == nil {
+			s = &outlierStats{}
+			d.endpoints[key] = s
+		}
+		d.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if !failed {
+		s.consecutiveFailures = 0
+		return
+	}
+
+	s.failures++
+	s.consecutiveFailures++
+	if s.consecutiveFailures >= d.options.ConsecutiveErrors {
+		d.eject(key, s, endpointKeys(r.LBEndpoints), consecutiveErrorsReason, d.now())
+	}
+}
+
+func endpointKeys(endpoints []routing.LBEndpoint) []string {
+	keys := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		keys[i] = outlierKey(e)
+	}
+
+	return keys
+}
+
+type successRate struct {
+	key   string
+	stats *outlierStats
+	rate  float64
+}
+
+// evaluateSuccessRate ejects the endpoints of the set whose success rate is
+// too far below the mean.
+func (d *OutlierDetector) evaluateSuccessRate(set []string, now time.Time) {
+	var rates []successRate
+	for _, key := range set {
+		s := d.stats(key)
+		if s == nil {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.requests >= d.options.SuccessRateRequestVolume {
+			rates = append(rates, successRate{key, s, float64(s.requests-s.failures) / float64(s.requests)})
+		}
+		s.mu.Unlock()
+	}
+
+	if len(rates) < d.options.SuccessRateMinimumHosts {
+		return
+	}
+
+	var mean, variance float64
+	for _, r := range rates {
+		mean += r.rate
+	}
+
+	mean /= float64(len(rates))
+	for _, r := range rates {
+		variance += (r.rate - mean) * (r.rate - mean)
+	}
+
+	threshold := mean - d.options.SuccessRateStdevFactor*math.Sqrt(variance/float64(len(rates)))
+
+	// eject the worst endpoints first, when the ejections are limited
+	sort.Slice(rates, func(i, j int) bool { return rates[i].rate < rates[j].rate })
+	for _, r := range rates {
+		if r.rate >= threshold {
+			break
+		}
+
+		r.stats.mu.Lock()
+		d.eject(r.key, r.stats, set, successRateReason, now)
+		r.stats.mu.Unlock()
+	}
+}
+
+func (d *OutlierDetector) evaluate() {
+	now := d.now()
+
+	d.mu.RLock()
+	sets := d.sets
+	d.mu.RUnlock()
+
+	for _, set := range sets {
+		d.evaluateSuccessRate(set, now)
+	}
+
+	var ejected int
+	for _, s := range d.snapshot() {
+		s.mu.Lock()
+		if d.ejected(s, now) {
+			ejected++
+		} else if s.ejections > 0 && s.ejectedUntil.Load()+int64(d.options.Interval) < now.UnixNano() {
+			// the ejection duration decreases, when the endpoint stays healthy
+			s.ejections--
+		}
+
+		s.requests = 0
+		s.failures = 0
+		s.mu.Unlock()
+	}
+
+	d.metrics.UpdateGauge("outlier.ejected", float64(ejected))
+}
+
+// Do implements routing.PostProcessor. It needs to be applied after the
+// algorithms of the routes were initialized.
+func (d *OutlierDetector) Do(routes []*routing.Route) []*routing.Route {
+	var sets [][]string
+	active := make(map[string]bool)
+	for _, r := range routes {
+		if r.Route.BackendType != eskip.LBBackend || r.LBAlgorithm == nil {
+			continue
+		}
+
+		if _, ok := r.LBAlgorithm.(*outlierAlgorithm); !ok {
+			r.LBAlgorithm = &outlierAlgorithm{LBAlgorithm: r.LBAlgorithm, detector: d}
+		}
+
+		set := endpointKeys(r.LBEndpoints)
+		for _, key := range set {
+			active[key] = true
+		}
+
+		sets = append(sets, set)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sets = sets
+	for key := range d.endpoints {
+		if !active[key] {
+			delete(d.endpoints, key)
+		}
+	}
+
+	return routes
+}
+
+// Apply implements routing.LBAlgorithm. When the endpoint chosen by the
+// wrapped algorithm is ejected, it chooses again, and then falls back to the
+// next endpoint that is not ejected.
+func (a *outlierAlgorithm) Apply(ctx *routing.LBContext) routing.LBEndpoint {
+	return chooseHealthy(a.LBAlgorithm, ctx, func(e routing.LBEndpoint) bool { return !a.detector.Ejected(e) })
+}
+
+// chooseHealthy applies the algorithm, and when the chosen endpoint is not
+// healthy, it chooses again, and then falls back to the next healthy
+// endpoint. When none of the endpoints is healthy, it returns the chosen one.
+func chooseHealthy(a routing.LBAlgorithm, ctx *routing.LBContext, healthy func(routing.LBEndpoint) bool) routing.LBEndpoint {
+	e := a.Apply(ctx)
+	if len(ctx.Route.LBEndpoints) == 1 || healthy(e) {
+		return e
+	}
+
+	if e = a.Apply(ctx); healthy(e) {
+		return e
+	}
+
+	endpoints := ctx.Route.LBEndpoints
+	start := 0
+	for i, ei := range endpoints {
+		if ei.Host == e.Host {
+			start = i
+			break
+		}
+	}
+
+	for i := 1; i < len(endpoints); i++ {
+		if candidate := endpoints[(start+i)%len(endpoints)]; healthy(candidate) {
+			return candidate
+		}
+	}
+
+	return e
+}
+
+// ServeHTTP shows the state of the endpoints as JSON.
+func (d *OutlierDetector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := d.now()
+
+	endpoints := d.snapshot()
+	states := make([]outlierEndpointState, 0, len(endpoints))
+	for key, s := range endpoints {
+		s.mu.Lock()
+		state := outlierEndpointState{
+			Endpoint:            key,
+			Ejected:             d.ejected(s, now),
+			Ejections:           s.ejections,
+			ConsecutiveFailures: s.consecutiveFailures,
+			Requests:            s.requests,
+			Failures:            s.failures,
+		}
+		s.mu.Unlock()
+
+		if state.Ejected {
+			until := time.Unix(0, s.ejectedUntil.Load()).UTC()
+			state.EjectedUntil = &until
+		}
+
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].Endpoint < states[j].Endpoint })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(states)
+}
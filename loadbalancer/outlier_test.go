@@ -0,0 +1,286 @@
+package loadbalancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time             { return c.now }
+func (c *testClock) Advance(d time.Duration)    { c.now = c.now.Add(d) }
+func endpointN(rt *routing.Route, i int) string { return outlierKey(rt.LBEndpoints[i]) }
+
+func newOutlierTestRoute(t *testing.T, d *OutlierDetector, algorithm string, n int) *routing.Route {
+	t.Helper()
+
+	eps := make([]string, n)
+	for i := range eps {
+		eps[i] = fmt.Sprintf("http://10.0.0.%d:8080", i+1)
+	}
+
+	r := &routing.Route{Route: eskip.Route{
+		Id:          "outlier",
+		BackendType: eskip.LBBackend,
+		LBAlgorithm: algorithm,
+		LBEndpoints: eps,
+	}}
+
+	rr := NewAlgorithmProvider().Do([]*routing.Route{r})
+	rr = d.Do(rr)
+	if len(rr) != 1 {
+		t.Fatalf("failed to create route: %v", rr)
+	}
+
+	return rr[0]
+}
+
+func newTestOutlierDetector(o OutlierDetectionOptions) (*OutlierDetector, *testClock, *metricstest.MockMetrics) {
+	m := &metricstest.MockMetrics{}
+	o.Metrics = m
+	o.Interval = time.Hour
+
+	d := NewOutlierDetector(o)
+	clock := &testClock{now: time.Now()}
+	d.now = clock.Now
+	return d, clock, m
+}
+
+func TestOutlierConsecutiveErrors(t *testing.T) {
+	d, clock, m := newTestOutlierDetector(OutlierDetectionOptions{
+		ConsecutiveErrors:  3,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    150 * time.Second,
+		MaxEjectionPercent: 50,
+	})
+	defer d.Close()
+
+	rt := newOutlierTestRoute(t, d, "roundRobin", 4)
+	e := rt.LBEndpoints[0]
+
+	d.Report(rt, e, true)
+	d.Report(rt, e, true)
+	d.Report(rt, e, false)
+	d.Report(rt, e, true)
+	d.Report(rt, e, true)
+	if d.Ejected(e) {
+		t.Fatal("ejected without consecutive errors")
+	}
+
+	d.Report(rt, e, true)
+	if !d.Ejected(e) {
+		t.Fatal("not ejected after consecutive errors")
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	if d.Ejected(e) {
+		t.Fatal("ejected after the ejection time")
+	}
+
+	// the second ejection lasts longer
+	for i := 0; i < 3; i++ {
+		d.Report(rt, e, true)
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	if !d.Ejected(e) {
+		t.Fatal("second ejection did not last longer")
+	}
+
+	clock.Advance(time.Minute)
+	if d.Ejected(e) {
+		t.Fatal("ejected after the second ejection time")
+	}
+
+	// the ejection time is limited
+	for i := 0; i < 3; i++ {
+		d.Report(rt, e, true)
+	}
+
+	clock.Advance(151 * time.Second)
+	if d.Ejected(e) {
+		t.Fatal("ejected longer than the max ejection time")
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["outlier.ejections.consecutive-errors"] != 3 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	d, _, m := newTestOutlierDetector(OutlierDetectionOptions{ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+	defer d.Close()
+
+	rt := newOutlierTestRoute(t, d, "roundRobin", 4)
+	for _, e := range rt.LBEndpoints {
+		d.Report(rt, e, true)
+	}
+
+	var ejected int
+	for _, e := range rt.LBEndpoints {
+		if d.Ejected(e) {
+			ejected++
+		}
+	}
+
+	if ejected != 2 {
+		t.Errorf("expected 2 ejected endpoints, got: %d", ejected)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["outlier.ejections.overflow"] != 2 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestOutlierOneEndpointAlwaysEjectable(t *testing.T) {
+	d, _, _ := newTestOutlierDetector(OutlierDetectionOptions{ConsecutiveErrors: 1})
+	defer d.Close()
+
+	rt := newOutlierTestRoute(t, d, "roundRobin", 3)
+	d.Report(rt, rt.LBEndpoints[0], true)
+	d.Report(rt, rt.LBEndpoints[1], true)
+
+	if !d.Ejected(rt.LBEndpoints[0]) || d.Ejected(rt.LBEndpoints[1]) {
+		t.Error("expected only the first endpoint to be ejected")
+	}
+}
+
+func TestOutlierSuccessRate(t *testing.T) {
+	d, _, m := newTestOutlierDetector(OutlierDetectionOptions{
+		ConsecutiveErrors:        1000,
+		MaxEjectionPercent:       50,
+		SuccessRateRequestVolume: 10,
+		SuccessRateMinimumHosts:  5,
+	})
+	defer d.Close()
+
+	rt := newOutlierTestRoute(t, d, "random", 6)
+	for i, e := range rt.LBEndpoints {
+		for j := 0; j < 100; j++ {
+			// the last endpoint fails half of the requests, the others 1%
+			failed := j%100 == 0 || i == len(rt.LBEndpoints)-1 && j%2 == 0
+			d.Report(rt, e, failed)
+		}
+	}
+
+	d.evaluate()
+
+	for i, e := range rt.LBEndpoints {
+		if ejected := d.Ejected(e); ejected != (i == len(rt.LBEndpoints)-1) {
+			t.Errorf("endpoint %s ejected: %v", endpointN(rt, i), ejected)
+		}
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["outlier.ejections.success-rate"] != 1 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+
+	m.WithGauges(func(gauges map[string]float64) {
+		if gauges["outlier.ejected"] != 1 {
+			t.Errorf("unexpected gauges: %v", gauges)
+		}
+	})
+}
+
+func TestOutlierSuccessRateNotEnoughHosts(t *testing.T) {
+	d, _, _ := newTestOutlierDetector(OutlierDetectionOptions{ConsecutiveErrors: 1000, SuccessRateRequestVolume: 10})
+	defer d.Close()
+
+	rt := newOutlierTestRoute(t, d, "random", 3)
+	for i, e := range rt.LBEndpoints {
+		for j := 0; j < 100; j++ {
+			d.Report(rt, e, i == 0)
+		}
+	}
+
+	d.evaluate()
+	if d.Ejected(rt.LBEndpoints[0]) {
+		t.Error("ejected without enough hosts")
+	}
+}
+
+func TestOutlierAlgorithms(t *testing.T) {
+	for _, algorithm := range []string{"roundRobin", "random", "consistentHash", "powerOfRandomNChoices"} {
+		t.Run(algorithm, func(t *testing.T) {
+			d, _, _ := newTestOutlierDetector(OutlierDetectionOptions{ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+			defer d.Close()
+
+			rt := newOutlierTestRoute(t, d, algorithm, 4)
+			if _, ok := rt.LBAlgorithm.(*outlierAlgorithm); !ok {
+				t.Fatalf("algorithm not wrapped: %T", rt.LBAlgorithm)
+			}
+
+			d.Report(rt, rt.LBEndpoints[0], true)
+			d.Report(rt, rt.LBEndpoints[2], true)
+
+			req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+			for i := 0; i < 100; i++ {
+				req.RemoteAddr = fmt.Sprintf("192.168.0.%d:1234", i)
+				e := rt.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: rt})
+				if e.Host == rt.LBEndpoints[0].Host || e.Host == rt.LBEndpoints[2].Host {
+					t.Fatalf("ejected endpoint selected: %s", e.Host)
+				}
+			}
+		})
+	}
+}
+
+func TestOutlierRouteUpdate(t *testing.T) {
+	d, _, _ := newTestOutlierDetector(OutlierDetectionOptions{ConsecutiveErrors: 1})
+	defer d.Close()
+
+	rt := newOutlierTestRoute(t, d, "roundRobin", 3)
+	d.Report(rt, rt.LBEndpoints[0], true)
+
+	// the state is kept for endpoints that are still used
+	updated := newOutlierTestRoute(t, d, "roundRobin", 2)
+	if !d.Ejected(updated.LBEndpoints[0]) {
+		t.Error("ejection lost on route update")
+	}
+
+	d.Report(updated, updated.LBEndpoints[1], false)
+	d.Do(nil)
+	if len(d.snapshot()) != 0 {
+		t.Error("unused endpoints not removed")
+	}
+}
+
+func TestOutlierHandler(t *testing.T) {
+	d, _, _ := newTestOutlierDetector(OutlierDetectionOptions{ConsecutiveErrors: 1})
+	defer d.Close()
+
+	rt := newOutlierTestRoute(t, d, "roundRobin", 3)
+	d.Report(rt, rt.LBEndpoints[0], true)
+	d.Report(rt, rt.LBEndpoints[1], false)
+
+	w := httptest.NewRecorder()
+	d.ServeHTTP(w, httptest.NewRequest("GET", "/outliers", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	var states []outlierEndpointState
+	if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) != 2 ||
+		states[0].Endpoint != endpointN(rt, 0) || !states[0].Ejected || states[0].EjectedUntil == nil ||
+		states[1].Endpoint != endpointN(rt, 1) || states[1].Ejected || states[1].Requests != 1 {
+		t.Errorf("unexpected states: %+v", states)
+	}
+}
@@ -0,0 +1,183 @@
+package loadbalancer
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	defaultZoneMinHealthyPercent = 70
+	defaultZoneMaxLoadFactor     = 2.0
+)
+
+// ZoneAwareOptions configures the zone-aware load balancing. The zero values
+// mean the defaults.
+type ZoneAwareOptions struct {
+	// Zone is the availability zone of Skipper. The endpoints in the same
+	// zone are preferred.
+	Zone string
+
+	// MinHealthyPercent is the minimum percentage of the endpoints of a
+	// route in the local zone that need to be healthy, otherwise the
+	// requests spill over to the other zones, 70 by default.
+	MinHealthyPercent int
+
+	// MaxLoadFactor limits the load of the local zone. When the average
+	// number of outstanding requests of the healthy endpoints in the local
+	// zone is higher than this factor times the average of all the healthy
+	// endpoints of the route, the requests spill over to the other zones,
+	// 2 by default.
+	MaxLoadFactor float64
+
+	// OutlierDetector, when set, tells which endpoints are healthy. Without
+	// it, all endpoints are considered healthy.
+	OutlierDetector *OutlierDetector
+
+	// ActiveHealthChecker, when set, tells which endpoints are healthy, too.
+	ActiveHealthChecker *ActiveHealthChecker
+
+	// Metrics is used to report the spillovers, metrics.Default when not
+	// set.
+	Metrics metrics.Metrics
+}
+
+// ZoneAware implements routing.PostProcessor, and makes the load balanced
+// routes prefer the endpoints in the same zone as Skipper. The zones of the
+// endpoints are set by the post-processor found in the filters/zone package,
+// which needs to run before. When used together with the OutlierDetector,
+// ZoneAware needs to run before it, too. Use NewZoneAware() to create one.
+type ZoneAware struct {
+	options ZoneAwareOptions
+	metrics metrics.Metrics
+}
+
+type zoneAlgorithm struct {
+	routing.LBAlgorithm
+	local *routing.Route
+	zone  *ZoneAware
+}
+
+// NewZoneAware creates the post-processor for the zone-aware load
+// balancing.
+func NewZoneAware(o ZoneAwareOptions) *ZoneAware {
+	if o.MinHealthyPercent <= 0 {
+		o.MinHealthyPercent = defaultZoneMinHealthyPercent
+	}
+
+	if o.MaxLoadFactor <= 0 {
+		o.MaxLoadFactor = defaultZoneMaxLoadFactor
+	}
+
+	m := o.Metrics
+	if m == nil {
+		m = metrics.Default
+	}
+
+	return &ZoneAware{options: o, metrics: m}
+}
+
+// Do implements routing.PostProcessor. It wraps the algorithm of the load
+// balanced routes, that have endpoints both in the local and in other zones.
+func (z *ZoneAware) Do(routes []*routing.Route) []*routing.Route {
+	if z.options.Zone == "" {
+		return routes
+	}
+
+	for _, r := range routes {
+		if r.Route.BackendType != eskip.LBBackend || r.LBAlgorithm == nil {
+			continue
+		}
+
+		if _, ok := r.LBAlgorithm.(*zoneAlgorithm); ok {
+			continue
+		}
+
+		local := *r
+		local.LBEndpoints = nil
+		local.Route.LBEndpoints = nil
+		local.Route.LBEndpointWeights = nil
+		for i, e := range r.LBEndpoints {
+			if e.Zone == z.options.Zone {
+				local.LBEndpoints = append(local.LBEndpoints, e)
+				local.Route.LBEndpoints = append(local.Route.LBEndpoints, r.Route.LBEndpoints[i])
+				if len(r.Route.LBEndpointWeights) > 0 {
+					local.Route.LBEndpointWeights = append(local.Route.LBEndpointWeights, r.Route.LBEndpointWeights[i])
+				}
+			}
+		}
+
+		if len(local.LBEndpoints) == 0 || len(local.LBEndpoints) == len(r.LBEndpoints) {
+			continue
+		}
+
+		a, err := newAlgorithm(r.Route.LBAlgorithm, local.Route.LBEndpoints, local.Route.LBEndpointWeights)
+		if err != nil {
+			log.Errorf("Failed to set the zone-aware LB algorithm for route %s: %v.", r.Id, err)
+			continue
+		}
+
+		local.LBAlgorithm = a
+		r.LBAlgorithm = &zoneAlgorithm{LBAlgorithm: r.LBAlgorithm, local: &local, zone: z}
+	}
+
+	return routes
+}
+
+func (z *ZoneAware) healthy(routeID string, e routing.LBEndpoint) bool {
+	if z.options.OutlierDetector != nil && z.options.OutlierDetector.Ejected(e) {
+		return false
+	}
+
+	return z.options.ActiveHealthChecker == nil || z.options.ActiveHealthChecker.Healthy(routeID, e)
+}
+
+// load returns the number of healthy endpoints and their average outstanding
+// requests, increased by one to smooth the idle state.
+func (z *ZoneAware) load(routeID string, endpoints []routing.LBEndpoint) (int, float64) {
+	var healthy, inflight int
+	for _, e := range endpoints {
+		if !z.healthy(routeID, e) {
+			continue
+		}
+
+		healthy++
+		if e.Metrics != nil {
+			inflight += e.Metrics.GetInflightRequests()
+		}
+	}
+
+	if healthy == 0 {
+		return 0, 0
+	}
+
+	return healthy, float64(inflight)/float64(healthy) + 1
+}
+
+// spillover tells whether the local zone of a route has too few healthy
+// endpoints, or too much load compared to the other zones.
+func (a *zoneAlgorithm) spillover(routeID string, all []routing.LBEndpoint) bool {
+	healthy, localLoad := a.zone.load(routeID, a.local.LBEndpoints)
+	if healthy*100 < a.zone.options.MinHealthyPercent*len(a.local.LBEndpoints) {
+		return true
+	}
+
+	_, allLoad := a.zone.load(routeID, all)
+	return localLoad > a.zone.options.MaxLoadFactor*allLoad
+}
+
+// Apply implements routing.LBAlgorithm. It applies the algorithm of the
+// route to the endpoints in the local zone, or to all endpoints when the
+// requests spill over.
+func (a *zoneAlgorithm) Apply(ctx *routing.LBContext) routing.LBEndpoint {
+	if a.spillover(ctx.Route.Id, ctx.Route.LBEndpoints) {
+		a.zone.metrics.IncCounter("zoneaware.spillover." + ctx.Route.Id)
+		return a.LBAlgorithm.Apply(ctx)
+	}
+
+	local := *ctx
+	local.Route = a.local
+	return a.local.LBAlgorithm.Apply(&local)
+}
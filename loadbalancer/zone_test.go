@@ -0,0 +1,153 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+// newZoneTestRoute creates a route with endpoints in the given zones.
+func newZoneTestRoute(t *testing.T, algorithm string, zones ...string) *routing.Route {
+	t.Helper()
+
+	eps := make([]string, len(zones))
+	for i := range eps {
+		eps[i] = fmt.Sprintf("http://10.0.0.%d:8080", i+1)
+	}
+
+	r := &routing.Route{Route: eskip.Route{
+		Id:          "zone",
+		BackendType: eskip.LBBackend,
+		LBAlgorithm: algorithm,
+		LBEndpoints: eps,
+	}}
+
+	rr := NewAlgorithmProvider().Do([]*routing.Route{r})
+	if len(rr) != 1 {
+		t.Fatalf("failed to create route: %v", rr)
+	}
+
+	for i, z := range zones {
+		rr[0].LBEndpoints[i].Zone = z
+	}
+
+	return rr[0]
+}
+
+func applyZoneTestRoute(rt *routing.Route, n int) map[string]int {
+	hosts := make(map[string]int)
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	for i := 0; i < n; i++ {
+		req.RemoteAddr = fmt.Sprintf("192.168.0.%d:1234", i%256)
+		e := rt.LBAlgorithm.Apply(&routing.LBContext{Request: req, Route: rt})
+		hosts[e.Host]++
+	}
+
+	return hosts
+}
+
+func TestZoneAwarePrefersLocalZone(t *testing.T) {
+	for _, algorithm := range []string{"roundRobin", "random", "consistentHash", "powerOfRandomNChoices", "peakEwma", "weightedLeastRequest", "maglev"} {
+		t.Run(algorithm, func(t *testing.T) {
+			rt := newZoneTestRoute(t, algorithm, "a", "b", "a", "b", "c", "a")
+			NewZoneAware(ZoneAwareOptions{Zone: "a", Metrics: &metricstest.MockMetrics{}}).Do([]*routing.Route{rt})
+			if _, ok := rt.LBAlgorithm.(*zoneAlgorithm); !ok {
+				t.Fatalf("algorithm not wrapped: %T", rt.LBAlgorithm)
+			}
+
+			for host := range applyZoneTestRoute(rt, 300) {
+				if host != "10.0.0.1:8080" && host != "10.0.0.3:8080" && host != "10.0.0.6:8080" {
+					t.Fatalf("endpoint from another zone selected: %s", host)
+				}
+			}
+		})
+	}
+}
+
+func TestZoneAwareNotApplied(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		zone  string
+		zones []string
+	}{{
+		title: "zone not set",
+		zones: []string{"a", "b"},
+	}, {
+		title: "no local endpoints",
+		zone:  "c",
+		zones: []string{"a", "b"},
+	}, {
+		title: "all endpoints local",
+		zone:  "a",
+		zones: []string{"a", "a"},
+	}, {
+		title: "endpoint zones not known",
+		zone:  "a",
+		zones: []string{"", ""},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			rt := newZoneTestRoute(t, "roundRobin", test.zones...)
+			NewZoneAware(ZoneAwareOptions{Zone: test.zone}).Do([]*routing.Route{rt})
+			if _, ok := rt.LBAlgorithm.(*zoneAlgorithm); ok {
+				t.Fatal("algorithm wrapped")
+			}
+		})
+	}
+}
+
+func TestZoneAwareSpilloverUnhealthy(t *testing.T) {
+	d, _, _ := newTestOutlierDetector(OutlierDetectionOptions{ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+	defer d.Close()
+
+	m := &metricstest.MockMetrics{}
+	rt := newZoneTestRoute(t, "roundRobin", "a", "b", "a", "b", "a", "b")
+	rr := NewZoneAware(ZoneAwareOptions{Zone: "a", MinHealthyPercent: 60, OutlierDetector: d, Metrics: m}).Do([]*routing.Route{rt})
+	d.Do(rr)
+
+	// with one of the three local endpoints ejected, the local zone is still healthy enough
+	d.Report(rt, rt.LBEndpoints[0], true)
+	hosts := applyZoneTestRoute(rt, 60)
+	if hosts["10.0.0.2:8080"] != 0 || hosts["10.0.0.4:8080"] != 0 || hosts["10.0.0.6:8080"] != 0 {
+		t.Fatalf("spilled over with enough healthy local endpoints: %v", hosts)
+	}
+
+	d.Report(rt, rt.LBEndpoints[2], true)
+	hosts = applyZoneTestRoute(rt, 60)
+	if hosts["10.0.0.2:8080"] == 0 || hosts["10.0.0.4:8080"] == 0 || hosts["10.0.0.6:8080"] == 0 {
+		t.Fatalf("failed to spill over: %v", hosts)
+	}
+
+	if hosts["10.0.0.1:8080"] != 0 || hosts["10.0.0.3:8080"] != 0 {
+		t.Fatalf("ejected endpoint selected: %v", hosts)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["zoneaware.spillover.zone"] < 60 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestZoneAwareSpilloverLoad(t *testing.T) {
+	rt := newZoneTestRoute(t, "roundRobin", "a", "b", "b", "b")
+	NewZoneAware(ZoneAwareOptions{Zone: "a", MaxLoadFactor: 2, Metrics: &metricstest.MockMetrics{}}).Do([]*routing.Route{rt})
+
+	// local load: 3+1, average load: 3/4+1
+	addInflightRequests(rt.LBEndpoints[0], 3)
+	hosts := applyZoneTestRoute(rt, 40)
+	if len(hosts) != 4 {
+		t.Fatalf("failed to spill over: %v", hosts)
+	}
+
+	// local load: 1+1, average load: 1/4+1
+	rt.LBEndpoints[0].Metrics.DecInflightRequest()
+	rt.LBEndpoints[0].Metrics.DecInflightRequest()
+	hosts = applyZoneTestRoute(rt, 40)
+	if len(hosts) != 1 || hosts["10.0.0.1:8080"] != 40 {
+		t.Fatalf("spilled over without enough load: %v", hosts)
+	}
+}
@@ -111,6 +111,10 @@ func (c *CodaHale) UpdateGauge(key string, v float64) {
 	c.getGauge(key).Update(v)
 }
 
+func (c *CodaHale) DeleteGauge(key string) {
+	c.reg.Unregister(key)
+}
+
 func (c *CodaHale) IncCounter(key string) {
 	c.incCounter(key, 1)
 }
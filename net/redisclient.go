@@ -400,6 +400,16 @@ func (r *RedisRingClient) Set(ctx context.Context, key string, value interface{}
 	return res.Result()
 }
 
+func (r *RedisRingClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	res := r.ring.SetNX(ctx, key, value, expiration)
+	return res.Result()
+}
+
+func (r *RedisRingClient) Del(ctx context.Context, keys ...string) (int64, error) {
+	res := r.ring.Del(ctx, keys...)
+	return res.Val(), res.Err()
+}
+
 func (r *RedisRingClient) ZAdd(ctx context.Context, key string, val int64, score float64) (int64, error) {
 	res := r.ring.ZAdd(ctx, key, redis.Z{Member: val, Score: score})
 	return res.Val(), res.Err()
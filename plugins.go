@@ -84,7 +84,7 @@ func (o *Options) findAndLoadPlugins() error {
 
 		if !pluginIsLoaded(done, name, "InitFilter") {
 			if sym, err := mod.Lookup("InitFilter"); err == nil {
-				spec, err := initFilterPlugin(sym, path, conf)
+				spec, err := initFilterPlugin(sym, path, conf, o.PluginConfig[name])
 				if err != nil {
 					return fmt.Errorf("filter plugin %s returned: %s", path, err)
 				}
@@ -213,7 +213,7 @@ func (o *Options) loadFilterPlugins(found map[string]string, done map[string][]s
 		if !ok {
 			return fmt.Errorf("filter plugin %s not found in plugin dirs", name)
 		}
-		spec, err := loadFilterPlugin(path, fltr[1:])
+		spec, err := loadFilterPlugin(path, fltr[1:], o.PluginConfig[name])
 		if err != nil {
 			return fmt.Errorf("failed to load plugin %s: %s", path, err)
 		}
@@ -224,7 +224,7 @@ func (o *Options) loadFilterPlugins(found map[string]string, done map[string][]s
 	return nil
 }
 
-func loadFilterPlugin(path string, args []string) (filters.Spec, error) {
+func loadFilterPlugin(path string, args []string, config filters.PluginConfig) (filters.Spec, error) {
 	mod, err := plugin.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("open filter plugin %s: %s", path, err)
@@ -239,15 +239,26 @@ func loadFilterPlugin(path string, args []string) (filters.Spec, error) {
 	if err != nil {
 		return nil, fmt.Errorf("lookup module symbol failed for %s: %s", path, err)
 	}
-	return initFilterPlugin(sym, path, append(conf, args...))
+	return initFilterPlugin(sym, path, append(conf, args...), config)
 }
 
-func initFilterPlugin(sym plugin.Symbol, path string, args []string) (filters.Spec, error) {
-	fn, ok := sym.(func([]string) (filters.Spec, error))
-	if !ok {
+// initFilterPlugin calls InitFilter with the arguments, and with the plugin's
+// section of the plugin config when it accepts one:
+//
+//	func InitFilter(args []string, config filters.PluginConfig) (filters.Spec, error)
+func initFilterPlugin(sym plugin.Symbol, path string, args []string, config filters.PluginConfig) (filters.Spec, error) {
+	var (
+		spec filters.Spec
+		err  error
+	)
+	switch fn := sym.(type) {
+	case func([]string) (filters.Spec, error):
+		spec, err = fn(args)
+	case func([]string, filters.PluginConfig) (filters.Spec, error):
+		spec, err = fn(args, config)
+	default:
 		return nil, fmt.Errorf("plugin %s's InitFilter function has wrong signature", path)
 	}
-	spec, err := fn(args)
 	if err != nil {
 		return nil, fmt.Errorf("plugin %s returned: %s", path, err)
 	}
@@ -1,4 +1,4 @@
-package main
+package attestation
 
 import (
 	_ "embed"
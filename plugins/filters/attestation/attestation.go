@@ -1,36 +1,144 @@
-package main
+package attestation
 
 import (
-	"github.com/zalando/skipper/filters"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"sync"
+
+	"github.com/zalando/skipper/filters"
 )
 
+// Name is the name of the attestation filter.
+const Name = "attestation"
+
+// Config is the configuration of the attestation filter, from the
+// attestation section of the plugin config.
+type Config struct {
+	// Environment is production, dev or local, local by default. It
+	// selects the host used to calculate the request nonce.
+	Environment string `yaml:"environment"`
+
+	// DynamoTableName is the DynamoDB table storing the attestations.
+	DynamoTableName string `yaml:"dynamo-table-name"`
+
+	// GoogleCredentialsFile is the service account file used for the Play
+	// Integrity API. The default credentials are used when it is empty.
+	GoogleCredentialsFile string `yaml:"google-credentials-file"`
+}
+
+func (c Config) environment() string {
+	switch c.Environment {
+	case production, dev:
+		return c.Environment
+	default:
+		return local
+	}
+}
+
 var _ filters.Spec = (*attestationSpec)(nil)
 
-type attestationSpec struct{}
+type attestationSpec struct {
+	config Config
+	logger *slog.Logger
 
-// InitFilter is called by Skipper to create a new instance of the filter when loaded as a plugin
-func InitFilter(_ []string) (filters.Spec, error) {
-	return &attestationSpec{}, nil
+	mu      sync.Mutex
+	refs    int
+	clients *clients
 }
 
-func (s *attestationSpec) Name() string {
-	return "attestation"
+// clients are shared by all attestation filters. They are created with the
+// first filter and closed when the last filter is closed.
+type clients struct {
+	transport  *http.Transport
+	repo       *repo
+	googlePlay googlePlayIntegrityServiceClient
+	appStore   appStore
 }
 
-func (s *attestationSpec) CreateFilter(_ []interface{}) (filters.Filter, error) {
+// NewAttestation creates the attestation filter spec.
+func NewAttestation(c Config) filters.Spec {
 	slogHandler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	})
 
-	logger := slog.New(slogHandler)
+	return &attestationSpec{
+		config: c,
+		logger: slog.New(slogHandler),
+	}
+}
 
-	filter := &attestationFilter{
-		repo:       NewRepo(os.Getenv("DYNAMO_TABLE_NAME")),
-		googlePlay: newGooglePlayIntegrityServiceClient(logger),
+func newClients(c Config, logger *slog.Logger) (*clients, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	repo, err := NewRepo(c.DynamoTableName, &http.Client{Transport: transport})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DynamoDB client: %w", err)
+	}
+
+	googlePlay, err := newGooglePlayIntegrityServiceClient(logger, c.GoogleCredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Play Integrity client: %w", err)
+	}
+
+	return &clients{
+		transport:  transport,
+		repo:       repo,
+		googlePlay: googlePlay,
 		appStore:   newAppStoreIntegrityServiceClient(logger),
-		logger:     logger,
+	}, nil
+}
+
+func (c *clients) close() {
+	c.transport.CloseIdleConnections()
+}
+
+func (s *attestationSpec) acquire() (*clients, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.clients == nil {
+		c, err := newClients(s.config, s.logger)
+		if err != nil {
+			return nil, err
+		}
+
+		s.clients = c
+	}
+
+	s.refs++
+	return s.clients, nil
+}
+
+func (s *attestationSpec) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refs--
+	if s.refs == 0 {
+		s.clients.close()
+		s.clients = nil
+	}
+}
+
+func (s *attestationSpec) Name() string {
+	return Name
+}
+
+func (s *attestationSpec) CreateFilter(_ []interface{}) (filters.Filter, error) {
+	c, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &attestationFilter{
+		spec:        s,
+		repo:        c.repo,
+		googlePlay:  c.googlePlay,
+		appStore:    c.appStore,
+		logger:      s.logger,
+		environment: s.config.environment(),
 	}
 
 	return filter, nil
@@ -1,4 +1,4 @@
-package main
+package attestation
 
 import (
 	"regexp"
@@ -10,6 +10,7 @@ const (
 	production            = "production"
 	dev                   = "dev"
 	local                 = "local"
+	maxRequestBodyBytes   = 1 << 20
 
 	productionAndroidPackageName       = "com.muzmatch.muzmatchapp"
 	productionAndroidSigningCertDigest = "dpkBP6sRbN7Cu7B7Rv0AvxQPSZzOYJ9u-Gn5zYs_pWI"
@@ -1,4 +1,4 @@
-package main
+package attestation
 
 import (
 	"bytes"
@@ -6,6 +6,7 @@ import (
 	_ "embed"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"golang.org/x/mod/semver"
 	"golang.org/x/text/language"
 	"io"
@@ -16,16 +17,18 @@ import (
 	"github.com/zalando/skipper/filters"
 )
 
-var _ filters.Filter = (*attestationFilter)(nil)
+var _ filters.FilterCloser = (*attestationFilter)(nil)
 
 //go:embed lang.json
 var langStrings []byte
 
 type attestationFilter struct {
-	repo       *repo
-	googlePlay googlePlayIntegrityServiceClient
-	appStore   appStore
-	logger     *slog.Logger
+	spec        *attestationSpec
+	repo        *repo
+	googlePlay  googlePlayIntegrityServiceClient
+	appStore    appStore
+	logger      *slog.Logger
+	environment string
 }
 
 func (a attestationFilter) Request(ctx filters.FilterContext) {
@@ -158,9 +161,16 @@ func (a attestationFilter) Request(ctx filters.FilterContext) {
 		buf := make([]byte, 128)
 		_, _ = rand.Read(buf)
 
-		requestBody, _ := io.ReadAll(ctx.Request().Body)
+		requestBody, err := readRequestBody(ctx)
+		if errors.Is(err, filters.ErrRequestBodyTooLarge) {
+			sendErrorResponse(ctx, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		} else if err != nil {
+			sendErrorResponse(ctx, http.StatusInternalServerError, "Failed to read request body")
+			return
+		}
 
-		err := a.repo.CreateAttestationForUDID(
+		err = a.repo.CreateAttestationForUDID(
 			deviceUDID,
 			[]byte(base64.URLEncoding.EncodeToString(buf)),
 			platform,
@@ -301,8 +311,17 @@ func (a attestationFilter) Request(ctx filters.FilterContext) {
 	}
 
 	// Calculate the hash
+	requestBody, err := readRequestBody(ctx)
+	if errors.Is(err, filters.ErrRequestBodyTooLarge) {
+		sendErrorResponse(ctx, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	} else if err != nil {
+		sendErrorResponse(ctx, http.StatusInternalServerError, "Failed to calculate server nonce")
+		return
+	}
+
 	var base64encodedChallenge string // TODO: base64.URLEncoding.EncodeToString(existingAppAttestation.challenge))
-	serverNonce, serverNonceErr := calculateRequestNonce(ctx.Request(), base64encodedChallenge)
+	serverNonce, serverNonceErr := calculateRequestNonce(ctx.Request(), requestBody, base64encodedChallenge, a.environment)
 	if serverNonceErr != nil {
 		sendErrorResponse(ctx, http.StatusInternalServerError, "Failed to calculate server nonce")
 		return
@@ -367,3 +386,9 @@ func (a attestationFilter) Request(ctx filters.FilterContext) {
 }
 
 func (a attestationFilter) Response(_ filters.FilterContext) {}
+
+// Close releases the clients shared with the other attestation filters.
+func (a attestationFilter) Close() error {
+	a.spec.release()
+	return nil
+}
@@ -0,0 +1,33 @@
+package attestation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestUnprotectedRouteIsPassedThrough(t *testing.T) {
+	ctx := &filtertest.Context{
+		FRequest: httptest.NewRequest("GET", "http://api.example.org/v2.5/members", nil),
+	}
+
+	attestationFilter{}.Request(ctx)
+
+	if ctx.FServed {
+		t.Errorf("expected request to be passed through, got %d", ctx.FResponse.StatusCode)
+	}
+}
+
+func TestMissingUDID(t *testing.T) {
+	ctx := &filtertest.Context{
+		FRequest: httptest.NewRequest("POST", "http://api.example.org/v2.5/auth/confirm", nil),
+	}
+
+	attestationFilter{}.Request(ctx)
+
+	if !ctx.FServed || ctx.FResponse.StatusCode != http.StatusForbidden {
+		t.Errorf("expected %d response", http.StatusForbidden)
+	}
+}
@@ -1,8 +1,7 @@
-package main
+package attestation
 
 import (
 	"context"
-	_ "embed"
 	"fmt"
 	"log/slog"
 
@@ -10,29 +9,26 @@ import (
 	"google.golang.org/api/playintegrity/v1"
 )
 
-var (
-	//go:embed googleCredentials.json
-	googleCredentials []byte
-)
-
 type googlePlayIntegrityServiceClient struct {
 	logger *slog.Logger
 	client *playintegrity.Service
 }
 
-func newGooglePlayIntegrityServiceClient(logger *slog.Logger) googlePlayIntegrityServiceClient {
-	client, initGoogleServiceErr := playintegrity.NewService(
-		context.Background(),
-		option.WithCredentialsJSON(googleCredentials),
-	)
+func newGooglePlayIntegrityServiceClient(logger *slog.Logger, credentialsFile string) (googlePlayIntegrityServiceClient, error) {
+	var opts []option.ClientOption
+	if credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(credentialsFile))
+	}
+
+	client, initGoogleServiceErr := playintegrity.NewService(context.Background(), opts...)
 	if initGoogleServiceErr != nil {
-		panic("Failed to init Google Play Integrity Service")
+		return googlePlayIntegrityServiceClient{}, initGoogleServiceErr
 	}
 
 	return googlePlayIntegrityServiceClient{
 		logger: logger,
 		client: client,
-	}
+	}, nil
 }
 
 func (c googlePlayIntegrityServiceClient) validate(token []byte, nonce string) integrityEvaluation {
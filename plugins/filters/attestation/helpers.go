@@ -1,4 +1,4 @@
-package main
+package attestation
 
 import (
 	"bytes"
@@ -9,7 +9,6 @@ import (
 	log "github.com/sirupsen/logrus"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/zalando/skipper/filters"
@@ -92,20 +91,20 @@ func sendUpgradeResponse(ctx filters.FilterContext, platform Platform, locale st
 	)
 }
 
-func env() string {
-	switch os.Getenv("ENVIRONMENT") {
-	case production:
-		return production
-	case dev:
-		return dev
-	default:
-		return local
+// readRequestBody reads the request body, leaving it in place for the
+// backend.
+func readRequestBody(ctx filters.FilterContext) ([]byte, error) {
+	body, err := ctx.BufferedRequestBody(maxRequestBodyBytes)
+	if err != nil {
+		return nil, err
 	}
+
+	return io.ReadAll(body)
 }
 
-func calculateRequestNonce(r *http.Request, challenge string) (string, error) {
+func calculateRequestNonce(r *http.Request, body []byte, challenge string, environment string) (string, error) {
 	r.URL.Scheme = "https"
-	switch env() {
+	switch environment {
 	case production:
 		r.URL.Host = "api.muzzapi.com"
 	case dev:
@@ -115,13 +114,7 @@ func calculateRequestNonce(r *http.Request, challenge string) (string, error) {
 	}
 
 	usingBody := true
-	bodyBuf, readBodyErr := io.ReadAll(r.Body)
-	if readBodyErr != nil {
-		return "", fmt.Errorf("cannot read body: %w", readBodyErr)
-	}
-
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyBuf)) // Set the body back to the original so it can be read again later
-	dataToHash := bytes.NewBuffer(bodyBuf).Bytes()
+	dataToHash := body
 
 	// If there's no request body use the URL as the data to hash
 	if len(dataToHash) == 0 {
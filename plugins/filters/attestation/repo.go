@@ -1,4 +1,4 @@
-package main
+package attestation
 
 import (
 	"context"
@@ -20,14 +20,18 @@ type repo struct {
 	table  string
 }
 
-func NewRepo(table string) *repo {
-	cfg, _ := config.LoadDefaultConfig(context.Background())
+func NewRepo(table string, httpClient *http.Client) (*repo, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+
 	client := dynamodb.NewFromConfig(cfg)
 
 	return &repo{
 		client: client,
 		table:  table,
-	}
+	}, nil
 }
 
 type AttestationModel struct {
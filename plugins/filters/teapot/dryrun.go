@@ -0,0 +1,108 @@
+package teapot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+var (
+	_ filters.Spec   = (*teapotDryRunSpec)(nil)
+	_ filters.Filter = (*teapotDryRunFilter)(nil)
+)
+
+// teapotDryRunSpec creates the teapotDryRun filter. It reports which teapot
+// a request would hit, without blocking anything:
+//
+//	dryRun: Path("/teapot/dry-run") -> teapotDryRun() -> <shunt>
+//
+// The request to check is described by the query parameters method (GET by
+// default), path, host and country (GB by default).
+type teapotDryRunSpec struct {
+	loader *Loader
+}
+
+type teapotDryRunFilter struct {
+	loader *Loader
+}
+
+type teapotDryRunResponse struct {
+	Matched                     bool   `json:"matched"`
+	Teapot                      string `json:"teapot,omitempty"`
+	Service                     string `json:"service,omitempty"`
+	Route                       string `json:"route,omitempty"`
+	Global                      bool   `json:"global,omitempty"`
+	PredictedUptimeTimestampUTC string `json:"predictedUptimeTimestampUTC,omitempty"`
+}
+
+func (s *teapotDryRunSpec) Name() string {
+	return DryRunName
+}
+
+func (s *teapotDryRunSpec) CreateFilter(_ []interface{}) (filters.Filter, error) {
+	s.loader.ensureLoaded()
+	return &teapotDryRunFilter{loader: s.loader}, nil
+}
+
+// dryRunRequest builds the request described by the query parameters.
+func dryRunRequest(q url.Values) *http.Request {
+	method := strings.ToUpper(q.Get("method"))
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	path := q.Get("path")
+	if path == "" {
+		path = "/"
+	}
+
+	return &http.Request{
+		Method: method,
+		URL:    &url.URL{Path: path},
+		Host:   q.Get("host"),
+		Header: make(http.Header),
+	}
+}
+
+func (f *teapotDryRunFilter) Request(ctx filters.FilterContext) {
+	f.loader.reloadIfDue(time.Now())
+
+	q := ctx.Request().URL.Query()
+	country := strings.ToUpper(q.Get("country"))
+	if country == "" {
+		country = "GB"
+	}
+
+	var response teapotDryRunResponse
+	if m := f.loader.current().match(dryRunRequest(q), country, time.Now()); m != nil {
+		response = teapotDryRunResponse{
+			Matched:                     true,
+			Teapot:                      m.Name,
+			Service:                     m.Service,
+			Route:                       m.Route,
+			Global:                      m.Global,
+			PredictedUptimeTimestampUTC: m.Teapot.EndsAt.UTC().Format(time.RFC3339),
+		}
+	}
+
+	body, _ := json.Marshal(response)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+
+	ctx.Serve(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		},
+	)
+}
+
+func (f *teapotDryRunFilter) Response(_ filters.FilterContext) {}
@@ -1,73 +1,19 @@
-package main
+package teapot
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
-	"os"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/zalando/skipper/filters"
-	"golang.org/x/text/language"
+	"github.com/zalando/skipper/filters/accesslog"
 )
 
 var _ filters.Filter = (*teapotFilter)(nil)
 
 type teapotFilter struct {
-	NextLoad     time.Time
-	Services     []teapotService
-	ServicesHash string
-	Teapots      []teapotConfig
-	TeapotsHash  string
-}
-
-func (f *teapotFilter) loadServices() {
-	data, md5result, fetchErr := fetchS3File(
-		os.Getenv("TEAPOT_S3_BUCKET"),
-		os.Getenv("TEAPOT_S3_SERVICES_KEY"),
-	)
-	if fetchErr != nil {
-		slog.Error("Error fetching services.json", "error", fetchErr)
-		return
-	}
-
-	// Only import if the hash is different
-	if f.ServicesHash == md5result {
-		return
-	}
-
-	if unmarshalErr := json.Unmarshal(data, &f.Services); unmarshalErr != nil {
-		slog.Error("Error reading services.json", "error", unmarshalErr)
-		return
-	}
-	f.ServicesHash = md5result
-}
-
-func (f *teapotFilter) loadTeapots() {
-	data, md5result, fetchErr := fetchS3File(
-		os.Getenv("TEAPOT_S3_BUCKET"),
-		os.Getenv("TEAPOT_S3_TEAPOTS_KEY"),
-	)
-	if fetchErr != nil {
-		slog.Error("Error fetching teapots.json", "error", fetchErr)
-		return
-	}
-
-	// Only import if the hash is different
-	if f.TeapotsHash == md5result {
-		return
-	}
-
-	if unmarshalErr := json.Unmarshal(data, &f.Teapots); unmarshalErr != nil {
-		slog.Error("Error reading teapots.json", "error", unmarshalErr)
-		return
-	}
-	f.TeapotsHash = md5result
+	loader *Loader
 }
 
 func (f *teapotFilter) determineCountry(ctx filters.FilterContext) string {
@@ -86,180 +32,94 @@ func (f *teapotFilter) determineCountry(ctx filters.FilterContext) string {
 	return "GB" // Fallback to UK
 }
 
-func (f *teapotFilter) sendTeapotMessage(ctx filters.FilterContext, teapot teapotConfig, global bool) {
-	var languageTags []language.Tag
-	for lang := range teapot.Message {
-		languageTags = append(languageTags, language.Make(lang))
-	}
-
-	var matcher = language.NewMatcher(languageTags)
-	accept := ctx.Request().Header.Get("Accept-Language")
-	tag, _ := language.MatchStrings(matcher, "", accept)
-	locale := tag.String()
-
-	if len(locale) > 5 {
-		locale = strings.Split(locale, "-")[0]
+// requestPlatform tells the apps apart by their User-Agent, everything else
+// is counted as web.
+func requestPlatform(r *http.Request) string {
+	userAgent := r.Header.Get("User-Agent")
+	switch {
+	case strings.Contains(userAgent, "iOS"):
+		return "ios"
+	case strings.HasPrefix(userAgent, "okhttp/"), strings.Contains(userAgent, "Android"):
+		return "android"
+	default:
+		return "web"
 	}
+}
 
-	var titleLanguageTags []language.Tag
-	for lang := range teapot.Title {
-		titleLanguageTags = append(titleLanguageTags, language.Make(lang))
+// metricCountry limits the country used in metric keys to ISO 3166 alpha-2
+// codes, as the CDN headers can be set by the clients.
+func metricCountry(country string) string {
+	if len(country) != 2 {
+		return "unknown"
 	}
 
-	matcher = language.NewMatcher(titleLanguageTags)
-	tag, _ = language.MatchStrings(matcher, "", accept)
-	titleLocale := tag.String()
-
-	if len(titleLocale) > 5 {
-		titleLocale = strings.Split(titleLocale, "-")[0]
+	for _, c := range country {
+		if c < 'A' || c > 'Z' {
+			return "unknown"
+		}
 	}
 
-	ctx.Logger().Debugf("Locale: %s", locale)
+	return country
+}
 
-	response := &teapotResponse{
-		PredictedUptimeTimestampUTC: teapot.EndsAt.UTC().Format(time.RFC3339),
-		Global:                      global,
-	}
+// tagRequest records the matched teapot in the state bag, the access log and
+// the filter metrics.
+func tagRequest(ctx filters.FilterContext, m *teapotMatch, country, platform string) {
+	bag := ctx.StateBag()
+	bag[TeapotNameStateBagKey] = m.Name
+	bag[TeapotServiceStateBagKey] = m.Service
 
-	message := teapot.Message[locale]
-	if strings.Contains(teapot.Message[locale], "%s") {
-		message = fmt.Sprintf(teapot.Message[locale], teapot.EndsAt.UTC().Format("3:04pm UTC"))
-	}
-	message = strings.TrimSpace(message)
-	if len(message) > 0 {
-		response.Message = &message
+	additionalData, ok := bag[accesslog.AccessLogAdditionalDataKey].(map[string]interface{})
+	if !ok {
+		additionalData = make(map[string]interface{})
+		bag[accesslog.AccessLogAdditionalDataKey] = additionalData
 	}
+	additionalData["teapot"] = m.Name
+	additionalData["teapot_service"] = m.Service
 
-	title := teapot.Title[titleLocale]
-	title = strings.TrimSpace(title)
-	if len(title) > 0 {
-		response.Title = &title
-	}
-
-	jsonResponse, _ := json.Marshal(
-		&teapotError{
-			Status: http.StatusTeapot,
-			Error:  *response,
-		},
-	)
-
-	header := http.Header{}
-	header.Set("Content-Type", "application/json")
-
-	ctx.Serve(
-		&http.Response{
-			StatusCode: http.StatusTeapot,
-			Header:     header,
-			Body:       io.NopCloser(bytes.NewBufferString(string(jsonResponse))),
-		},
-	)
+	ctx.Metrics().IncCounter("matched." + m.Name + "." + m.Service + "." + metricCountry(country) + "." + platform)
 }
 
 func (f *teapotFilter) Request(ctx filters.FilterContext) {
-	if time.Now().After(f.NextLoad) {
+	if f.loader.reloadIfDue(time.Now()) {
 		ctx.Logger().Debugf(
 			"Teapot Reload required",
 		)
-
-		f.NextLoad = time.Now().Add(30 * time.Second)
-		go f.loadServices()
-		go f.loadTeapots()
 	}
 
-	ctx.Logger().Debugf("Teapot Route: %q. Next Load: %q", ctx.Request().RequestURI, f.NextLoad)
+	ctx.Logger().Debugf("Teapot Route: %q", ctx.Request().URL.Path)
 
 	ipAddress := strings.TrimSpace(ctx.Request().Header.Get("Cf-Connecting-Ip"))
-	for whitelistIP, name := range map[string]string{
-		"151.224.191.144": "David",
-		"2.100.105.116":   "Mark",
-		"188.127.93.222":  "Office",
-	} {
-		if whitelistIP == ipAddress {
-			ctx.Logger().Infof("IP address %q has been whitelisted for %q", whitelistIP, name)
-			return
-		}
+	if name, ok := f.loader.config.AllowedIPs[ipAddress]; ok {
+		ctx.Logger().Infof("IP address %q has been whitelisted for %q", ipAddress, name)
+		return
 	}
 
-	ctx.Logger().Infof("IP address %q is not whitelisted\n", ipAddress)
+	ctx.Logger().Debugf("IP address %q is not whitelisted", ipAddress)
 
 	// Get the country code
 	visitorCountryCode := f.determineCountry(ctx)
 
 	// Check for teapot
-	for _, teapot := range f.Teapots {
-		if teapot.Enabled {
-			// Check if we have gone over the estimated time
-			if teapot.EndsAt.Before(time.Now().UTC()) {
-				teapot.EndsAt = time.
-					Now().
-					Round(time.Duration(teapot.ExtendBy) * time.Minute).
-					Add(time.Duration(teapot.ExtendBy) * time.Minute)
-			}
-
-			// Check if we have ignored this country
-			ignored := false
-			for _, country := range teapot.IgnoreCountries {
-				if country == visitorCountryCode {
-					ignored = true
-					break
-				}
-			}
-
-			if ignored {
-				// We are ignoring this country - continue to next teapot
-				continue
-			}
-
-			// Check if we are only teapotting for this country
-			if len(teapot.OnlyCountries) > 0 {
-				found := false
-				for _, country := range teapot.OnlyCountries {
-					if country == visitorCountryCode {
-						found = true
-						break
-					}
-				}
-
-				if !found {
-					// This country isn't in the list - continue to next teapot
-					continue
-				}
-			}
-
-			ctx.Logger().Infof("Teapot enabled")
+	m := f.loader.current().match(ctx.Request(), visitorCountryCode, time.Now())
+	if m == nil {
+		return
+	}
 
-			for _, TService := range teapot.Services {
-				for _, service := range f.Services {
-					if service.Name == TService {
-						ctx.Logger().Infof(">>>>>> %s\n", service.Name)
-						for _, route := range service.Routes {
-							if route.IsRegex {
-								match, _ := regexp.MatchString(route.URI, ctx.Request().RequestURI)
-								if match {
-									ctx.Logger().Infof("Matched route %s\n", route.URI)
+	platform := requestPlatform(ctx.Request())
+	slog.Info(
+		"Teapot matched",
+		"teapot", m.Name,
+		"service", m.Service,
+		"route", m.Route,
+		"country", visitorCountryCode,
+		"platform", platform,
+		"method", ctx.Request().Method,
+		"path", ctx.Request().URL.Path,
+	)
 
-									f.sendTeapotMessage(ctx, teapot, TService == "all")
-									return
-								}
-							} else {
-								if strings.HasSuffix(route.URI, "*") {
-									if strings.HasPrefix(ctx.Request().RequestURI, route.URI[0:len(route.URI)-1]) {
-										ctx.Logger().Infof("Matched route %s\n", route.URI)
-										f.sendTeapotMessage(ctx, teapot, TService == "all")
-										return
-									}
-								} else if ctx.Request().RequestURI == route.URI {
-									ctx.Logger().Infof("Matched route %s\n", route.URI)
-									f.sendTeapotMessage(ctx, teapot, TService == "all")
-									return
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-	}
+	tagRequest(ctx, m, visitorCountryCode, platform)
+	sendTeapotResponse(ctx, m, time.Now())
 }
 
 func (f *teapotFilter) Response(_ filters.FilterContext) {}
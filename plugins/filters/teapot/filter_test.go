@@ -0,0 +1,121 @@
+package teapot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+func newTestLoader(t *testing.T, c Config) *Loader {
+	t.Helper()
+
+	services, err := compileServices([]teapotService{{
+		Name:   "all",
+		Routes: []teapotRoute{{URI: "/*"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Loader{config: c}
+	l.nextLoad.Store(time.Now().Add(time.Hour).UnixNano())
+	l.state.Store(&teapotState{
+		services: services,
+		teapots: []teapotConfig{{
+			Name:     "maintenance",
+			Enabled:  true,
+			Services: []string{"all"},
+			EndsAt:   time.Now().Add(time.Hour),
+		}},
+	})
+
+	return l
+}
+
+func TestTeapotFilter(t *testing.T) {
+	l := newTestLoader(t, Config{AllowedIPs: map[string]string{"192.0.2.1": "office"}})
+
+	for _, tc := range []struct {
+		name     string
+		clientIP string
+		served   bool
+	}{{
+		name:     "teapot",
+		clientIP: "192.0.2.2",
+		served:   true,
+	}, {
+		name:     "allowed ip",
+		clientIP: "192.0.2.1",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://api.example.org/v2.5/members", nil)
+			r.Header.Set("Cf-Connecting-Ip", tc.clientIP)
+			r.Header.Set("CF-IPCountry", "PK")
+			r.Header.Set("User-Agent", "okhttp/4.9.0")
+			m := &metricstest.MockMetrics{}
+			ctx := &filtertest.Context{
+				FRequest:  r,
+				FStateBag: make(map[string]interface{}),
+				FMetrics:  m,
+			}
+
+			(&teapotFilter{loader: l}).Request(ctx)
+
+			if ctx.FServed != tc.served {
+				t.Fatalf("expected served %v, got %v", tc.served, ctx.FServed)
+			}
+
+			if !tc.served {
+				return
+			}
+
+			if ctx.FResponse.StatusCode != http.StatusTeapot {
+				t.Errorf("expected %d, got %d", http.StatusTeapot, ctx.FResponse.StatusCode)
+			}
+
+			if ctx.FStateBag[TeapotNameStateBagKey] != "maintenance" {
+				t.Errorf("expected teapot name in the state bag, got %v", ctx.FStateBag[TeapotNameStateBagKey])
+			}
+
+			m.WithCounters(func(counters map[string]int64) {
+				if counters["matched.maintenance.all.PK.android"] != 1 {
+					t.Errorf("expected matched counter, got %v", counters)
+				}
+			})
+		})
+	}
+}
+
+func TestRequestPlatform(t *testing.T) {
+	for userAgent, want := range map[string]string{
+		"Muzz/7.51.0 (com.muzmatch.muzmatch; build:7688; iOS 16.6.1) Alamofire/5.6.4": "ios",
+		"okhttp/4.9.0": "android",
+		"Mozilla/5.0 (Linux; Android 13) AppleWebKit/537.36": "android",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)":    "web",
+	} {
+		r := httptest.NewRequest("GET", "http://api.example.org/", nil)
+		r.Header.Set("User-Agent", userAgent)
+		if got := requestPlatform(r); got != want {
+			t.Errorf("%s: expected %s, got %s", userAgent, want, got)
+		}
+	}
+}
+
+func TestMetricCountry(t *testing.T) {
+	for country, want := range map[string]string{
+		"GB":  "GB",
+		"XX":  "XX",
+		"gb":  "unknown",
+		"GBR": "unknown",
+		"":    "unknown",
+		"G.":  "unknown",
+	} {
+		if got := metricCountry(country); got != want {
+			t.Errorf("%q: expected %s, got %s", country, want, got)
+		}
+	}
+}
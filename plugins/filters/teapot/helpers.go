@@ -1,4 +1,4 @@
-package main
+package teapot
 
 import (
 	"crypto/md5"
@@ -10,16 +10,16 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-var (
-	s3client *s3.S3
-)
+func newS3Client() (*s3.S3, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
 
-func init() {
-	sess := session.Must(session.NewSession())
-	s3client = s3.New(sess)
+	return s3.New(sess), nil
 }
 
-func fetchS3File(bucket string, key string) ([]byte, string, error) {
+func fetchS3File(s3client *s3.S3, bucket string, key string) ([]byte, string, error) {
 	result, getObjectErr := s3client.GetObject(
 		&s3.GetObjectInput{
 			Bucket: aws.String(bucket),
@@ -0,0 +1,187 @@
+package teapot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zalando/skipper/metrics"
+)
+
+const reloadInterval = 30 * time.Second
+
+// Loader metrics, reported through metrics.Default
+const (
+	servicesHashGauge = "teapot.config.services.hash"
+	teapotsHashGauge  = "teapot.config.teapots.hash"
+	configAgeGauge    = "teapot.config.age"
+	loadErrorsCounter = "teapot.config.load.errors."
+)
+
+// teapotState is an immutable snapshot of the loaded configuration.
+type teapotState struct {
+	services     map[string]*compiledService
+	servicesHash string
+	teapots      []teapotConfig
+	teapotsHash  string
+}
+
+// Loader fetches services.json and teapots.json from S3 and shares the
+// compiled result between all teapot filter instances.
+type Loader struct {
+	config   Config
+	fetch    func(bucket, key string) ([]byte, string, error)
+	metrics  metrics.Metrics
+	mu       sync.Mutex
+	once     sync.Once
+	nextLoad atomic.Int64
+	state    atomic.Pointer[teapotState]
+
+	// lastSuccess is guarded by mu
+	lastSuccess time.Time
+}
+
+// NewLoader creates a Loader with its S3 client. The configuration is
+// loaded when the first filter is created.
+func NewLoader(c Config) (*Loader, error) {
+	s3client, err := newS3Client()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	l := &Loader{
+		config: c,
+		fetch: func(bucket, key string) ([]byte, string, error) {
+			return fetchS3File(s3client, bucket, key)
+		},
+	}
+	l.state.Store(&teapotState{})
+	return l, nil
+}
+
+func (l *Loader) current() *teapotState {
+	return l.state.Load()
+}
+
+// metricsOrDefault returns metrics.Default unless the loader has its own,
+// because the default is only set up when skipper starts.
+func (l *Loader) metricsOrDefault() metrics.Metrics {
+	if l.metrics != nil {
+		return l.metrics
+	}
+
+	return metrics.Default
+}
+
+// hashGaugeValue converts the first 32 bits of an md5 hex digest into a gauge
+// value, so that instances running with different configs can be told apart.
+func hashGaugeValue(hash string) float64 {
+	if len(hash) < 8 {
+		return 0
+	}
+
+	v, err := strconv.ParseUint(hash[:8], 16, 32)
+	if err != nil {
+		return 0
+	}
+
+	return float64(v)
+}
+
+// ensureLoaded loads the configuration synchronously the first time it is
+// called.
+func (l *Loader) ensureLoaded() {
+	l.once.Do(func() {
+		l.nextLoad.Store(time.Now().Add(reloadInterval).UnixNano())
+		l.load()
+	})
+}
+
+// reloadIfDue starts a background reload when the reload interval has
+// passed. Only one caller wins the reload.
+func (l *Loader) reloadIfDue(now time.Time) bool {
+	next := l.nextLoad.Load()
+	if now.UnixNano() < next {
+		return false
+	}
+
+	if !l.nextLoad.CompareAndSwap(next, now.Add(reloadInterval).UnixNano()) {
+		return false
+	}
+
+	go l.load()
+	return true
+}
+
+func (l *Loader) loadError(file string, msg string, err error) {
+	slog.Error(msg, "file", file, "error", err)
+	l.metricsOrDefault().IncCounter(loadErrorsCounter + file)
+}
+
+func (l *Loader) load() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := l.current()
+	next := *current
+	failed := false
+
+	if data, md5result, fetchErr := l.fetch(
+		l.config.S3Bucket,
+		l.config.S3ServicesKey,
+	); fetchErr != nil {
+		l.loadError("services", "Error fetching services.json", fetchErr)
+		failed = true
+	} else if md5result != current.servicesHash {
+		// Only import if the hash is different
+		var services []teapotService
+		if unmarshalErr := json.Unmarshal(data, &services); unmarshalErr != nil {
+			l.loadError("services", "Error reading services.json", unmarshalErr)
+			failed = true
+		} else if compiled, compileErr := compileServices(services); compileErr != nil {
+			l.loadError("services", "Error compiling services.json", compileErr)
+			failed = true
+		} else {
+			next.services = compiled
+			next.servicesHash = md5result
+			slog.Info("Loaded services.json", "hash", md5result, "services", len(compiled))
+		}
+	}
+
+	if data, md5result, fetchErr := l.fetch(
+		l.config.S3Bucket,
+		l.config.S3TeapotsKey,
+	); fetchErr != nil {
+		l.loadError("teapots", "Error fetching teapots.json", fetchErr)
+		failed = true
+	} else if md5result != current.teapotsHash {
+		// Only import if the hash is different
+		var teapots []teapotConfig
+		if unmarshalErr := json.Unmarshal(data, &teapots); unmarshalErr != nil {
+			l.loadError("teapots", "Error reading teapots.json", unmarshalErr)
+			failed = true
+		} else {
+			next.teapots = teapots
+			next.teapotsHash = md5result
+			slog.Info("Loaded teapots.json", "hash", md5result, "teapots", len(teapots))
+		}
+	}
+
+	l.state.Store(&next)
+
+	now := time.Now()
+	if !failed {
+		l.lastSuccess = now
+	}
+
+	m := l.metricsOrDefault()
+	m.UpdateGauge(servicesHashGauge, hashGaugeValue(next.servicesHash))
+	m.UpdateGauge(teapotsHashGauge, hashGaugeValue(next.teapotsHash))
+	if !l.lastSuccess.IsZero() {
+		m.UpdateGauge(configAgeGauge, now.Sub(l.lastSuccess).Seconds())
+	}
+}
@@ -0,0 +1,75 @@
+package teapot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+func TestLoaderMetrics(t *testing.T) {
+	files := map[string][]byte{
+		"services.json": []byte(`[{"name": "all", "routes": [{"uri": "/*"}]}]`),
+		"teapots.json":  []byte(`[{"name": "maintenance", "enabled": true, "services": ["all"]}]`),
+	}
+	hashes := map[string]string{
+		"services.json": "0000000a0000",
+		"teapots.json":  "0000000b0000",
+	}
+
+	m := &metricstest.MockMetrics{}
+	l := &Loader{
+		config: Config{
+			S3ServicesKey: "services.json",
+			S3TeapotsKey:  "teapots.json",
+		},
+		fetch: func(_, key string) ([]byte, string, error) {
+			data, ok := files[key]
+			if !ok {
+				return nil, "", errors.New("not found")
+			}
+
+			return data, hashes[key], nil
+		},
+		metrics: m,
+	}
+	l.state.Store(&teapotState{})
+
+	l.load()
+
+	if s := l.current(); len(s.services) != 1 || len(s.teapots) != 1 {
+		t.Fatalf("expected config to be loaded, got %d services and %d teapots", len(s.services), len(s.teapots))
+	}
+
+	m.WithGauges(func(gauges map[string]float64) {
+		if gauges[servicesHashGauge] != 10 || gauges[teapotsHashGauge] != 11 {
+			t.Errorf("unexpected hash gauges: %v", gauges)
+		}
+
+		if _, ok := gauges[configAgeGauge]; !ok {
+			t.Error("expected config age gauge")
+		}
+	})
+
+	delete(files, "teapots.json")
+	files["services.json"] = []byte(`[{"name": "all", "routes": [{"uri": "(", "regex": true}]}]`)
+	hashes["services.json"] = "0000000c0000"
+
+	l.load()
+
+	if s := l.current(); len(s.services) != 1 || len(s.teapots) != 1 {
+		t.Error("expected the last good config to be kept")
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters[loadErrorsCounter+"services"] != 1 || counters[loadErrorsCounter+"teapots"] != 1 {
+			t.Errorf("unexpected load error counters: %v", counters)
+		}
+	})
+
+	m.WithGauges(func(gauges map[string]float64) {
+		if gauges[servicesHashGauge] != 10 {
+			t.Errorf("expected hash of the loaded services, got %v", gauges[servicesHashGauge])
+		}
+	})
+}
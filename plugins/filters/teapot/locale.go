@@ -0,0 +1,134 @@
+package teapot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+const defaultLocale = "en"
+
+var pluralForms = map[string]plural.Form{
+	"other": plural.Other,
+	"zero":  plural.Zero,
+	"one":   plural.One,
+	"two":   plural.Two,
+	"few":   plural.Few,
+	"many":  plural.Many,
+}
+
+// Clock formats per base language, the rest use the 24-hour clock
+var clockFormats = map[string]string{
+	"en": "3:04pm UTC",
+}
+
+// localizedText holds the text of a single locale. In teapots.json it is
+// either a plain string, or an object keyed by the CLDR plural forms (zero,
+// one, two, few, many, other), which are selected by the number of minutes
+// remaining. The text may contain the placeholders {time} and {minutes}.
+// The legacy %s placeholder is replaced with the time.
+type localizedText map[plural.Form]string
+
+func (t *localizedText) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = localizedText{plural.Other: s}
+		return nil
+	}
+
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return errors.New("localized text must be a string or an object of plural forms")
+	}
+
+	lt := make(localizedText, len(forms))
+	for name, text := range forms {
+		form, ok := pluralForms[name]
+		if !ok {
+			return fmt.Errorf("unknown plural form %q", name)
+		}
+
+		lt[form] = text
+	}
+
+	if _, ok := lt[plural.Other]; !ok {
+		return errors.New(`localized text is missing the "other" plural form`)
+	}
+
+	*t = lt
+	return nil
+}
+
+func minutesUntil(endsAt, now time.Time) int {
+	m := int(math.Ceil(endsAt.Sub(now).Minutes()))
+	if m < 0 {
+		return 0
+	}
+
+	return m
+}
+
+// format selects the plural form and replaces the placeholders for the
+// given locale.
+func (t localizedText) format(tag language.Tag, endsAt, now time.Time) string {
+	minutes := minutesUntil(endsAt, now)
+
+	text, ok := t[plural.Cardinal.MatchPlural(tag, minutes, 0, 0, 0, 0)]
+	if !ok {
+		text = t[plural.Other]
+	}
+
+	base, _ := tag.Base()
+	clockFormat, ok := clockFormats[base.String()]
+	if !ok {
+		clockFormat = "15:04 UTC"
+	}
+	clock := endsAt.UTC().Format(clockFormat)
+
+	p := message.NewPrinter(tag)
+	text = strings.NewReplacer(
+		"%s", clock,
+		"{time}", clock,
+		"{minutes}", p.Sprint(minutes),
+	).Replace(text)
+
+	return strings.TrimSpace(text)
+}
+
+// matchLocale returns the key of texts that best matches the Accept-Language
+// header. English is preferred when nothing matches.
+func matchLocale(texts map[string]localizedText, acceptLanguage string) (string, language.Tag) {
+	if len(texts) == 0 {
+		return defaultLocale, language.English
+	}
+
+	keys := make([]string, 0, len(texts))
+	for k := range texts {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == defaultLocale || keys[j] == defaultLocale {
+			return keys[i] == defaultLocale
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	tags := make([]language.Tag, len(keys))
+	for i, k := range keys {
+		tags[i] = language.Make(k)
+	}
+
+	desired, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, index, _ := language.NewMatcher(tags).Match(desired...)
+	return keys[index], tags[index]
+}
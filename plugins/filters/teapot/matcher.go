@@ -0,0 +1,187 @@
+package teapot
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// routeMatcher is the compiled form of a teapotRoute. It is built once when
+// services.json is loaded, so matching a request does not compile anything.
+type routeMatcher struct {
+	uri     string
+	path    *regexp.Regexp
+	host    *regexp.Regexp
+	methods map[string]struct{}
+}
+
+type compiledService struct {
+	name   string
+	routes []*routeMatcher
+}
+
+// teapotMatch describes the teapot and service a request was matched against.
+type teapotMatch struct {
+	Name    string
+	Service string
+	Route   string
+	Global  bool
+	Teapot  teapotConfig
+}
+
+// globToRegexp converts a glob pattern, where '*' matches any sequence of
+// characters, into an anchored regular expression.
+func globToRegexp(glob string) string {
+	parts := strings.Split(glob, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+
+	return "^" + strings.Join(parts, ".*") + "$"
+}
+
+func compileRoute(route teapotRoute) (*routeMatcher, error) {
+	expr := route.URI
+	if !route.IsRegex {
+		expr = globToRegexp(route.URI)
+	}
+
+	path, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid route %q: %w", route.URI, err)
+	}
+
+	m := &routeMatcher{
+		uri:  route.URI,
+		path: path,
+	}
+
+	if route.Host != "" {
+		m.host, err = regexp.Compile("(?i)" + globToRegexp(route.Host))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host %q: %w", route.Host, err)
+		}
+	}
+
+	if len(route.Methods) > 0 {
+		m.methods = make(map[string]struct{}, len(route.Methods))
+		for _, method := range route.Methods {
+			m.methods[strings.ToUpper(strings.TrimSpace(method))] = struct{}{}
+		}
+	}
+
+	return m, nil
+}
+
+func compileServices(services []teapotService) (map[string]*compiledService, error) {
+	compiled := make(map[string]*compiledService, len(services))
+	for _, service := range services {
+		cs := &compiledService{name: service.Name}
+		for _, route := range service.Routes {
+			m, err := compileRoute(route)
+			if err != nil {
+				return nil, fmt.Errorf("service %q: %w", service.Name, err)
+			}
+
+			cs.routes = append(cs.routes, m)
+		}
+
+		compiled[service.Name] = cs
+	}
+
+	return compiled, nil
+}
+
+func requestHost(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		return h
+	}
+
+	return r.Host
+}
+
+// match checks the request method, host and path. The path is matched
+// without the query string.
+func (m *routeMatcher) match(r *http.Request) bool {
+	if m.methods != nil {
+		if _, ok := m.methods[r.Method]; !ok {
+			return false
+		}
+	}
+
+	if m.host != nil && !m.host.MatchString(requestHost(r)) {
+		return false
+	}
+
+	return m.path.MatchString(r.URL.Path)
+}
+
+func (s *compiledService) match(r *http.Request) *routeMatcher {
+	for _, m := range s.routes {
+		if m.match(r) {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func containsCountry(countries []string, country string) bool {
+	for _, c := range countries {
+		if c == country {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match returns the first enabled teapot that applies to the request, or
+// nil when the request should be passed through.
+func (s *teapotState) match(r *http.Request, country string, now time.Time) *teapotMatch {
+	for i, teapot := range s.teapots {
+		if !teapot.Enabled {
+			continue
+		}
+
+		if containsCountry(teapot.IgnoreCountries, country) {
+			continue
+		}
+
+		if len(teapot.OnlyCountries) > 0 && !containsCountry(teapot.OnlyCountries, country) {
+			continue
+		}
+
+		for _, name := range teapot.Services {
+			service, ok := s.services[name]
+			if !ok {
+				continue
+			}
+
+			m := service.match(r)
+			if m == nil {
+				continue
+			}
+
+			// Check if we have gone over the estimated time
+			if teapot.EndsAt.Before(now.UTC()) {
+				teapot.EndsAt = now.
+					Round(time.Duration(teapot.ExtendBy) * time.Minute).
+					Add(time.Duration(teapot.ExtendBy) * time.Minute)
+			}
+
+			return &teapotMatch{
+				Name:    teapot.name(i),
+				Service: name,
+				Route:   m.uri,
+				Global:  name == "all",
+				Teapot:  teapot,
+			}
+		}
+	}
+
+	return nil
+}
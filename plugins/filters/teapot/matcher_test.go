@@ -0,0 +1,195 @@
+package teapot
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouteMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		route  teapotRoute
+		method string
+		target string
+		want   bool
+	}{{
+		name:   "exact path",
+		route:  teapotRoute{URI: "/v2.5/members"},
+		method: "GET",
+		target: "http://api.example.org/v2.5/members",
+		want:   true,
+	}, {
+		name:   "exact path ignores query",
+		route:  teapotRoute{URI: "/v2.5/members"},
+		method: "GET",
+		target: "http://api.example.org/v2.5/members?page=2",
+		want:   true,
+	}, {
+		name:   "trailing glob",
+		route:  teapotRoute{URI: "/v2.5/members/discover*"},
+		method: "GET",
+		target: "http://api.example.org/v2.5/members/discover/all",
+		want:   true,
+	}, {
+		name:   "glob does not match query",
+		route:  teapotRoute{URI: "/v2.5/members*"},
+		method: "GET",
+		target: "http://api.example.org/v2.5/other?next=/v2.5/members",
+		want:   false,
+	}, {
+		name:   "inner glob",
+		route:  teapotRoute{URI: "/v2.5/*/activities"},
+		method: "GET",
+		target: "http://api.example.org/v2.5/user/activities",
+		want:   true,
+	}, {
+		name:   "glob escapes regexp characters",
+		route:  teapotRoute{URI: "/v2.5/a.b"},
+		method: "GET",
+		target: "http://api.example.org/v2.5/axb",
+		want:   false,
+	}, {
+		name:   "regex",
+		route:  teapotRoute{URI: `^/v2\.5/members/\d+$`, IsRegex: true},
+		method: "GET",
+		target: "http://api.example.org/v2.5/members/42",
+		want:   true,
+	}, {
+		name:   "method allowed",
+		route:  teapotRoute{URI: "/*", Methods: []string{"post", "PUT"}},
+		method: "POST",
+		target: "http://api.example.org/v2.5/members",
+		want:   true,
+	}, {
+		name:   "method not allowed",
+		route:  teapotRoute{URI: "/*", Methods: []string{"POST"}},
+		method: "GET",
+		target: "http://api.example.org/v2.5/members",
+		want:   false,
+	}, {
+		name:   "host matches ignoring port and case",
+		route:  teapotRoute{URI: "/*", Host: "*.Example.org"},
+		method: "GET",
+		target: "http://api.example.org:9090/v2.5/members",
+		want:   true,
+	}, {
+		name:   "host does not match",
+		route:  teapotRoute{URI: "/*", Host: "web.example.org"},
+		method: "GET",
+		target: "http://api.example.org/v2.5/members",
+		want:   false,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := compileRoute(tc.route)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(tc.method, tc.target, nil)
+			if got := m.match(r); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCompileServicesInvalidRegex(t *testing.T) {
+	_, err := compileServices([]teapotService{{
+		Name:   "broken",
+		Routes: []teapotRoute{{URI: "/v2.5/(", IsRegex: true}},
+	}})
+	if err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
+
+func TestStateMatch(t *testing.T) {
+	services, err := compileServices([]teapotService{{
+		Name:   "all",
+		Routes: []teapotRoute{{URI: "/*"}},
+	}, {
+		Name:   "discover",
+		Routes: []teapotRoute{{URI: "/v2.5/members/discover*", Methods: []string{"GET"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2023, 9, 21, 0, 0, 0, 0, time.UTC)
+	state := &teapotState{
+		services: services,
+		teapots: []teapotConfig{{
+			Name:     "disabled",
+			Services: []string{"all"},
+		}, {
+			Name:            "discover",
+			Enabled:         true,
+			Services:        []string{"discover"},
+			IgnoreCountries: []string{"FR"},
+			EndsAt:          now.Add(time.Hour),
+		}, {
+			Enabled:       true,
+			Services:      []string{"all"},
+			OnlyCountries: []string{"PK"},
+			EndsAt:        now.Add(-time.Hour),
+			ExtendBy:      15,
+		}},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		method  string
+		path    string
+		country string
+		teapot  string
+		service string
+	}{{
+		name:    "service route",
+		method:  "GET",
+		path:    "/v2.5/members/discover",
+		country: "GB",
+		teapot:  "discover",
+		service: "discover",
+	}, {
+		name:    "ignored country",
+		method:  "GET",
+		path:    "/v2.5/members/discover",
+		country: "FR",
+	}, {
+		name:    "method not in service route",
+		method:  "POST",
+		path:    "/v2.5/members/discover",
+		country: "GB",
+	}, {
+		name:    "only country with unnamed teapot",
+		method:  "POST",
+		path:    "/v2.5/auth/confirm",
+		country: "PK",
+		teapot:  "teapot2",
+		service: "all",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "http://api.example.org"+tc.path, nil)
+			m := state.match(r, tc.country, now)
+			if tc.teapot == "" {
+				if m != nil {
+					t.Fatalf("expected no match, got %q", m.Name)
+				}
+				return
+			}
+
+			if m == nil {
+				t.Fatal("expected match")
+			}
+
+			if m.Name != tc.teapot || m.Service != tc.service {
+				t.Errorf("expected %s/%s, got %s/%s", tc.teapot, tc.service, m.Name, m.Service)
+			}
+
+			if !m.Teapot.EndsAt.After(now) {
+				t.Errorf("expected end time in the future, got %v", m.Teapot.EndsAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package teapot
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+)
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeProblem = "application/problem+json"
+	contentTypeHTML    = "text/html"
+)
+
+//go:embed maintenance.html
+var maintenancePage string
+
+var maintenanceTemplate = template.Must(template.New("maintenance").Parse(maintenancePage))
+
+var rtlLanguages = map[string]bool{
+	"ar": true,
+	"fa": true,
+	"he": true,
+	"ur": true,
+}
+
+type teapotProblem struct {
+	Title                       string `json:"title,omitempty"`
+	Status                      int    `json:"status"`
+	Detail                      string `json:"detail,omitempty"`
+	PredictedUptimeTimestampUTC string `json:"predictedUptimeTimestampUTC"`
+	Global                      bool   `json:"global"`
+}
+
+type maintenancePageData struct {
+	Lang       string
+	Dir        string
+	Title      string
+	Paragraphs []string
+	EndsAt     string
+}
+
+// negotiateContentType picks the response format from the Accept header. The
+// JSON contract used by the apps is the default, also for wildcards.
+func negotiateContentType(accept string) string {
+	best, bestQ := contentTypeJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		var offer string
+		switch mediaType {
+		case contentTypeJSON, contentTypeProblem, contentTypeHTML:
+			offer = mediaType
+		case "application/xhtml+xml":
+			offer = contentTypeHTML
+		default:
+			continue
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+func retryAfterSeconds(endsAt, now time.Time) int {
+	s := int(math.Ceil(endsAt.Sub(now).Seconds()))
+	if s < 1 {
+		return 1
+	}
+
+	return s
+}
+
+func (t teapotConfig) webStatusCode() int {
+	if t.WebStatusCode != 0 {
+		return t.WebStatusCode
+	}
+
+	return http.StatusServiceUnavailable
+}
+
+func paragraphs(text string) []string {
+	var p []string
+	for _, s := range strings.Split(text, "\n\n") {
+		if s = strings.TrimSpace(s); s != "" {
+			p = append(p, s)
+		}
+	}
+
+	return p
+}
+
+// sendTeapotResponse serves the teapot in the format requested by the client:
+// the JSON contract of the apps with status 418, an HTML maintenance page or
+// an RFC 7807 problem, the latter two with the configured web status code.
+func sendTeapotResponse(ctx filters.FilterContext, m *teapotMatch, now time.Time) {
+	r := ctx.Request()
+	teapot := m.Teapot
+	acceptLanguage := r.Header.Get("Accept-Language")
+
+	messageLocale, messageTag := matchLocale(teapot.Message, acceptLanguage)
+	titleLocale, titleTag := matchLocale(teapot.Title, acceptLanguage)
+	ctx.Logger().Debugf("Locale: %s", messageLocale)
+
+	message := teapot.Message[messageLocale].format(messageTag, teapot.EndsAt, now)
+	title := teapot.Title[titleLocale].format(titleTag, teapot.EndsAt, now)
+	predictedUptime := teapot.EndsAt.UTC().Format(time.RFC3339)
+
+	contentType := negotiateContentType(r.Header.Get("Accept"))
+	statusCode := http.StatusTeapot
+
+	var body []byte
+	switch contentType {
+	case contentTypeHTML:
+		statusCode = teapot.webStatusCode()
+
+		base, _ := messageTag.Base()
+		data := maintenancePageData{
+			Lang:       messageLocale,
+			Dir:        "ltr",
+			Title:      title,
+			Paragraphs: paragraphs(message),
+			EndsAt:     predictedUptime,
+		}
+		if rtlLanguages[base.String()] {
+			data.Dir = "rtl"
+		}
+
+		var buf bytes.Buffer
+		if err := maintenanceTemplate.Execute(&buf, data); err != nil {
+			ctx.Logger().Errorf("Failed to render maintenance page: %v", err)
+		}
+		body = buf.Bytes()
+		contentType += "; charset=utf-8"
+	case contentTypeProblem:
+		statusCode = teapot.webStatusCode()
+		body, _ = json.Marshal(&teapotProblem{
+			Title:                       title,
+			Status:                      statusCode,
+			Detail:                      message,
+			PredictedUptimeTimestampUTC: predictedUptime,
+			Global:                      m.Global,
+		})
+	default:
+		response := teapotResponse{
+			PredictedUptimeTimestampUTC: predictedUptime,
+			Global:                      m.Global,
+		}
+		if len(message) > 0 {
+			response.Message = &message
+		}
+		if len(title) > 0 {
+			response.Title = &title
+		}
+
+		body, _ = json.Marshal(&teapotError{
+			Status: statusCode,
+			Error:  response,
+		})
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Language", messageLocale)
+	header.Set("Retry-After", strconv.Itoa(retryAfterSeconds(teapot.EndsAt, now)))
+	header.Set("Cache-Control", "no-store")
+	header.Set("Vary", "Accept, Accept-Language")
+
+	ctx.Serve(
+		&http.Response{
+			StatusCode: statusCode,
+			Header:     header,
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		},
+	)
+}
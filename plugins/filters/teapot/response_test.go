@@ -0,0 +1,173 @@
+package teapot
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/filtertest"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	for _, tc := range []struct {
+		accept string
+		want   string
+	}{
+		{"", contentTypeJSON},
+		{"*/*", contentTypeJSON},
+		{"application/json", contentTypeJSON},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", contentTypeHTML},
+		{"application/problem+json", contentTypeProblem},
+		{"application/json;q=0.5, application/problem+json", contentTypeProblem},
+		{"text/html;q=0", contentTypeJSON},
+		{"application/json, text/html", contentTypeJSON},
+	} {
+		if got := negotiateContentType(tc.accept); got != tc.want {
+			t.Errorf("%q: expected %s, got %s", tc.accept, tc.want, got)
+		}
+	}
+}
+
+func TestLocalizedText(t *testing.T) {
+	now := time.Date(2023, 9, 21, 0, 0, 0, 0, time.UTC)
+
+	var texts map[string]localizedText
+	if err := json.Unmarshal([]byte(`{
+		"en": {"one": "Back in {minutes} minute", "other": "Back in {minutes} minutes at {time}"},
+		"fr": "Retour à %s"
+	}`), &texts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := texts["en"].format(language.English, now.Add(time.Minute), now); got != "Back in 1 minute" {
+		t.Errorf("unexpected singular: %q", got)
+	}
+
+	if got := texts["en"].format(language.English, now.Add(90*time.Minute), now); got != "Back in 90 minutes at 1:30am UTC" {
+		t.Errorf("unexpected plural: %q", got)
+	}
+
+	if got := texts["fr"].format(language.French, now.Add(90*time.Minute), now); got != "Retour à 01:30 UTC" {
+		t.Errorf("unexpected legacy placeholder: %q", got)
+	}
+
+	if err := json.Unmarshal([]byte(`{"en": {"one": "missing other"}}`), &texts); err == nil {
+		t.Error("expected error for missing other form")
+	}
+}
+
+func TestMatchLocale(t *testing.T) {
+	texts := map[string]localizedText{
+		"ar": {},
+		"en": {},
+		"fr": {},
+	}
+
+	for accept, want := range map[string]string{
+		"":                "en",
+		"fr-FR,fr;q=0.9":  "fr",
+		"ar-EG":           "ar",
+		"ja-JP, de;q=0.5": "en",
+	} {
+		if got, _ := matchLocale(texts, accept); got != want {
+			t.Errorf("%q: expected %s, got %s", accept, want, got)
+		}
+	}
+}
+
+func TestSendTeapotResponse(t *testing.T) {
+	now := time.Date(2023, 9, 21, 0, 0, 0, 0, time.UTC)
+	m := &teapotMatch{
+		Name:    "maintenance",
+		Service: "all",
+		Global:  true,
+		Teapot: teapotConfig{
+			Title:   map[string]localizedText{"en": {plural.Other: "Essential Maintenance"}, "ar": {plural.Other: "صيانة"}},
+			Message: map[string]localizedText{"en": {plural.Other: "Back at {time}\n\nNo need to reinstall"}, "ar": {plural.Other: "عذراً"}},
+			EndsAt:  now.Add(10 * time.Minute),
+		},
+	}
+
+	for _, tc := range []struct {
+		name           string
+		accept         string
+		acceptLanguage string
+		statusCode     int
+		webStatusCode  int
+		contentType    string
+		contains       string
+	}{{
+		name:        "json contract",
+		statusCode:  http.StatusTeapot,
+		contentType: contentTypeJSON,
+		contains:    `"predictedUptimeTimestampUTC":"2023-09-21T00:10:00Z"`,
+	}, {
+		name:        "html page",
+		accept:      "text/html",
+		statusCode:  http.StatusServiceUnavailable,
+		contentType: "text/html; charset=utf-8",
+		contains:    "<p>No need to reinstall</p>",
+	}, {
+		name:           "rtl html page",
+		accept:         "text/html",
+		acceptLanguage: "ar",
+		statusCode:     http.StatusServiceUnavailable,
+		contentType:    "text/html; charset=utf-8",
+		contains:       `dir="rtl"`,
+	}, {
+		name:          "problem with configured status",
+		accept:        "application/problem+json",
+		webStatusCode: http.StatusTooManyRequests,
+		statusCode:    http.StatusTooManyRequests,
+		contentType:   contentTypeProblem,
+		contains:      `"detail":"Back at 12:10am UTC`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://api.example.org/", nil)
+			r.Header.Set("Accept", tc.accept)
+			r.Header.Set("Accept-Language", tc.acceptLanguage)
+			ctx := &filtertest.Context{FRequest: r, FStateBag: map[string]interface{}{}}
+
+			mc := *m
+			mc.Teapot.WebStatusCode = tc.webStatusCode
+			sendTeapotResponse(ctx, &mc, now)
+
+			rsp := ctx.FResponse
+			if rsp.StatusCode != tc.statusCode {
+				t.Errorf("expected status %d, got %d", tc.statusCode, rsp.StatusCode)
+			}
+
+			if got := rsp.Header.Get("Content-Type"); got != tc.contentType {
+				t.Errorf("expected content type %s, got %s", tc.contentType, got)
+			}
+
+			if got := rsp.Header.Get("Retry-After"); got != "600" {
+				t.Errorf("expected Retry-After 600, got %s", got)
+			}
+
+			body, _ := io.ReadAll(rsp.Body)
+			if !strings.Contains(string(body), tc.contains) {
+				t.Errorf("expected body to contain %q, got %s", tc.contains, body)
+			}
+		})
+	}
+}
+
+func TestTeapotsFileParses(t *testing.T) {
+	data, err := os.ReadFile("../../../teapot-s3/teapots.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var teapots []teapotConfig
+	if err := json.Unmarshal(data, &teapots); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,35 +1,80 @@
-package main
+package teapot
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/zalando/skipper/filters"
 )
 
+const (
+	// Name is the name of the teapot filter.
+	Name = "teapot"
+
+	// DryRunName is the name of the teapotDryRun filter.
+	DryRunName = "teapotDryRun"
+
+	// TeapotNameStateBagKey is the state bag key holding the name of the matched teapot.
+	TeapotNameStateBagKey = "teapot:name"
+
+	// TeapotServiceStateBagKey is the state bag key holding the name of the matched service.
+	TeapotServiceStateBagKey = "teapot:service"
+)
+
+// Config is the configuration of the teapot filters, from the teapot
+// section of the plugin config.
+type Config struct {
+	// S3Bucket is the bucket holding services.json and teapots.json.
+	S3Bucket string `yaml:"s3-bucket"`
+
+	// S3ServicesKey is the key of services.json in the bucket.
+	S3ServicesKey string `yaml:"s3-services-key"`
+
+	// S3TeapotsKey is the key of teapots.json in the bucket.
+	S3TeapotsKey string `yaml:"s3-teapots-key"`
+
+	// AllowedIPs are never served a teapot. The keys are the client IPs
+	// from the Cf-Connecting-Ip header, the values are logged with them.
+	AllowedIPs map[string]string `yaml:"allowed-ips"`
+}
+
 var _ filters.Spec = (*teapotSpec)(nil)
 
-type teapotSpec struct{}
+type teapotSpec struct {
+	loader *Loader
+}
 
-type teapotRoute []struct {
-	URI     string `json:"uri"`
-	Note    string `json:"note,omitempty"`
-	IsRegex bool   `json:"regex,omitempty"`
+// teapotRoute is a single route of a service. URI is a glob, where '*'
+// matches any sequence of characters, or a regular expression when IsRegex
+// is set. Both are matched against the request path without the query.
+// Methods and Host optionally restrict the match further.
+type teapotRoute struct {
+	URI     string   `json:"uri"`
+	Note    string   `json:"note,omitempty"`
+	IsRegex bool     `json:"regex,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+	Host    string   `json:"host,omitempty"`
 }
 
 type teapotService struct {
-	Name   string      `json:"name"`
-	Routes teapotRoute `json:"routes"`
+	Name   string        `json:"name"`
+	Routes []teapotRoute `json:"routes"`
 }
 
 type teapotConfig struct {
-	Enabled         bool              `json:"enabled"`
-	Services        []string          `json:"services"`
-	IgnoreCountries []string          `json:"ignoreCountries"`
-	OnlyCountries   []string          `json:"onlyCountries"`
-	Title           map[string]string `json:"title"`
-	Message         map[string]string `json:"message"`
-	EndsAt          time.Time         `json:"endsAt"`
-	ExtendBy        int               `json:"extendBy"`
+	Name            string                   `json:"name,omitempty"`
+	Enabled         bool                     `json:"enabled"`
+	Services        []string                 `json:"services"`
+	IgnoreCountries []string                 `json:"ignoreCountries"`
+	OnlyCountries   []string                 `json:"onlyCountries"`
+	Title           map[string]localizedText `json:"title"`
+	Message         map[string]localizedText `json:"message"`
+	EndsAt          time.Time                `json:"endsAt"`
+	ExtendBy        int                      `json:"extendBy"`
+
+	// WebStatusCode is the status of the HTML and problem+json responses,
+	// 503 by default. The JSON response of the apps always uses 418.
+	WebStatusCode int `json:"webStatusCode,omitempty"`
 }
 
 type teapotError struct {
@@ -45,19 +90,32 @@ type teapotResponse struct {
 	Global                      bool    `json:"global"`
 }
 
-// InitFilter is called by Skipper to create a new instance of the filter when loaded as a plugin
-func InitFilter(_ []string) (filters.Spec, error) {
-	return &teapotSpec{}, nil
+func (t teapotConfig) name(index int) string {
+	if t.Name != "" {
+		return t.Name
+	}
+
+	return fmt.Sprintf("teapot%d", index)
+}
+
+// NewTeapot creates the teapot filter spec. It blocks the requests matching
+// an enabled teapot and serves the teapot response instead:
+//
+//	api: PathSubtree("/") -> teapot() -> "https://api.example.org"
+func NewTeapot(loader *Loader) filters.Spec {
+	return &teapotSpec{loader: loader}
+}
+
+// NewTeapotDryRun creates the teapotDryRun filter spec.
+func NewTeapotDryRun(loader *Loader) filters.Spec {
+	return &teapotDryRunSpec{loader: loader}
 }
 
 func (s *teapotSpec) Name() string {
-	return "teapot"
+	return Name
 }
 
 func (s *teapotSpec) CreateFilter(_ []interface{}) (filters.Filter, error) {
-	teapotFilter := &teapotFilter{}
-	teapotFilter.loadServices()
-	teapotFilter.loadTeapots()
-
-	return teapotFilter, nil
+	s.loader.ensureLoaded()
+	return &teapotFilter{loader: s.loader}, nil
 }
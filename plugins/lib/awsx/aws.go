@@ -73,24 +73,9 @@ func DetectRegion(awsRegion, awsDefaultRegion string) string {
 	}
 
 	if region == "" {
-		ctx, to := context.WithTimeout(context.Background(), time.Second)
-		defer to()
-
-		// If running in Elastic Container, the AZ can be inferred from the metadata endpoint,
-		// otherwise fetch from EC2 metadata endpoint
-		var az string
-		var err error
-		if endpoint, ok := os.LookupEnv("ECS_CONTAINER_METADATA_URI_V4"); ok {
-			az, err = lookupAvailabilityZoneFromECSMetadataEndpoint(ctx, endpoint)
-		} else {
-			az, err = lookupAvailabilityZoneFromEC2MetadataEndpoint(ctx)
-		}
-
-		if err == nil {
-			region = strings.TrimSpace(az)
-			if len(region) > 0 {
-				region = region[0 : len(region)-1]
-			}
+		region = DetectZone()
+		if len(region) > 0 {
+			region = region[0 : len(region)-1]
 		}
 	}
 
@@ -101,6 +86,30 @@ func DetectRegion(awsRegion, awsDefaultRegion string) string {
 	return region
 }
 
+// DetectZone discovers the AWS availability zone from the ECS or the EC2
+// metadata endpoint. It returns an empty string when the zone can't be
+// detected.
+func DetectZone() string {
+	ctx, to := context.WithTimeout(context.Background(), time.Second)
+	defer to()
+
+	// If running in Elastic Container, the AZ can be inferred from the metadata endpoint,
+	// otherwise fetch from EC2 metadata endpoint
+	var az string
+	var err error
+	if endpoint, ok := os.LookupEnv("ECS_CONTAINER_METADATA_URI_V4"); ok {
+		az, err = lookupAvailabilityZoneFromECSMetadataEndpoint(ctx, endpoint)
+	} else {
+		az, err = lookupAvailabilityZoneFromEC2MetadataEndpoint(ctx)
+	}
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(az)
+}
+
 func lookupAvailabilityZoneFromEC2MetadataEndpoint(ctx context.Context) (string, error) {
 	req, _ := http.NewRequestWithContext(
 		ctx,
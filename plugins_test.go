@@ -1,6 +1,11 @@
 package skipper
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+)
 
 func TestLoadPlugins(t *testing.T) {
 	if testing.Short() {
@@ -28,3 +33,24 @@ func TestLoadPluginsFail(t *testing.T) {
 		t.Fatalf("did not fail to load plugins: %s", err)
 	}
 }
+
+func TestInitFilterPluginWithConfig(t *testing.T) {
+	var received filters.PluginConfig
+	initFilter := func(args []string, config filters.PluginConfig) (filters.Spec, error) {
+		received = config
+		return builtin.NewStatus(), nil
+	}
+
+	spec, err := initFilterPlugin(initFilter, "config.so", nil, filters.PluginConfig{"key": "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Name() != filters.StatusName || received["key"] != "value" {
+		t.Errorf("plugin was not initialized with its config: %v", received)
+	}
+
+	if _, err := initFilterPlugin(func() {}, "wrong.so", nil, nil); err == nil {
+		t.Error("expected error for wrong signature")
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+	"regexp"
+
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+)
+
+type clientCertSpec struct{}
+
+type clientCertPredicate struct {
+	subject *regexp.Regexp
+	san     *regexp.Regexp
+}
+
+// NewClientCert creates a predicate specification, whose instances match
+// the verified client certificate of the request.
+//
+// The ClientCert predicate requires a regular expression matching the
+// subject of the certificate, and optionally a regular expression matching
+// any of its subject alternative names. Example:
+//
+//	ClientCert("^CN=partner-a,O=Example$", "^spiffe://example.org/partner-a$")
+func NewClientCert() routing.PredicateSpec {
+	return &clientCertSpec{}
+}
+
+func (*clientCertSpec) Name() string {
+	return predicates.ClientCertName
+}
+
+// Create a predicate instance matching the client certificate
+func (*clientCertSpec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	var exprs []*regexp.Regexp
+	for _, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, predicates.ErrInvalidPredicateParameters
+		}
+
+		expr, err := regexp.Compile(s)
+		if err != nil {
+			return nil, err
+		}
+
+		exprs = append(exprs, expr)
+	}
+
+	p := &clientCertPredicate{subject: exprs[0]}
+	if len(exprs) == 2 {
+		p.san = exprs[1]
+	}
+
+	return p, nil
+}
+
+// VerifiedClientCert returns the client certificate of the request, when
+// it was verified during the TLS handshake.
+func VerifiedClientCert(r *http.Request) (*x509.Certificate, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	return r.TLS.VerifiedChains[0][0], true
+}
+
+// SubjectAltNames returns the subject alternative names of the
+// certificate: DNS names, email addresses, IP addresses and URIs.
+func SubjectAltNames(cert *x509.Certificate) []string {
+	var names []string
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+
+	return names
+}
+
+func (p *clientCertPredicate) Match(r *http.Request) bool {
+	cert, ok := VerifiedClientCert(r)
+	if !ok || !p.subject.MatchString(cert.Subject.String()) {
+		return false
+	}
+
+	if p.san == nil {
+		return true
+	}
+
+	for _, name := range SubjectAltNames(cert) {
+		if p.san.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestClientCertArgs(t *testing.T) {
+	s := NewClientCert()
+	for _, args := range [][]interface{}{
+		{},
+		{"("},
+		{"^CN=partner-a$", "("},
+		{42.0},
+		{"^CN=partner-a$", ".*", ".*"},
+	} {
+		if _, err := s.Create(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+}
+
+func clientCertRequest(verified bool) *http.Request {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "partner-a", Organization: []string{"Example"}},
+		DNSNames:       []string{"partner-a.example.org"},
+		EmailAddresses: []string{"ops@partner-a.example.org"},
+		IPAddresses:    []net.IP{net.ParseIP("192.0.2.1")},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/partner-a"}},
+	}
+
+	state := &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if verified {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+
+	return &http.Request{TLS: state}
+}
+
+func TestClientCertMatch(t *testing.T) {
+	for _, tc := range []struct {
+		args  []interface{}
+		req   *http.Request
+		match bool
+	}{
+		{args: []interface{}{".*"}, req: &http.Request{}},
+		{args: []interface{}{".*"}, req: clientCertRequest(false)},
+		{args: []interface{}{".*"}, req: clientCertRequest(true), match: true},
+		{args: []interface{}{"^CN=partner-a,O=Example$"}, req: clientCertRequest(true), match: true},
+		{args: []interface{}{"^CN=partner-b,"}, req: clientCertRequest(true)},
+		{args: []interface{}{"CN=partner-a", "^partner-a.example.org$"}, req: clientCertRequest(true), match: true},
+		{args: []interface{}{"CN=partner-a", "^spiffe://example.org/partner-a$"}, req: clientCertRequest(true), match: true},
+		{args: []interface{}{"CN=partner-a", "^ops@"}, req: clientCertRequest(true), match: true},
+		{args: []interface{}{"CN=partner-a", "^192.0.2.1$"}, req: clientCertRequest(true), match: true},
+		{args: []interface{}{"CN=partner-a", "^partner-b"}, req: clientCertRequest(true)},
+	} {
+		p, err := NewClientCert().Create(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m := p.Match(tc.req); m != tc.match {
+			t.Errorf("unexpected match result for %v: %v", tc.args, m)
+		}
+	}
+}
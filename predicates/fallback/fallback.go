@@ -0,0 +1,67 @@
+/*
+Package fallback provides the Fallback predicate, which matches the requests
+that are sent to a fallback route by the fallback filter.
+
+The fallback routes are selected only when the backend of a route with the
+fallback filter of the same key failed:
+
+	fallback: Fallback("catalog") && Path("/catalog")
+	  -> setRequestHeader("X-Degraded", "true")
+	  -> "http://catalog-replica.example.org";
+
+The mark of the fallback requests is not visible to the clients or the
+backends, so the fallback routes cannot be selected by the incoming requests.
+*/
+package fallback
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+)
+
+type contextKey struct{}
+
+type spec struct{}
+
+type predicate struct {
+	key string
+}
+
+// New creates the predicate specification of the Fallback predicate.
+func New() routing.PredicateSpec { return spec{} }
+
+func (spec) Name() string { return predicates.FallbackName }
+
+func (spec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) != 1 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	key, _ := args[0].(string)
+	if key == "" {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	return &predicate{key: key}, nil
+}
+
+func (p *predicate) Match(r *http.Request) bool {
+	key, _ := FromContext(r.Context())
+	return key == p.key
+}
+
+// NewContext returns a context marking the request as a fallback request
+// with the key.
+func NewContext(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// FromContext returns the key of the fallback request, when the context was
+// marked with NewContext.
+func FromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(contextKey{}).(string)
+	return key, ok
+}
@@ -0,0 +1,39 @@
+package fallback
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{""},
+		{42.0},
+		{"foo", "bar"},
+	} {
+		if _, err := New().Create(args); err == nil {
+			t.Errorf("failed to fail: %v", args)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	p, err := New().Create([]interface{}{"foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+	if p.Match(req) {
+		t.Error("unexpected match without fallback")
+	}
+
+	if p.Match(req.WithContext(NewContext(req.Context(), "bar"))) {
+		t.Error("unexpected match with a different key")
+	}
+
+	if !p.Match(req.WithContext(NewContext(req.Context(), "foo"))) {
+		t.Error("failed to match")
+	}
+}
@@ -34,6 +34,7 @@ const (
 	JWTPayloadAnyKVRegexpName = "JWTPayloadAnyKVRegexp"
 	JWTPayloadAllKVRegexpName = "JWTPayloadAllKVRegexp"
 	HeaderSHA256Name          = "HeaderSHA256"
+	ClientCertName            = "ClientCert"
 	AfterName                 = "After"
 	BeforeName                = "Before"
 	BetweenName               = "Between"
@@ -43,7 +44,10 @@ const (
 	SourceFromLastName        = "SourceFromLast"
 	ClientIPName              = "ClientIP"
 	TeeName                   = "Tee"
+	FallbackName              = "Fallback"
 	TrafficName               = "Traffic"
 	TrafficSegmentName        = "TrafficSegment"
 	ContentLengthBetweenName  = "ContentLengthBetween"
+	ProxyProtocolTLVName      = "ProxyProtocolTLV"
+	TLSFingerprintName        = "TLSFingerprint"
 )
@@ -0,0 +1,71 @@
+/*
+Package proxyprotocol provides the ProxyProtocolTLV predicate, which matches
+the requests by the TLV fields of the PROXY protocol header of their
+connection.
+
+The predicate matches only when the PROXY protocol is enabled on the
+listener, and the header of the connection contains the field with a value
+matching the regular expression:
+
+	vpce: ProxyProtocolTLV("aws-vpce-id", "^vpce-0123456789abcdef0$")
+	  -> "http://internal.example.org";
+
+The field is identified by one of the names alpn, authority, unique-id,
+netns and aws-vpce-id, or by its type as a decimal or hexadecimal number.
+*/
+package proxyprotocol
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/proxyprotocol"
+	"github.com/zalando/skipper/routing"
+)
+
+type spec struct{}
+
+type predicate struct {
+	name  string
+	value *regexp.Regexp
+}
+
+// NewTLV creates the predicate specification of the ProxyProtocolTLV
+// predicate.
+func NewTLV() routing.PredicateSpec { return spec{} }
+
+func (spec) Name() string { return predicates.ProxyProtocolTLVName }
+
+func (spec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) != 2 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	name, ok := args[0].(string)
+	if !ok || !proxyprotocol.ValidName(name) {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	expr, ok := args[1].(string)
+	if !ok {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	value, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	return &predicate{name: name, value: value}, nil
+}
+
+func (p *predicate) Match(r *http.Request) bool {
+	h, ok := proxyprotocol.FromContext(r.Context())
+	if !ok {
+		return false
+	}
+
+	v, ok := h.Value(p.name)
+	return ok && p.value.MatchString(v)
+}
@@ -0,0 +1,101 @@
+package proxyprotocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"go4.org/netipx"
+
+	"github.com/zalando/skipper/proxyprotocol"
+)
+
+func TestCreate(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"aws-vpce-id"},
+		{"foo", ".*"},
+		{"aws-vpce-id", "("},
+		{42.0, ".*"},
+		{"aws-vpce-id", 42.0},
+		{"aws-vpce-id", ".*", ".*"},
+	} {
+		if _, err := NewTLV().Create(args); err == nil {
+			t.Errorf("failed to fail: %v", args)
+		}
+	}
+}
+
+func v2Header(vpce string) []byte {
+	value := append([]byte{proxyprotocol.SubtypeAWSVPCEndpointID}, vpce...)
+
+	var b bytes.Buffer
+	b.WriteString("\r\n\r\n\x00\r\nQUIT\n")
+	b.Write([]byte{0x21, 0x11})
+	binary.Write(&b, binary.BigEndian, uint16(12+3+len(value)))
+	b.Write([]byte{192, 0, 2, 1, 198, 51, 100, 1, 0x30, 0x39, 0x01, 0xbb})
+	b.WriteByte(proxyprotocol.TypeAWS)
+	binary.Write(&b, binary.BigEndian, uint16(len(value)))
+	b.Write(value)
+	return b.Bytes()
+}
+
+func TestMatch(t *testing.T) {
+	p, err := NewTLV().Create([]interface{}{"aws-vpce-id", "^vpce-1$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Match(&http.Request{}) {
+		t.Error("unexpected match without PROXY protocol")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, p.Match(r))
+		}),
+		ConnContext: proxyprotocol.ConnContext,
+	}
+
+	var b netipx.IPSetBuilder
+	b.AddPrefix(netip.MustParsePrefix("127.0.0.1/32"))
+	trusted, err := b.IPSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go srv.Serve(proxyprotocol.NewListener(l, proxyprotocol.Options{Trusted: trusted}))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		vpce     string
+		expected string
+	}{
+		{vpce: "vpce-1", expected: "true"},
+		{vpce: "vpce-2", expected: "false"},
+	} {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c.Write(v2Header(test.vpce))
+		fmt.Fprint(c, "GET / HTTP/1.0\r\n\r\n")
+		b, _ := io.ReadAll(c)
+		c.Close()
+
+		if !bytes.HasSuffix(b, []byte(test.expected)) {
+			t.Errorf("%s: unexpected response: %s", test.vpce, b)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Package tlsfingerprint provides the TLSFingerprint predicate, which matches
+the requests by the JA3 or JA4 fingerprint of the TLS client.
+
+The predicate matches only when the TLS fingerprints are enabled on the
+listener, and the fingerprint of the client equals any of the listed
+values:
+
+	scripts: TLSFingerprint("ja4", "t13d1516h2_8daaf6152771_e5627efa2ab1")
+	  -> status(403) -> <shunt>;
+
+The JA3 fingerprint is matched by its MD5 hash with the name ja3, and by
+the full JA3 string with the name ja3-full.
+*/
+package tlsfingerprint
+
+import (
+	"net/http"
+
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/tlsfingerprint"
+)
+
+type spec struct{}
+
+type predicate struct {
+	name   string
+	values map[string]bool
+}
+
+// New creates the predicate specification of the TLSFingerprint
+// predicate.
+func New() routing.PredicateSpec { return spec{} }
+
+func (spec) Name() string { return predicates.TLSFingerprintName }
+
+func (spec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) < 2 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	name, ok := args[0].(string)
+	if !ok || name != "ja3" && name != "ja3-full" && name != "ja4" {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	values := make(map[string]bool)
+	for _, arg := range args[1:] {
+		v, ok := arg.(string)
+		if !ok || v == "" {
+			return nil, predicates.ErrInvalidPredicateParameters
+		}
+
+		values[v] = true
+	}
+
+	return &predicate{name: name, values: values}, nil
+}
+
+func (p *predicate) Match(r *http.Request) bool {
+	fp, ok := tlsfingerprint.FromContext(r.Context())
+	return ok && p.values[fp.Value(p.name)]
+}
@@ -0,0 +1,102 @@
+package tlsfingerprint
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/zalando/skipper/tlsfingerprint"
+)
+
+func TestCreate(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"ja4"},
+		{"ja5", "foo"},
+		{42.0, "foo"},
+		{"ja4", 42.0},
+		{"ja4", ""},
+	} {
+		if _, err := New().Create(args); err == nil {
+			t.Errorf("failed to fail: %v", args)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	p, err := New().Create([]interface{}{"ja4", "t13d1516h2_8daaf6152771_e5627efa2ab1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Match(&http.Request{}) {
+		t.Error("unexpected match without fingerprint")
+	}
+
+	// without the name, responds with the fingerprint, otherwise with the
+	// result of the predicate
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("name") == "" {
+			fp, _ := tlsfingerprint.FromContext(r.Context())
+			fmt.Fprint(w, fp.Value("ja3"), " ", fp.Value("ja4"))
+			return
+		}
+
+		args := []interface{}{q.Get("name")}
+		for _, v := range q["value"] {
+			args = append(args, v)
+		}
+
+		p, err := New().Create(args)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprint(w, p.Match(r))
+	}))
+
+	srv.Listener = tlsfingerprint.NewListener(srv.Listener)
+	srv.Config.ConnContext = tlsfingerprint.ConnContext
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(q url.Values) string {
+		rsp, err := srv.Client().Get(srv.URL + "?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rsp.Body.Close()
+		b, err := io.ReadAll(rsp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(b)
+	}
+
+	var ja3, ja4 string
+	if _, err := fmt.Sscan(get(nil), &ja3, &ja4); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		query    url.Values
+		expected string
+	}{
+		{query: url.Values{"name": {"ja4"}, "value": {ja4}}, expected: "true"},
+		{query: url.Values{"name": {"ja4"}, "value": {"foo", ja4}}, expected: "true"},
+		{query: url.Values{"name": {"ja4"}, "value": {"foo"}}, expected: "false"},
+		{query: url.Values{"name": {"ja4"}, "value": {ja3}}, expected: "false"},
+		{query: url.Values{"name": {"ja3"}, "value": {ja3}}, expected: "true"},
+	} {
+		if got := get(test.query); got != test.expected {
+			t.Errorf("%v: expected %s, got %s", test.query, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// DefaultRequestBodyBufferMemoryBytes is the default size, above which the
+// buffered request bodies are stored in temporary files.
+const DefaultRequestBodyBufferMemoryBytes = 1 << 20
+
+var bodyBufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// bodyBuffer holds the request body read by the filters, in pooled memory,
+// or, above the memory limit, in a temporary file. It is released, when
+// both the request is done, and the request body, which reads from the
+// buffer, is closed.
+type bodyBuffer struct {
+	memoryLimit int64
+	source      io.ReadCloser
+
+	mem  *bytes.Buffer
+	file *os.File
+	size int64
+	eof  bool
+	err  error
+
+	// set when the request body was read beyond the buffer, and the
+	// source cannot be buffered anymore
+	passThrough bool
+
+	refs atomic.Int32
+}
+
+// requestBodyBuffer holds the buffer of the request body, shared by the
+// loopback contexts of the request.
+type requestBodyBuffer struct {
+	buffer *bodyBuffer
+}
+
+// bufferedBody is the request body, which reads the buffer first, and then
+// the rest of the source.
+type bufferedBody struct {
+	buffer *bodyBuffer
+	offset int64
+	closed atomic.Bool
+}
+
+func newBodyBuffer(source io.ReadCloser, memoryLimit int64) *bodyBuffer {
+	b := &bodyBuffer{
+		memoryLimit: memoryLimit,
+		source:      source,
+		mem:         bodyBufferPool.Get().(*bytes.Buffer),
+	}
+
+	// one reference for the request and one for the request body
+	b.refs.Store(2)
+	return b
+}
+
+func (b *bodyBuffer) write(p []byte) error {
+	if b.file == nil && b.size+int64(len(p)) > b.memoryLimit {
+		f, err := os.CreateTemp("", "skipper-body-")
+		if err != nil {
+			return err
+		}
+
+		// the file is removed right away, and the space is freed, when
+		// it is closed
+		os.Remove(f.Name())
+		if _, err := f.Write(b.mem.Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+
+		b.file = f
+		b.mem.Reset()
+		bodyBufferPool.Put(b.mem)
+		b.mem = nil
+	}
+
+	if b.file != nil {
+		if _, err := b.file.Write(p); err != nil {
+			return err
+		}
+	} else {
+		b.mem.Write(p)
+	}
+
+	b.size += int64(len(p))
+	return nil
+}
+
+// fill reads the source into the buffer, until it is complete, or it
+// exceeds maxBytes.
+func (b *bodyBuffer) fill(maxBytes int64) error {
+	if b.err != nil {
+		return b.err
+	}
+
+	p := make([]byte, 32<<10)
+	for !b.eof && b.size <= maxBytes {
+		if b.passThrough {
+			return filters.ErrRequestBodyTooLarge
+		}
+
+		n, err := b.source.Read(p)
+		if n > 0 {
+			if werr := b.write(p[:n]); werr != nil {
+				b.err = werr
+				return werr
+			}
+		}
+
+		if err == io.EOF {
+			b.eof = true
+		} else if err != nil {
+			b.err = err
+			return err
+		}
+	}
+
+	if b.size > maxBytes {
+		return filters.ErrRequestBodyTooLarge
+	}
+
+	return nil
+}
+
+func (b *bodyBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if b.file != nil {
+		return b.file.ReadAt(p, off)
+	}
+
+	if b.mem == nil {
+		return 0, os.ErrClosed
+	}
+
+	if off >= int64(b.mem.Len()) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.mem.Bytes()[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (b *bodyBuffer) release() {
+	if b.refs.Add(-1) > 0 {
+		return
+	}
+
+	if b.file != nil {
+		b.file.Close()
+	}
+
+	if b.mem != nil {
+		b.mem.Reset()
+		bodyBufferPool.Put(b.mem)
+		b.mem = nil
+	}
+}
+
+func (r *bufferedBody) Read(p []byte) (int, error) {
+	b := r.buffer
+	if r.offset < b.size {
+		n, err := b.ReadAt(p, r.offset)
+		r.offset += int64(n)
+		if err == io.EOF {
+			err = nil
+		}
+
+		return n, err
+	}
+
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	if b.eof {
+		return 0, io.EOF
+	}
+
+	b.passThrough = true
+	return b.source.Read(p)
+}
+
+func (r *bufferedBody) Close() error {
+	if !r.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	err := r.buffer.source.Close()
+	r.buffer.release()
+	return err
+}
+
+// BufferedRequestBody implements filters.FilterContext.
+func (c *context) BufferedRequestBody(maxBytes int64) (*io.SectionReader, error) {
+	req := c.Request()
+	if req.Body == nil || req.Body == http.NoBody {
+		return io.NewSectionReader(bytes.NewReader(nil), 0, 0), nil
+	}
+
+	rb := c.requestBodyBuffer
+	body, ok := req.Body.(*bufferedBody)
+	if !ok || body.buffer != rb.buffer || body.offset > 0 {
+		// the body was not buffered yet, or it was replaced since
+		rb.release()
+		rb.buffer = newBodyBuffer(req.Body, c.proxy.requestBodyMemoryBytes)
+		req.Body = &bufferedBody{buffer: rb.buffer}
+	}
+
+	if err := rb.buffer.fill(maxBytes); err != nil {
+		return nil, err
+	}
+
+	return io.NewSectionReader(rb.buffer, 0, rb.buffer.size), nil
+}
+
+// reader returns a new reader of the buffered request body, from its
+// start, or http.NoBody, when the request body was not buffered. The reader
+// holds a reference of the buffer, until it is closed.
+func (rb *requestBodyBuffer) reader() io.ReadCloser {
+	if rb.buffer == nil {
+		return http.NoBody
+	}
+
+	rb.buffer.refs.Add(1)
+	return &bufferedBody{buffer: rb.buffer}
+}
+
+// release releases the request reference of the buffered body.
+func (rb *requestBodyBuffer) release() {
+	if rb.buffer != nil {
+		rb.buffer.release()
+		rb.buffer = nil
+	}
+}
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+)
+
+type readBodySpec struct{}
+
+type readBodyFilter struct {
+	maxBytes int64
+}
+
+func (readBodySpec) Name() string { return "readBody" }
+
+func (readBodySpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	return readBodyFilter{maxBytes: int64(args[0].(float64))}, nil
+}
+
+func (f readBodyFilter) Request(ctx filters.FilterContext) {
+	body, err := ctx.BufferedRequestBody(f.maxBytes)
+	if errors.Is(err, filters.ErrRequestBodyTooLarge) {
+		ctx.Serve(&http.Response{StatusCode: http.StatusRequestEntityTooLarge})
+		return
+	} else if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusBadRequest})
+		return
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		ctx.Serve(&http.Response{StatusCode: http.StatusInternalServerError})
+		return
+	}
+
+	ctx.Request().Header.Add("X-Body", string(b))
+}
+
+func (readBodyFilter) Response(filters.FilterContext) {}
+
+func TestBufferedRequestBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["X-Body"] = r.Header["X-Body"]
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+
+	fr := builtin.MakeRegistry()
+	fr.Register(readBodySpec{})
+
+	for _, memory := range []int64{0, 4} {
+		t.Run("memory "+strconv.FormatInt(memory, 10), func(t *testing.T) {
+			tp, err := newTestProxyWithFiltersAndParams(fr, fmt.Sprintf(`
+				once: Path("/once") -> readBody(16) -> "%s";
+				twice: Path("/twice") -> readBody(16) -> readBody(16) -> "%s";
+				shorter: Path("/shorter") -> readBody(16) -> readBody(4) -> "%s";
+			`, backend.URL, backend.URL, backend.URL), Params{RequestBodyBufferMemoryBytes: memory}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tp.close()
+
+			ps := httptest.NewServer(tp.proxy)
+			defer ps.Close()
+
+			for _, test := range []struct {
+				title    string
+				path     string
+				body     string
+				chunked  bool
+				expected int
+				reads    int
+			}{
+				{title: "empty", path: "/once", expected: http.StatusOK, reads: 1},
+				{title: "small", path: "/once", body: "123", expected: http.StatusOK, reads: 1},
+				{title: "limit", path: "/once", body: strings.Repeat("x", 16), expected: http.StatusOK, reads: 1},
+				{title: "streaming", path: "/once", body: "123456789", chunked: true, expected: http.StatusOK, reads: 1},
+				{title: "read twice", path: "/twice", body: "123456789", expected: http.StatusOK, reads: 2},
+				{title: "too large", path: "/once", body: strings.Repeat("x", 17), expected: http.StatusRequestEntityTooLarge},
+				{title: "too large while streaming", path: "/once", body: strings.Repeat("x", 17), chunked: true, expected: http.StatusRequestEntityTooLarge},
+				{title: "too large for the second read", path: "/shorter", body: "12345", expected: http.StatusRequestEntityTooLarge},
+			} {
+				t.Run(test.title, func(t *testing.T) {
+					var body io.Reader = strings.NewReader(test.body)
+					if test.chunked {
+						// hides the length of the body
+						body = struct{ io.Reader }{body}
+					}
+
+					rsp, err := ps.Client().Post(ps.URL+test.path, "text/plain", body)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer rsp.Body.Close()
+
+					b, _ := io.ReadAll(rsp.Body)
+					if rsp.StatusCode != test.expected {
+						t.Fatalf("expected %d, got: %d %s", test.expected, rsp.StatusCode, b)
+					}
+
+					if test.expected != http.StatusOK {
+						return
+					}
+
+					if string(b) != test.body {
+						t.Errorf("unexpected body sent to the backend: %s", b)
+					}
+
+					reads := rsp.Header["X-Body"]
+					if len(reads) != test.reads {
+						t.Fatalf("unexpected reads: %v", reads)
+					}
+
+					for _, r := range reads {
+						if r != test.body {
+							t.Errorf("unexpected body read by the filter: %s", r)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestBufferedBodyPassThrough(t *testing.T) {
+	source := io.NopCloser(strings.NewReader("123456789"))
+	b := newBodyBuffer(source, 4)
+	defer b.release()
+
+	if err := b.fill(2); !errors.Is(err, filters.ErrRequestBodyTooLarge) {
+		t.Fatalf("expected too large error, got: %v", err)
+	}
+
+	body := &bufferedBody{buffer: b}
+	defer body.Close()
+
+	p, err := io.ReadAll(body)
+	if err != nil || string(p) != "123456789" {
+		t.Fatalf("unexpected body: %s, %v", p, err)
+	}
+
+	if err := b.fill(16); !errors.Is(err, filters.ErrRequestBodyTooLarge) {
+		t.Errorf("expected too large error after the body was streamed, got: %v", err)
+	}
+}
+
+func TestBufferedRequestBodyRetry(t *testing.T) {
+	var requests atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header()["X-Body"] = r.Header["X-Body"]
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+
+	fr := builtin.MakeRegistry()
+	fr.Register(readBodySpec{})
+
+	tp, err := newTestProxyWithFiltersAndParams(fr, fmt.Sprintf(`* -> readBody(16) -> retry(2, "503", "1s", "methods=all") -> "%s"`, backend.URL), Params{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	rsp, err := ps.Client().Post(ps.URL, "text/plain", strings.NewReader("123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	b, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK || string(b) != "123456789" || rsp.Header.Get("X-Body") != "123456789" {
+		t.Errorf("unexpected response: %d %s %v", rsp.StatusCode, b, rsp.Header)
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected 2 backend requests, got: %d", n)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/tlsfingerprint"
 	"github.com/zalando/skipper/tracing"
 
 	log "github.com/sirupsen/logrus"
@@ -51,6 +52,10 @@ type context struct {
 	routeLookup          *routing.RouteLookup
 	cancelBackendContext stdlibcontext.CancelFunc
 	logger               filters.FilterContextLogger
+	requestBodyBuffer    *requestBodyBuffer
+
+	// triedEndpoints are excluded from load balancing while retrying
+	triedEndpoints map[string]struct{}
 }
 
 type filterMetrics struct {
@@ -145,12 +150,18 @@ func newContext(
 		metrics:        &filterMetrics{impl: p.metrics},
 		proxy:          p,
 		routeLookup:    p.routing.Get(),
+
+		requestBodyBuffer: &requestBodyBuffer{},
 	}
 
 	if p.flags.PreserveOriginal() {
 		c.originalRequest = cloneRequestMetadata(r)
 	}
 
+	if fp, ok := tlsfingerprint.FromContext(r.Context()); ok {
+		c.stateBag[filters.TLSFingerprint] = fp
+	}
+
 	return c
 }
 
@@ -274,6 +285,7 @@ func (c *context) Split() (filters.FilterContext, error) {
 	}
 	cc := c.clone()
 	cc.stateBag = map[string]interface{}{}
+	cc.requestBodyBuffer = &requestBodyBuffer{}
 	cc.responseWriter = noopFlushedResponseWriter{}
 	cc.metrics = &filterMetrics{
 		prefix: cc.metrics.prefix,
@@ -296,6 +308,8 @@ func (c *context) Split() (filters.FilterContext, error) {
 }
 
 func (c *context) Loopback() {
+	defer c.requestBodyBuffer.release()
+
 	err := c.proxy.do(c)
 	if c.response != nil && c.response.Body != nil {
 		if _, err := io.Copy(io.Discard, c.response.Body); err != nil {
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/fallback"
+	"github.com/zalando/skipper/predicates"
+	fallbackpredicate "github.com/zalando/skipper/predicates/fallback"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/tracing"
+)
+
+type fallbackRequest struct {
+	policy *fallback.Policy
+}
+
+// prepareFallback buffers the request body, when the route has a fallback
+// policy, so that the request can be sent to the fallback route. It returns
+// nil, when the request cannot be sent to the fallback route.
+func (p *Proxy) prepareFallback(ctx *context) (*fallbackRequest, *proxyError) {
+	policy, ok := ctx.StateBag()[filters.BackendFallback].(*fallback.Policy)
+	if !ok || isUpgradeRequest(ctx.request) {
+		return nil, nil
+	}
+
+	// a fallback request is not sent to another fallback route, otherwise
+	// a fallback route with the fallback filter could loop
+	if _, isFallback := fallbackpredicate.FromContext(ctx.request.Context()); isFallback {
+		return nil, nil
+	}
+
+	ok, err := bufferRequestBody(ctx, policy.MaxBodyBytes)
+	if err != nil {
+		return nil, bufferError(err)
+	}
+
+	if !ok {
+		p.metrics.IncCounter("fallback.skipped." + policy.Key)
+		return nil, nil
+	}
+
+	return &fallbackRequest{policy: policy}, nil
+}
+
+// fallbackReason returns why the failed backend request should be sent to
+// the fallback route, or an empty string when it should not be, or when
+// there is no route with the Fallback predicate of the policy key that
+// would handle it.
+func (p *Proxy) fallbackReason(ctx *context, f *fallbackRequest, rsp *http.Response, perr *proxyError) string {
+	if f == nil {
+		return ""
+	}
+
+	reason := failureReason(f.policy.FallbackOn, f.policy.FallbackStatus, rsp, perr)
+	if reason == "" {
+		return ""
+	}
+
+	key := f.policy.Key
+	req := ctx.request.WithContext(fallbackpredicate.NewContext(ctx.request.Context(), key))
+	route, _ := p.lookupRoute(&context{request: req, routeLookup: ctx.routeLookup})
+	if !hasFallbackPredicate(route, key) {
+		p.metrics.IncCounter("fallback.noroute." + key)
+		ctx.Logger().Debugf("No route found for fallback %s", key)
+		return ""
+	}
+
+	return reason
+}
+
+func hasFallbackPredicate(route *routing.Route, key string) bool {
+	if route == nil {
+		return false
+	}
+
+	for _, p := range route.Route.Predicates {
+		if p.Name == predicates.FallbackName && len(p.Args) == 1 && p.Args[0] == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// doFallback routes the request again, when its backend request failed, so
+// that it is handled by a route with the Fallback predicate of the policy
+// key, and sets the response of the fallback route.
+func (p *Proxy) doFallback(ctx *context, f *fallbackRequest, reason string, rsp *http.Response) error {
+	discardResponse(rsp)
+	if ctx.proxySpan != nil {
+		ctx.proxySpan.Finish()
+		ctx.proxySpan = nil
+	}
+
+	key := f.policy.Key
+	p.metrics.IncCounter("fallback.used." + key)
+	tracing.LogKV("fallback", reason, ctx.request.Context())
+	ctx.Logger().Debugf("Sending request to fallback %s: %s", key, reason)
+
+	req := ctx.request.Clone(fallbackpredicate.NewContext(ctx.request.Context(), key))
+	req.Body = ctx.requestBodyBuffer.reader()
+
+	fallbackCtx := ctx.clone()
+	fallbackCtx.request = req
+	fallbackCtx.stateBag = make(map[string]interface{})
+	fallbackCtx.response = nil
+	fallbackCtx.cancelBackendContext = nil
+
+	err := p.do(fallbackCtx)
+	if cancel := fallbackCtx.cancelBackendContext; cancel != nil {
+		cancelBackendContext := ctx.cancelBackendContext
+		ctx.cancelBackendContext = func() {
+			cancel()
+			if cancelBackendContext != nil {
+				cancelBackendContext()
+			}
+		}
+	}
+
+	ctx.proxySpan = fallbackCtx.proxySpan
+	if err != nil {
+		p.metrics.IncCounter("fallback.failed." + key)
+		ctx.response = fallbackCtx.response
+		return err
+	}
+
+	ctx.setResponse(fallbackCtx.response, p.flags.PreserveOriginal())
+	return nil
+}
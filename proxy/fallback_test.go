@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFallbackStatus(t *testing.T) {
+	var primaryRequests atomic.Int64
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryRequests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Degraded", r.Header.Get("X-Degraded"))
+		w.Write([]byte("replica: " + string(b)))
+	}))
+	defer replica.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`
+		main: Path("/catalog") -> fallback("catalog", "gateway-error") -> setResponseHeader("X-Route", "main") -> "%s";
+		fallback: Fallback("catalog") && Path("/catalog") -> setRequestHeader("X-Degraded", "true") -> "%s";
+	`, primary.URL, replica.URL))
+
+	rsp, err := ps.Client().Post(ps.URL+"/catalog", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	b, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK || string(b) != "replica: hello" {
+		t.Errorf("unexpected response: %d %s", rsp.StatusCode, b)
+	}
+
+	if rsp.Header.Get("X-Degraded") != "true" {
+		t.Error("fallback route filters not applied")
+	}
+
+	if rsp.Header.Get("X-Route") != "main" {
+		t.Error("primary route response filters not applied")
+	}
+
+	if n := primaryRequests.Load(); n != 1 {
+		t.Errorf("expected 1 primary request, got: %d", n)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["fallback.used.catalog"] != 1 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestFallbackConnectFailure(t *testing.T) {
+	ps, m := newRetryTestProxy(t, `
+		main: * -> fallback("degraded") -> <roundRobin, "http://127.0.0.1:1">;
+		fallback: Fallback("degraded") -> status(200) -> inlineContent("degraded") -> <shunt>;
+	`)
+
+	rsp, err := ps.Client().Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	b, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK || string(b) != "degraded" {
+		t.Errorf("unexpected response: %d %s", rsp.StatusCode, b)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["fallback.used.degraded"] != 1 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestFallbackTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	ps, _ := newRetryTestProxy(t, fmt.Sprintf(`
+		main: * -> backendTimeout("20ms") -> fallback("degraded") -> "%s";
+		fallback: Fallback("degraded") -> status(200) -> inlineContent("degraded") -> <shunt>;
+	`, slow.URL))
+
+	rsp, err := ps.Client().Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	if b, _ := io.ReadAll(rsp.Body); rsp.StatusCode != http.StatusOK || string(b) != "degraded" {
+		t.Errorf("unexpected response: %d %s", rsp.StatusCode, b)
+	}
+}
+
+func TestFallbackNotUsed(t *testing.T) {
+	var fallbackRequests atomic.Int64
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackRequests.Add(1)
+	}))
+	defer replica.Close()
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`
+		main: Path("/catalog") -> fallback("catalog", "500", "max-body=4") -> "%s";
+		other: Path("/other") -> fallback("catalog", "503", "max-body=4") -> "%s";
+		fallback: Fallback("catalog") -> "%s";
+	`, primary.URL, primary.URL, replica.URL))
+
+	for _, test := range []struct {
+		title string
+		path  string
+		body  string
+	}{{
+		title: "status not configured",
+		path:  "/catalog",
+	}, {
+		title: "body too large",
+		path:  "/other",
+		body:  "too large",
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			rsp, err := ps.Client().Post(ps.URL+test.path, "text/plain", strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rsp.Body.Close()
+
+			if rsp.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("unexpected status: %d", rsp.StatusCode)
+			}
+		})
+	}
+
+	if n := fallbackRequests.Load(); n != 0 {
+		t.Errorf("unexpected fallback requests: %d", n)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["fallback.skipped.catalog"] != 1 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestFallbackRouteNotReachable(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	ps, _ := newRetryTestProxy(t, fmt.Sprintf(`
+		main: Path("/") -> "%s";
+		fallback: Fallback("main") -> status(500) -> <shunt>;
+	`, backend.URL))
+
+	rsp, err := ps.Client().Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("fallback route matched the incoming request: %d", rsp.StatusCode)
+	}
+}
+
+func TestFallbackRouteNotMatching(t *testing.T) {
+	var backendRequests atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendRequests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("primary"))
+	}))
+	defer backend.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`
+		main: Path("/catalog") && Method("GET") -> fallback("catalog", "503") -> "%s";
+		fb: Fallback("catalog") && PathSubtree("/x") -> status(200) -> inlineContent("fallback") -> <shunt>;
+		chained: Path("/chained") -> fallback("chained", "503") -> "%s";
+		chainedFallback: Fallback("chained") && Path("/chained") -> fallback("chained", "503") -> "%s";
+	`, backend.URL, backend.URL, backend.URL))
+
+	for _, test := range []struct {
+		title            string
+		path             string
+		expectedRequests int64
+	}{{
+		title:            "no fallback route matches",
+		path:             "/catalog",
+		expectedRequests: 1,
+	}, {
+		title:            "fallback route with the fallback filter",
+		path:             "/chained",
+		expectedRequests: 2,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			backendRequests.Store(0)
+			rsp, err := ps.Client().Get(ps.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rsp.Body.Close()
+
+			b, _ := io.ReadAll(rsp.Body)
+			if rsp.StatusCode != http.StatusServiceUnavailable || string(b) != "primary" {
+				t.Errorf("unexpected response: %d %s", rsp.StatusCode, b)
+			}
+
+			if n := backendRequests.Load(); n != test.expectedRequests {
+				t.Errorf("expected %d backend requests, got: %d", test.expectedRequests, n)
+			}
+		})
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["fallback.noroute.catalog"] != 1 || counters["fallback.used.catalog"] != 0 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
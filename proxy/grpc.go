@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/grpc"
+)
+
+// grpcContentType returns the content type of the gRPC error responses,
+// when the route was marked as a gRPC route by the grpc() or the grpcWeb()
+// filter.
+func grpcContentType(ctx *context) (string, bool) {
+	contentType, ok := ctx.stateBag[filters.GRPCContentType].(string)
+	return contentType, ok
+}
+
+// backendTimeout returns the timeout set by the backendTimeout filter, or
+// the grpc-timeout of the gRPC requests, whichever is shorter.
+func backendTimeout(ctx *context) (time.Duration, bool) {
+	timeout, ok := ctx.stateBag[filters.BackendTimeout].(time.Duration)
+	if _, isGRPC := grpcContentType(ctx); !isGRPC {
+		return timeout, ok
+	}
+
+	h := ctx.request.Header.Get("Grpc-Timeout")
+	if h == "" {
+		return timeout, ok
+	}
+
+	d, err := grpc.ParseTimeout(h)
+	if err != nil {
+		ctx.Logger().Debugf("Ignoring invalid grpc-timeout: %s", h)
+		return timeout, ok
+	}
+
+	if !ok || d < timeout {
+		return d, true
+	}
+
+	return timeout, true
+}
+
+// setGRPCErrorResponse replaces the response with a gRPC trailers-only
+// response, with the status mapped from the HTTP status code of the
+// response.
+func setGRPCErrorResponse(ctx *context, contentType string) {
+	rsp := ctx.response
+	if rsp.Body != nil {
+		rsp.Body.Close()
+	}
+
+	if rsp.Header == nil {
+		rsp.Header = make(http.Header)
+	}
+
+	rsp.Header.Del("Content-Length")
+	rsp.Header.Del("Content-Encoding")
+	rsp.Header.Del("X-Content-Type-Options")
+	rsp.Header.Set("Content-Type", contentType)
+	rsp.Header.Set("Grpc-Status", strconv.Itoa(int(grpc.CodeFromHTTPStatus(rsp.StatusCode))))
+	rsp.Header.Set("Grpc-Message", grpc.EncodeMessage(http.StatusText(rsp.StatusCode)))
+
+	rsp.StatusCode = http.StatusOK
+	rsp.ContentLength = 0
+	rsp.Body = http.NoBody
+}
+
+// copyTrailers sets the trailers of the backend response to be sent to
+// the client. The gRPC-Web responses contain the trailers in the body.
+func copyTrailers(w http.ResponseWriter, rsp *http.Response) {
+	if strings.HasPrefix(rsp.Header.Get("Content-Type"), "application/grpc-web") {
+		return
+	}
+
+	for name, values := range rsp.Trailer {
+		w.Header()[http.TrailerPrefix+name] = values
+	}
+}
+
+// measureGRPC measures the gRPC requests by route and status:
+//
+//	grpc.<route ID>.<status>
+//
+// The gRPC method is not used in the metric keys, because it is taken
+// from the path of the request, and this way the clients could create an
+// unbounded number of metrics.
+func (p *Proxy) measureGRPC(ctx *context) {
+	status := ctx.response.Header.Get("Grpc-Status")
+	if status == "" {
+		status = ctx.response.Trailer.Get("Grpc-Status")
+	}
+
+	code := grpc.Unknown
+	if c, err := strconv.Atoi(status); err == nil {
+		code = grpc.Code(c)
+	}
+
+	key := "grpc." + ctx.route.Id
+	p.metrics.IncCounter(key + "." + code.String())
+	p.metrics.MeasureSince(key, ctx.startServe)
+}
@@ -0,0 +1,365 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+var grpcTestMessage = []byte{0, 0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o'}
+
+func grpcHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+
+		if r.URL.Path == "/helloworld.Greeter/Slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(200 * time.Millisecond):
+			}
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write(grpcTestMessage)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "te="+r.Header.Get("Te"))
+	})
+}
+
+func newGRPCTestProxy(t *testing.T) (*httptest.Server, *metricstest.MockMetrics) {
+	t.Helper()
+
+	backend := httptest.NewServer(h2c.NewHandler(grpcHandler(), &http2.Server{}))
+	t.Cleanup(backend.Close)
+
+	tp, err := newTestProxyWithFiltersAndParams(nil, fmt.Sprintf(`
+		greeter: PathRegexp("^/helloworld[.]Greeter/") -> grpc() -> backendProtocol("h2c") -> "%s";
+		greeterUnavailable: Path("/helloworld.Greeter/Unavailable") -> grpc() -> "http://127.0.0.1:1";
+		greeterWeb: PathRegexp("^/web/") -> modPath("^/web", "") -> grpcWeb() -> backendProtocol("h2c") -> "%s";
+		greeterBackendTimeout: PathRegexp("^/timeout/") -> modPath("^/timeout", "") -> grpc() -> backendTimeout("1m") -> backendProtocol("h2c") -> "%s";
+	`, backend.URL, backend.URL, backend.URL), Params{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tp.close)
+	t.Cleanup(tp.proxy.h2cRoundTripper.(*http2.Transport).CloseIdleConnections)
+
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = m
+
+	ps := httptest.NewServer(tp.proxy)
+	t.Cleanup(ps.Close)
+
+	return ps, m
+}
+
+func grpcRequest(t *testing.T, url, contentType string, body []byte, header http.Header) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rsp
+}
+
+func TestGRPCTrailers(t *testing.T) {
+	ps, m := newGRPCTestProxy(t)
+
+	rsp := grpcRequest(t, ps.URL+"/helloworld.Greeter/SayHello", "application/grpc", grpcTestMessage, nil)
+	defer rsp.Body.Close()
+
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b, grpcTestMessage) {
+		t.Errorf("invalid body: %v", b)
+	}
+
+	if s := rsp.Trailer.Get("Grpc-Status"); s != "0" {
+		t.Errorf("expected grpc-status 0, got: %q", s)
+	}
+
+	if s := rsp.Trailer.Get("Grpc-Message"); s != "te=trailers" {
+		t.Errorf("expected te=trailers, got: %q", s)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if c := counters["grpc.greeter.OK"]; c != 1 {
+			t.Errorf("expected 1 OK request, got: %d, %v", c, counters)
+		}
+	})
+
+	m.WithMeasures(func(measures map[string][]time.Duration) {
+		if len(measures["grpc.greeter"]) != 1 {
+			t.Errorf("expected a measure, got: %v", measures)
+		}
+	})
+}
+
+func TestGRPCErrorResponses(t *testing.T) {
+	ps, m := newGRPCTestProxy(t)
+
+	for _, test := range []struct {
+		title          string
+		path           string
+		header         http.Header
+		expectedStatus string
+		expectedMetric string
+	}{{
+		title:          "unavailable backend",
+		path:           "/helloworld.Greeter/Unavailable",
+		expectedStatus: "14",
+		expectedMetric: "grpc.greeterUnavailable.UNAVAILABLE",
+	}, {
+		title:          "grpc-timeout",
+		path:           "/helloworld.Greeter/Slow",
+		header:         http.Header{"Grpc-Timeout": []string{"10m"}},
+		expectedStatus: "4",
+		expectedMetric: "grpc.greeter.DEADLINE_EXCEEDED",
+	}, {
+		title:          "non-gRPC backend response",
+		path:           "/helloworld.Greeter/Slow",
+		header:         http.Header{"Grpc-Timeout": []string{"invalid"}},
+		expectedStatus: "2",
+		expectedMetric: "grpc.greeter.UNKNOWN",
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			rsp := grpcRequest(t, ps.URL+test.path, "application/grpc+proto", grpcTestMessage, test.header)
+			defer rsp.Body.Close()
+
+			b, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rsp.StatusCode != http.StatusOK {
+				t.Errorf("expected status 200, got: %d", rsp.StatusCode)
+			}
+
+			if ct := rsp.Header.Get("Content-Type"); ct != "application/grpc" {
+				t.Errorf("expected gRPC content type, got: %s", ct)
+			}
+
+			if s := rsp.Header.Get("Grpc-Status"); s != test.expectedStatus {
+				t.Errorf("expected grpc-status %s, got: %q", test.expectedStatus, s)
+			}
+
+			if rsp.Header.Get("Grpc-Message") == "" {
+				t.Error("expected grpc-message")
+			}
+
+			if len(b) != 0 {
+				t.Errorf("expected empty body, got: %q", b)
+			}
+
+			m.WithCounters(func(counters map[string]int64) {
+				if counters[test.expectedMetric] == 0 {
+					t.Errorf("expected %s, got: %v", test.expectedMetric, counters)
+				}
+			})
+		})
+	}
+}
+
+func TestGRPCTimeout(t *testing.T) {
+	ps, m := newGRPCTestProxy(t)
+
+	for _, test := range []struct {
+		title          string
+		header         http.Header
+		expectedStatus string
+		expectedMetric string
+	}{{
+		title:          "backend timeout only",
+		expectedStatus: "2",
+		expectedMetric: "grpc.greeterBackendTimeout.UNKNOWN",
+	}, {
+		title:          "grpc-timeout shorter than the backend timeout",
+		header:         http.Header{"Grpc-Timeout": []string{"10m"}},
+		expectedStatus: "4",
+		expectedMetric: "grpc.greeterBackendTimeout.DEADLINE_EXCEEDED",
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			start := time.Now()
+			rsp := grpcRequest(t, ps.URL+"/timeout/helloworld.Greeter/Slow", "application/grpc", grpcTestMessage, test.header)
+			defer rsp.Body.Close()
+
+			if s := rsp.Header.Get("Grpc-Status"); s != test.expectedStatus {
+				t.Errorf("expected grpc-status %s, got: %q", test.expectedStatus, s)
+			}
+
+			if test.header != nil && time.Since(start) >= 200*time.Millisecond {
+				t.Errorf("expected the backend request to be bounded by grpc-timeout, took: %v", time.Since(start))
+			}
+
+			m.WithCounters(func(counters map[string]int64) {
+				if counters[test.expectedMetric] == 0 {
+					t.Errorf("expected %s, got: %v", test.expectedMetric, counters)
+				}
+			})
+		})
+	}
+}
+
+func TestGRPCMetricsByRoute(t *testing.T) {
+	ps, m := newGRPCTestProxy(t)
+
+	for _, path := range []string{
+		"/helloworld.Greeter/SayHello",
+		"/helloworld.Greeter/Foo",
+		"/helloworld.Greeter/Bar",
+		"/helloworld.Greeter/SayHello/foo",
+	} {
+		rsp := grpcRequest(t, ps.URL+path, "application/grpc", grpcTestMessage, nil)
+		io.Copy(io.Discard, rsp.Body)
+		rsp.Body.Close()
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if c := counters["grpc.greeter.OK"]; c != 4 {
+			t.Errorf("expected 4 OK requests, got: %d, %v", c, counters)
+		}
+
+		for key := range counters {
+			if strings.HasPrefix(key, "grpc.") && key != "grpc.greeter.OK" {
+				t.Errorf("unexpected metric: %s", key)
+			}
+		}
+	})
+}
+
+func TestGRPCWeb(t *testing.T) {
+	ps, _ := newGRPCTestProxy(t)
+
+	trailerFrame := append([]byte{0x80, 0, 0, 0, 41}, "grpc-message:te=trailers\r\ngrpc-status:0\r\n"...)
+	expected := append(append([]byte(nil), grpcTestMessage...), trailerFrame...)
+	for _, test := range []struct {
+		title       string
+		contentType string
+		encode      func([]byte) []byte
+		decode      func([]byte) []byte
+	}{{
+		title:       "binary",
+		contentType: "application/grpc-web+proto",
+		encode:      func(b []byte) []byte { return b },
+		decode:      func(b []byte) []byte { return b },
+	}, {
+		title:       "text",
+		contentType: "application/grpc-web-text",
+		encode:      func(b []byte) []byte { return []byte(base64.StdEncoding.EncodeToString(b)) },
+		decode: func(b []byte) []byte {
+			// the chunks are encoded separately
+			var decoded []byte
+			for len(b) > 0 {
+				n := bytes.IndexByte(b, '=')
+				for n >= 0 && n < len(b) && b[n] == '=' {
+					n++
+				}
+
+				if n < 0 {
+					n = len(b)
+				}
+
+				d, err := base64.StdEncoding.DecodeString(string(b[:n]))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				decoded = append(decoded, d...)
+				b = b[n:]
+			}
+
+			return decoded
+		},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			rsp := grpcRequest(t, ps.URL+"/web/helloworld.Greeter/SayHello", test.contentType, test.encode(grpcTestMessage), nil)
+			defer rsp.Body.Close()
+
+			b, err := io.ReadAll(rsp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ct := rsp.Header.Get("Content-Type"); ct != test.contentType {
+				t.Errorf("expected %s, got: %s", test.contentType, ct)
+			}
+
+			if len(rsp.Trailer) != 0 {
+				t.Errorf("unexpected trailers: %v", rsp.Trailer)
+			}
+
+			if d := test.decode(b); !bytes.Equal(d, expected) {
+				t.Errorf("expected %q, got: %q", expected, d)
+			}
+		})
+	}
+
+	t.Run("error", func(t *testing.T) {
+		rsp := grpcRequest(t, ps.URL+"/web/helloworld.Greeter/Slow", "application/grpc-web-text", nil, http.Header{"Grpc-Timeout": []string{"1m"}})
+		defer rsp.Body.Close()
+
+		if ct := rsp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/grpc-web-text") {
+			t.Errorf("expected gRPC-Web content type, got: %s", ct)
+		}
+
+		if s := rsp.Header.Get("Grpc-Status"); s != "4" {
+			t.Errorf("expected grpc-status 4, got: %q", s)
+		}
+	})
+
+	t.Run("CORS preflight", func(t *testing.T) {
+		req, err := http.NewRequest("OPTIONS", ps.URL+"/web/helloworld.Greeter/Slow", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Origin", "https://www.example.org")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK {
+			t.Errorf("expected status 200, got: %d", rsp.StatusCode)
+		}
+
+		if ct := rsp.Header.Get("Content-Type"); strings.HasPrefix(ct, "application/grpc") {
+			t.Errorf("unexpected gRPC content type: %s", ct)
+		}
+
+		if s := rsp.Header.Get("Grpc-Status"); s != "" {
+			t.Errorf("unexpected grpc-status: %q", s)
+		}
+	})
+}
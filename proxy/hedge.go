@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/hedge"
+	"github.com/zalando/skipper/filters/requestbody"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/tracing"
+)
+
+type hedgeResult struct {
+	response *http.Response
+	err      error
+	cancel   stdlibcontext.CancelFunc
+	hedge    int
+}
+
+func hedgeSucceeded(r hedgeResult) bool {
+	return r.err == nil && r.response.StatusCode < http.StatusInternalServerError
+}
+
+// nextHedgeEndpoint returns an endpoint of the route that was not used yet,
+// chosen by the load balancer algorithm when possible.
+func nextHedgeEndpoint(ctx *context, used map[string]struct{}) (routing.LBEndpoint, bool) {
+	rt := ctx.route
+	e := rt.LBAlgorithm.Apply(&routing.LBContext{Request: ctx.request, Route: rt, Params: ctx.StateBag()})
+	if _, ok := used[e.Host]; ok {
+		e = untriedEndpoint(rt.LBEndpoints, e, used)
+		if _, ok := used[e.Host]; ok {
+			return routing.LBEndpoint{}, false
+		}
+	}
+
+	used[e.Host] = struct{}{}
+	return e, true
+}
+
+// roundTrip makes the backend roundtrip, and hedges it according to the
+// policy set by the hedge filter, if any.
+func (p *Proxy) roundTrip(ctx *context, roundTripper http.RoundTripper, req *http.Request, endpoint *routing.LBEndpoint) (*http.Response, error) {
+	policy, ok := ctx.StateBag()[filters.BackendHedge].(*hedge.Policy)
+	if !ok ||
+		ctx.route.BackendType != eskip.LBBackend ||
+		len(ctx.route.LBEndpoints) < 2 ||
+		(req.URL.Scheme != "http" && req.URL.Scheme != "https") ||
+		!policy.HedgeRequest(req) {
+		start := time.Now()
+		rsp, err := roundTripper.RoundTrip(req)
+		p.reportEndpoint(ctx, endpoint, req, rsp, err, start)
+		return rsp, err
+	}
+
+	end := policy.Begin()
+	defer end()
+
+	used := map[string]struct{}{req.URL.Host: {}}
+	for host := range ctx.triedEndpoints {
+		used[host] = struct{}{}
+	}
+
+	results := make(chan hedgeResult, policy.MaxHedges+1)
+	var cancels []stdlibcontext.CancelFunc
+	send := func(r *http.Request, e *routing.LBEndpoint, release func()) {
+		attemptContext, cancel := stdlibcontext.WithCancel(r.Context())
+		r = r.WithContext(attemptContext)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			if release != nil {
+				defer release()
+			}
+
+			start := time.Now()
+			rsp, err := roundTripper.RoundTrip(r)
+			p.reportEndpoint(ctx, e, r, rsp, err, start)
+			results <- hedgeResult{response: rsp, err: err, cancel: cancel, hedge: index}
+		}()
+	}
+
+	send(req, endpoint, nil)
+	pending, hedges := 1, 0
+
+	timer := time.NewTimer(policy.Delay)
+	defer timer.Stop()
+
+	routeID := ctx.route.Id
+	var failed *hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			release, ok := policy.AcquireHedge()
+			if !ok {
+				p.metrics.IncCounter("hedge.budgetexceeded." + routeID)
+				continue
+			}
+
+			e, ok := nextHedgeEndpoint(ctx, used)
+			if !ok {
+				release()
+				continue
+			}
+
+			hedges++
+			hr := req.Clone(req.Context())
+			hr.URL.Scheme = e.Scheme
+			hr.URL.Host = e.Host
+			e.Metrics.IncInflightRequest()
+			send(hr, &e, func() {
+				e.Metrics.DecInflightRequest()
+				release()
+			})
+			pending++
+
+			p.metrics.IncCounter("hedge.issued." + routeID)
+			tracing.LogKV("hedge", e.Host, ctx.request.Context())
+
+			if hedges < policy.MaxHedges {
+				timer.Reset(policy.Delay)
+			}
+		case r := <-results:
+			pending--
+			if !hedgeSucceeded(r) && pending > 0 {
+				if failed != nil {
+					failed.cancel()
+					discardResponse(failed.response)
+				}
+
+				failed = &r
+				continue
+			}
+
+			if failed != nil {
+				failed.cancel()
+				discardResponse(failed.response)
+			}
+
+			for i, cancel := range cancels {
+				if i != r.hedge {
+					cancel()
+				}
+			}
+
+			go discardHedges(results, pending)
+
+			if r.err != nil {
+				r.cancel()
+				return nil, r.err
+			}
+
+			if r.hedge > 0 {
+				p.metrics.IncCounter("hedge.won." + routeID)
+				p.tracing.setTag(ctx.proxySpan, HedgeWonTag, r.hedge)
+			}
+
+			// the winning request context is needed until the response is streamed
+			cancelBackendContext := ctx.cancelBackendContext
+			ctx.cancelBackendContext = func() {
+				r.cancel()
+				if cancelBackendContext != nil {
+					cancelBackendContext()
+				}
+			}
+
+			return r.response, nil
+		}
+	}
+}
+
+// reportEndpoint records the latency of a request to a load balanced
+// endpoint, and reports its result to the outlier detector. Requests
+// canceled by the proxy are not reported.
+func (p *Proxy) reportEndpoint(ctx *context, endpoint *routing.LBEndpoint, req *http.Request, rsp *http.Response, err error, start time.Time) {
+	if endpoint == nil || errors.Is(req.Context().Err(), stdlibcontext.Canceled) || errors.Is(err, ErrBlocked) || errors.Is(err, requestbody.ErrTooLarge) {
+		return
+	}
+
+	if endpoint.Metrics != nil {
+		now := time.Now()
+		endpoint.Metrics.ObserveLatency(now, now.Sub(start))
+	}
+
+	if p.outliers != nil {
+		p.outliers.Report(ctx.route, *endpoint, err != nil || rsp.StatusCode >= http.StatusInternalServerError)
+	}
+}
+
+// discardHedges discards the responses of the canceled requests that did not
+// win.
+func discardHedges(results <-chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		discardResponse((<-results).response)
+	}
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeSlowEndpoint(t *testing.T) {
+	var slowCanceled atomic.Int64
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+			slowCanceled.Add(1)
+		}
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`r: * -> hedge("20ms", 1) -> <roundRobin, "%s", "%s">`, slow.URL, fast.URL))
+
+	const requests = 4
+	for i := 0; i < requests; i++ {
+		start := time.Now()
+		rsp, err := ps.Client().Get(ps.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200, got: %d", rsp.StatusCode)
+		}
+
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Errorf("request was not hedged, took: %v", d)
+		}
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		issued, won := counters["hedge.issued.r"], counters["hedge.won.r"]
+		if issued < requests/2 || won < requests/2 || won > issued {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	if slowCanceled.Load() < requests/2 {
+		t.Errorf("slow requests were not canceled: %d", slowCanceled.Load())
+	}
+}
+
+func TestHedgeNotIdempotent(t *testing.T) {
+	var requests atomic.Int64
+	backend := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			time.Sleep(50 * time.Millisecond)
+		}))
+	}
+
+	b1, b2 := backend(), backend()
+	defer b1.Close()
+	defer b2.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`r: * -> hedge("10ms", 1) -> <"%s", "%s">`, b1.URL, b2.URL))
+
+	rsp, err := ps.Client().Post(ps.URL, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected 1 backend request, got: %d", n)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["hedge.issued.r"] != 0 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestHedgeFailedFirstResponse(t *testing.T) {
+	// the original requests fail after the hedge was sent, and the hedged
+	// requests succeed later
+	var requests atomic.Int64
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%2 == 1 {
+			time.Sleep(30 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		time.Sleep(40 * time.Millisecond)
+	})
+
+	b1, b2 := httptest.NewServer(handler), httptest.NewServer(handler)
+	defer b1.Close()
+	defer b2.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`r: * -> hedge("10ms", 1) -> <roundRobin, "%s", "%s">`, b1.URL, b2.URL))
+
+	for i := 0; i < 4; i++ {
+		rsp, err := ps.Client().Get(ps.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200, got: %d", rsp.StatusCode)
+		}
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["hedge.issued.r"] != 4 || counters["hedge.won.r"] != 4 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
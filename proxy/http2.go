@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// Backend protocols, set by the backendProtocol filter. Without the
+// filter, and with http1, the default transport is used.
+const (
+	backendProtocolH2  = "h2"
+	backendProtocolH2C = "h2c"
+)
+
+// Health checks of the HTTP/2 backend connections. When no frame is
+// received on a connection for h2ReadIdleTimeout, a ping is sent, and when
+// it is not answered within h2PingTimeout, the connection is closed.
+const (
+	h2ReadIdleTimeout = 30 * time.Second
+	h2PingTimeout     = 15 * time.Second
+)
+
+// newHTTP2Transport creates an HTTP/2 transport with the parameters of the
+// HTTP/1 transport that apply to HTTP/2: the response header timeout, the
+// expect continue timeout, the idle connection timeout and the disabled
+// keepalives. MaxIdleConns and IdleConnectionsPerHost don't apply, because
+// the requests to a backend are multiplexed on a single connection, and
+// the backend proxies are not supported.
+func newHTTP2Transport(p Params) *http2.Transport {
+	t1 := &http.Transport{
+		ResponseHeaderTimeout: p.ResponseHeaderTimeout,
+		ExpectContinueTimeout: p.ExpectContinueTimeout,
+		IdleConnTimeout:       p.CloseIdleConnsPeriod,
+		DisableKeepAlives:     p.DisableHTTPKeepalives,
+	}
+
+	// fails only when t1 was configured for HTTP/2 before
+	t2, _ := http2.ConfigureTransports(t1)
+
+	// t1 is used only for its settings, the connections are dialed by
+	// the HTTP/2 transport with the default connection pool
+	t2.ConnPool = nil
+	t2.ReadIdleTimeout = h2ReadIdleTimeout
+	t2.PingTimeout = h2PingTimeout
+	return t2
+}
+
+// newH2Transport creates the transport of the HTTP/2 backends over TLS.
+// The connections are established with the same dialer as the HTTP/1
+// connections, and ALPN must select h2 during the TLS handshake.
+func newH2Transport(dialer *skipperDialer, p Params) *http2.Transport {
+	t := newHTTP2Transport(p)
+	t.DialTLSContext = func(ctx stdlibcontext.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.TLSHandshakeTimeout > 0 {
+			var cancel stdlibcontext.CancelFunc
+			ctx, cancel = stdlibcontext.WithTimeout(ctx, p.TLSHandshakeTimeout)
+			defer cancel()
+		}
+
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		if proto := tlsConn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+			conn.Close()
+			return nil, fmt.Errorf("backend %s does not support HTTP/2, negotiated protocol: %q", addr, proto)
+		}
+
+		return tlsConn, nil
+	}
+
+	return t
+}
+
+// newH2CTransport creates the transport of the HTTP/2 backends without
+// TLS, connecting with prior knowledge.
+func newH2CTransport(dialer *skipperDialer, p Params) *http2.Transport {
+	t := newHTTP2Transport(p)
+	t.AllowHTTP = true
+	t.DialTLSContext = func(ctx stdlibcontext.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	return t
+}
+
+// backendProtocolRoundTripper returns the round tripper of the protocol
+// selected by the backendProtocol filter, or the default round tripper.
+func (p *Proxy) backendProtocolRoundTripper(ctx *context, req *http.Request) (http.RoundTripper, error) {
+	protocol, _ := ctx.StateBag()[filters.BackendProtocol].(string)
+	if _, isProxy := ctx.StateBag()[filters.BackendIsProxyKey]; isProxy && (protocol == backendProtocolH2 || protocol == backendProtocolH2C) {
+		return nil, fmt.Errorf("backend protocol %s is not supported with backend proxies", protocol)
+	}
+
+	switch protocol {
+	case backendProtocolH2:
+		if req.URL.Scheme != "https" {
+			return nil, fmt.Errorf("backend protocol h2 requires an https backend, got: %s", req.URL.Scheme)
+		}
+
+		return p.h2RoundTripper, nil
+	case backendProtocolH2C:
+		if req.URL.Scheme != "http" {
+			return nil, fmt.Errorf("backend protocol h2c requires an http backend, got: %s", req.URL.Scheme)
+		}
+
+		return p.h2cRoundTripper, nil
+	default:
+		return p.roundTripper, nil
+	}
+}
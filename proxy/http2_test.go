@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func protoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+}
+
+func TestBackendProtocol(t *testing.T) {
+	h2cBackend := httptest.NewServer(h2c.NewHandler(protoHandler(), &http2.Server{}))
+	defer h2cBackend.Close()
+
+	h2Backend := httptest.NewUnstartedServer(protoHandler())
+	h2Backend.EnableHTTP2 = true
+	h2Backend.StartTLS()
+	defer h2Backend.Close()
+
+	tp, err := newTestProxyWithFiltersAndParams(nil, fmt.Sprintf(`
+		default: Path("/default") -> "%s";
+		http1: Path("/http1") -> backendProtocol("http1") -> "%s";
+		h2c: Path("/h2c") -> backendProtocol("h2c") -> "%s";
+		h2cLB: Path("/h2c-lb") -> backendProtocol("h2c") -> <roundRobin, "%s">;
+		h2cProxy: Path("/h2c-proxy") -> backendIsProxy() -> backendProtocol("h2c") -> "%s";
+		h2: Path("/h2") -> backendProtocol("h2") -> "%s";
+		h2Default: Path("/h2-default") -> "%s";
+		h2Mismatch: Path("/h2-mismatch") -> backendProtocol("h2") -> "%s";
+	`,
+		h2cBackend.URL,
+		h2cBackend.URL,
+		h2cBackend.URL,
+		h2cBackend.URL,
+		h2cBackend.URL,
+		h2Backend.URL,
+		h2Backend.URL,
+		h2cBackend.URL,
+	), Params{Flags: Insecure}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+	defer tp.proxy.h2RoundTripper.(*http2.Transport).CloseIdleConnections()
+	defer tp.proxy.h2cRoundTripper.(*http2.Transport).CloseIdleConnections()
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	for _, test := range []struct {
+		path           string
+		expectedStatus int
+		expectedProto  string
+	}{
+		{path: "/default", expectedStatus: http.StatusOK, expectedProto: "HTTP/1.1"},
+		{path: "/http1", expectedStatus: http.StatusOK, expectedProto: "HTTP/1.1"},
+		{path: "/h2c", expectedStatus: http.StatusOK, expectedProto: "HTTP/2.0"},
+		{path: "/h2c-lb", expectedStatus: http.StatusOK, expectedProto: "HTTP/2.0"},
+		{path: "/h2c-proxy", expectedStatus: http.StatusBadGateway},
+		{path: "/h2", expectedStatus: http.StatusOK, expectedProto: "HTTP/2.0"},
+		{path: "/h2-default", expectedStatus: http.StatusOK, expectedProto: "HTTP/1.1"},
+		{path: "/h2-mismatch", expectedStatus: http.StatusBadGateway},
+	} {
+		t.Run(test.path, func(t *testing.T) {
+			rsp, err := http.Get(ps.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rsp.Body.Close()
+
+			b, _ := io.ReadAll(rsp.Body)
+			if rsp.StatusCode != test.expectedStatus {
+				t.Fatalf("expected status %d, got: %d", test.expectedStatus, rsp.StatusCode)
+			}
+
+			if test.expectedProto != "" && string(b) != test.expectedProto {
+				t.Errorf("expected protocol %s, got: %s", test.expectedProto, b)
+			}
+		})
+	}
+}
+
+func TestBackendProtocolResponseHeaderTimeout(t *testing.T) {
+	backend := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}), &http2.Server{}))
+	defer backend.Close()
+
+	tp, err := newTestProxyWithFiltersAndParams(nil, fmt.Sprintf(`* -> backendProtocol("h2c") -> "%s"`, backend.URL), Params{ResponseHeaderTimeout: 20 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+	defer tp.proxy.h2cRoundTripper.(*http2.Transport).CloseIdleConnections()
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	rsp, err := http.Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected the response header timeout, got: %d", rsp.StatusCode)
+	}
+}
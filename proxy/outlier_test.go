@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/loadbalancer"
+	"github.com/zalando/skipper/logging/loggingtest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/routing/testdataclient"
+)
+
+func TestOutlierDetectionEjectsFailingEndpoint(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	detector := loadbalancer.NewOutlierDetector(loadbalancer.OutlierDetectionOptions{ConsecutiveErrors: 2, MaxEjectionPercent: 50})
+	defer detector.Close()
+
+	dc, err := testdataclient.NewDoc(fmt.Sprintf(`* -> <roundRobin, "%s", "%s">`, failing.URL, healthy.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+
+	tl := loggingtest.New()
+	defer tl.Close()
+
+	rt := routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		DataClients:    []routing.DataClient{dc},
+		PostProcessors: []routing.PostProcessor{loadbalancer.NewAlgorithmProvider(), detector},
+		Log:            tl,
+	})
+	defer rt.Close()
+
+	p := WithParams(Params{Routing: rt, OutlierDetector: detector})
+	defer p.Close()
+
+	if err := tl.WaitFor("route settings applied", time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := httptest.NewServer(p)
+	defer ps.Close()
+
+	var failed int
+	for i := 0; i < 20; i++ {
+		rsp, err := ps.Client().Get(ps.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK {
+			failed++
+		}
+	}
+
+	if failed != 2 {
+		t.Errorf("expected 2 failed requests before the ejection, got: %d", failed)
+	}
+}
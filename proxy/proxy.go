@@ -30,17 +30,22 @@ import (
 	al "github.com/zalando/skipper/filters/accesslog"
 	circuitfilters "github.com/zalando/skipper/filters/circuit"
 	flowidFilter "github.com/zalando/skipper/filters/flowid"
+	"github.com/zalando/skipper/filters/grpc"
 	filterslog "github.com/zalando/skipper/filters/log"
 	ratelimitfilters "github.com/zalando/skipper/filters/ratelimit"
+	"github.com/zalando/skipper/filters/requestbody"
+	"github.com/zalando/skipper/filters/stickysession"
 	tracingfilter "github.com/zalando/skipper/filters/tracing"
 	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/logging"
 	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/proxy/fastcgi"
+	"github.com/zalando/skipper/proxyprotocol"
 	"github.com/zalando/skipper/ratelimit"
 	"github.com/zalando/skipper/rfc"
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/scheduler"
+	"github.com/zalando/skipper/tlsfingerprint"
 	"github.com/zalando/skipper/tracing"
 )
 
@@ -50,6 +55,8 @@ const (
 	unknownRouteBackendType = "<unknown>"
 	unknownRouteBackend     = "<unknown>"
 
+	forwardedClientCertHeader = "X-Forwarded-Client-Cert"
+
 	// Number of loops allowed by default.
 	DefaultMaxLoopbacks = 9
 
@@ -174,6 +181,16 @@ type Params struct {
 	// for a request.
 	DefaultHTTPStatus int
 
+	// MaxRequestBodyBytes limits the size of the request bodies of the
+	// routes without the maxRequestBody filter. The requests exceeding it
+	// are rejected with 413. Zero means no limit.
+	MaxRequestBodyBytes int64
+
+	// RequestBodyBufferMemoryBytes is the size, above which the request
+	// bodies buffered for the filters are stored in temporary files. The
+	// default is 1MiB.
+	RequestBodyBufferMemoryBytes int64
+
 	// MaxLoopbacks sets the maximum number of allowed loops. If 0
 	// the default (9) is applied. To disable looping, set it to
 	// -1. Note, that disabling looping by this option, may result
@@ -206,6 +223,16 @@ type Params struct {
 	// LoadBalancer to report unhealthy or dead backends to
 	LoadBalancer *loadbalancer.LB
 
+	// OutlierDetector to report the results of the requests to the
+	// load balanced endpoints to. If not set, no passive outlier
+	// detection is done.
+	OutlierDetector *loadbalancer.OutlierDetector
+
+	// ActiveHealthChecker tells which endpoints pass their active health
+	// checks. It is used by the sticky sessions to avoid the unhealthy
+	// endpoints.
+	ActiveHealthChecker *loadbalancer.ActiveHealthChecker
+
 	// Defines the time period of how often the idle connections are
 	// forcibly closed. The default is 12 seconds. When set to less than
 	// 0, the proxy doesn't force closing the idle connections.
@@ -235,6 +262,13 @@ type Params struct {
 	// Client TLS to connect to Backends
 	ClientTLS *tls.Config
 
+	// RemoveForwardedClientCert removes the X-Forwarded-Client-Cert
+	// header from the incoming requests, so that the backends receive
+	// it only when it was set by the forwardClientCert filter from a
+	// verified client certificate. Skipper sets it, when the TLS client
+	// authentication is enabled.
+	RemoveForwardedClientCert bool
+
 	// OpenTracing contains parameters related to OpenTracing instrumentation. For default values
 	// check OpenTracingParams
 	OpenTracing *OpenTracingParams
@@ -321,9 +355,13 @@ type Proxy struct {
 	experimentalUpgradeAudit bool
 	accessLogDisabled        bool
 	maxLoops                 int
+	maxRequestBodyBytes      int64
+	requestBodyMemoryBytes   int64
 	defaultHTTPStatus        int
 	routing                  *routing.Routing
 	roundTripper             http.RoundTripper
+	h2RoundTripper           http.RoundTripper
+	h2cRoundTripper          http.RoundTripper
 	priorityRoutes           []PriorityRoute
 	flags                    Flags
 	metrics                  metrics.Metrics
@@ -334,10 +372,13 @@ type Proxy struct {
 	log                      logging.Logger
 	tracing                  *proxyTracing
 	lb                       *loadbalancer.LB
+	outliers                 *loadbalancer.OutlierDetector
+	healthChecker            *loadbalancer.ActiveHealthChecker
 	upgradeAuditLogOut       io.Writer
 	upgradeAuditLogErr       io.Writer
 	auditLogHook             chan struct{}
 	clientTLS                *tls.Config
+	removeClientCertHeader   bool
 	hostname                 string
 	onPanicSometimes         rate.Sometimes
 }
@@ -462,8 +503,16 @@ func setRequestURLForDynamicBackend(u *url.URL, stateBag map[string]interface{})
 	}
 }
 
-func setRequestURLForLoadBalancedBackend(u *url.URL, rt *routing.Route, lbctx *routing.LBContext) *routing.LBEndpoint {
+func setRequestURLForLoadBalancedBackend(u *url.URL, rt *routing.Route, lbctx *routing.LBContext, tried map[string]struct{}) *routing.LBEndpoint {
 	e := rt.LBAlgorithm.Apply(lbctx)
+	if tried != nil {
+		if _, ok := tried[e.Host]; ok {
+			e = untriedEndpoint(rt.LBEndpoints, e, tried)
+		}
+
+		tried[e.Host] = struct{}{}
+	}
+
 	u.Scheme = e.Scheme
 	u.Host = e.Host
 	return &e
@@ -484,7 +533,12 @@ func mapRequest(ctx *context, requestContext stdlibcontext.Context, removeHopHea
 		setRequestURLFromRequest(u, r)
 		setRequestURLForDynamicBackend(u, stateBag)
 	case eskip.LBBackend:
-		endpoint = setRequestURLForLoadBalancedBackend(u, rt, &routing.LBContext{Request: r, Route: rt, Params: stateBag})
+		lbctx := &routing.LBContext{Request: r, Route: rt, Params: stateBag}
+		if session, ok := stateBag[filters.BackendStickySession].(*stickysession.Session); ok {
+			endpoint = ctx.proxy.setRequestURLForStickySession(u, lbctx, ctx.triedEndpoints, session)
+		} else {
+			endpoint = setRequestURLForLoadBalancedBackend(u, rt, lbctx, ctx.triedEndpoints)
+		}
 	default:
 		u.Scheme = rt.Scheme
 		u.Host = rt.Host
@@ -630,12 +684,14 @@ func WithParams(p Params) *Proxy {
 		}
 	}
 
+	dialer := newSkipperDialer(net.Dialer{
+		Timeout:   p.Timeout,
+		KeepAlive: p.KeepAlive,
+		DualStack: p.DualStack,
+	})
+
 	tr := &http.Transport{
-		DialContext: newSkipperDialer(net.Dialer{
-			Timeout:   p.Timeout,
-			KeepAlive: p.KeepAlive,
-			DualStack: p.DualStack,
-		}).DialContext,
+		DialContext:           dialer.DialContext,
 		TLSHandshakeTimeout:   p.TLSHandshakeTimeout,
 		ResponseHeaderTimeout: p.ResponseHeaderTimeout,
 		ExpectContinueTimeout: p.ExpectContinueTimeout,
@@ -646,6 +702,9 @@ func WithParams(p Params) *Proxy {
 		Proxy:                 proxyFromContext,
 	}
 
+	h2 := newH2Transport(dialer, p)
+	h2c := newH2CTransport(dialer, p)
+
 	quit := make(chan struct{})
 	// We need this to reliably fade on DNS change, which is right
 	// now not fixed with IdleConnTimeout in the http.Transport.
@@ -658,6 +717,8 @@ func WithParams(p Params) *Proxy {
 				select {
 				case <-ticker.C:
 					tr.CloseIdleConnections()
+					h2.CloseIdleConnections()
+					h2c.CloseIdleConnections()
 				case <-quit:
 					return
 				}
@@ -679,6 +740,8 @@ func WithParams(p Params) *Proxy {
 		}
 	}
 
+	h2.TLSClientConfig = tr.TLSClientConfig
+
 	m := metrics.Default
 	if p.Flags.Debug() {
 		m = metrics.Void
@@ -690,6 +753,10 @@ func WithParams(p Params) *Proxy {
 		p.MaxLoopbacks = 0
 	}
 
+	if p.RequestBodyBufferMemoryBytes <= 0 {
+		p.RequestBodyBufferMemoryBytes = DefaultRequestBodyBufferMemoryBytes
+	}
+
 	defaultHTTPStatus := http.StatusNotFound
 
 	if p.DefaultHTTPStatus >= http.StatusContinue && p.DefaultHTTPStatus <= http.StatusNetworkAuthenticationRequired {
@@ -701,6 +768,8 @@ func WithParams(p Params) *Proxy {
 	return &Proxy{
 		routing:                  p.Routing,
 		roundTripper:             p.CustomHttpRoundTripperWrap(tr),
+		h2RoundTripper:           p.CustomHttpRoundTripperWrap(h2),
+		h2cRoundTripper:          p.CustomHttpRoundTripperWrap(h2c),
 		priorityRoutes:           p.PriorityRoutes,
 		flags:                    p.Flags,
 		metrics:                  m,
@@ -709,8 +778,12 @@ func WithParams(p Params) *Proxy {
 		experimentalUpgrade:      p.ExperimentalUpgrade,
 		experimentalUpgradeAudit: p.ExperimentalUpgradeAudit,
 		maxLoops:                 p.MaxLoopbacks,
+		maxRequestBodyBytes:      p.MaxRequestBodyBytes,
+		requestBodyMemoryBytes:   p.RequestBodyBufferMemoryBytes,
 		breakers:                 p.CircuitBreakers,
 		lb:                       p.LoadBalancer,
+		outliers:                 p.OutlierDetector,
+		healthChecker:            p.ActiveHealthChecker,
 		limiters:                 p.RateLimiters,
 		log:                      &logging.DefaultLog{},
 		defaultHTTPStatus:        defaultHTTPStatus,
@@ -719,6 +792,7 @@ func WithParams(p Params) *Proxy {
 		upgradeAuditLogOut:       os.Stdout,
 		upgradeAuditLogErr:       os.Stderr,
 		clientTLS:                tr.TLSClientConfig,
+		removeClientCertHeader:   p.RemoveForwardedClientCert,
 		hostname:                 hostname,
 		onPanicSometimes:         rate.Sometimes{First: 3, Interval: 1 * time.Minute},
 	}
@@ -808,6 +882,7 @@ func (p *Proxy) makeUpgradeRequest(ctx *context, req *http.Request) error {
 		auditLogOut:     p.upgradeAuditLogOut,
 		auditLogErr:     p.upgradeAuditLogErr,
 		auditLogHook:    p.auditLogHook,
+		responseHeader:  stickySessionHeader(ctx),
 	}
 
 	upgradeProxy.serveHTTP(ctx.responseWriter, req)
@@ -822,6 +897,11 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 		return nil, &proxyError{err: fmt.Errorf("could not map backend request: %w", err)}
 	}
 
+	if _, ok := grpcContentType(ctx); ok {
+		// required by the gRPC protocol, and removed with the hop headers
+		req.Header.Set("Te", "trailers")
+	}
+
 	if res, ok := p.rejectBackend(ctx, req); ok {
 		return res, nil
 	}
@@ -869,7 +949,7 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 	ctx.proxySpan.LogKV("http_roundtrip", StartEvent)
 	req = injectClientTrace(req, ctx.proxySpan)
 
-	response, err := roundTripper.RoundTrip(req)
+	response, err := p.roundTrip(ctx, roundTripper, req, endpoint)
 
 	ctx.proxySpan.LogKV("http_roundtrip", EndEvent)
 	if err != nil {
@@ -878,6 +958,9 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 			p.tracing.setTag(ctx.proxySpan, HTTPStatusCodeTag, uint16(http.StatusBadRequest))
 			return nil, &proxyError{err: err, code: http.StatusBadRequest}
 		}
+		if errors.Is(err, requestbody.ErrTooLarge) {
+			return nil, errRequestBodyTooLarge
+		}
 		p.tracing.setTag(ctx.proxySpan, ErrorTag, true)
 
 		// Check if the request has been cancelled or timed out
@@ -946,7 +1029,7 @@ func (p *Proxy) getRoundTripper(ctx *context, req *http.Request) (http.RoundTrip
 
 		return rt, nil
 	default:
-		return p.roundTripper, nil
+		return p.backendProtocolRoundTripper(ctx, req)
 	}
 }
 
@@ -1076,6 +1159,10 @@ func (p *Proxy) do(ctx *context) (err error) {
 	}
 
 	ctx.applyRoute(route, params, p.flags.PreserveHost())
+	if ctx.executionCounter == 1 && !p.limitRequestBody(ctx) {
+		p.makeErrorResponse(ctx, errRequestBodyTooLarge)
+		return errRequestBodyTooLarge
+	}
 
 	processedFilters := p.applyFiltersToRequest(ctx.route.Filters, ctx)
 
@@ -1125,8 +1212,8 @@ func (p *Proxy) do(ctx *context) (err error) {
 		}
 
 		backendContext := ctx.request.Context()
-		if timeout, ok := ctx.StateBag()[filters.BackendTimeout]; ok {
-			backendContext, ctx.cancelBackendContext = stdlibcontext.WithTimeout(backendContext, timeout.(time.Duration))
+		if timeout, ok := backendTimeout(ctx); ok {
+			backendContext, ctx.cancelBackendContext = stdlibcontext.WithTimeout(backendContext, timeout)
 		}
 
 		backendStart := time.Now()
@@ -1136,7 +1223,36 @@ func (p *Proxy) do(ctx *context) (err error) {
 				ctx.Logger().Errorf("Failed to set read deadline: %v", e)
 			}
 		}
-		rsp, perr := p.makeBackendRequest(ctx, backendContext)
+
+		fallbackRequest, perr := p.prepareFallback(ctx)
+		if perr != nil {
+			p.makeErrorResponse(ctx, perr)
+			p.applyFiltersOnError(ctx, processedFilters)
+			return perr
+		}
+
+		rsp, perr := p.makeBackendRequestWithRetries(ctx, backendContext)
+		if reason := p.fallbackReason(ctx, fallbackRequest, rsp, perr); reason != "" {
+			if done != nil {
+				done(false)
+			}
+
+			if perr != nil {
+				p.metrics.IncErrorsBackend(ctx.route.Id)
+			} else if rsp.StatusCode >= http.StatusInternalServerError {
+				p.metrics.MeasureBackend5xx(backendStart)
+			}
+
+			if err := p.doFallback(ctx, fallbackRequest, reason, rsp); err != nil {
+				p.applyFiltersOnError(ctx, processedFilters)
+				return err
+			}
+
+			addBranding(ctx.response.Header)
+			p.applyFiltersToResponse(processedFilters, ctx)
+			return nil
+		}
+
 		if perr != nil {
 			if done != nil {
 				done(false)
@@ -1190,6 +1306,11 @@ func (p *Proxy) do(ctx *context) (err error) {
 }
 
 func retryable(ctx *context, perr *proxyError) bool {
+	if _, ok := ctx.StateBag()[filters.BackendRetry]; ok {
+		// already retried according to the route's retry policy
+		return false
+	}
+
 	req := ctx.Request()
 	return perr.code != 499 && perr.DialError() &&
 		ctx.route.BackendType == eskip.LBBackend &&
@@ -1208,6 +1329,14 @@ func (p *Proxy) serveResponse(ctx *context) {
 		return
 	}
 
+	grpcType, isGRPC := grpcContentType(ctx)
+	if isGRPC && !grpc.IsGRPC(ctx.response.Header.Get("Content-Type")) {
+		setGRPCErrorResponse(ctx, grpcType)
+	} else if isGRPC {
+		// HTTP/1 clients can receive the trailers only with chunked encoding
+		ctx.response.Header.Del("Content-Length")
+	}
+
 	start := time.Now()
 	p.tracing.logStreamEvent(ctx.proxySpan, StreamHeadersEvent, StartEvent)
 	copyHeader(ctx.responseWriter.Header(), ctx.response.Header)
@@ -1235,9 +1364,45 @@ func (p *Proxy) serveResponse(ctx *context) {
 		p.tracing.setTag(ctx.proxySpan, StreamBodyEvent, StreamBodyError)
 		p.tracing.logStreamEvent(ctx.proxySpan, StreamBodyEvent, fmt.Sprintf("Failed to stream response: %v", err))
 	} else {
+		if isGRPC {
+			copyTrailers(ctx.responseWriter, ctx.response)
+		}
+
 		p.metrics.MeasureResponse(ctx.response.StatusCode, ctx.request.Method, ctx.route.Id, start)
 	}
 	p.metrics.MeasureServe(ctx.route.Id, ctx.metricsHost(), ctx.request.Method, ctx.response.StatusCode, ctx.startServe)
+
+	if isGRPC {
+		p.measureGRPC(ctx)
+	}
+}
+
+// connectionLogData adds the details of the client connection to the
+// additional data of the access log: the ID of the AWS VPC endpoint, when
+// the connection was received with the PROXY protocol, and the TLS
+// fingerprints of the client.
+func connectionLogData(ctx *context, data map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if h, ok := proxyprotocol.FromContext(ctx.request.Context()); ok {
+		if id := h.AWSVPCEndpointID(); id != "" {
+			fields["vpce-id"] = id
+		}
+	}
+
+	if fp, ok := ctx.stateBag[filters.TLSFingerprint].(*tlsfingerprint.Fingerprint); ok {
+		fields["ja3"] = fp.JA3
+		fields["ja4"] = fp.JA4
+	}
+
+	if len(fields) == 0 {
+		return data
+	}
+
+	for k, v := range data {
+		fields[k] = v
+	}
+
+	return fields
 }
 
 func (p *Proxy) errorResponse(ctx *context, err error) {
@@ -1318,6 +1483,11 @@ func (p *Proxy) errorResponse(ctx *context, err error) {
 		)
 	}
 
+	grpcType, isGRPC := grpcContentType(ctx)
+	if isGRPC {
+		setGRPCErrorResponse(ctx, grpcType)
+	}
+
 	copyHeader(ctx.responseWriter.Header(), ctx.response.Header)
 	ctx.responseWriter.WriteHeader(ctx.response.StatusCode)
 	ctx.responseWriter.Flush()
@@ -1330,6 +1500,10 @@ func (p *Proxy) errorResponse(ctx *context, err error) {
 		ctx.response.StatusCode,
 		ctx.startServe,
 	)
+
+	if isGRPC {
+		p.measureGRPC(ctx)
+	}
 }
 
 // strip port from addresses with hostname, ipv4 or ipv6
@@ -1423,6 +1597,7 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 
 			additionalData, _ := ctx.stateBag[al.AccessLogAdditionalDataKey].(map[string]interface{})
+			additionalData = connectionLogData(ctx, additionalData)
 
 			logging.LogAccess(entry, additionalData)
 		}
@@ -1437,6 +1612,10 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r.URL.Path = rfc.PatchPath(r.URL.Path, r.URL.RawPath)
 	}
 
+	if p.removeClientCertHeader {
+		r.Header.Del(forwardedClientCertHeader)
+	}
+
 	p.tracing.
 		setTag(span, SpanKindTag, SpanKindServer).
 		setTag(span, HTTPRemoteIPTag, stripPort(r.RemoteAddr))
@@ -1448,6 +1627,7 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx.startServe = time.Now()
 	ctx.tracer = p.tracing.tracer
 	ctx.initialSpan = span
+	defer ctx.requestBodyBuffer.release()
 
 	defer func() {
 		if ctx.response != nil && ctx.response.Body != nil {
@@ -1459,6 +1639,9 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	err := p.do(ctx)
+	if ctx.route != nil && requestbody.Exceeded(ctx) {
+		p.metrics.IncCounter("requestbody.exceeded." + ctx.route.Id)
+	}
 
 	if d, ok := ctx.StateBag()[filters.WriteTimeout].(time.Duration); ok {
 		e := ctx.ResponseController().SetWriteDeadline(time.Now().Add(d))
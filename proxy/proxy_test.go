@@ -35,6 +35,7 @@ import (
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/routing/testdataclient"
 
+	fallbackPredicate "github.com/zalando/skipper/predicates/fallback"
 	teePredicate "github.com/zalando/skipper/predicates/tee"
 )
 
@@ -214,7 +215,7 @@ func newTestProxyWithFiltersAndParams(fr filters.Registry, doc string, params Pa
 		DataClients:    []routing.DataClient{dc},
 		PostProcessors: []routing.PostProcessor{loadbalancer.NewAlgorithmProvider()},
 		Log:            tl,
-		Predicates:     []routing.PredicateSpec{teePredicate.New()},
+		Predicates:     []routing.PredicateSpec{teePredicate.New(), fallbackPredicate.New()},
 	}
 	if len(preprocs) > 0 {
 		opts.PreProcessors = preprocs
@@ -2153,6 +2154,42 @@ func TestHopHeaderRemovalDisabled(t *testing.T) {
 	}
 }
 
+func TestRemoveForwardedClientCert(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		remove   bool
+		expected string
+	}{
+		{title: "client authentication disabled", expected: "Hash=foo"},
+		{title: "client authentication enabled", remove: true},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			s := startTestServer(nil, 0, func(r *http.Request) {
+				if got := r.Header.Get("X-Forwarded-Client-Cert"); got != test.expected {
+					t.Errorf("expected %q, got: %q", test.expected, got)
+				}
+			})
+			defer s.Close()
+
+			doc := fmt.Sprintf(`hello: Path("/hello") -> "%s"`, s.URL)
+			tp, err := newTestProxyWithParams(doc, Params{RemoveForwardedClientCert: test.remove})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tp.close()
+
+			r := httptest.NewRequest("GET", "http://www.example.org/hello", nil)
+			r.Header.Set("X-Forwarded-Client-Cert", "Hash=foo")
+			w := httptest.NewRecorder()
+			tp.proxy.ServeHTTP(w, r)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("unexpected status: %d", w.Code)
+			}
+		})
+	}
+}
+
 func TestUserAgent(t *testing.T) {
 	for _, tc := range []struct {
 		name      string
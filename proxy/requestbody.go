@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/requestbody"
+)
+
+var errRequestBodyTooLarge = &proxyError{err: requestbody.ErrTooLarge, code: http.StatusRequestEntityTooLarge}
+
+// limitRequestBody applies the global request body limit to the routes
+// without their own limit. It returns false, when the Content-Length of the
+// request exceeds the limit.
+func (p *Proxy) limitRequestBody(ctx *context) bool {
+	if p.maxRequestBodyBytes <= 0 {
+		return true
+	}
+
+	for _, f := range ctx.route.Filters {
+		if f.Name == filters.MaxRequestBodyName {
+			return true
+		}
+	}
+
+	return requestbody.Limit(ctx, p.maxRequestBodyBytes)
+}
+
+// bufferError returns the error of buffering the request body, 413 when it
+// exceeded its limit.
+func bufferError(err error) *proxyError {
+	if errors.Is(err, requestbody.ErrTooLarge) {
+		return errRequestBodyTooLarge
+	}
+
+	return &proxyError{err: fmt.Errorf("failed to buffer request body: %w", err), code: http.StatusBadRequest}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+func TestMaxRequestBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer backend.Close()
+
+	tp, err := newTestProxyWithParams(fmt.Sprintf(`
+		global: Path("/global") -> "%s";
+		route: Path("/route") -> maxRequestBody(16) -> "%s";
+	`, backend.URL, backend.URL), Params{MaxRequestBodyBytes: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = m
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	for _, test := range []struct {
+		title    string
+		path     string
+		body     string
+		chunked  bool
+		expected int
+	}{
+		{title: "global limit", path: "/global", body: "12345678", expected: http.StatusOK},
+		{title: "global limit exceeded", path: "/global", body: "123456789", expected: http.StatusRequestEntityTooLarge},
+		{title: "global limit exceeded while streaming", path: "/global", body: "123456789", chunked: true, expected: http.StatusRequestEntityTooLarge},
+		{title: "route limit", path: "/route", body: "123456789", expected: http.StatusOK},
+		{title: "route limit while streaming", path: "/route", body: "123456789", chunked: true, expected: http.StatusOK},
+		{title: "route limit exceeded", path: "/route", body: strings.Repeat("x", 17), expected: http.StatusRequestEntityTooLarge},
+		{title: "route limit exceeded while streaming", path: "/route", body: strings.Repeat("x", 17), chunked: true, expected: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(test.body)
+			if test.chunked {
+				// hides the length of the body
+				body = struct{ io.Reader }{body}
+			}
+
+			rsp, err := ps.Client().Post(ps.URL+test.path, "text/plain", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rsp.Body.Close()
+
+			b, _ := io.ReadAll(rsp.Body)
+			if rsp.StatusCode != test.expected {
+				t.Fatalf("expected %d, got: %d %s", test.expected, rsp.StatusCode, b)
+			}
+
+			if test.expected == http.StatusOK && string(b) != test.body {
+				t.Errorf("unexpected body: %s", b)
+			}
+		})
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["requestbody.exceeded.global"] != 2 || counters["requestbody.exceeded.route"] != 2 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
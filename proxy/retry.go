@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	stdlibcontext "context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/retry"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/tracing"
+)
+
+// maxRetryDrainBytes limits how much of a discarded response body is read,
+// so that its connection can be reused.
+const maxRetryDrainBytes = 64 * 1024
+
+// bufferRequestBody buffers the request body with the filter context, when
+// it is not larger than maxBytes, so that it can be sent again with the
+// readers of the buffer. It returns false when the body is too large, in
+// which case the rest of it is streamed.
+func bufferRequestBody(ctx *context, maxBytes int64) (bool, error) {
+	r := ctx.request
+	if r.ContentLength > maxBytes {
+		return false, nil
+	}
+
+	body, err := ctx.BufferedRequestBody(maxBytes)
+	if errors.Is(err, filters.ErrRequestBodyTooLarge) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if r.ContentLength < 0 {
+		r.ContentLength = body.Size()
+	}
+
+	return true, nil
+}
+
+func isConnectionReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// failureReason returns the condition or the status of the failed backend
+// request, when it is enabled by the matching functions, or an empty string.
+func failureReason(on func(retry.Condition) bool, status func(int) bool, rsp *http.Response, perr *proxyError) string {
+	if perr == nil {
+		if status(rsp.StatusCode) {
+			return strconv.Itoa(rsp.StatusCode)
+		}
+
+		return ""
+	}
+
+	switch {
+	case perr.handled || perr.code == 499:
+		return ""
+	case perr.DialError():
+		if on(retry.ConnectFailure) {
+			return "connect-failure"
+		}
+	case perr.code == http.StatusGatewayTimeout:
+		if on(retry.Timeout) {
+			return "timeout"
+		}
+	case isConnectionReset(perr.err):
+		if on(retry.Reset) {
+			return "reset"
+		}
+	}
+
+	return ""
+}
+
+// retryReason returns why the failed attempt should be retried according to
+// the policy, or an empty string when it should not be.
+func retryReason(policy *retry.Policy, rsp *http.Response, perr *proxyError) string {
+	return failureReason(policy.RetryOn, policy.RetryStatus, rsp, perr)
+}
+
+// untriedEndpoint returns the first endpoint after e that was not tried
+// yet, or e when all of them were.
+func untriedEndpoint(endpoints []routing.LBEndpoint, e routing.LBEndpoint, tried map[string]struct{}) routing.LBEndpoint {
+	start := 0
+	for i, ei := range endpoints {
+		if ei.Host == e.Host {
+			start = i
+			break
+		}
+	}
+
+	for i := 1; i < len(endpoints); i++ {
+		candidate := endpoints[(start+i)%len(endpoints)]
+		if _, ok := tried[candidate.Host]; !ok {
+			return candidate
+		}
+	}
+
+	return e
+}
+
+func discardResponse(rsp *http.Response) {
+	if rsp == nil || rsp.Body == nil {
+		return
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(rsp.Body, maxRetryDrainBytes))
+	rsp.Body.Close()
+}
+
+// makeBackendRequestWithRetries makes the backend request, and retries it
+// according to the policy set by the retry filter, if any.
+func (p *Proxy) makeBackendRequestWithRetries(ctx *context, backendContext stdlibcontext.Context) (*http.Response, *proxyError) {
+	policy, ok := ctx.StateBag()[filters.BackendRetry].(*retry.Policy)
+	if !ok {
+		return p.makeBackendRequest(ctx, backendContext)
+	}
+
+	end := policy.Begin()
+	defer end()
+
+	retryable := policy.Attempts > 1 && policy.RetryMethod(ctx.request.Method)
+
+	if retryable {
+		var err error
+		retryable, err = bufferRequestBody(ctx, policy.MaxBodyBytes)
+		if err != nil {
+			return nil, bufferError(err)
+		}
+	}
+
+	if retryable && !policy.SameEndpoint && ctx.route.BackendType == eskip.LBBackend {
+		ctx.triedEndpoints = make(map[string]struct{})
+		defer func() { ctx.triedEndpoints = nil }()
+	}
+
+	routeID := ctx.route.Id
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if ctx.request.Body != nil {
+				ctx.request.Body.Close()
+			}
+
+			ctx.request.Body = ctx.requestBodyBuffer.reader()
+		}
+
+		attemptContext, cancel := backendContext, stdlibcontext.CancelFunc(nil)
+		if policy.PerTryTimeout > 0 {
+			attemptContext, cancel = stdlibcontext.WithTimeout(backendContext, policy.PerTryTimeout)
+		}
+
+		rsp, perr := p.makeBackendRequest(ctx, attemptContext)
+		if attempt > 1 {
+			p.tracing.setTag(ctx.proxySpan, RetryAttemptTag, attempt)
+		}
+
+		reason := retryReason(policy, rsp, perr)
+
+		var release func()
+		if reason != "" && retryable && attempt < policy.Attempts && backendContext.Err() == nil {
+			if release, ok = policy.AcquireRetry(); !ok {
+				p.metrics.IncCounter("retry.budgetexceeded." + routeID)
+			}
+		} else if reason != "" && retryable {
+			p.metrics.IncCounter("retry.exhausted." + routeID)
+		}
+
+		if release == nil {
+			if cancel != nil {
+				if perr != nil {
+					cancel()
+				} else {
+					// the attempt context is needed until the response is streamed
+					cancelBackendContext := ctx.cancelBackendContext
+					ctx.cancelBackendContext = func() {
+						cancel()
+						if cancelBackendContext != nil {
+							cancelBackendContext()
+						}
+					}
+				}
+			}
+
+			return rsp, perr
+		}
+
+		defer release()
+
+		discardResponse(rsp)
+		if cancel != nil {
+			cancel()
+		}
+
+		if ctx.proxySpan != nil {
+			ctx.proxySpan.Finish()
+			ctx.proxySpan = nil
+		}
+
+		p.metrics.IncCounter("retry.attempts." + routeID)
+		tracing.LogKV("retry", reason, ctx.request.Context())
+		ctx.Logger().Debugf("Retrying backend request after attempt %d: %s", attempt, reason)
+	}
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+func newRetryTestProxy(t *testing.T, doc string) (*httptest.Server, *metricstest.MockMetrics) {
+	t.Helper()
+
+	tp, err := newTestProxy(doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tp.close)
+
+	m := &metricstest.MockMetrics{}
+	tp.proxy.metrics = m
+
+	ps := httptest.NewServer(tp.proxy)
+	t.Cleanup(ps.Close)
+
+	return ps, m
+}
+
+func TestRetryStatus(t *testing.T) {
+	var requests atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("OK"))
+	}))
+	defer backend.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`r: * -> retry(3, "503") -> "%s"`, backend.URL))
+
+	rsp, err := ps.Client().Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got: %d", rsp.StatusCode)
+	}
+
+	if n := requests.Load(); n != 3 {
+		t.Errorf("expected 3 backend requests, got: %d", n)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["retry.attempts.r"] != 2 {
+			t.Errorf("expected 2 retries, got: %v", counters)
+		}
+	})
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var requests atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer backend.Close()
+
+	ps, m := newRetryTestProxy(t, fmt.Sprintf(`r: * -> retry(2, "gateway-error") -> "%s"`, backend.URL))
+
+	rsp, err := ps.Client().Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected 502, got: %d", rsp.StatusCode)
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expected 2 backend requests, got: %d", n)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		if counters["retry.attempts.r"] != 1 || counters["retry.exhausted.r"] != 1 {
+			t.Errorf("unexpected counters: %v", counters)
+		}
+	})
+}
+
+func TestRetryMethods(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		options  string
+		expected int64
+	}{{
+		name:     "idempotent only",
+		options:  "methods=idempotent",
+		expected: 1,
+	}, {
+		name:     "all methods",
+		options:  "methods=all",
+		expected: 2,
+	}, {
+		name:     "body too large",
+		options:  "methods=all,max-body=2",
+		expected: 1,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int64
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				if string(b) != "hello" {
+					t.Errorf("unexpected request body: %q", b)
+				}
+
+				if requests.Add(1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer backend.Close()
+
+			ps, _ := newRetryTestProxy(t, fmt.Sprintf(`* -> retry(2, "503", "1s", "%s") -> "%s"`, tt.options, backend.URL))
+
+			rsp, err := ps.Client().Post(ps.URL, "text/plain", strings.NewReader("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rsp.Body.Close()
+
+			if n := requests.Load(); n != tt.expected {
+				t.Errorf("expected %d backend requests, got: %d", tt.expected, n)
+			}
+		})
+	}
+}
+
+func TestRetryConnectFailureDifferentEndpoint(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	ps, _ := newRetryTestProxy(t, fmt.Sprintf(`* -> retry(2) -> <roundRobin, "%s", "%s">`, closed.URL, backend.URL))
+
+	for i := 0; i < 4; i++ {
+		rsp, err := ps.Client().Get(ps.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK {
+			t.Errorf("expected 200, got: %d", rsp.StatusCode)
+		}
+	}
+}
+
+func TestUntriedEndpoint(t *testing.T) {
+	endpoints := []routing.LBEndpoint{{Host: "a"}, {Host: "b"}, {Host: "c"}}
+
+	for _, tt := range []struct {
+		picked   string
+		tried    []string
+		expected string
+	}{
+		{"a", nil, "b"},
+		{"a", []string{"a", "b"}, "c"},
+		{"c", []string{"a", "c"}, "b"},
+		{"b", []string{"a", "b", "c"}, "b"},
+	} {
+		tried := make(map[string]struct{})
+		for _, h := range tt.tried {
+			tried[h] = struct{}{}
+		}
+
+		e := untriedEndpoint(endpoints, routing.LBEndpoint{Host: tt.picked}, tried)
+		if e.Host != tt.expected {
+			t.Errorf("picked %s, tried %v: expected %s, got %s", tt.picked, tt.tried, tt.expected, e.Host)
+		}
+	}
+}
+
+func newBufferTestContext(r *http.Request) *context {
+	return &context{
+		request:           r,
+		proxy:             &Proxy{requestBodyMemoryBytes: DefaultRequestBodyBufferMemoryBytes},
+		requestBodyBuffer: &requestBodyBuffer{},
+	}
+}
+
+func TestBufferRequestBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello world"))
+	r.ContentLength = -1
+	ctx := newBufferTestContext(r)
+	defer ctx.requestBodyBuffer.release()
+
+	if ok, err := bufferRequestBody(ctx, 5); err != nil || ok {
+		t.Fatalf("expected body not to be buffered: %v", err)
+	}
+
+	if b, _ := io.ReadAll(r.Body); string(b) != "hello world" {
+		t.Errorf("body was not preserved: %q", b)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	ctx = newBufferTestContext(r)
+	if ok, err := bufferRequestBody(ctx, 5); err != nil || !ok {
+		t.Fatalf("expected body to be buffered: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if b, _ := io.ReadAll(r.Body); string(b) != "hello" {
+			t.Errorf("body was not preserved: %q", b)
+		}
+
+		r.Body.Close()
+		r.Body = ctx.requestBodyBuffer.reader()
+	}
+
+	r.Body.Close()
+	buffer := ctx.requestBodyBuffer.buffer
+	ctx.requestBodyBuffer.release()
+	if n := buffer.refs.Load(); n != 0 || buffer.mem != nil {
+		t.Errorf("buffer not released: %d references", n)
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/stickysession"
+	"github.com/zalando/skipper/routing"
+)
+
+// stickyEndpoint returns the endpoint of the sticky session, when it is still
+// an endpoint of the route, it was not tried yet, it is not ejected by the
+// outlier detection, and it passes its active health checks.
+func (p *Proxy) stickyEndpoint(rt *routing.Route, session *stickysession.Session, tried map[string]struct{}) (routing.LBEndpoint, bool) {
+	if session.Endpoint == "" {
+		return routing.LBEndpoint{}, false
+	}
+
+	for _, e := range rt.LBEndpoints {
+		if e.Scheme+"://"+e.Host != session.Endpoint {
+			continue
+		}
+
+		if _, ok := tried[e.Host]; ok {
+			return routing.LBEndpoint{}, false
+		}
+
+		if p.outliers != nil && p.outliers.Ejected(e) {
+			return routing.LBEndpoint{}, false
+		}
+
+		if p.healthChecker != nil && !p.healthChecker.Healthy(rt.Id, e) {
+			return routing.LBEndpoint{}, false
+		}
+
+		return e, true
+	}
+
+	return routing.LBEndpoint{}, false
+}
+
+// setRequestURLForStickySession sets the endpoint of the sticky session as the
+// backend, or the one chosen by the load balancer algorithm, when the session
+// endpoint is not available, and stores the selection in the session.
+func (p *Proxy) setRequestURLForStickySession(u *url.URL, lbctx *routing.LBContext, tried map[string]struct{}, session *stickysession.Session) *routing.LBEndpoint {
+	e, ok := p.stickyEndpoint(lbctx.Route, session, tried)
+	if !ok {
+		ep := setRequestURLForLoadBalancedBackend(u, lbctx.Route, lbctx, tried)
+		session.Selected = ep.Scheme + "://" + ep.Host
+		return ep
+	}
+
+	if tried != nil {
+		tried[e.Host] = struct{}{}
+	}
+
+	u.Scheme = e.Scheme
+	u.Host = e.Host
+	session.Selected = session.Endpoint
+	return &e
+}
+
+// stickySessionHeader returns the header setting the sticky session cookie in
+// the response of an upgrade request, because the response filters are not
+// applied in that case.
+func stickySessionHeader(ctx *context) http.Header {
+	session, ok := ctx.StateBag()[filters.BackendStickySession].(*stickysession.Session)
+	if !ok {
+		return nil
+	}
+
+	c := session.Cookie()
+	if c == nil {
+		return nil
+	}
+
+	return http.Header{"Set-Cookie": []string{c.String()}}
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/stickysession"
+	"github.com/zalando/skipper/loadbalancer"
+	"github.com/zalando/skipper/secrets/secrettest"
+)
+
+type stickyBackend struct {
+	*httptest.Server
+	failing atomic.Bool
+}
+
+func newStickyBackend(id string) *stickyBackend {
+	b := &stickyBackend{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		w.Write([]byte(id))
+	}))
+
+	return b
+}
+
+func stickyRequest(t *testing.T, ps *httptest.Server, c *http.Cookie) (string, *http.Cookie) {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", ps.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c != nil {
+		req.AddCookie(c)
+	}
+
+	rsp, err := ps.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rc := range rsp.Cookies() {
+		if rc.Name == "session" {
+			return string(b), rc
+		}
+	}
+
+	return string(b), nil
+}
+
+func TestStickySession(t *testing.T) {
+	backends := make(map[string]*stickyBackend)
+	var urls []interface{}
+	for _, id := range []string{"b0", "b1", "b2"} {
+		b := newStickyBackend(id)
+		defer b.Close()
+		backends[id] = b
+		urls = append(urls, b.URL)
+	}
+
+	fr := builtin.MakeRegistry()
+	fr.Register(stickysession.NewStickySession("test-secret", secrettest.NewTestRegistry()))
+
+	outliers := loadbalancer.NewOutlierDetector(loadbalancer.OutlierDetectionOptions{ConsecutiveErrors: 3})
+	defer outliers.Close()
+
+	doc := fmt.Sprintf(`r: * -> stickySession("session", "1h") -> <roundRobin, "%s", "%s", "%s">`, urls...)
+	tp, err := newTestProxyWithFiltersAndParams(fr, doc, Params{OutlierDetector: outliers}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	pinned, cookie := stickyRequest(t, ps, nil)
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+
+	for i := 0; i < 10; i++ {
+		id, c := stickyRequest(t, ps, cookie)
+		if id != pinned {
+			t.Fatalf("expected endpoint %s, got: %s", pinned, id)
+		}
+
+		if c != nil {
+			t.Fatal("unexpected session cookie update")
+		}
+	}
+
+	// without the cookie, the requests are balanced
+	others := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		id, _ := stickyRequest(t, ps, nil)
+		others[id] = true
+	}
+
+	if len(others) != 3 {
+		t.Errorf("requests without session cookie were not balanced: %v", others)
+	}
+
+	// the ejected endpoint is not used
+	backends[pinned].failing.Store(true)
+	for i := 0; i < 3; i++ {
+		stickyRequest(t, ps, cookie)
+	}
+
+	id, c := stickyRequest(t, ps, cookie)
+	if id == pinned {
+		t.Fatal("request sent to the ejected endpoint")
+	}
+
+	if c == nil {
+		t.Fatal("session cookie not updated")
+	}
+
+	for i := 0; i < 10; i++ {
+		if next, _ := stickyRequest(t, ps, c); next != id {
+			t.Fatalf("expected endpoint %s, got: %s", id, next)
+		}
+	}
+}
+
+func TestStickySessionUnknownEndpoint(t *testing.T) {
+	b0, b1 := newStickyBackend("b0"), newStickyBackend("b1")
+	defer b0.Close()
+	defer b1.Close()
+
+	fr := builtin.MakeRegistry()
+	fr.Register(stickysession.NewStickySession("test-secret", secrettest.NewTestRegistry()))
+
+	doc := fmt.Sprintf(`
+		r0: Path("/") -> stickySession("session", "1h") -> <roundRobin, "%s">;
+		r1: Path("/other") -> stickySession("session", "1h") -> <roundRobin, "%s">;
+	`, b0.URL, b1.URL)
+	tp, err := newTestProxyWithFilters(fr, doc, FlagsNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+
+	ps := httptest.NewServer(tp.proxy)
+	defer ps.Close()
+
+	_, cookie := stickyRequest(t, ps, nil)
+	if cookie == nil {
+		t.Fatal("session cookie not set")
+	}
+
+	req, err := http.NewRequest("GET", ps.URL+"/other", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.AddCookie(cookie)
+	rsp, err := ps.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	body, _ := io.ReadAll(rsp.Body)
+	if string(body) != "b1" {
+		t.Errorf("expected endpoint b1, got: %s", body)
+	}
+
+	if len(rsp.Cookies()) != 1 {
+		t.Error("session cookie not updated")
+	}
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/tlsfingerprint"
+)
+
+type tlsFingerprintStateSpec struct{}
+
+type tlsFingerprintStateFilter struct{}
+
+func (tlsFingerprintStateSpec) Name() string { return "tlsFingerprintState" }
+
+func (tlsFingerprintStateSpec) CreateFilter([]interface{}) (filters.Filter, error) {
+	return tlsFingerprintStateFilter{}, nil
+}
+
+func (tlsFingerprintStateFilter) Request(ctx filters.FilterContext) {
+	if fp, ok := ctx.StateBag()[filters.TLSFingerprint].(*tlsfingerprint.Fingerprint); ok {
+		ctx.Request().Header.Set("X-State-Ja3", fp.JA3)
+	}
+}
+
+func (tlsFingerprintStateFilter) Response(filters.FilterContext) {}
+
+func TestTLSFingerprint(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ja4", r.Header.Get("X-Ja4"))
+		w.Header().Set("X-State-Ja3", r.Header.Get("X-State-Ja3"))
+	}))
+	defer backend.Close()
+
+	fr := builtin.MakeRegistry()
+	fr.Register(tlsFingerprintStateSpec{})
+
+	tp, err := newTestProxyWithFiltersAndParams(fr, `*
+		-> setRequestHeader("X-Ja4", "${request.tlsFingerprint.ja4}")
+		-> tlsFingerprintState()
+		-> "`+backend.URL+`"`, Params{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.close()
+
+	var fingerprint *tlsfingerprint.Fingerprint
+	ps := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fingerprint, _ = tlsfingerprint.FromContext(r.Context())
+		tp.proxy.ServeHTTP(w, r)
+	}))
+	ps.Listener = tlsfingerprint.NewListener(ps.Listener)
+	ps.Config.ConnContext = tlsfingerprint.ConnContext
+	ps.StartTLS()
+	defer ps.Close()
+
+	rsp, err := ps.Client().Get(ps.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	if fingerprint == nil {
+		t.Fatal("failed to record the fingerprint")
+	}
+
+	if got := rsp.Header.Get("X-Ja4"); got != fingerprint.JA4 {
+		t.Errorf("expected JA4 %s, got: %s", fingerprint.JA4, got)
+	}
+
+	if got := rsp.Header.Get("X-State-Ja3"); got != fingerprint.JA3 {
+		t.Errorf("expected JA3 %s, got: %s", fingerprint.JA3, got)
+	}
+}
+
+func TestConnectionLogData(t *testing.T) {
+	ctx := &context{
+		request:  httptest.NewRequest("GET", "/", nil),
+		stateBag: make(map[string]interface{}),
+	}
+
+	data := map[string]interface{}{"foo": "bar"}
+	if d := connectionLogData(ctx, data); len(d) != 1 {
+		t.Errorf("unexpected data: %v", d)
+	}
+
+	ctx.stateBag[filters.TLSFingerprint] = &tlsfingerprint.Fingerprint{JA3: "ja3", JA4: "ja4"}
+	d := connectionLogData(ctx, data)
+	if d["foo"] != "bar" || d["ja3"] != "ja3" || d["ja4"] != "ja4" {
+		t.Errorf("unexpected data: %v", d)
+	}
+
+	if len(data) != 1 {
+		t.Errorf("additional data modified: %v", data)
+	}
+}
@@ -19,6 +19,8 @@ const (
 	HTTPPathTag           = "http.path"
 	HTTPUrlTag            = "http.url"
 	HTTPStatusCodeTag     = "http.status_code"
+	HedgeWonTag           = "hedge.won"
+	RetryAttemptTag       = "retry.attempt"
 	SkipperRouteIDTag     = "skipper.route_id"
 	SpanKindTag           = "span.kind"
 
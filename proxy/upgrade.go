@@ -47,6 +47,10 @@ type upgradeProxy struct {
 	auditLogOut     io.Writer
 	auditLogErr     io.Writer
 	auditLogHook    chan struct{}
+
+	// responseHeader is added to the header of the switching protocols
+	// response.
+	responseHeader http.Header
 }
 
 // TODO: add user here
@@ -152,6 +156,10 @@ func (p *upgradeProxy) serveHTTP(w http.ResponseWriter, req *http.Request) {
 	// NOTE: from this point forward, we own the connection and we can't use
 	// w.Header(), w.Write(), or w.WriteHeader any more
 
+	for k, v := range p.responseHeader {
+		resp.Header[k] = append(resp.Header[k], v...)
+	}
+
 	err = resp.Write(requestHijackedConn)
 	if err != nil {
 		log.Errorf("Error writing backend response to client: %s", err)
@@ -0,0 +1,354 @@
+/*
+Package proxyprotocol implements the listener side of the HAProxy PROXY
+protocol, version 1 and 2.
+
+Load balancers working on the TCP level, e.g. the AWS Network Load
+Balancer, can send the address of the client at the start of the
+connection, in the PROXY protocol header. The listener returned by
+NewListener reads the header from the connections of the trusted sources,
+and the connections report the address of the client as their remote
+address. This way, the RemoteAddr of the incoming requests, and so the
+ClientIP and Source predicates, and the access logs, see the address of
+the client instead of the address of the load balancer.
+
+The version 2 headers may contain additional fields, TLVs (type, length,
+value), e.g. the ID of the AWS VPC endpoint, which the connection was
+received through. The header of a connection can be accessed from the
+context of the requests, when the http.Server is configured with
+ConnContext:
+
+	srv := &http.Server{ConnContext: proxyprotocol.ConnContext}
+
+	...
+
+	if h, ok := proxyprotocol.FromContext(r.Context()); ok {
+		vpce, _ := h.Value("aws-vpce-id")
+	}
+
+See also: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+*/
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// TLV types defined by the protocol.
+const (
+	TypeALPN      = 0x01
+	TypeAuthority = 0x02
+	TypeCRC32C    = 0x03
+	TypeNoop      = 0x04
+	TypeUniqueID  = 0x05
+	TypeSSL       = 0x20
+	TypeNetNS     = 0x30
+
+	// TypeAWS is the type of the AWS specific fields. The first byte of
+	// the value is the subtype.
+	TypeAWS = 0xea
+
+	// SubtypeAWSVPCEndpointID is the subtype of the AWS VPC endpoint ID.
+	SubtypeAWSVPCEndpointID = 0x01
+)
+
+const (
+	// the maximum length of a version 1 header, including the CRLF
+	maxV1Length = 107
+
+	v2HeaderLength = 16
+)
+
+var (
+	v1Signature = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// ErrInvalidHeader is returned, when the PROXY protocol header of a
+// connection cannot be parsed.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// TLV is an additional field of the version 2 headers.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header is the PROXY protocol header received at the start of a
+// connection.
+type Header struct {
+	// Version is 1 or 2.
+	Version int
+
+	// Source is the address of the client. It is nil, when the header
+	// does not contain the addresses, e.g. the health checks of the load
+	// balancer, or the v1 UNKNOWN protocol.
+	Source *net.TCPAddr
+
+	// Destination is the address, which the client connected to. It is
+	// nil, when Source is nil.
+	Destination *net.TCPAddr
+
+	// TLVs contains the additional fields of the version 2 headers.
+	TLVs []TLV
+}
+
+// TLV returns the value of the first field of type t.
+func (h *Header) TLV(t byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// AWSVPCEndpointID returns the ID of the AWS VPC endpoint, which the
+// connection was received through, or an empty string.
+func (h *Header) AWSVPCEndpointID() string {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == TypeAWS && len(tlv.Value) > 0 && tlv.Value[0] == SubtypeAWSVPCEndpointID {
+			return string(tlv.Value[1:])
+		}
+	}
+
+	return ""
+}
+
+// tlvName identifies a TLV field by type, and, when subtype is not
+// negative, by the first byte of the value.
+type tlvName struct {
+	typ     byte
+	subtype int
+}
+
+var tlvNames = map[string]tlvName{
+	"alpn":        {typ: TypeALPN, subtype: -1},
+	"authority":   {typ: TypeAuthority, subtype: -1},
+	"unique-id":   {typ: TypeUniqueID, subtype: -1},
+	"netns":       {typ: TypeNetNS, subtype: -1},
+	"aws-vpce-id": {typ: TypeAWS, subtype: SubtypeAWSVPCEndpointID},
+}
+
+func parseName(name string) (tlvName, bool) {
+	if n, ok := tlvNames[name]; ok {
+		return n, true
+	}
+
+	t, err := strconv.ParseUint(name, 0, 8)
+	if err != nil {
+		return tlvName{}, false
+	}
+
+	return tlvName{typ: byte(t), subtype: -1}, true
+}
+
+// ValidName tells whether name can be used to look up a TLV field with
+// Value.
+func ValidName(name string) bool {
+	_, ok := parseName(name)
+	return ok
+}
+
+// Value returns the value of a TLV field by name. The name is either
+// one of alpn, authority, unique-id, netns and aws-vpce-id, or the type of
+// the field as a decimal or hexadecimal number, e.g. 0xea.
+func (h *Header) Value(name string) (string, bool) {
+	n, ok := parseName(name)
+	if !ok {
+		return "", false
+	}
+
+	for _, tlv := range h.TLVs {
+		if tlv.Type != n.typ {
+			continue
+		}
+
+		if n.subtype < 0 {
+			return string(tlv.Value), true
+		}
+
+		if len(tlv.Value) > 0 && int(tlv.Value[0]) == n.subtype {
+			return string(tlv.Value[1:]), true
+		}
+	}
+
+	return "", false
+}
+
+// readHeader reads the header from r. It returns a nil header, when the
+// data does not start with a PROXY protocol header.
+func readHeader(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b[0] {
+	case v1Signature[0]:
+		b, err = r.Peek(len(v1Signature))
+		if err != nil || !bytes.Equal(b, v1Signature) {
+			// too short, or not a header, e.g. POST or PUT
+			return nil, nil
+		}
+
+		return readV1(r)
+	case v2Signature[0]:
+		b, err = r.Peek(len(v2Signature))
+		if err != nil || !bytes.Equal(b, v2Signature) {
+			return nil, nil
+		}
+
+		return readV2(r)
+	default:
+		return nil, nil
+	}
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidHeader, fmt.Sprintf(format, args...))
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < maxV1Length {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, invalid("v1 header not terminated")
+	}
+
+	fields := strings.Split(s, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &Header{Version: 1}, nil
+	}
+
+	if len(fields) != 6 {
+		return nil, invalid("v1 header with %d fields", len(fields))
+	}
+
+	var is4 bool
+	switch fields[1] {
+	case "TCP4":
+		is4 = true
+	case "TCP6":
+	default:
+		return nil, invalid("v1 protocol %q", fields[1])
+	}
+
+	src, err := parseV1Addr(fields[2], fields[4], is4)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := parseV1Addr(fields[3], fields[5], is4)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Header{Version: 1, Source: src, Destination: dst}, nil
+}
+
+func parseV1Addr(addr, port string, is4 bool) (*net.TCPAddr, error) {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil || ip.Is4() != is4 || ip.Zone() != "" {
+		return nil, invalid("v1 address %q", addr)
+	}
+
+	// leading zeros are not allowed
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || strconv.FormatUint(p, 10) != port {
+		return nil, invalid("v1 port %q", port)
+	}
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(p))), nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	var hb [v2HeaderLength]byte
+	if _, err := io.ReadFull(r, hb[:]); err != nil {
+		return nil, err
+	}
+
+	if version := hb[12] >> 4; version != 2 {
+		return nil, invalid("v2 version %d", version)
+	}
+
+	command := hb[12] & 0x0f
+	if command > 1 {
+		return nil, invalid("v2 command %d", command)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(hb[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	h := &Header{Version: 2}
+
+	var addrLength int
+	family, transport := hb[13]>>4, hb[13]&0x0f
+	switch family {
+	case 0x1:
+		addrLength = 2*4 + 2*2
+	case 0x2:
+		addrLength = 2*16 + 2*2
+	case 0x3:
+		addrLength = 2 * 108
+	}
+
+	if len(body) < addrLength {
+		return nil, invalid("v2 address block of %d bytes", len(body))
+	}
+
+	// the LOCAL command, e.g. the health checks, and the unspecified and
+	// unix addresses leave the address of the connection in place
+	if command == 1 && transport == 0x1 && (family == 0x1 || family == 0x2) {
+		n := addrLength/2 - 2
+		src, _ := netip.AddrFromSlice(body[:n])
+		dst, _ := netip.AddrFromSlice(body[n : 2*n])
+		sport := binary.BigEndian.Uint16(body[2*n:])
+		dport := binary.BigEndian.Uint16(body[2*n+2:])
+		h.Source = net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, sport))
+		h.Destination = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, dport))
+	}
+
+	tlvs := body[addrLength:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, invalid("truncated v2 TLV")
+		}
+
+		n := int(binary.BigEndian.Uint16(tlvs[1:]))
+		if len(tlvs) < 3+n {
+			return nil, invalid("truncated v2 TLV")
+		}
+
+		if tlvs[0] != TypeNoop {
+			h.TLVs = append(h.TLVs, TLV{Type: tlvs[0], Value: tlvs[3 : 3+n]})
+		}
+
+		tlvs = tlvs[3+n:]
+	}
+
+	return h, nil
+}
@@ -0,0 +1,192 @@
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func v2Header(command, family byte, addrs []byte, tlvs ...TLV) []byte {
+	var body bytes.Buffer
+	body.Write(addrs)
+	for _, tlv := range tlvs {
+		body.WriteByte(tlv.Type)
+		binary.Write(&body, binary.BigEndian, uint16(len(tlv.Value)))
+		body.Write(tlv.Value)
+	}
+
+	var b bytes.Buffer
+	b.Write(v2Signature)
+	b.WriteByte(0x20 | command)
+	b.WriteByte(family)
+	binary.Write(&b, binary.BigEndian, uint16(body.Len()))
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+var (
+	v4Addrs = []byte{192, 0, 2, 1, 198, 51, 100, 1, 0x30, 0x39, 0x01, 0xbb}
+	v6Addrs = append(append(
+		[]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1},
+		[]byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}...),
+		0x30, 0x39, 0x01, 0xbb,
+	)
+)
+
+func TestReadHeader(t *testing.T) {
+	for _, test := range []struct {
+		title   string
+		data    []byte
+		source  string
+		version int
+		noProxy bool
+		invalid bool
+	}{{
+		title:   "no header",
+		data:    []byte("GET / HTTP/1.1\r\n"),
+		noProxy: true,
+	}, {
+		title:   "no header, starting with P",
+		data:    []byte("POST / HTTP/1.1\r\n"),
+		noProxy: true,
+	}, {
+		title:   "v1 tcp4",
+		data:    []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345 443\r\n"),
+		source:  "192.0.2.1:12345",
+		version: 1,
+	}, {
+		title:   "v1 tcp6",
+		data:    []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 443\r\n"),
+		source:  "[2001:db8::1]:12345",
+		version: 1,
+	}, {
+		title:   "v1 unknown",
+		data:    []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"),
+		version: 1,
+	}, {
+		title:   "v1 mismatching address family",
+		data:    []byte("PROXY TCP4 2001:db8::1 198.51.100.1 12345 443\r\n"),
+		invalid: true,
+	}, {
+		title:   "v1 invalid port",
+		data:    []byte("PROXY TCP4 192.0.2.1 198.51.100.1 012345 443\r\n"),
+		invalid: true,
+	}, {
+		title:   "v1 missing fields",
+		data:    []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345\r\n"),
+		invalid: true,
+	}, {
+		title:   "v1 not terminated",
+		data:    []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345 443" + strings.Repeat(" ", 100) + "\r\n"),
+		invalid: true,
+	}, {
+		title:   "v2 tcp4",
+		data:    v2Header(1, 0x11, v4Addrs),
+		source:  "192.0.2.1:12345",
+		version: 2,
+	}, {
+		title:   "v2 tcp6",
+		data:    v2Header(1, 0x21, v6Addrs),
+		source:  "[2001:db8::1]:12345",
+		version: 2,
+	}, {
+		title:   "v2 local",
+		data:    v2Header(0, 0x11, v4Addrs),
+		version: 2,
+	}, {
+		title:   "v2 unspecified",
+		data:    v2Header(1, 0x00, nil),
+		version: 2,
+	}, {
+		title:   "v2 invalid command",
+		data:    v2Header(2, 0x11, v4Addrs),
+		invalid: true,
+	}, {
+		title:   "v2 short address block",
+		data:    v2Header(1, 0x21, v4Addrs),
+		invalid: true,
+	}, {
+		title:   "v2 truncated TLV",
+		data:    v2Header(1, 0x11, append(v4Addrs, TypeAuthority, 0, 8, 'a')),
+		invalid: true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(test.data), strings.NewReader("data")))
+			h, err := readHeader(r)
+			if test.invalid {
+				if !errors.Is(err, ErrInvalidHeader) {
+					t.Fatalf("expected invalid header error, got: %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.noProxy {
+				if h != nil {
+					t.Fatalf("unexpected header: %v", h)
+				}
+
+				return
+			}
+
+			if h.Version != test.version {
+				t.Errorf("unexpected version: %d", h.Version)
+			}
+
+			if test.source == "" && h.Source != nil || test.source != "" && (h.Source == nil || h.Source.String() != test.source) {
+				t.Errorf("unexpected source: %v", h.Source)
+			}
+
+			if rest, _ := io.ReadAll(r); string(rest) != "data" {
+				t.Errorf("unexpected data after the header: %q", rest)
+			}
+		})
+	}
+}
+
+func TestTLVs(t *testing.T) {
+	data := v2Header(1, 0x11, v4Addrs,
+		TLV{Type: TypeNoop, Value: []byte{0, 0}},
+		TLV{Type: TypeAuthority, Value: []byte("www.example.org")},
+		TLV{Type: TypeAWS, Value: append([]byte{SubtypeAWSVPCEndpointID}, "vpce-0123456789abcdef0"...)},
+		TLV{Type: 0xe0, Value: []byte("custom")},
+	)
+
+	h, err := readHeader(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(h.TLVs) != 3 {
+		t.Errorf("unexpected TLVs: %v", h.TLVs)
+	}
+
+	if id := h.AWSVPCEndpointID(); id != "vpce-0123456789abcdef0" {
+		t.Errorf("unexpected VPC endpoint ID: %s", id)
+	}
+
+	for _, test := range []struct {
+		name     string
+		expected string
+		missing  bool
+	}{
+		{name: "authority", expected: "www.example.org"},
+		{name: "aws-vpce-id", expected: "vpce-0123456789abcdef0"},
+		{name: "0xe0", expected: "custom"},
+		{name: "224", expected: "custom"},
+		{name: "alpn", missing: true},
+		{name: "foo", missing: true},
+	} {
+		if v, ok := h.Value(test.name); ok == test.missing || v != test.expected {
+			t.Errorf("%s: unexpected value: %q, %v", test.name, v, ok)
+		}
+	}
+}
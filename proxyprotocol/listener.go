@@ -0,0 +1,201 @@
+package proxyprotocol
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"go4.org/netipx"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics"
+)
+
+// DefaultHeaderTimeout is the default time limit for receiving the PROXY
+// protocol header.
+const DefaultHeaderTimeout = 5 * time.Second
+
+const (
+	invalidHeaderKey = "proxyprotocol.invalid"
+	untrustedKey     = "proxyprotocol.untrusted"
+)
+
+// Options are used to initialize the PROXY protocol listener.
+type Options struct {
+	// Trusted contains the addresses of the load balancers, which are
+	// allowed to send the PROXY protocol header. The header is not read
+	// from the connections of the other sources. When not set, no source
+	// is trusted.
+	Trusted *netipx.IPSet
+
+	// HeaderTimeout sets the time limit for receiving the header from the
+	// trusted sources. Defaults to DefaultHeaderTimeout.
+	HeaderTimeout time.Duration
+
+	// Metrics is used to count the invalid headers, and the connections
+	// from the untrusted sources.
+	Metrics metrics.Metrics
+}
+
+type listener struct {
+	net.Listener
+	options Options
+}
+
+// Conn is a connection, which reads the PROXY protocol header, when the
+// header is received from a trusted source.
+//
+// The header is read on the first call to Read, RemoteAddr or Header,
+// so that the slow connections don't block accepting the others.
+type Conn struct {
+	net.Conn
+	options Options
+	trusted bool
+
+	once   sync.Once
+	reader *bufio.Reader
+	header *Header
+	err    error
+}
+
+type contextKey struct{}
+
+// NewListener wraps l, and reads the PROXY protocol header from the
+// accepted connections of the trusted sources.
+func NewListener(l net.Listener, o Options) net.Listener {
+	if o.HeaderTimeout <= 0 {
+		o.HeaderTimeout = DefaultHeaderTimeout
+	}
+
+	return &listener{Listener: l, options: o}
+}
+
+func (l *listener) trusted(addr net.Addr) bool {
+	if l.options.Trusted == nil {
+		return false
+	}
+
+	var ip netip.Addr
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		ip = tcp.AddrPort().Addr()
+	} else if ap, err := netip.ParseAddrPort(addr.String()); err == nil {
+		ip = ap.Addr()
+	}
+
+	return l.options.Trusted.Contains(ip.Unmap())
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	trusted := l.trusted(c.RemoteAddr())
+	if !trusted && l.options.Metrics != nil {
+		l.options.Metrics.IncCounter(untrustedKey)
+	}
+
+	return &Conn{Conn: c, options: l.options, trusted: trusted}, nil
+}
+
+func (c *Conn) readHeader() {
+	if !c.trusted {
+		return
+	}
+
+	c.reader = bufio.NewReader(c.Conn)
+	c.Conn.SetReadDeadline(time.Now().Add(c.options.HeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	c.header, c.err = readHeader(c.reader)
+	if c.err != nil {
+		c.header = nil
+		if errors.Is(c.err, ErrInvalidHeader) && c.options.Metrics != nil {
+			c.options.Metrics.IncCounter(invalidHeaderKey)
+		}
+	}
+}
+
+func (c *Conn) init() {
+	c.once.Do(c.readHeader)
+}
+
+// Header returns the PROXY protocol header of the connection. It returns
+// false, when no header was received, or the source of the connection is
+// not trusted.
+func (c *Conn) Header() (*Header, bool) {
+	c.init()
+	return c.header, c.header != nil
+}
+
+// Read reads the data following the header. When the header was invalid,
+// it returns the error of the header.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	if c.reader != nil && c.reader.Buffered() > 0 {
+		return c.reader.Read(p)
+	}
+
+	return c.Conn.Read(p)
+}
+
+// RemoteAddr returns the source address received in the header, or the
+// address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// ConnContext can be used as the ConnContext of http.Server, to make the
+// PROXY protocol header accessible from the context of the requests.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	for {
+		if pc, ok := c.(*Conn); ok {
+			return context.WithValue(ctx, contextKey{}, pc)
+		}
+
+		// unwrap *tls.Conn, and the other wrapping connections
+		nc, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return ctx
+		}
+
+		c = nc.NetConn()
+	}
+}
+
+func init() {
+	eskip.RegisterTemplateResolver("request.proxyProtocol.", func(r *http.Request, name string) string {
+		if h, ok := FromContext(r.Context()); ok {
+			v, _ := h.Value(name)
+			return v
+		}
+
+		return ""
+	})
+}
+
+// FromContext returns the PROXY protocol header of the connection, which
+// the request was received on.
+func FromContext(ctx context.Context) (*Header, bool) {
+	c, ok := ctx.Value(contextKey{}).(*Conn)
+	if !ok {
+		return nil, false
+	}
+
+	return c.Header()
+}
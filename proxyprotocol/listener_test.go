@@ -0,0 +1,163 @@
+package proxyprotocol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"go4.org/netipx"
+
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+func ipSet(t *testing.T, cidr string) *netipx.IPSet {
+	t.Helper()
+
+	var b netipx.IPSetBuilder
+	b.AddPrefix(netip.MustParsePrefix(cidr))
+	s, err := b.IPSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func startServer(t *testing.T, o Options) (string, *metricstest.MockMetrics) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &metricstest.MockMetrics{}
+	o.Metrics = m
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vpce := "-"
+			if h, ok := FromContext(r.Context()); ok {
+				vpce = h.AWSVPCEndpointID()
+			}
+
+			fmt.Fprintf(w, "%s %s", r.RemoteAddr, vpce)
+		}),
+		ConnContext: ConnContext,
+	}
+
+	go srv.Serve(NewListener(l, o))
+	t.Cleanup(func() { srv.Close() })
+
+	return l.Addr().String(), m
+}
+
+func request(t *testing.T, addr string, header []byte) (int, string) {
+	t.Helper()
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Write(header)
+	fmt.Fprint(c, "GET / HTTP/1.1\r\nHost: www.example.org\r\nConnection: close\r\n\r\n")
+
+	rsp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	b, _ := io.ReadAll(rsp.Body)
+	return rsp.StatusCode, string(b)
+}
+
+func TestListener(t *testing.T) {
+	v1 := []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345 443\r\n")
+	v2 := v2Header(1, 0x11, v4Addrs, TLV{Type: TypeAWS, Value: append([]byte{SubtypeAWSVPCEndpointID}, "vpce-1"...)})
+
+	t.Run("trusted", func(t *testing.T) {
+		addr, m := startServer(t, Options{Trusted: ipSet(t, "127.0.0.0/8")})
+		for _, test := range []struct {
+			title    string
+			header   []byte
+			expected string
+		}{
+			{title: "v1", header: v1, expected: "192.0.2.1:12345 "},
+			{title: "v2", header: v2, expected: "192.0.2.1:12345 vpce-1"},
+			{title: "local", header: v2Header(0, 0x11, v4Addrs), expected: "127.0.0.1:"},
+		} {
+			t.Run(test.title, func(t *testing.T) {
+				status, b := request(t, addr, test.header)
+				if status != http.StatusOK || b[:len(test.expected)] != test.expected {
+					t.Errorf("unexpected response: %d %s", status, b)
+				}
+			})
+		}
+
+		t.Run("no header", func(t *testing.T) {
+			if status, b := request(t, addr, nil); status != http.StatusOK || b[:len("127.0.0.1:")] != "127.0.0.1:" {
+				t.Errorf("unexpected response: %d %s", status, b)
+			}
+		})
+
+		t.Run("invalid header", func(t *testing.T) {
+			if status, _ := request(t, addr, []byte("PROXY TCP4 foo bar\r\n")); status != http.StatusBadRequest {
+				t.Errorf("unexpected status: %d", status)
+			}
+
+			m.WithCounters(func(counters map[string]int64) {
+				if counters[invalidHeaderKey] != 1 {
+					t.Errorf("unexpected counters: %v", counters)
+				}
+			})
+		})
+	})
+
+	for _, test := range []struct {
+		title   string
+		trusted *netipx.IPSet
+	}{
+		{title: "untrusted", trusted: ipSet(t, "10.0.0.0/8")},
+		{title: "no trusted sources"},
+	} {
+		t.Run(test.title, func(t *testing.T) {
+			addr, m := startServer(t, Options{Trusted: test.trusted})
+			if status, _ := request(t, addr, v1); status != http.StatusBadRequest {
+				t.Errorf("unexpected status: %d", status)
+			}
+
+			if status, b := request(t, addr, nil); status != http.StatusOK || b[:len("127.0.0.1:")] != "127.0.0.1:" {
+				t.Errorf("unexpected response: %d %s", status, b)
+			}
+
+			m.WithCounters(func(counters map[string]int64) {
+				if counters[untrustedKey] != 2 {
+					t.Errorf("unexpected counters: %v", counters)
+				}
+			})
+		})
+	}
+}
+
+func TestHeaderTimeout(t *testing.T) {
+	addr, _ := startServer(t, Options{Trusted: ipSet(t, "127.0.0.0/8"), HeaderTimeout: 10 * time.Millisecond})
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection closed, got: %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package routing
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -145,9 +147,17 @@ type RouteFilter struct {
 	Index int
 }
 
+// LatencyDecay is the time constant of the decay of the latency EWMA
+// tracked by LBMetrics.
+const LatencyDecay = 10 * time.Second
+
 // LBMetrics contains metrics used by LB algorithms
 type LBMetrics struct {
 	inflightRequests int64
+
+	mu           sync.Mutex
+	latency      float64
+	latencyStamp time.Time
 }
 
 // IncInflightRequest increments the number of outstanding requests from the proxy to a given backend.
@@ -165,6 +175,45 @@ func (m *LBMetrics) GetInflightRequests() int {
 	return int(atomic.LoadInt64(&m.inflightRequests))
 }
 
+// ObserveLatency updates the peak exponentially weighted moving average
+// of the response latency of a given backend. Latencies higher than the
+// current average replace it, lower ones are averaged in, weighted by the
+// time passed since the last observation.
+func (m *LBMetrics) ObserveLatency(now time.Time, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l := float64(latency)
+	if l > m.latency {
+		m.latency = l
+	} else {
+		w := math.Exp(-float64(now.Sub(m.latencyStamp)) / float64(LatencyDecay))
+		m.latency = m.latency*w + l*(1-w)
+	}
+
+	m.latencyStamp = now
+}
+
+// GetLatencyEWMA returns the peak exponentially weighted moving average of
+// the response latency of a given backend in nanoseconds, decayed by the
+// time passed since the last observation. It returns 0 when no latency was
+// observed.
+func (m *LBMetrics) GetLatencyEWMA(now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.latency == 0 {
+		return 0
+	}
+
+	elapsed := now.Sub(m.latencyStamp)
+	if elapsed <= 0 {
+		return m.latency
+	}
+
+	return m.latency * math.Exp(-float64(elapsed)/float64(LatencyDecay))
+}
+
 // LBEndpoint represents the scheme and the host of load balanced
 // backends.
 type LBEndpoint struct {
@@ -174,6 +223,14 @@ type LBEndpoint struct {
 	// Detected represents the time when skipper instances first detected a new LB endpoint. This detection
 	// time is used for the fade-in feature of the round-robin and random LB algorithms.
 	Detected time.Time
+
+	// Zone is the availability zone of the LB endpoint, when known. It is set by the post-processor
+	// found in the filters/zone package, and used by the zone-aware load balancing.
+	Zone string
+
+	// Weight is the relative weight of the LB endpoint, taken from eskip.Route.LBEndpointWeights. The zero
+	// value means the default weight 1.
+	Weight float64
 }
 
 // LBAlgorithm implementations apply a load balancing algorithm
@@ -990,3 +990,35 @@ func TestSignalFirstLoad(t *testing.T) {
 		}
 	})
 }
+
+func TestLBMetricsLatency(t *testing.T) {
+	var m routing.LBMetrics
+	now := time.Now()
+	if l := m.GetLatencyEWMA(now); l != 0 {
+		t.Fatalf("unexpected latency without observations: %v", l)
+	}
+
+	m.ObserveLatency(now, 100*time.Millisecond)
+	if l := m.GetLatencyEWMA(now); l != float64(100*time.Millisecond) {
+		t.Fatalf("unexpected latency after the first observation: %v", l)
+	}
+
+	// a peak replaces the average
+	m.ObserveLatency(now, 200*time.Millisecond)
+	if l := m.GetLatencyEWMA(now); l != float64(200*time.Millisecond) {
+		t.Fatalf("peak latency not applied: %v", l)
+	}
+
+	// lower latencies are averaged in
+	now = now.Add(routing.LatencyDecay)
+	m.ObserveLatency(now, 0)
+	if l := m.GetLatencyEWMA(now); l <= 0 || l >= float64(100*time.Millisecond) {
+		t.Fatalf("unexpected average latency: %v", l)
+	}
+
+	// the average decays over time
+	l := m.GetLatencyEWMA(now)
+	if decayed := m.GetLatencyEWMA(now.Add(routing.LatencyDecay)); decayed >= l {
+		t.Fatalf("latency did not decay: %v >= %v", decayed, l)
+	}
+}
@@ -3,7 +3,9 @@ package skipper
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -22,6 +24,8 @@ import (
 	ot "github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	"github.com/zalando/skipper/circuit"
 	"github.com/zalando/skipper/dataclients/kubernetes"
@@ -34,14 +38,18 @@ import (
 	"github.com/zalando/skipper/filters/auth"
 	block "github.com/zalando/skipper/filters/block"
 	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/cache"
 	"github.com/zalando/skipper/filters/fadein"
+	"github.com/zalando/skipper/filters/idempotency"
 	logfilter "github.com/zalando/skipper/filters/log"
 	"github.com/zalando/skipper/filters/openpolicyagent"
 	"github.com/zalando/skipper/filters/openpolicyagent/opaauthorizerequest"
 	"github.com/zalando/skipper/filters/openpolicyagent/opaserveresponse"
 	ratelimitfilters "github.com/zalando/skipper/filters/ratelimit"
 	"github.com/zalando/skipper/filters/shedder"
+	"github.com/zalando/skipper/filters/stickysession"
 	teefilters "github.com/zalando/skipper/filters/tee"
+	"github.com/zalando/skipper/filters/zone"
 	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/logging"
 	"github.com/zalando/skipper/metrics"
@@ -50,16 +58,20 @@ import (
 	"github.com/zalando/skipper/predicates/content"
 	"github.com/zalando/skipper/predicates/cookie"
 	"github.com/zalando/skipper/predicates/cron"
+	"github.com/zalando/skipper/predicates/fallback"
 	"github.com/zalando/skipper/predicates/forwarded"
 	"github.com/zalando/skipper/predicates/host"
 	"github.com/zalando/skipper/predicates/interval"
 	"github.com/zalando/skipper/predicates/methods"
 	"github.com/zalando/skipper/predicates/primitive"
+	pproxyprotocol "github.com/zalando/skipper/predicates/proxyprotocol"
 	"github.com/zalando/skipper/predicates/query"
 	"github.com/zalando/skipper/predicates/source"
 	"github.com/zalando/skipper/predicates/tee"
+	ptlsfingerprint "github.com/zalando/skipper/predicates/tlsfingerprint"
 	"github.com/zalando/skipper/predicates/traffic"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxyprotocol"
 	"github.com/zalando/skipper/queuelistener"
 	"github.com/zalando/skipper/ratelimit"
 	"github.com/zalando/skipper/routing"
@@ -68,12 +80,15 @@ import (
 	"github.com/zalando/skipper/secrets"
 	"github.com/zalando/skipper/secrets/certregistry"
 	"github.com/zalando/skipper/swarm"
+	"github.com/zalando/skipper/tlsfingerprint"
 	"github.com/zalando/skipper/tracing"
 )
 
 const (
-	defaultSourcePollTimeout   = 30 * time.Millisecond
-	defaultRoutingUpdateBuffer = 1 << 5
+	defaultSourcePollTimeout         = 30 * time.Millisecond
+	defaultRoutingUpdateBuffer       = 1 << 5
+	defaultCacheMemoryMaxBytes       = 64 << 20
+	defaultIdempotencyMemoryMaxBytes = 64 << 20
 )
 
 const DefaultPluginDir = "./plugins"
@@ -127,6 +142,31 @@ type Options struct {
 	// If defines the maximum number of pending connection waiting in the queue.
 	MaxTCPListenerQueue int
 
+	// EnableProxyProtocol enables reading the PROXY protocol v1 and v2
+	// headers on the listeners, and using the client address received in
+	// the header as the remote address of the requests.
+	EnableProxyProtocol bool
+
+	// ProxyProtocolTrustedCIDRs lists the addresses of the load balancers,
+	// which are allowed to send the PROXY protocol header. It is required,
+	// when the PROXY protocol is enabled.
+	ProxyProtocolTrustedCIDRs []string
+
+	// ProxyProtocolHeaderTimeout sets the time limit for receiving the
+	// PROXY protocol header.
+	ProxyProtocolHeaderTimeout time.Duration
+
+	// EnableH2C enables accepting HTTP/2 without TLS (h2c) on the
+	// listeners, with prior knowledge, or by upgrading HTTP/1.1
+	// connections.
+	EnableH2C bool
+
+	// EnableTLSFingerprint enables recording the ClientHello of the TLS
+	// connections, and calculating the JA3 and JA4 fingerprints of the
+	// clients. The fingerprints are available to the TLSFingerprint
+	// predicate, to the filters, and are logged in the access log.
+	EnableTLSFingerprint bool
+
 	// List of custom filter specifications.
 	CustomFilters []filters.Spec
 
@@ -278,9 +318,13 @@ type Options struct {
 	KubernetesBackendTrafficAlgorithm kubernetes.BackendTrafficAlgorithm
 
 	// KubernetesDefaultLoadBalancerAlgorithm sets the default algorithm to be used for load balancing between backend endpoints,
-	// available options: roundRobin, consistentHash, random, powerOfRandomNChoices
+	// available options: roundRobin, consistentHash, random, powerOfRandomNChoices, peakEwma, weightedLeastRequest, maglev
 	KubernetesDefaultLoadBalancerAlgorithm string
 
+	// KubernetesEnableEndpointSlices enables loading the backend endpoints from the
+	// EndpointSlices instead of the Endpoints, which also provides the zone of the endpoints.
+	KubernetesEnableEndpointSlices bool
+
 	// File containing static route definitions. Multiple may be given comma separated.
 	RoutesFile string
 
@@ -602,6 +646,16 @@ type Options struct {
 	// TLSMinVersion to set the minimal TLS version for all TLS configurations
 	TLSMinVersion uint16
 
+	// ClientCAPathTLS is the path on the local filesystem to the PEM
+	// files of the CAs used to verify the client certificates, multiple
+	// may be given comma separated.
+	ClientCAPathTLS string
+
+	// ClientAuthTLS sets whether the server requests or requires client
+	// certificates. When set to other than tls.NoClientCert, the client
+	// certificates are verified with the CAs of ClientCAPathTLS.
+	ClientAuthTLS tls.ClientAuthType
+
 	// Flush interval for upgraded Proxy connections
 	BackendFlushInterval time.Duration
 
@@ -616,6 +670,14 @@ type Options struct {
 	// contains loop backends (<loopback>).
 	MaxLoopbacks int
 
+	// MaxRequestBodyBytes limits the size of the request bodies of the
+	// routes without the maxRequestBody filter. Zero means no limit.
+	MaxRequestBodyBytes int64
+
+	// RequestBodyBufferMemoryBytes is the size, above which the request
+	// bodies buffered for the filters are stored in temporary files.
+	RequestBodyBufferMemoryBytes int64
+
 	// EnableBreakers enables the usage of the breakers in the route definitions without initializing any
 	// by default. It is a shortcut for setting the BreakerSettings to:
 	//
@@ -694,6 +756,11 @@ type Options struct {
 	// necessary because of shared data between e.g. a filter and a data client).
 	Plugins [][]string
 
+	// PluginConfig holds the configuration sections of the plugins, keyed by
+	// the plugin name. Filter plugins receive their section when their
+	// InitFilter function accepts a filters.PluginConfig argument.
+	PluginConfig map[string]filters.PluginConfig
+
 	// DefaultHTTPStatus is the HTTP status used when no routes are found
 	// for a request.
 	DefaultHTTPStatus int
@@ -718,6 +785,49 @@ type Options struct {
 	// unhealthy routes
 	LoadBalancerHealthCheckInterval time.Duration
 
+	// EnableOutlierDetection enables the passive outlier detection
+	// of load balanced endpoints, which ejects the endpoints
+	// responding with consecutive errors or with a success rate
+	// below the other endpoints of a route.
+	EnableOutlierDetection bool
+
+	// OutlierDetectionOptions configures the passive outlier
+	// detection, when enabled.
+	OutlierDetectionOptions loadbalancer.OutlierDetectionOptions
+
+	// EnableZoneAwareLoadBalancing enables the zone-aware load
+	// balancing, which prefers the endpoints in the same zone as
+	// Skipper, and spills over to the other zones when the local
+	// zone doesn't have enough healthy endpoints or capacity.
+	EnableZoneAwareLoadBalancing bool
+
+	// ZoneAwareOptions configures the zone-aware load balancing,
+	// when enabled. The zone of Skipper needs to be set.
+	ZoneAwareOptions loadbalancer.ZoneAwareOptions
+
+	// StickySessionSecretsFile path to the file containing the key to
+	// encrypt the sticky session cookies. Enables the stickySession filter.
+	StickySessionSecretsFile string
+
+	// CacheStore enables the cache filter, and sets where the cached
+	// responses are stored, memory or redis. The redis store uses the
+	// Redis ring of the swarm.
+	CacheStore string
+
+	// CacheMemoryMaxBytes limits the size of the cached responses in
+	// the memory store, defaults to 64MiB.
+	CacheMemoryMaxBytes int64
+
+	// IdempotencyStore enables the idempotencyKey filter, and sets where
+	// the responses are stored, memory or redis. The redis store uses the
+	// Redis ring of the swarm, and is required, when running multiple
+	// instances.
+	IdempotencyStore string
+
+	// IdempotencyMemoryMaxBytes limits the size of the stored responses
+	// in the memory store, defaults to 64MiB.
+	IdempotencyMemoryMaxBytes int64
+
 	// ReverseSourcePredicate enables the automatic use of IP
 	// whitelisting in different places to use the reversed way of
 	// identifying a client IP within the X-Forwarded-For
@@ -936,6 +1046,7 @@ func (o *Options) KubernetesDataClientOptions() kubernetes.Options {
 		ForceKubernetesService:            o.KubernetesForceService,
 		BackendTrafficAlgorithm:           o.KubernetesBackendTrafficAlgorithm,
 		DefaultLoadBalancerAlgorithm:      o.KubernetesDefaultLoadBalancerAlgorithm,
+		EnableEndpointSlices:              o.KubernetesEnableEndpointSlices,
 	}
 }
 
@@ -1127,6 +1238,10 @@ func (o *Options) tlsConfig(cr *certregistry.CertRegistry) (*tls.Config, error)
 		config.GetCertificate = cr.GetCertFromHello
 	}
 
+	if err := o.clientAuthTLS(config); err != nil {
+		return nil, err
+	}
+
 	if o.CertPathTLS == "" && o.KeyPathTLS == "" {
 		return config, nil
 	}
@@ -1149,6 +1264,32 @@ func (o *Options) tlsConfig(cr *certregistry.CertRegistry) (*tls.Config, error)
 	return config, nil
 }
 
+func (o *Options) clientAuthTLS(config *tls.Config) error {
+	if o.ClientAuthTLS == tls.NoClientCert {
+		return nil
+	}
+
+	if o.ClientCAPathTLS == "" {
+		return fmt.Errorf("client CA is required to verify the client certificates")
+	}
+
+	pool := x509.NewCertPool()
+	for _, p := range strings.Split(o.ClientCAPathTLS, ",") {
+		pem, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA from %s: %w", p, err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("failed to load client CA from %s", p)
+		}
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = o.ClientAuthTLS
+	return nil
+}
+
 func (o *Options) openTracingTracerInstance() (ot.Tracer, error) {
 	if o.OpenTracingTracer != nil {
 		return o.OpenTracingTracer, nil
@@ -1171,7 +1312,32 @@ func (o *Options) openTracingTracerInstance() (ot.Tracer, error) {
 }
 
 func listen(o *Options, address string, mtr metrics.Metrics) (net.Listener, error) {
+	if !o.EnableProxyProtocol {
+		return listenTCP(o, address, mtr)
+	}
+
+	if len(o.ProxyProtocolTrustedCIDRs) == 0 {
+		return nil, errors.New("PROXY protocol is enabled without trusted CIDRs")
+	}
+
+	trusted, err := skpnet.ParseIPCIDRs(o.ProxyProtocolTrustedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol trusted CIDRs: %w", err)
+	}
 
+	l, err := listenTCP(o, address, mtr)
+	if err != nil {
+		return nil, err
+	}
+
+	return proxyprotocol.NewListener(l, proxyprotocol.Options{
+		Trusted:       trusted,
+		HeaderTimeout: o.ProxyProtocolHeaderTimeout,
+		Metrics:       mtr,
+	}), nil
+}
+
+func listenTCP(o *Options, address string, mtr metrics.Metrics) (net.Listener, error) {
 	if !o.EnableTCPQueue {
 		return net.Listen("tcp", address)
 	}
@@ -1247,6 +1413,10 @@ func listenAndServeQuit(
 		}
 	}
 
+	if o.EnableH2C {
+		proxy = h2c.NewHandler(proxy, &http2.Server{IdleTimeout: o.IdleTimeoutServer})
+	}
+
 	srv := &http.Server{
 		Addr:              address,
 		TLSConfig:         tlsConfig,
@@ -1259,6 +1429,25 @@ func listenAndServeQuit(
 		ErrorLog:          newServerErrorLog(),
 	}
 
+	var connContexts []func(context.Context, net.Conn) context.Context
+	if o.EnableProxyProtocol {
+		connContexts = append(connContexts, proxyprotocol.ConnContext)
+	}
+
+	if o.EnableTLSFingerprint && serveTLS {
+		connContexts = append(connContexts, tlsfingerprint.ConnContext)
+	}
+
+	if len(connContexts) > 0 {
+		srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			for _, cc := range connContexts {
+				ctx = cc(ctx, c)
+			}
+
+			return ctx
+		}
+	}
+
 	if o.EnableConnMetricsServer {
 		m := metrics.Default
 		srv.ConnState = func(conn net.Conn, state http.ConnState) {
@@ -1314,6 +1503,10 @@ func listenAndServeQuit(
 			}()
 		}
 
+		if o.EnableTLSFingerprint {
+			l = tlsfingerprint.NewListener(l)
+		}
+
 		if err := srv.ServeTLS(l, "", ""); err != http.ErrServerClosed {
 			log.Errorf("ServeTLS failed: %v", err)
 			return err
@@ -1469,6 +1662,27 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		lbInstance = loadbalancer.New(o.LoadBalancerHealthCheckInterval)
 	}
 
+	var outlierDetector *loadbalancer.OutlierDetector
+	if o.EnableOutlierDetection {
+		outlierDetector = loadbalancer.NewOutlierDetector(o.OutlierDetectionOptions)
+		defer outlierDetector.Close()
+	}
+
+	activeHealthChecker := loadbalancer.NewActiveHealthChecker(loadbalancer.ActiveHealthCheckOptions{})
+	defer activeHealthChecker.Close()
+
+	var zoneAware *loadbalancer.ZoneAware
+	if o.EnableZoneAwareLoadBalancing {
+		if o.ZoneAwareOptions.Zone == "" {
+			log.Warn("Zone-aware load balancing is enabled, but the zone is not set.")
+		}
+
+		zo := o.ZoneAwareOptions
+		zo.OutlierDetector = outlierDetector
+		zo.ActiveHealthChecker = activeHealthChecker
+		zoneAware = loadbalancer.NewZoneAware(zo)
+	}
+
 	if err := o.findAndLoadPlugins(); err != nil {
 		return err
 	}
@@ -1603,6 +1817,10 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		)
 	}
 
+	if o.StickySessionSecretsFile != "" {
+		o.CustomFilters = append(o.CustomFilters, stickysession.NewStickySession(o.StickySessionSecretsFile, o.SecretsRegistry))
+	}
+
 	var swarmer ratelimit.Swarmer
 	var redisOptions *skpnet.RedisOptions
 	log.Infof("enable swarm: %v", o.EnableSwarm)
@@ -1732,6 +1950,58 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		}
 	}
 
+	var cacheRegistry *cache.Registry
+	if o.CacheStore != "" {
+		var store cache.Store
+		switch o.CacheStore {
+		case "memory":
+			maxBytes := o.CacheMemoryMaxBytes
+			if maxBytes <= 0 {
+				maxBytes = defaultCacheMemoryMaxBytes
+			}
+
+			store = cache.NewMemoryStore(maxBytes)
+		case "redis":
+			if redisOptions == nil {
+				return fmt.Errorf("the redis cache store requires the redis based swarm")
+			}
+
+			redisClient := skpnet.NewRedisRingClient(redisOptions)
+			defer redisClient.Close()
+			store = cache.NewRedisStore(redisClient)
+		default:
+			return fmt.Errorf("invalid cache store: %s", o.CacheStore)
+		}
+
+		cacheRegistry = cache.NewRegistry(cache.Options{Store: store, Metrics: mtr})
+		o.CustomFilters = append(o.CustomFilters, cache.NewCache(cacheRegistry))
+	}
+
+	if o.IdempotencyStore != "" {
+		var store idempotency.Store
+		switch o.IdempotencyStore {
+		case "memory":
+			maxBytes := o.IdempotencyMemoryMaxBytes
+			if maxBytes <= 0 {
+				maxBytes = defaultIdempotencyMemoryMaxBytes
+			}
+
+			store = idempotency.NewMemoryStore(maxBytes)
+		case "redis":
+			if redisOptions == nil {
+				return fmt.Errorf("the redis idempotency store requires the redis based swarm")
+			}
+
+			redisClient := skpnet.NewRedisRingClient(redisOptions)
+			defer redisClient.Close()
+			store = idempotency.NewRedisStore(redisClient)
+		default:
+			return fmt.Errorf("invalid idempotency store: %s", o.IdempotencyStore)
+		}
+
+		o.CustomFilters = append(o.CustomFilters, idempotency.NewIdempotencyKey(idempotency.Options{Store: store, Metrics: mtr}))
+	}
+
 	if o.TLSMinVersion == 0 {
 		o.TLSMinVersion = tls.VersionTLS12
 	}
@@ -1852,12 +2122,16 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		pauth.NewJWTPayloadAllKVRegexp(),
 		pauth.NewJWTPayloadAnyKVRegexp(),
 		pauth.NewHeaderSHA256(),
+		pauth.NewClientCert(),
 		methods.New(),
 		tee.New(),
+		fallback.New(),
 		forwarded.NewForwardedHost(),
 		forwarded.NewForwardedProto(),
 		host.NewAny(),
 		content.NewContentLengthBetween(),
+		pproxyprotocol.NewTLV(),
+		ptlsfingerprint.New(),
 	)
 
 	// provide default value for wrapper if not defined
@@ -1888,6 +2162,7 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 			schedulerRegistry,
 			builtin.NewRouteCreationMetrics(mtr),
 			fadein.NewPostProcessor(),
+			zone.NewPostProcessor(),
 			admissionControlSpec.PostProcessor(),
 		},
 		SignalFirstLoad: o.WaitFirstRouteLoad,
@@ -1897,6 +2172,16 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		ro.PostProcessors = append(ro.PostProcessors, loadbalancer.HealthcheckPostProcessor{LB: lbInstance})
 	}
 
+	if zoneAware != nil {
+		ro.PostProcessors = append(ro.PostProcessors, zoneAware)
+	}
+
+	if outlierDetector != nil {
+		ro.PostProcessors = append(ro.PostProcessors, outlierDetector)
+	}
+
+	ro.PostProcessors = append(ro.PostProcessors, activeHealthChecker)
+
 	if failClosedRatelimitPostProcessor != nil {
 		ro.PostProcessors = append(ro.PostProcessors, failClosedRatelimitPostProcessor)
 	}
@@ -1938,29 +2223,34 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 
 	proxyFlags := proxy.Flags(o.ProxyOptions) | o.ProxyFlags
 	proxyParams := proxy.Params{
-		Routing:                    routing,
-		Flags:                      proxyFlags,
-		PriorityRoutes:             o.PriorityRoutes,
-		IdleConnectionsPerHost:     o.IdleConnectionsPerHost,
-		CloseIdleConnsPeriod:       o.CloseIdleConnsPeriod,
-		FlushInterval:              o.BackendFlushInterval,
-		ExperimentalUpgrade:        o.ExperimentalUpgrade,
-		ExperimentalUpgradeAudit:   o.ExperimentalUpgradeAudit,
-		MaxLoopbacks:               o.MaxLoopbacks,
-		DefaultHTTPStatus:          o.DefaultHTTPStatus,
-		LoadBalancer:               lbInstance,
-		Timeout:                    o.TimeoutBackend,
-		ResponseHeaderTimeout:      o.ResponseHeaderTimeoutBackend,
-		ExpectContinueTimeout:      o.ExpectContinueTimeoutBackend,
-		KeepAlive:                  o.KeepAliveBackend,
-		DualStack:                  o.DualStackBackend,
-		TLSHandshakeTimeout:        o.TLSHandshakeTimeoutBackend,
-		MaxIdleConns:               o.MaxIdleConnsBackend,
-		DisableHTTPKeepalives:      o.DisableHTTPKeepalives,
-		AccessLogDisabled:          o.AccessLogDisabled,
-		ClientTLS:                  o.ClientTLS,
-		CustomHttpRoundTripperWrap: o.CustomHttpRoundTripperWrap,
-		RateLimiters:               ratelimitRegistry,
+		Routing:                      routing,
+		Flags:                        proxyFlags,
+		PriorityRoutes:               o.PriorityRoutes,
+		IdleConnectionsPerHost:       o.IdleConnectionsPerHost,
+		CloseIdleConnsPeriod:         o.CloseIdleConnsPeriod,
+		FlushInterval:                o.BackendFlushInterval,
+		ExperimentalUpgrade:          o.ExperimentalUpgrade,
+		ExperimentalUpgradeAudit:     o.ExperimentalUpgradeAudit,
+		MaxLoopbacks:                 o.MaxLoopbacks,
+		MaxRequestBodyBytes:          o.MaxRequestBodyBytes,
+		RequestBodyBufferMemoryBytes: o.RequestBodyBufferMemoryBytes,
+		DefaultHTTPStatus:            o.DefaultHTTPStatus,
+		LoadBalancer:                 lbInstance,
+		OutlierDetector:              outlierDetector,
+		ActiveHealthChecker:          activeHealthChecker,
+		Timeout:                      o.TimeoutBackend,
+		ResponseHeaderTimeout:        o.ResponseHeaderTimeoutBackend,
+		ExpectContinueTimeout:        o.ExpectContinueTimeoutBackend,
+		KeepAlive:                    o.KeepAliveBackend,
+		DualStack:                    o.DualStackBackend,
+		TLSHandshakeTimeout:          o.TLSHandshakeTimeoutBackend,
+		MaxIdleConns:                 o.MaxIdleConnsBackend,
+		DisableHTTPKeepalives:        o.DisableHTTPKeepalives,
+		AccessLogDisabled:            o.AccessLogDisabled,
+		ClientTLS:                    o.ClientTLS,
+		RemoveForwardedClientCert:    o.ClientAuthTLS != tls.NoClientCert,
+		CustomHttpRoundTripperWrap:   o.CustomHttpRoundTripperWrap,
+		RateLimiters:                 ratelimitRegistry,
 	}
 
 	if o.EnableBreakers || len(o.BreakerSettings) > 0 {
@@ -1988,6 +2278,15 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		mux.Handle("/routes", routing)
 		mux.Handle("/routes/", routing)
 
+		if outlierDetector != nil {
+			mux.Handle("/outliers", outlierDetector)
+		}
+
+		mux.Handle("/healthchecks", activeHealthChecker)
+		if cacheRegistry != nil {
+			mux.Handle("/cache", cacheRegistry)
+		}
+
 		metricsHandler := metrics.NewHandler(mtrOpts, mtr)
 		mux.Handle("/metrics", metricsHandler)
 		mux.Handle("/metrics/", metricsHandler)
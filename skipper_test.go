@@ -1,6 +1,7 @@
 package skipper
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -23,6 +24,7 @@ import (
 	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/metrics/metricstest"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxyprotocol"
 	"github.com/zalando/skipper/ratelimit"
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/scheduler"
@@ -31,6 +33,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
 )
 
 const (
@@ -186,6 +189,20 @@ func TestOptionsTLSConfig(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, uint16(tls.VersionTLS13), c.MinVersion)
 	require.Equal(t, []tls.Certificate{cert, cert2}, c.Certificates)
+
+	// client authentication
+	o = &Options{CertPathTLS: "fixtures/test.crt", KeyPathTLS: "fixtures/test.key", ClientCAPathTLS: "fixtures/test.crt,fixtures/test2.crt", ClientAuthTLS: tls.RequireAndVerifyClientCert}
+	c, err = o.tlsConfig(cr)
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, c.ClientAuth)
+	require.NotNil(t, c.ClientCAs)
+
+	// client CA without client authentication
+	o = &Options{CertPathTLS: "fixtures/test.crt", KeyPathTLS: "fixtures/test.key", ClientCAPathTLS: "fixtures/test.crt"}
+	c, err = o.tlsConfig(cr)
+	require.NoError(t, err)
+	require.Equal(t, tls.NoClientCert, c.ClientAuth)
+	require.Nil(t, c.ClientCAs)
 }
 
 func TestOptionsTLSConfigInvalidPaths(t *testing.T) {
@@ -202,6 +219,9 @@ func TestOptionsTLSConfigInvalidPaths(t *testing.T) {
 		{"cert key mismatch", &Options{CertPathTLS: "fixtures/test.crt", KeyPathTLS: "fixtures/test2.key"}},
 		{"multiple cert key count mismatch", &Options{CertPathTLS: "fixtures/test.crt,fixtures/test2.crt", KeyPathTLS: "fixtures/test.key"}},
 		{"multiple cert key mismatch", &Options{CertPathTLS: "fixtures/test.crt,fixtures/test2.crt", KeyPathTLS: "fixtures/test2.key,fixtures/test.key"}},
+		{"missing client CA", &Options{ClientAuthTLS: tls.VerifyClientCertIfGiven}},
+		{"wrong client CA path", &Options{ClientCAPathTLS: "fixtures/notFound.crt", ClientAuthTLS: tls.VerifyClientCertIfGiven}},
+		{"invalid client CA", &Options{ClientCAPathTLS: "fixtures/test.key", ClientAuthTLS: tls.VerifyClientCertIfGiven}},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			_, err := tt.options.tlsConfig(cr)
@@ -313,6 +333,92 @@ func TestHTTPServer(t *testing.T) {
 	}
 }
 
+func TestListenProxyProtocol(t *testing.T) {
+	o := &Options{EnableProxyProtocol: true}
+	if _, err := listen(o, "127.0.0.1:0", nil); err == nil {
+		t.Error("failed to fail without trusted CIDRs")
+	}
+
+	o.ProxyProtocolTrustedCIDRs = []string{"10.0.0.0/8", "foo"}
+	if _, err := listen(o, "127.0.0.1:0", nil); err == nil {
+		t.Error("failed to fail with invalid CIDRs")
+	}
+
+	o.ProxyProtocolTrustedCIDRs = []string{"10.0.0.0/8"}
+	l, err := listen(o, "127.0.0.1:0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err == nil {
+			c.Close()
+		}
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, ok := c.(*proxyprotocol.Conn); !ok {
+		t.Errorf("unexpected connection: %T", c)
+	}
+}
+
+func TestListenH2C(t *testing.T) {
+	address, err := findAddress()
+	require.NoError(t, err)
+
+	dc, err := routestring.New(`* -> inlineContent("OK") -> <shunt>`)
+	require.NoError(t, err)
+
+	rt := routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		DataClients:    []routing.DataClient{dc},
+	})
+	defer rt.Close()
+
+	proxy := proxy.New(rt, proxy.OptionsNone)
+	defer proxy.Close()
+
+	o := &Options{Address: address, EnableH2C: true}
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		err := listenAndServeQuit(proxy, o, sigs, done, nil, nil)
+		require.NoError(t, err)
+	}()
+
+	defer func() {
+		sigs <- syscall.SIGTERM
+		<-done
+	}()
+
+	tr := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	defer tr.CloseIdleConnections()
+
+	rsp, err := waitConn(func() (*http.Response, error) {
+		return (&http.Client{Transport: tr}).Get("http://" + address)
+	})
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", rsp.Proto)
+	assert.Equal(t, "OK", string(body))
+}
+
 func TestServerShutdownHTTP(t *testing.T) {
 	o := &Options{}
 	testServerShutdown(t, o, "http")
@@ -0,0 +1,417 @@
+/*
+Package tlsfingerprint calculates the JA3 and JA4 fingerprints of the TLS
+clients from their ClientHello message.
+
+The fingerprints identify the TLS library and its configuration used by a
+client, so they can tell apart the clients sending the same User-Agent
+header, e.g. the mobile apps and the scripts imitating them.
+
+The listener returned by NewListener records the ClientHello of the
+accepted connections, while it is read by the TLS server. The fingerprint
+of a connection can be accessed from the context of the requests, when
+the http.Server is configured with ConnContext:
+
+	srv := &http.Server{ConnContext: tlsfingerprint.ConnContext}
+
+	...
+
+	if fp, ok := tlsfingerprint.FromContext(r.Context()); ok {
+		log.Println(fp.JA4)
+	}
+
+See also:
+
+  - https://github.com/salesforce/ja3
+  - https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+*/
+package tlsfingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	recordTypeHandshake    = 0x16
+	handshakeClientHello   = 0x01
+	recordHeaderLength     = 5
+	handshakeHeaderLength  = 4
+	maxClientHelloLength   = 1 << 16
+	extensionServerName    = 0x0000
+	extensionGroups        = 0x000a
+	extensionPointFormats  = 0x000b
+	extensionSignatureAlgs = 0x000d
+	extensionALPN          = 0x0010
+	extensionVersions      = 0x002b
+)
+
+var (
+	errNotClientHello = errors.New("not a TLS ClientHello")
+	errTruncated      = errors.New("truncated TLS ClientHello")
+)
+
+// Fingerprint contains the fingerprints of a TLS client.
+type Fingerprint struct {
+
+	// JA3 is the MD5 hash of JA3Full, the commonly used form of the JA3
+	// fingerprint.
+	JA3 string
+
+	// JA3Full is the JA3 string: the version, the cipher suites, the
+	// extensions, the supported groups and the point formats.
+	JA3Full string
+
+	// JA4 is the JA4 fingerprint of the client, e.g.
+	// t13d1516h2_8daaf6152771_e5627efa2ab1.
+	JA4 string
+}
+
+// clientHello contains the fields of the ClientHello used by the
+// fingerprints.
+type clientHello struct {
+	version       uint16
+	ciphers       []uint16
+	extensions    []uint16
+	groups        []uint16
+	pointFormats  []uint8
+	signatureAlgs []uint16
+	versions      []uint16
+	alpn          []string
+	serverName    bool
+}
+
+// grease tells whether v is one of the reserved GREASE values, which the
+// fingerprints ignore.
+func grease(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGrease(values []uint16) []uint16 {
+	var result []uint16
+	for _, v := range values {
+		if !grease(v) {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if len(r.data) < n {
+		r.err = errTruncated
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *reader) uint8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+
+	return 0
+}
+
+func (r *reader) vector8() *reader {
+	return &reader{data: r.bytes(int(r.uint8())), err: r.err}
+}
+
+func (r *reader) vector16() *reader {
+	return &reader{data: r.bytes(int(r.uint16())), err: r.err}
+}
+
+func (r *reader) uint16s() []uint16 {
+	var values []uint16
+	for len(r.data) >= 2 {
+		values = append(values, r.uint16())
+	}
+
+	return values
+}
+
+// handshakeMessage returns the ClientHello handshake message from the
+// records of data. It returns errTruncated, when more data is needed.
+func handshakeMessage(data []byte) ([]byte, error) {
+	var msg []byte
+	for {
+		if len(data) < recordHeaderLength {
+			return nil, errTruncated
+		}
+
+		if data[0] != recordTypeHandshake {
+			return nil, errNotClientHello
+		}
+
+		n := int(binary.BigEndian.Uint16(data[3:]))
+		if len(data) < recordHeaderLength+n {
+			return nil, errTruncated
+		}
+
+		msg = append(msg, data[recordHeaderLength:recordHeaderLength+n]...)
+		data = data[recordHeaderLength+n:]
+
+		if len(msg) < handshakeHeaderLength {
+			continue
+		}
+
+		if msg[0] != handshakeClientHello {
+			return nil, errNotClientHello
+		}
+
+		length := int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])
+		if length > maxClientHelloLength {
+			return nil, errNotClientHello
+		}
+
+		if len(msg) >= handshakeHeaderLength+length {
+			return msg[handshakeHeaderLength : handshakeHeaderLength+length], nil
+		}
+	}
+}
+
+func parseClientHello(data []byte) (*clientHello, error) {
+	msg, err := handshakeMessage(data)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reader{data: msg}
+	h := &clientHello{version: r.uint16()}
+	r.bytes(32) // random
+	r.vector8() // session ID
+	h.ciphers = r.vector16().uint16s()
+	r.vector8() // compression methods
+
+	// no extensions
+	if r.err == nil && len(r.data) == 0 {
+		return h, nil
+	}
+
+	extensions := r.vector16()
+	for extensions.err == nil && len(extensions.data) > 0 {
+		typ := extensions.uint16()
+		ext := extensions.vector16()
+		h.extensions = append(h.extensions, typ)
+
+		switch typ {
+		case extensionServerName:
+			h.serverName = true
+		case extensionGroups:
+			h.groups = ext.vector16().uint16s()
+		case extensionPointFormats:
+			h.pointFormats = ext.vector8().data
+		case extensionSignatureAlgs:
+			h.signatureAlgs = ext.vector16().uint16s()
+		case extensionVersions:
+			h.versions = ext.vector8().uint16s()
+		case extensionALPN:
+			protocols := ext.vector16()
+			for protocols.err == nil && len(protocols.data) > 0 {
+				if p := protocols.vector8(); p.err == nil {
+					h.alpn = append(h.alpn, string(p.data))
+				}
+			}
+		}
+
+		if ext.err != nil {
+			return nil, ext.err
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if extensions.err != nil {
+		return nil, extensions.err
+	}
+
+	return h, nil
+}
+
+func joinDecimal(values []uint16) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(int(v))
+	}
+
+	return strings.Join(s, "-")
+}
+
+func (h *clientHello) ja3() string {
+	formats := make([]uint16, len(h.pointFormats))
+	for i, f := range h.pointFormats {
+		formats[i] = uint16(f)
+	}
+
+	return strings.Join([]string{
+		strconv.Itoa(int(h.version)),
+		joinDecimal(withoutGrease(h.ciphers)),
+		joinDecimal(withoutGrease(h.extensions)),
+		joinDecimal(withoutGrease(h.groups)),
+		joinDecimal(formats),
+	}, ",")
+}
+
+func ja4Version(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	default:
+		return "00"
+	}
+}
+
+func alphanumeric(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+func ja4ALPN(alpn []string) string {
+	if len(alpn) == 0 || alpn[0] == "" {
+		return "00"
+	}
+
+	p := alpn[0]
+	first, last := p[0], p[len(p)-1]
+	if alphanumeric(first) && alphanumeric(last) {
+		return string([]byte{first, last})
+	}
+
+	return hex.EncodeToString([]byte{first})[:1] + hex.EncodeToString([]byte{last})[1:]
+}
+
+func joinHex(values []uint16) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprintf("%04x", v)
+	}
+
+	return strings.Join(s, ",")
+}
+
+func truncatedHash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])[:12]
+}
+
+func (h *clientHello) ja4() string {
+	// the highest supported version, or the legacy version
+	version := h.version
+	if versions := withoutGrease(h.versions); len(versions) > 0 {
+		version = 0
+		for _, v := range versions {
+			if v > version {
+				version = v
+			}
+		}
+	}
+
+	sni := "i"
+	if h.serverName {
+		sni = "d"
+	}
+
+	ciphers := withoutGrease(h.ciphers)
+	extensions := withoutGrease(h.extensions)
+	a := fmt.Sprintf("t%s%s%02d%02d%s",
+		ja4Version(version),
+		sni,
+		min99(len(ciphers)),
+		min99(len(extensions)),
+		ja4ALPN(h.alpn),
+	)
+
+	sortedCiphers := append([]uint16(nil), ciphers...)
+	sort.Slice(sortedCiphers, func(i, j int) bool { return sortedCiphers[i] < sortedCiphers[j] })
+
+	var sortedExtensions []uint16
+	for _, e := range extensions {
+		if e != extensionServerName && e != extensionALPN {
+			sortedExtensions = append(sortedExtensions, e)
+		}
+	}
+
+	sort.Slice(sortedExtensions, func(i, j int) bool { return sortedExtensions[i] < sortedExtensions[j] })
+
+	c := joinHex(sortedExtensions)
+	if c != "" && len(h.signatureAlgs) > 0 {
+		c += "_" + joinHex(withoutGrease(h.signatureAlgs))
+	}
+
+	return a + "_" + truncatedHash(joinHex(sortedCiphers)) + "_" + truncatedHash(c)
+}
+
+func min99(n int) int {
+	if n > 99 {
+		return 99
+	}
+
+	return n
+}
+
+func newFingerprint(h *clientHello) *Fingerprint {
+	ja3 := h.ja3()
+	ja3Hash := md5.Sum([]byte(ja3))
+	return &Fingerprint{
+		JA3:     hex.EncodeToString(ja3Hash[:]),
+		JA3Full: ja3,
+		JA4:     h.ja4(),
+	}
+}
+
+// Value returns the fingerprint by its name: ja3, ja3-full or ja4. It
+// returns empty string for unknown names.
+func (fp *Fingerprint) Value(name string) string {
+	switch name {
+	case "ja3":
+		return fp.JA3
+	case "ja3-full":
+		return fp.JA3Full
+	case "ja4":
+		return fp.JA4
+	default:
+		return ""
+	}
+}
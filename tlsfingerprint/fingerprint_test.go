@@ -0,0 +1,144 @@
+package tlsfingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type extension struct {
+	typ  uint16
+	data []byte
+}
+
+func vector16(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(b))), b...)
+}
+
+func uint16s(values ...uint16) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+
+	return b
+}
+
+func testClientHello(ciphers []uint16, extensions []extension) []byte {
+	var body bytes.Buffer
+	body.Write([]byte{0x03, 0x03})
+	body.Write(make([]byte, 32))
+	body.WriteByte(0)
+	body.Write(vector16(uint16s(ciphers...)))
+	body.Write([]byte{1, 0})
+
+	var ext bytes.Buffer
+	for _, e := range extensions {
+		ext.Write(uint16s(e.typ))
+		ext.Write(vector16(e.data))
+	}
+
+	body.Write(vector16(ext.Bytes()))
+
+	msg := []byte{handshakeClientHello, 0, byte(body.Len() >> 8), byte(body.Len())}
+	msg = append(msg, body.Bytes()...)
+	return append([]byte{recordTypeHandshake, 0x03, 0x01}, vector16(msg)...)
+}
+
+func chromeLikeHello() []byte {
+	alpn := append([]byte{2}, "h2"...)
+	alpn = append(alpn, 8)
+	alpn = append(alpn, "http/1.1"...)
+
+	return testClientHello(
+		[]uint16{0x0a0a, 0x1301, 0x1302, 0xc02b},
+		[]extension{
+			{typ: 0x1a1a},
+			{typ: extensionServerName, data: vector16(append([]byte{0, 0, 11}, "example.org"...))},
+			{typ: extensionGroups, data: vector16(uint16s(0x2a2a, 0x001d, 0x0017))},
+			{typ: extensionPointFormats, data: []byte{1, 0}},
+			{typ: extensionSignatureAlgs, data: vector16(uint16s(0x0403, 0x0804))},
+			{typ: extensionALPN, data: vector16(alpn)},
+			{typ: extensionVersions, data: append([]byte{6}, uint16s(0x3a3a, 0x0304, 0x0303)...)},
+		},
+	)
+}
+
+func TestFingerprint(t *testing.T) {
+	h, err := parseClientHello(chromeLikeHello())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := newFingerprint(h)
+	if fp.JA3Full != "771,4865-4866-49195,0-10-11-13-16-43,29-23,0" {
+		t.Errorf("unexpected JA3 string: %s", fp.JA3Full)
+	}
+
+	if fp.JA3 != "11138d9933242c3a03b6aad35a296476" {
+		t.Errorf("unexpected JA3: %s", fp.JA3)
+	}
+
+	if fp.JA4 != "t13d0306h2_5559582ccdc4_fb71836bce29" {
+		t.Errorf("unexpected JA4: %s", fp.JA4)
+	}
+}
+
+func TestFingerprintWithoutExtensions(t *testing.T) {
+	h, err := parseClientHello(testClientHello([]uint16{0x002f}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := newFingerprint(h)
+	if fp.JA3Full != "771,47,,," {
+		t.Errorf("unexpected JA3 string: %s", fp.JA3Full)
+	}
+
+	if fp.JA4[:10] != "t12i010000" || fp.JA4[len(fp.JA4)-12:] != "000000000000" {
+		t.Errorf("unexpected JA4: %s", fp.JA4)
+	}
+}
+
+func TestSplitRecords(t *testing.T) {
+	hello := chromeLikeHello()
+	msg := hello[recordHeaderLength:]
+
+	// the same handshake message split into two records
+	var split []byte
+	split = append(split, recordTypeHandshake, 0x03, 0x01)
+	split = append(split, vector16(msg[:10])...)
+	split = append(split, recordTypeHandshake, 0x03, 0x01)
+	split = append(split, vector16(msg[10:])...)
+
+	h, err := parseClientHello(split)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fp := newFingerprint(h); fp.JA4 != "t13d0306h2_5559582ccdc4_fb71836bce29" {
+		t.Errorf("unexpected JA4: %s", fp.JA4)
+	}
+
+	if _, err := parseClientHello(split[:len(split)-1]); err != errTruncated {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestInvalidClientHello(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("GET / HTTP/1.1\r\n\r\n"),
+		{recordTypeHandshake, 0x03, 0x01, 0, 4, 0x02, 0, 0, 0},
+	} {
+		if _, err := parseClientHello(data); err != errNotClientHello {
+			t.Errorf("unexpected error for %q: %v", data, err)
+		}
+	}
+
+	hello := chromeLikeHello()
+	// corrupt the length of the cipher suites
+	hello[recordHeaderLength+handshakeHeaderLength+2+32+1] = 0xff
+	if _, err := parseClientHello(hello); err == nil {
+		t.Error("failed to fail")
+	}
+}
@@ -0,0 +1,134 @@
+package tlsfingerprint
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/zalando/skipper/eskip"
+)
+
+// maxRecordedBytes limits the bytes recorded from a connection, while
+// looking for the ClientHello. It fits the largest accepted ClientHello
+// with its record headers.
+const maxRecordedBytes = maxClientHelloLength + 1024
+
+type listener struct {
+	net.Listener
+}
+
+// Conn is a connection, which records the ClientHello received from the
+// client, and calculates its fingerprint.
+//
+// The recording stops once the ClientHello was received, or when the
+// connection turned out not to start with a ClientHello.
+type Conn struct {
+	net.Conn
+
+	mu          sync.Mutex
+	done        bool
+	data        []byte
+	fingerprint *Fingerprint
+}
+
+type contextKey struct{}
+
+// NewListener wraps l, and records the ClientHello of the accepted
+// connections. It should wrap the listener passed to the TLS server.
+func NewListener(l net.Listener) net.Listener {
+	return &listener{Listener: l}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{Conn: c}, nil
+}
+
+func (c *Conn) record(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.done {
+		return
+	}
+
+	c.data = append(c.data, p...)
+	h, err := parseClientHello(c.data)
+	if err == errTruncated && len(c.data) < maxRecordedBytes {
+		return
+	}
+
+	if err == nil {
+		c.fingerprint = newFingerprint(h)
+	}
+
+	c.done = true
+	c.data = nil
+}
+
+// Read reads from the connection, and records the data until the
+// ClientHello was received.
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.record(p[:n])
+	}
+
+	return n, err
+}
+
+// NetConn returns the wrapped connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Fingerprint returns the fingerprint of the client. It returns false,
+// when the ClientHello was not received yet, or it could not be parsed.
+func (c *Conn) Fingerprint() (*Fingerprint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fingerprint, c.fingerprint != nil
+}
+
+// ConnContext can be used as the ConnContext of http.Server, to make the
+// fingerprint of the client accessible from the context of the requests.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	for {
+		if fc, ok := c.(*Conn); ok {
+			return context.WithValue(ctx, contextKey{}, fc)
+		}
+
+		nc, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return ctx
+		}
+
+		c = nc.NetConn()
+	}
+}
+
+func init() {
+	eskip.RegisterTemplateResolver("request.tlsFingerprint.", func(r *http.Request, name string) string {
+		if fp, ok := FromContext(r.Context()); ok {
+			return fp.Value(name)
+		}
+
+		return ""
+	})
+}
+
+// FromContext returns the fingerprint of the client, which sent the
+// request.
+func FromContext(ctx context.Context) (*Fingerprint, bool) {
+	c, ok := ctx.Value(contextKey{}).(*Conn)
+	if !ok {
+		return nil, false
+	}
+
+	return c.Fingerprint()
+}
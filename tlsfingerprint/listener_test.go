@@ -0,0 +1,76 @@
+package tlsfingerprint
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListener(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fp, ok := FromContext(r.Context())
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(w, "%s %s", fp.JA3, fp.JA4)
+	}))
+
+	srv.Listener = NewListener(srv.Listener)
+	srv.Config.ConnContext = ConnContext
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	rsp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", rsp.StatusCode)
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 || len(fields[0]) != 32 {
+		t.Fatalf("unexpected fingerprints: %s", b)
+	}
+
+	// TLS 1.3, IP address without SNI, h2 as the first ALPN protocol
+	if !strings.HasPrefix(fields[1], "t13i") || !strings.HasPrefix(fields[1][8:], "h2_") {
+		t.Errorf("unexpected JA4: %s", fields[1])
+	}
+}
+
+func TestListenerPlainHTTP(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := FromContext(r.Context()); ok {
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}))
+
+	srv.Listener = NewListener(srv.Listener)
+	srv.Config.ConnContext = ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	rsp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code: %d", rsp.StatusCode)
+	}
+}